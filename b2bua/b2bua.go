@@ -0,0 +1,558 @@
+// b2bua package implements back-to-back user agent (RFC 7092).
+//
+// B2BUA answers the incoming INVITE as UAS and calls one or more targets as UAC with new Call-ID,
+// tags and Contact. The first answered outbound leg is bridged with the inbound one, other legs are canceled.
+// Provisional responses (early media) are relayed to the caller, CANCEL of the caller is propagated
+// to the outbound legs. Requests within the bridged dialogs (re-INVITE, UPDATE, INFO, BYE, etc.)
+// are relayed to the other leg with their responses. Hooks allow to rewrite headers and bodies per direction.
+package b2bua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// Direction of the relayed message.
+type Direction int
+
+const (
+	// CallerToCallee is direction from the inbound leg to the outbound leg.
+	CallerToCallee Direction = iota
+	// CalleeToCaller is direction from the outbound leg to the inbound leg.
+	CalleeToCaller
+)
+
+func (dir Direction) String() string {
+	switch dir {
+	case CallerToCallee:
+		return "caller -> callee"
+	case CalleeToCaller:
+		return "callee -> caller"
+	default:
+		return "unknown"
+	}
+}
+
+// RequestHook rewrites the request relayed to the other leg, in is the received request.
+type RequestHook func(dir Direction, out, in sip.Request)
+
+// ResponseHook rewrites the response relayed to the other leg, in is the received response.
+type ResponseHook func(dir Direction, out, in sip.Response)
+
+// Headers relayed to the other leg together with the message body, other headers are leg specific
+// and have to be copied by hooks.
+var relayedHeaders = []string{
+	"Content-Type",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Info-Package",
+	"Subject",
+}
+
+type Option interface {
+	ApplyB2BUA(opts *Options)
+}
+
+type Options struct {
+	RequestHook  RequestHook
+	ResponseHook ResponseHook
+	// RequestOptions are passed to all requests sent to the legs.
+	RequestOptions []gosip.RequestWithContextOption
+}
+
+type withRequestHook struct {
+	hook RequestHook
+}
+
+func (o withRequestHook) ApplyB2BUA(opts *Options) {
+	opts.RequestHook = o.hook
+}
+
+// WithRequestHook sets the hook called with each request relayed to the other leg, including the initial INVITE.
+func WithRequestHook(hook RequestHook) Option {
+	return withRequestHook{hook}
+}
+
+type withResponseHook struct {
+	hook ResponseHook
+}
+
+func (o withResponseHook) ApplyB2BUA(opts *Options) {
+	opts.ResponseHook = o.hook
+}
+
+// WithResponseHook sets the hook called with each response relayed to the other leg.
+func WithResponseHook(hook ResponseHook) Option {
+	return withResponseHook{hook}
+}
+
+type withRequestOptions struct {
+	options []gosip.RequestWithContextOption
+}
+
+func (o withRequestOptions) ApplyB2BUA(opts *Options) {
+	opts.RequestOptions = append(opts.RequestOptions, o.options...)
+}
+
+// WithRequestOptions sets options of the requests sent to the legs, e.g. gosip.WithAuthorizer.
+func WithRequestOptions(options ...gosip.RequestWithContextOption) Option {
+	return withRequestOptions{options}
+}
+
+// B2BUA bridges incoming calls to outbound legs.
+type B2BUA struct {
+	sender  gosip.Sender
+	contact *sip.Address
+	opts    Options
+
+	mu sync.RWMutex
+	// bridged calls by dialog ID of both legs
+	calls map[string]*Call
+
+	log log.Logger
+}
+
+// New creates B2BUA that uses contact as Contact of both legs.
+func New(sender gosip.Sender, contact *sip.Address, logger log.Logger, options ...Option) *B2BUA {
+	b := &B2BUA{
+		sender:  sender,
+		contact: contact,
+		calls:   make(map[string]*Call),
+	}
+	for _, opt := range options {
+		opt.ApplyB2BUA(&b.opts)
+	}
+	b.log = logger.
+		WithPrefix("b2bua.B2BUA").
+		WithFields(log.Fields{
+			"b2bua_ptr": fmt.Sprintf("%p", b),
+		})
+
+	return b
+}
+
+func (b *B2BUA) Log() log.Logger {
+	return b.log
+}
+
+// Calls returns currently bridged calls.
+func (b *B2BUA) Calls() []*Call {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	calls := make([]*Call, 0, len(b.calls)/2)
+	for id, call := range b.calls {
+		// each call is indexed by both legs
+		if id == call.caller.ID() {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+type legResult struct {
+	leg *outboundLeg
+	res sip.Response
+	err error
+}
+
+type outboundLeg struct {
+	invite sip.Request
+	cancel context.CancelFunc
+}
+
+// Bridge calls the targets in parallel on behalf of the caller of the incoming INVITE
+// and bridges the first answered leg with the caller.
+// The caller receives provisional responses of all legs and the best final response if no one answered.
+// CANCEL of the caller or ctx cancellation cancels all outbound legs.
+func (b *B2BUA) Bridge(ctx context.Context, req sip.Request, tx sip.ServerTransaction, targets ...sip.Uri) (*Call, error) {
+	if !req.IsInvite() {
+		return nil, fmt.Errorf("unexpected method %s", req.Method())
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets")
+	}
+
+	logger := b.Log().WithFields(req.Fields())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	callerCanceled := make(chan struct{})
+	if tx != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case cancelReq, ok := <-tx.Cancels():
+				if !ok {
+					return
+				}
+
+				logger.Debug("caller canceled the call")
+
+				close(callerCanceled)
+				cancel()
+				b.respond(sip.NewResponseFromRequest("", cancelReq, 200, "OK", ""), logger)
+			}
+		}()
+	}
+
+	callerTag := util.RandString(8)
+	var (
+		mu       sync.Mutex
+		answered bool
+	)
+	relayProvisional := func(res sip.Response) {
+		if !res.IsProvisional() || res.StatusCode() == 100 {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !answered {
+			b.respond(b.callerResponse(req, callerTag, res), logger)
+		}
+	}
+
+	results := make(chan legResult, len(targets))
+	legs := make([]*outboundLeg, 0, len(targets))
+	for _, target := range targets {
+		legCtx, legCancel := context.WithCancel(ctx)
+		leg := &outboundLeg{
+			invite: b.newInvite(req, target),
+			cancel: legCancel,
+		}
+		legs = append(legs, leg)
+
+		go func() {
+			options := append([]gosip.RequestWithContextOption{
+				gosip.WithResponseHandler(func(res sip.Response, request sip.Request) {
+					relayProvisional(res)
+				}),
+			}, b.opts.RequestOptions...)
+			res, err := b.sender.RequestWithContext(legCtx, leg.invite, options...)
+			results <- legResult{leg, res, err}
+		}()
+	}
+
+	var best sip.Response
+	for pending := len(legs); pending > 0; pending-- {
+		result := <-results
+		if result.err != nil {
+			var reqErr *sip.RequestError
+			if errors.As(result.err, &reqErr) && reqErr.Response != nil {
+				if best == nil || betterResponse(reqErr.Response, best) {
+					best = reqErr.Response
+				}
+			}
+
+			logger.Debugf("call to %s failed: %s", result.leg.invite.Recipient(), result.err)
+
+			continue
+		}
+
+		mu.Lock()
+		answered = true
+		mu.Unlock()
+
+		for _, leg := range legs {
+			if leg != result.leg {
+				leg.cancel()
+			}
+		}
+		go b.dropLegs(results, pending-1, logger)
+
+		call, err := b.answer(req, callerTag, result.leg.invite, result.res, logger)
+		if err != nil {
+			logger.Errorf("bridge call failed: %s", err)
+
+			return nil, err
+		}
+
+		return call, nil
+	}
+
+	var (
+		res sip.Response
+		err error
+	)
+	select {
+	case <-callerCanceled:
+		res = sip.NewResponseFromRequest("", req, 487, "Request Terminated", "")
+		err = fmt.Errorf("call canceled by the caller")
+	default:
+		if best != nil {
+			res = b.callerResponse(req, callerTag, best)
+			err = fmt.Errorf("call failed with '%d %s'", best.StatusCode(), best.Reason())
+		} else if ctx.Err() != nil {
+			res = sip.NewResponseFromRequest("", req, 487, "Request Terminated", "")
+			err = ctx.Err()
+		} else {
+			res = sip.NewResponseFromRequest("", req, 408, "Request Timeout", "")
+			err = fmt.Errorf("no final response from targets")
+		}
+	}
+	setToTag(res, callerTag)
+	b.respond(res, logger)
+
+	return nil, err
+}
+
+// Builds the INVITE of the outbound leg with new Call-ID and From tag.
+func (b *B2BUA) newInvite(in sip.Request, target sip.Uri) sip.Request {
+	from, _ := in.From()
+	to, _ := in.To()
+
+	transport := in.Transport()
+	if params := target.UriParams(); params != nil {
+		if val, ok := params.Get("transport"); ok && val != nil && val.String() != "" {
+			transport = strings.ToUpper(val.String())
+		}
+	}
+
+	maxForwards := sip.MaxForwards(70)
+	if hdrs := in.GetHeaders("Max-Forwards"); len(hdrs) > 0 {
+		if val, ok := hdrs[0].(*sip.MaxForwards); ok && *val > 0 {
+			maxForwards = *val - 1
+		}
+	}
+	callID := sip.CallID(util.RandString(32))
+
+	out := sip.NewRequest(
+		"",
+		sip.INVITE,
+		target.Clone(),
+		"SIP/2.0",
+		[]sip.Header{
+			sip.ViaHeader{
+				&sip.ViaHop{
+					ProtocolName:    "SIP",
+					ProtocolVersion: "2.0",
+					Transport:       transport,
+					Host:            sip.DefaultHost,
+					Params:          sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+				},
+			},
+			&maxForwards,
+			&sip.FromHeader{
+				DisplayName: from.DisplayName,
+				Address:     from.Address.Clone(),
+				Params:      sip.NewParams().Add("tag", sip.String{Str: util.RandString(8)}),
+			},
+			&sip.ToHeader{
+				DisplayName: to.DisplayName,
+				Address:     to.Address.Clone(),
+				Params:      sip.NewParams(),
+			},
+			&callID,
+			&sip.CSeq{SeqNo: 1, MethodName: sip.INVITE},
+			b.contact.AsContactHeader(),
+		},
+		"",
+		nil,
+	)
+	out.SetTransport(transport)
+	copyContent(out, in)
+
+	if b.opts.RequestHook != nil {
+		b.opts.RequestHook(CallerToCallee, out, in)
+	}
+
+	return out
+}
+
+// Builds the response to the caller from the response of the callee.
+func (b *B2BUA) callerResponse(req sip.Request, toTag string, in sip.Response) sip.Response {
+	out := sip.NewResponseFromRequest("", req, in.StatusCode(), in.Reason(), "")
+	setToTag(out, toTag)
+	if in.StatusCode() < 300 {
+		out.AppendHeader(b.contact.AsContactHeader())
+	}
+	copyContent(out, in)
+
+	if b.opts.ResponseHook != nil {
+		b.opts.ResponseHook(CalleeToCaller, out, in)
+	}
+
+	return out
+}
+
+// Answers the caller with 2xx of the callee and creates dialogs of both legs.
+// The callee is terminated with BYE if the call can not be bridged.
+func (b *B2BUA) answer(
+	req sip.Request,
+	callerTag string,
+	invite sip.Request,
+	res sip.Response,
+	logger log.Logger,
+) (*Call, error) {
+	fail := func(err error) (*Call, error) {
+		b.dropLeg(invite, res, logger)
+
+		out := sip.NewResponseFromRequest("", req, 500, "Server Internal Error", "")
+		setToTag(out, callerTag)
+		b.respond(out, logger)
+
+		return nil, err
+	}
+
+	callee, err := sip.NewClientDialog(invite, res)
+	if err != nil {
+		return fail(fmt.Errorf("create callee dialog: %w", err))
+	}
+
+	out := b.callerResponse(req, callerTag, res)
+	caller, err := sip.NewServerDialog(req, out)
+	if err != nil {
+		return fail(fmt.Errorf("create caller dialog: %w", err))
+	}
+
+	ack, err := callee.NewAck(invite)
+	if err != nil {
+		return fail(err)
+	}
+
+	call := newCall(b, caller, callee)
+	// late offer, the answer comes with ACK of the caller
+	lateOffer := len(invite.Body()) == 0
+	if lateOffer {
+		call.pendingAcks[CallerToCallee] = ack
+	}
+
+	b.mu.Lock()
+	b.calls[caller.ID()] = call
+	b.calls[callee.ID()] = call
+	b.mu.Unlock()
+
+	if _, err := b.sender.Respond(out); err != nil {
+		b.remove(call)
+		b.dropLeg(invite, res, logger)
+
+		return nil, fmt.Errorf("respond '%d %s' to caller: %w", out.StatusCode(), out.Reason(), err)
+	}
+
+	if !lateOffer {
+		if err := b.sender.Send(ack); err != nil {
+			go call.Hangup(context.Background())
+
+			return nil, fmt.Errorf("send ACK to callee: %w", err)
+		}
+	}
+
+	call.Log().Debug("call bridged")
+
+	return call, nil
+}
+
+// Waits for the canceled legs, the ones that answered anyway are terminated.
+func (b *B2BUA) dropLegs(results <-chan legResult, pending int, logger log.Logger) {
+	for ; pending > 0; pending-- {
+		if result := <-results; result.err == nil {
+			b.dropLeg(result.leg.invite, result.res, logger)
+		}
+	}
+}
+
+// Acknowledges and terminates the answered leg that is not bridged.
+func (b *B2BUA) dropLeg(invite sip.Request, res sip.Response, logger log.Logger) {
+	dialog, err := sip.NewClientDialog(invite, res)
+	if err != nil {
+		logger.Warnf("drop leg %s failed: %s", invite.Recipient(), err)
+		return
+	}
+	if ack, err := dialog.NewAck(invite); err == nil {
+		if err := b.sender.Send(ack); err != nil {
+			logger.Warnf("send ACK to %s failed: %s", invite.Recipient(), err)
+		}
+	}
+
+	go func() {
+		_, err := b.sender.RequestWithContext(context.Background(), dialog.NewRequest(sip.BYE), b.opts.RequestOptions...)
+		if err != nil {
+			logger.Warnf("send BYE to %s failed: %s", invite.Recipient(), err)
+		}
+	}()
+}
+
+func (b *B2BUA) respond(res sip.Response, logger log.Logger) {
+	if _, err := b.sender.Respond(res); err != nil {
+		logger.Errorf("respond '%d %s' failed: %s", res.StatusCode(), res.Reason(), err)
+	}
+}
+
+func (b *B2BUA) remove(call *Call) {
+	b.mu.Lock()
+	delete(b.calls, call.caller.ID())
+	delete(b.calls, call.callee.ID())
+	b.mu.Unlock()
+}
+
+// HandleRequest relays the request received within a bridged call to the other leg.
+// It returns false if the request does not belong to any call.
+// Handlers of BYE, re-INVITE, UPDATE, INFO, ACK and other in-dialog requests should call it first.
+func (b *B2BUA) HandleRequest(req sip.Request, tx sip.ServerTransaction) bool {
+	id, err := sip.MakeDialogIDFromMessage(req)
+	if err != nil {
+		return false
+	}
+
+	b.mu.RLock()
+	call, ok := b.calls[id]
+	b.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	if id == call.caller.ID() {
+		call.relay(CallerToCallee, req)
+	} else {
+		call.relay(CalleeToCaller, req)
+	}
+
+	return true
+}
+
+// RFC 3261 s. 16.7 (6): 6xx wins, otherwise the lowest response class.
+func betterResponse(res, than sip.Response) bool {
+	if than.StatusCode() >= 600 {
+		return false
+	}
+	if res.StatusCode() >= 600 {
+		return true
+	}
+	return res.StatusCode()/100 < than.StatusCode()/100
+}
+
+func setToTag(res sip.Response, tag string) {
+	to, ok := res.To()
+	if !ok {
+		return
+	}
+	if to.Params == nil {
+		to.Params = sip.NewParams()
+	}
+	if !to.Params.Has("tag") {
+		to.Params.Add("tag", sip.String{Str: tag})
+	}
+}
+
+func copyContent(dst, src sip.Message) {
+	for _, name := range relayedHeaders {
+		for _, hdr := range src.GetHeaders(name) {
+			dst.AppendHeader(hdr.Clone())
+		}
+	}
+	dst.SetBodyBytes(src.BodyBytes(), true)
+}
@@ -0,0 +1,489 @@
+package b2bua_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/b2bua"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+var logger = log.NewDefaultLogrusLogger()
+
+// callee answers the outbound request, handler receives provisional responses.
+type callee func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error)
+
+// fakeSender routes requests to callees by user of Request-URI and records everything.
+type fakeSender struct {
+	// methods that are not used by the tests panic
+	gosip.Sender
+
+	mu        sync.Mutex
+	callees   map[string]callee
+	requests  []sip.Request
+	sent      []sip.Message
+	responses []sip.Response
+	// returned by Respond
+	respondErr error
+}
+
+func (s *fakeSender) Send(msg sip.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *fakeSender) RequestWithContext(
+	ctx context.Context,
+	request sip.Request,
+	options ...gosip.RequestWithContextOption,
+) (sip.Response, error) {
+	opts := &gosip.RequestWithContextOptions{}
+	for _, opt := range options {
+		opt.ApplyRequestWithContext(opts)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	answer, ok := s.callees[request.Recipient().User().String()]
+	s.mu.Unlock()
+
+	if !ok {
+		answer = reply(200, "")
+	}
+	return answer(ctx, request, func(res sip.Response) {
+		if opts.ResponseHandler != nil {
+			opts.ResponseHandler(res, request)
+		}
+	})
+}
+
+func (s *fakeSender) Respond(res sip.Response) (sip.ServerTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, res)
+	return nil, s.respondErr
+}
+
+func (s *fakeSender) requestsTo(user string) []sip.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []sip.Request
+	for _, req := range s.requests {
+		if req.Recipient().User().String() == user {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+func (s *fakeSender) statuses() []sip.StatusCode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := make([]sip.StatusCode, 0, len(s.responses))
+	for _, res := range s.responses {
+		codes = append(codes, res.StatusCode())
+	}
+	return codes
+}
+
+func (s *fakeSender) lastResponse(t *testing.T) sip.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.responses) == 0 {
+		t.Fatalf("no responses sent")
+	}
+	return s.responses[len(s.responses)-1]
+}
+
+func (s *fakeSender) lastSent(t *testing.T) sip.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sent) == 0 {
+		t.Fatalf("no messages sent")
+	}
+	return s.sent[len(s.sent)-1]
+}
+
+func newResponse(req sip.Request, status sip.StatusCode, body string) sip.Response {
+	res := sip.NewResponseFromRequest("", req, status, "", "")
+	if to, ok := res.To(); ok && !to.Params.Has("tag") {
+		to.Params.Add("tag", sip.String{Str: "callee-tag"})
+	}
+	res.AppendHeader(&sip.ContactHeader{
+		Address: &sip.SipUri{FUser: req.Recipient().User(), FHost: "callee.example.com"},
+	})
+	if body != "" {
+		res.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Type", Contents: "application/sdp"})
+		res.SetBody(body, true)
+	}
+	return res
+}
+
+// reply answers with the final response at once.
+func reply(status sip.StatusCode, body string) callee {
+	return func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+		res := newResponse(req, status, body)
+		if status >= 300 {
+			return nil, sip.NewRequestError(uint(status), "", req, res)
+		}
+		return res, nil
+	}
+}
+
+// ring sends 180 and waits for cancellation.
+func ring(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+	handler(newResponse(req, 180, ""))
+	<-ctx.Done()
+	return nil, sip.NewRequestError(487, "Request Terminated", req, newResponse(req, 487, ""))
+}
+
+type fakeTransaction struct {
+	sip.ServerTransaction
+	cancels chan sip.Request
+}
+
+func (tx *fakeTransaction) Cancels() <-chan sip.Request {
+	return tx.cancels
+}
+
+func parse(t *testing.T, data string) sip.Message {
+	msg, err := parser.ParseMessage([]byte(data), logger)
+	if err != nil {
+		t.Fatalf("failed to parse message: %s\n%s", err, data)
+	}
+	return msg
+}
+
+func incomingInvite(t *testing.T, body string) sip.Request {
+	lines := []string{
+		"INVITE sip:b2bua@example.com SIP/2.0",
+		"Via: SIP/2.0/UDP alice.example.com;branch=z9hG4bK.call-1",
+		"Max-Forwards: 70",
+		"From: Alice <sip:alice@example.com>;tag=alice-tag",
+		"To: <sip:b2bua@example.com>",
+		"Call-ID: call-1",
+		"CSeq: 1 INVITE",
+		"Contact: <sip:alice@alice.example.com>",
+	}
+	if body != "" {
+		lines = append(lines, "Content-Type: application/sdp")
+	}
+	lines = append(lines, "Content-Length: "+sip.ContentLength(len(body)).Value(), "", body)
+
+	return parse(t, strings.Join(lines, "\r\n")).(sip.Request)
+}
+
+func newB2BUA(sender *fakeSender, options ...b2bua.Option) *b2bua.B2BUA {
+	contact := &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: "b2bua"}, FHost: "b2bua.example.com"}}
+	return b2bua.New(sender, contact, logger, options...)
+}
+
+func target(user string) sip.Uri {
+	return &sip.SipUri{FUser: sip.String{Str: user}, FHost: "example.com"}
+}
+
+func TestBridge(t *testing.T) {
+	sender := &fakeSender{
+		callees: map[string]callee{
+			"bob": func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+				handler(newResponse(req, 100, ""))
+				handler(newResponse(req, 180, ""))
+				return newResponse(req, 200, "v=0 bob"), nil
+			},
+			"carol": func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+	}
+	var hooked []b2bua.Direction
+	b := newB2BUA(sender,
+		b2bua.WithRequestHook(func(dir b2bua.Direction, out, in sip.Request) {
+			out.AppendHeader(&sip.GenericHeader{HeaderName: "X-Hooked", Contents: dir.String()})
+		}),
+		b2bua.WithResponseHook(func(dir b2bua.Direction, out, in sip.Response) {
+			hooked = append(hooked, dir)
+		}),
+	)
+
+	req := incomingInvite(t, "v=0 alice")
+	call, err := b.Bridge(context.Background(), req, &fakeTransaction{cancels: make(chan sip.Request)},
+		target("bob"), target("carol"))
+	if err != nil {
+		t.Fatalf("bridge failed: %s", err)
+	}
+
+	invite := sender.requestsTo("bob")[0]
+	if callID, _ := invite.CallID(); *callID == "call-1" {
+		t.Errorf("outbound leg must have new Call-ID:\n%s", invite)
+	}
+	if from, _ := invite.From(); from.Address.User().String() != "alice" || from.Params.String() == ";tag=alice-tag" {
+		t.Errorf("unexpected From header of outbound leg:\n%s", invite)
+	}
+	if invite.Body() != "v=0 alice" || len(invite.GetHeaders("X-Hooked")) != 1 {
+		t.Errorf("unexpected outbound INVITE:\n%s", invite)
+	}
+
+	if codes := sender.statuses(); len(codes) != 2 || codes[0] != 180 || codes[1] != 200 {
+		t.Fatalf("expected 180 and 200 responses to the caller, got %v", codes)
+	}
+	ok := sender.lastResponse(t)
+	if to, _ := ok.To(); !to.Params.Has("tag") || ok.Body() != "v=0 bob" {
+		t.Errorf("unexpected response to the caller:\n%s", ok)
+	}
+	if contact, _ := ok.Contact(); contact.Address.Host() != "b2bua.example.com" {
+		t.Errorf("unexpected Contact in response to the caller:\n%s", ok)
+	}
+	if len(hooked) != 2 || hooked[1] != b2bua.CalleeToCaller {
+		t.Errorf("unexpected response hook calls %v", hooked)
+	}
+
+	if ack := sender.lastSent(t).(sip.Request); !ack.IsAck() || ack.Recipient().Host() != "callee.example.com" {
+		t.Errorf("expected ACK to the callee:\n%s", ack)
+	}
+	if call.Callee().RemoteTarget().User().String() != "bob" || len(b.Calls()) != 1 {
+		t.Errorf("unexpected call %v", b.Calls())
+	}
+
+	// BYE from the caller
+	caller, err := sip.NewClientDialog(req, ok)
+	if err != nil {
+		t.Fatalf("failed to create caller dialog: %s", err)
+	}
+	bye := parse(t, caller.NewRequest(sip.BYE).String()).(sip.Request)
+	if !b.HandleRequest(bye, nil) {
+		t.Fatalf("BYE not matched")
+	}
+	if res := sender.lastResponse(t); res.StatusCode() != 200 {
+		t.Errorf("expected 200 response on BYE, got %d", res.StatusCode())
+	}
+	reqs := sender.requestsTo("bob")
+	if bye := reqs[len(reqs)-1]; bye.Method() != sip.BYE || !call.Callee().Matches(serverSide(t, bye)) {
+		t.Errorf("expected BYE to the callee:\n%s", bye)
+	}
+
+	select {
+	case <-call.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("call is not terminated")
+	}
+	if len(b.Calls()) != 0 {
+		t.Errorf("terminated call is not removed")
+	}
+}
+
+// serverSide swaps From and To tags to match the request sent by the dialog against the dialog itself.
+func serverSide(t *testing.T, req sip.Request) sip.Request {
+	req = parse(t, req.String()).(sip.Request)
+	from, _ := req.From()
+	to, _ := req.To()
+	from.Params, to.Params = to.Params, from.Params
+	return req
+}
+
+func TestBridgeLateOffer(t *testing.T) {
+	sender := &fakeSender{
+		callees: map[string]callee{"bob": reply(200, "v=0 bob")},
+	}
+	b := newB2BUA(sender)
+
+	req := incomingInvite(t, "")
+	call, err := b.Bridge(context.Background(), req, nil, target("bob"))
+	if err != nil {
+		t.Fatalf("bridge failed: %s", err)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatalf("ACK to the callee must wait for the answer of the caller")
+	}
+
+	caller, _ := sip.NewClientDialog(req, sender.lastResponse(t))
+	ack := caller.NewRequest(sip.ACK)
+	ack.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Type", Contents: "application/sdp"})
+	ack.SetBody("v=0 alice", true)
+	if !b.HandleRequest(parse(t, ack.String()).(sip.Request), nil) {
+		t.Fatalf("ACK not matched")
+	}
+
+	out := sender.lastSent(t).(sip.Request)
+	if !out.IsAck() || out.Body() != "v=0 alice" || !call.Callee().Matches(serverSide(t, out)) {
+		t.Errorf("unexpected ACK to the callee:\n%s", out)
+	}
+}
+
+func TestBridgeFailure(t *testing.T) {
+	sender := &fakeSender{
+		callees: map[string]callee{
+			"bob":   reply(503, ""),
+			"carol": reply(486, ""),
+		},
+	}
+	b := newB2BUA(sender)
+
+	if _, err := b.Bridge(context.Background(), incomingInvite(t, ""), nil, target("bob"), target("carol")); err == nil {
+		t.Fatalf("bridge must fail")
+	}
+	if res := sender.lastResponse(t); res.StatusCode() != 486 {
+		t.Errorf("expected 486 response to the caller, got %d", res.StatusCode())
+	}
+	if len(b.Calls()) != 0 {
+		t.Errorf("failed call is registered")
+	}
+}
+
+func TestBridgeAnswerFailure(t *testing.T) {
+	sender := &fakeSender{
+		callees: map[string]callee{
+			"bob": func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+				res := newResponse(req, 200, "v=0 bob")
+				res.RemoveHeader("Contact")
+				return res, nil
+			},
+		},
+	}
+	b := newB2BUA(sender)
+
+	if _, err := b.Bridge(context.Background(), incomingInvite(t, "v=0 alice"), nil, target("bob")); err == nil {
+		t.Fatalf("bridge must fail")
+	}
+	res := sender.lastResponse(t)
+	if to, _ := res.To(); res.StatusCode() != 500 || !to.Params.Has("tag") {
+		t.Errorf("expected 500 response with To tag:\n%s", res)
+	}
+}
+
+func TestBridgeRespondFailure(t *testing.T) {
+	sender := &fakeSender{
+		callees:    map[string]callee{"bob": reply(200, "v=0 bob")},
+		respondErr: errors.New("transport failure"),
+	}
+	b := newB2BUA(sender)
+
+	if _, err := b.Bridge(context.Background(), incomingInvite(t, "v=0 alice"), nil, target("bob")); err == nil {
+		t.Fatalf("bridge must fail")
+	}
+	if len(b.Calls()) != 0 {
+		t.Errorf("failed call is registered")
+	}
+	if ack := sender.lastSent(t).(sip.Request); !ack.IsAck() {
+		t.Errorf("expected ACK to the callee:\n%s", ack)
+	}
+	// BYE is sent in background
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if reqs := sender.requestsTo("bob"); reqs[len(reqs)-1].Method() == sip.BYE {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("callee is not terminated with BYE")
+		}
+	}
+}
+
+func TestBridgeCancel(t *testing.T) {
+	sender := &fakeSender{
+		callees: map[string]callee{"bob": ring},
+	}
+	b := newB2BUA(sender)
+
+	req := incomingInvite(t, "")
+	tx := &fakeTransaction{cancels: make(chan sip.Request, 1)}
+	tx.cancels <- sip.NewCancelRequest("", req, nil)
+
+	if _, err := b.Bridge(context.Background(), req, tx, target("bob")); err == nil {
+		t.Fatalf("bridge must fail")
+	}
+
+	var cancelOK, terminated bool
+	sender.mu.Lock()
+	for _, res := range sender.responses {
+		cseq, _ := res.CSeq()
+		switch {
+		case cseq.MethodName == sip.CANCEL && res.StatusCode() == 200:
+			cancelOK = true
+		case cseq.MethodName == sip.INVITE && res.StatusCode() == 487:
+			terminated = true
+		}
+	}
+	sender.mu.Unlock()
+	if !cancelOK || !terminated {
+		t.Errorf("expected 200 on CANCEL and 487 on INVITE, got %v", sender.statuses())
+	}
+}
+
+func TestRelayInDialogRequest(t *testing.T) {
+	sender := &fakeSender{
+		callees: map[string]callee{"bob": reply(200, "v=0 bob")},
+	}
+	b := newB2BUA(sender)
+
+	req := incomingInvite(t, "v=0 alice")
+	call, err := b.Bridge(context.Background(), req, nil, target("bob"))
+	if err != nil {
+		t.Fatalf("bridge failed: %s", err)
+	}
+	// the caller is reached by Contact
+	sender.callees["alice"] = func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+		return nil, sip.NewRequestError(415, "", req, newResponse(req, 415, ""))
+	}
+
+	// INFO from the callee
+	callee, _ := sip.NewServerDialog(sender.requestsTo("bob")[0], newResponse(sender.requestsTo("bob")[0], 200, ""))
+	info := callee.NewRequest(sip.INFO)
+	info.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Type", Contents: "application/dtmf-relay"})
+	info.SetBody("Signal=5", true)
+	if !b.HandleRequest(parse(t, info.String()).(sip.Request), nil) {
+		t.Fatalf("INFO not matched")
+	}
+
+	out := sender.requestsTo("alice")[0]
+	if out.Method() != sip.INFO || out.Body() != "Signal=5" || !call.Caller().Matches(serverSide(t, out)) {
+		t.Errorf("unexpected INFO to the caller:\n%s", out)
+	}
+	if res := sender.lastResponse(t); res.StatusCode() != 415 {
+		t.Errorf("expected relayed 415 response, got %d", res.StatusCode())
+	}
+
+	// re-INVITE without offer from the caller, ACK to the callee waits for the answer of the caller
+	caller, _ := sip.NewClientDialog(req, sender.responses[0])
+	reinvite := caller.NewRequest(sip.INVITE)
+	sent := len(sender.sent)
+	if !b.HandleRequest(parse(t, reinvite.String()).(sip.Request), nil) {
+		t.Fatalf("re-INVITE not matched")
+	}
+	if res := sender.lastResponse(t); res.StatusCode() != 200 || res.Body() != "v=0 bob" {
+		t.Errorf("unexpected response on re-INVITE:\n%s", res)
+	}
+	if len(sender.sent) != sent {
+		t.Fatalf("ACK to the callee must wait for the answer of the caller")
+	}
+
+	ack, err := caller.NewAck(reinvite)
+	if err != nil {
+		t.Fatalf("failed to create ACK: %s", err)
+	}
+	ack.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Type", Contents: "application/sdp"})
+	ack.SetBody("v=0 alice", true)
+	if !b.HandleRequest(parse(t, ack.String()).(sip.Request), nil) {
+		t.Fatalf("ACK not matched")
+	}
+	if len(sender.sent) != sent+1 {
+		t.Fatalf("ACK to the callee must be sent on ACK of the caller")
+	}
+	if out := sender.lastSent(t).(sip.Request); !out.IsAck() || out.Body() != "v=0 alice" || !call.Callee().Matches(serverSide(t, out)) {
+		t.Errorf("unexpected ACK to the callee:\n%s", out)
+	}
+}
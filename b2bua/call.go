@@ -0,0 +1,192 @@
+package b2bua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Call is a pair of dialogs bridged by B2BUA.
+type Call struct {
+	b2bua *B2BUA
+	// dialog with the caller, B2BUA is UAS
+	caller *sip.Dialog
+	// dialog with the callee, B2BUA is UAC
+	callee *sip.Dialog
+
+	mu sync.Mutex
+	// ACKs on 2xx of the INVITE relayed in the direction that wait for ACK of the sender of the INVITE,
+	// it may carry the answer to the late offer
+	pendingAcks [2]sip.Request
+	done        chan struct{}
+	doneOnce    sync.Once
+
+	log log.Logger
+}
+
+func newCall(b *B2BUA, caller, callee *sip.Dialog) *Call {
+	call := &Call{
+		b2bua:  b,
+		caller: caller,
+		callee: callee,
+		done:   make(chan struct{}),
+	}
+	call.log = b.Log().
+		WithPrefix("b2bua.Call").
+		WithFields(log.Fields{
+			"call_ptr":         fmt.Sprintf("%p", call),
+			"caller_dialog_id": caller.ID(),
+			"callee_dialog_id": callee.ID(),
+		})
+
+	return call
+}
+
+func (call *Call) Log() log.Logger {
+	return call.log
+}
+
+// Caller returns dialog with the caller.
+func (call *Call) Caller() *sip.Dialog {
+	return call.caller
+}
+
+// Callee returns dialog with the callee.
+func (call *Call) Callee() *sip.Dialog {
+	return call.callee
+}
+
+// Done is closed when the call is terminated by BYE of one of the legs or by Hangup.
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Hangup terminates both legs with BYE.
+func (call *Call) Hangup(ctx context.Context) error {
+	call.terminate()
+
+	var errs []error
+	for _, dialog := range []*sip.Dialog{call.caller, call.callee} {
+		if _, err := call.b2bua.sender.RequestWithContext(
+			ctx,
+			dialog.NewRequest(sip.BYE),
+			call.b2bua.opts.RequestOptions...,
+		); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("hangup call: %v", errs)
+	}
+
+	return nil
+}
+
+func (call *Call) terminate() {
+	call.doneOnce.Do(func() {
+		call.b2bua.remove(call)
+		close(call.done)
+
+		call.Log().Debug("call terminated")
+	})
+}
+
+// Relays the request received from one leg to the other one and the final response back.
+func (call *Call) relay(dir Direction, req sip.Request) {
+	from, to := call.caller, call.callee
+	if dir == CalleeToCaller {
+		from, to = to, from
+	}
+	logger := call.Log().WithFields(req.Fields())
+
+	if req.IsAck() {
+		call.relayAck(dir, req, logger)
+		return
+	}
+	if req.IsCancel() {
+		// CANCEL of the pending re-INVITE is answered by the transaction layer
+		return
+	}
+	if !from.ReceiveRequest(req) {
+		call.b2bua.respond(sip.NewResponseFromRequest("", req, 500, "Server Internal Error", ""), logger)
+		return
+	}
+
+	out := to.NewRequest(req.Method())
+	copyContent(out, req)
+	if call.b2bua.opts.RequestHook != nil {
+		call.b2bua.opts.RequestHook(dir, out, req)
+	}
+
+	if req.Method() == sip.BYE {
+		call.terminate()
+		call.b2bua.respond(sip.NewResponseFromRequest("", req, 200, "OK", ""), logger)
+
+		if _, err := call.b2bua.sender.RequestWithContext(
+			context.Background(),
+			out,
+			call.b2bua.opts.RequestOptions...,
+		); err != nil {
+			logger.Warnf("relay BYE failed: %s", err)
+		}
+
+		return
+	}
+
+	res, err := call.b2bua.sender.RequestWithContext(context.Background(), out, call.b2bua.opts.RequestOptions...)
+	if err != nil {
+		var reqErr *sip.RequestError
+		if !errors.As(err, &reqErr) || reqErr.Response == nil {
+			logger.Warnf("relay %s failed: %s", req.Method(), err)
+
+			call.b2bua.respond(sip.NewResponseFromRequest("", req, 408, "Request Timeout", ""), logger)
+
+			return
+		}
+		res = reqErr.Response
+	}
+
+	if out.IsInvite() && res.IsSuccess() {
+		if ack, err := to.NewAck(out); err == nil {
+			call.mu.Lock()
+			call.pendingAcks[dir] = ack
+			call.mu.Unlock()
+		}
+	}
+
+	reply := sip.NewResponseFromRequest("", req, res.StatusCode(), res.Reason(), "")
+	if res.IsSuccess() && (req.IsInvite() || req.Method() == sip.UPDATE) {
+		reply.AppendHeader(call.b2bua.contact.AsContactHeader())
+	}
+	copyContent(reply, res)
+	if call.b2bua.opts.ResponseHook != nil {
+		call.b2bua.opts.ResponseHook(dir, reply, res)
+	}
+
+	call.b2bua.respond(reply, logger)
+}
+
+// ACK of the leg that sent INVITE completes the pending ACK to the other leg,
+// the body of the ACK is relayed too.
+func (call *Call) relayAck(dir Direction, req sip.Request, logger log.Logger) {
+	call.mu.Lock()
+	ack := call.pendingAcks[dir]
+	call.pendingAcks[dir] = nil
+	call.mu.Unlock()
+
+	if ack == nil {
+		return
+	}
+
+	copyContent(ack, req)
+	if call.b2bua.opts.RequestHook != nil {
+		call.b2bua.opts.RequestHook(dir, ack, req)
+	}
+	if err := call.b2bua.sender.Send(ack); err != nil {
+		logger.Warnf("send ACK failed: %s", err)
+	}
+}
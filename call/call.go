@@ -0,0 +1,582 @@
+package call
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sdp"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transfer"
+)
+
+// DTMFContentType is the media type of INFO requests carrying DTMF digits.
+const DTMFContentType = "application/dtmf-relay"
+
+// DefaultDTMFDuration is used by SendDTMF when the duration is not set.
+const DefaultDTMFDuration = 160 * time.Millisecond
+
+// ErrNotAnswered is returned by in-dialog operations on calls that are not answered yet or already terminated.
+var ErrNotAnswered = errors.New("call is not answered")
+
+type State int
+
+const (
+	// StateCalling is the state of the outgoing call after INVITE is sent.
+	StateCalling State = iota
+	// StateRinging is the state of the outgoing call after a provisional response except 100 is received.
+	StateRinging
+	// StateAnswered is the state of the established call.
+	StateAnswered
+	// StateTerminated is the state of the finished call.
+	StateTerminated
+)
+
+func (state State) String() string {
+	switch state {
+	case StateCalling:
+		return "Calling"
+	case StateRinging:
+		return "Ringing"
+	case StateAnswered:
+		return "Answered"
+	case StateTerminated:
+		return "Terminated"
+	default:
+		return "Unknown"
+	}
+}
+
+type EventType int
+
+const (
+	// Ringing is reported on every provisional response except 100, Response is set.
+	Ringing EventType = iota
+	// Answered is reported once the call is established, Response is the 2xx response.
+	Answered
+	// Updated is reported when the remote party has modified the session with re-INVITE or UPDATE,
+	// e.g. put the call on hold, Request is set.
+	Updated
+	// DTMF is reported on INFO with DTMF digit, Request and Digit are set.
+	DTMF
+	// Terminated is the last event of the call.
+	// Request is the BYE of the remote party, Response is the failure response on INVITE if any.
+	Terminated
+)
+
+func (typ EventType) String() string {
+	switch typ {
+	case Ringing:
+		return "Ringing"
+	case Answered:
+		return "Answered"
+	case Updated:
+		return "Updated"
+	case DTMF:
+		return "DTMF"
+	case Terminated:
+		return "Terminated"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event is a change of the call.
+type Event struct {
+	Type     EventType
+	Request  sip.Request
+	Response sip.Response
+	Digit    string
+	// Err is the reason of termination, it is nil if the call was hung up by any party.
+	Err error
+}
+
+// Call is an outgoing call placed with UA.Dial or an incoming call answered with Incoming.Answer.
+type Call struct {
+	ua *UA
+	// INVITE of the outgoing call
+	invite         sip.Request
+	cancelDial     context.CancelFunc
+	requestOptions []gosip.RequestWithContextOption
+
+	mu     sync.Mutex
+	state  State
+	hungUp bool
+	dialog *sip.Dialog
+	// local capabilities used to answer offers of the remote party
+	media *sdp.Session
+	// session descriptions negotiated last
+	local  *sdp.Session
+	remote *sdp.Session
+	// local session description before hold, it is offered again on resume
+	held *sdp.Session
+
+	events   chan Event
+	done     chan struct{}
+	err      error
+	finished bool
+
+	log log.Logger
+}
+
+func newCall(ua *UA, media *sdp.Session, requestOptions []gosip.RequestWithContextOption) *Call {
+	call := &Call{
+		ua:             ua,
+		media:          media,
+		requestOptions: requestOptions,
+		events:         make(chan Event, 16),
+		done:           make(chan struct{}),
+	}
+	call.log = ua.Log().
+		WithPrefix("call.Call").
+		WithFields(log.Fields{
+			"call_ptr": fmt.Sprintf("%p", call),
+		})
+
+	return call
+}
+
+func (call *Call) Log() log.Logger {
+	return call.log
+}
+
+func (call *Call) State() State {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	return call.state
+}
+
+// Dialog returns the dialog of the call, it is nil until the call is answered.
+func (call *Call) Dialog() *sip.Dialog {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	return call.dialog
+}
+
+// LocalSDP returns copy of the session description sent to the remote party last.
+func (call *Call) LocalSDP() *sdp.Session {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	if call.local == nil {
+		return nil
+	}
+	return call.local.Clone()
+}
+
+// RemoteSDP returns copy of the session description received from the remote party last.
+func (call *Call) RemoteSDP() *sdp.Session {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	if call.remote == nil {
+		return nil
+	}
+	return call.remote.Clone()
+}
+
+// Events returns channel of the call events, it is closed after Terminated event.
+// Events except Terminated are dropped if the channel is not read.
+func (call *Call) Events() <-chan Event {
+	return call.events
+}
+
+// Done returns channel that is closed when the call is terminated.
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Err returns the reason of termination, it is valid after Done is closed.
+func (call *Call) Err() error {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	return call.err
+}
+
+// Hangup cancels the outgoing call that is not answered yet or sends BYE on the established call.
+func (call *Call) Hangup(ctx context.Context) error {
+	call.mu.Lock()
+	state := call.state
+	call.hungUp = true
+	call.mu.Unlock()
+
+	switch state {
+	case StateTerminated:
+		return nil
+	case StateCalling, StateRinging:
+		// the call is terminated by dial
+		call.cancelDial()
+		return nil
+	}
+
+	bye := call.dialog.NewRequest(sip.BYE)
+	call.terminate(Event{Type: Terminated})
+
+	call.Log().Debug("hanging up the call")
+
+	_, err := call.ua.sender.RequestWithContext(ctx, bye, call.requestOptions...)
+	return err
+}
+
+// Hold puts the call on hold with re-INVITE, the media streams become sendonly or inactive.
+func (call *Call) Hold(ctx context.Context) error {
+	return call.reinvite(ctx, true)
+}
+
+// Resume takes the call off hold with re-INVITE, the session description sent before hold is offered again.
+// Nothing is sent if the call is not on hold.
+func (call *Call) Resume(ctx context.Context) error {
+	return call.reinvite(ctx, false)
+}
+
+func (call *Call) reinvite(ctx context.Context, hold bool) error {
+	call.mu.Lock()
+	if call.state != StateAnswered {
+		call.mu.Unlock()
+		return ErrNotAnswered
+	}
+	if call.local == nil {
+		call.mu.Unlock()
+		return fmt.Errorf("no local session description")
+	}
+	var offer *sdp.Session
+	if hold {
+		offer = call.local.Clone()
+		sdp.Hold(offer)
+	} else {
+		if call.held == nil {
+			call.mu.Unlock()
+			return nil
+		}
+		offer = call.held.Clone()
+		offer.Origin.SessionVersion = call.local.Origin.SessionVersion
+		offer.IncrementVersion()
+	}
+	prev := call.local
+	call.mu.Unlock()
+
+	req := call.dialog.NewRequest(sip.INVITE)
+	sdp.SetBody(req, offer)
+	res, err := call.ua.sender.RequestWithContext(ctx, req, call.requestOptions...)
+	if err != nil {
+		return err
+	}
+
+	if ack, err := call.dialog.NewAck(req); err == nil {
+		if err := call.ua.sender.Send(ack); err != nil {
+			return fmt.Errorf("send ACK: %w", err)
+		}
+	}
+
+	var answer *sdp.Session
+	if sdp.HasBody(res) {
+		if answer, err = sdp.FromMessage(res); err != nil {
+			return fmt.Errorf("invalid answer: %w", err)
+		}
+	}
+
+	call.mu.Lock()
+	if !hold {
+		call.held = nil
+	} else if call.held == nil {
+		call.held = prev
+	}
+	call.local = offer
+	if answer != nil {
+		call.remote = answer
+	}
+	call.mu.Unlock()
+
+	return nil
+}
+
+// SendDTMF sends the digits one by one with INFO requests (application/dtmf-relay).
+// Digits are 0-9, *, # and A-D.
+func (call *Call) SendDTMF(ctx context.Context, digits string, duration time.Duration) error {
+	if call.State() != StateAnswered {
+		return ErrNotAnswered
+	}
+	for _, digit := range digits {
+		if !strings.ContainsRune("0123456789*#ABCD", digit) {
+			return fmt.Errorf("invalid DTMF digit %q", digit)
+		}
+	}
+	if duration <= 0 {
+		duration = DefaultDTMFDuration
+	}
+
+	for _, digit := range digits {
+		contentType := sip.ContentType(DTMFContentType)
+		req := call.dialog.NewRequest(sip.INFO, &contentType)
+		req.SetBody(fmt.Sprintf("Signal=%c\r\nDuration=%d\r\n", digit, duration/time.Millisecond), true)
+
+		if _, err := call.ua.sender.RequestWithContext(ctx, req, call.requestOptions...); err != nil {
+			return fmt.Errorf("send DTMF %c: %w", digit, err)
+		}
+	}
+
+	return nil
+}
+
+// Transfer asks the remote party to call the target (blind transfer).
+// Progress of the transfer is reported by the returned transfer.Transfer.
+func (call *Call) Transfer(ctx context.Context, target sip.Uri, options ...transfer.ReferOption) (*transfer.Transfer, error) {
+	if call.State() != StateAnswered {
+		return nil, ErrNotAnswered
+	}
+
+	options = append([]transfer.ReferOption{transfer.WithRequestOptions(call.requestOptions...)}, options...)
+
+	return call.ua.transferor.BlindTransfer(ctx, call.dialog, target, options...)
+}
+
+func (call *Call) dial(ctx context.Context) {
+	defer call.cancelDial()
+
+	options := append([]gosip.RequestWithContextOption{
+		gosip.WithResponseHandler(func(res sip.Response, request sip.Request) {
+			if !res.IsProvisional() || res.StatusCode() == 100 {
+				return
+			}
+
+			call.mu.Lock()
+			if call.state == StateCalling {
+				call.state = StateRinging
+			}
+			call.emit(Event{Type: Ringing, Response: res})
+			call.mu.Unlock()
+		}),
+	}, call.requestOptions...)
+
+	res, err := call.ua.sender.RequestWithContext(ctx, call.invite, options...)
+	if err != nil {
+		event := Event{Type: Terminated, Err: err}
+		var reqErr *sip.RequestError
+		if errors.As(err, &reqErr) {
+			event.Response = reqErr.Response
+		}
+		call.mu.Lock()
+		if call.hungUp {
+			event.Err = nil
+		}
+		call.mu.Unlock()
+
+		call.Log().Debugf("call failed: %s", err)
+
+		call.terminate(event)
+
+		return
+	}
+
+	if err := call.answered(res); err != nil {
+		call.Log().Errorf("establish call failed: %s", err)
+
+		call.terminate(Event{Type: Terminated, Response: res, Err: err})
+	}
+}
+
+// Acknowledges 2xx on the initial INVITE and establishes the call.
+func (call *Call) answered(res sip.Response) error {
+	dialog, err := sip.NewClientDialog(call.invite, res)
+	if err != nil {
+		return err
+	}
+
+	var answer *sdp.Session
+	if sdp.HasBody(res) {
+		if answer, err = sdp.FromMessage(res); err != nil {
+			return fmt.Errorf("invalid answer: %w", err)
+		}
+	}
+
+	ack, err := dialog.NewAck(call.invite)
+	if err != nil {
+		return err
+	}
+	if err := call.ua.sender.Send(ack); err != nil {
+		return fmt.Errorf("send ACK: %w", err)
+	}
+
+	call.mu.Lock()
+	call.dialog = dialog
+	call.remote = answer
+	hungUp := call.hungUp
+	if !hungUp {
+		call.state = StateAnswered
+		call.emit(Event{Type: Answered, Response: res})
+	}
+	call.mu.Unlock()
+
+	if hungUp {
+		// answered in spite of CANCEL
+		call.terminate(Event{Type: Terminated})
+
+		_, err := call.ua.sender.RequestWithContext(context.Background(), dialog.NewRequest(sip.BYE), call.requestOptions...)
+		return err
+	}
+
+	call.ua.add(call)
+
+	call.Log().Debug("call answered")
+
+	return nil
+}
+
+func (call *Call) handleRequest(req sip.Request) bool {
+	logger := call.Log().WithFields(req.Fields())
+
+	switch req.Method() {
+	case sip.ACK:
+		// the answer on the offer sent in 2xx
+		if sdp.HasBody(req) {
+			if answer, err := sdp.FromMessage(req); err == nil {
+				call.mu.Lock()
+				call.remote = answer
+				call.mu.Unlock()
+			} else {
+				logger.Warnf("invalid answer in ACK: %s", err)
+			}
+		}
+		return true
+	case sip.BYE, sip.INVITE, sip.UPDATE, sip.INFO:
+	default:
+		return false
+	}
+
+	if !call.dialog.ReceiveRequest(req) {
+		call.ua.respond(sip.NewResponseFromRequest("", req, 500, "Server Internal Error", ""), logger)
+		return true
+	}
+
+	switch req.Method() {
+	case sip.BYE:
+		logger.Debug("call hung up by the remote party")
+
+		call.ua.respond(sip.NewResponseFromRequest("", req, 200, "OK", ""), logger)
+		call.terminate(Event{Type: Terminated, Request: req})
+	case sip.INVITE, sip.UPDATE:
+		call.handleOffer(req, logger)
+	case sip.INFO:
+		digit, ok := parseDTMF(req)
+		if !ok {
+			call.ua.respond(sip.NewResponseFromRequest("", req, 415, "Unsupported Media Type", ""), logger)
+			return true
+		}
+
+		call.ua.respond(sip.NewResponseFromRequest("", req, 200, "OK", ""), logger)
+
+		call.mu.Lock()
+		call.emit(Event{Type: DTMF, Request: req, Digit: digit})
+		call.mu.Unlock()
+	}
+
+	return true
+}
+
+// Answers the offer of the remote party with the local capabilities,
+// re-INVITE without offer is answered with the current session description.
+func (call *Call) handleOffer(req sip.Request, logger log.Logger) {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	local := call.local
+	var offer *sdp.Session
+	if sdp.HasBody(req) {
+		var err error
+		if offer, err = sdp.FromMessage(req); err != nil {
+			call.ua.respond(sip.NewResponseFromRequest("", req, 400, "Bad Request", ""), logger)
+			return
+		}
+		if call.media == nil {
+			call.ua.respond(sip.NewResponseFromRequest("", req, 488, "Not Acceptable Here", ""), logger)
+			return
+		}
+		if local, err = sdp.NewAnswer(offer, call.media); err != nil {
+			call.ua.respond(sip.NewResponseFromRequest("", req, 488, "Not Acceptable Here", ""), logger)
+			return
+		}
+		if call.local != nil {
+			local.Origin = call.local.Origin
+			local.IncrementVersion()
+		}
+	}
+
+	res := sip.NewResponseFromRequest("", req, 200, "OK", "")
+	res.AppendHeader(call.ua.contact.AsContactHeader())
+	if local != nil {
+		sdp.SetBody(res, local)
+	}
+	call.ua.respond(res, logger)
+
+	call.local = local
+	if offer != nil {
+		call.remote = offer
+	}
+	call.emit(Event{Type: Updated, Request: req})
+}
+
+// Sends the event without blocking, must be called with the lock held.
+func (call *Call) emit(event Event) {
+	if call.finished {
+		return
+	}
+
+	select {
+	case call.events <- event:
+	default:
+	}
+}
+
+func (call *Call) terminate(event Event) {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	if call.finished {
+		return
+	}
+
+	call.ua.remove(call)
+
+	call.state = StateTerminated
+	call.err = event.Err
+	// the final event is delivered even if the channel is full,
+	// the consumer may drain it concurrently, other senders hold the lock
+	select {
+	case call.events <- event:
+	default:
+		select {
+		case <-call.events:
+		default:
+		}
+		call.events <- event
+	}
+	call.finished = true
+	close(call.events)
+	close(call.done)
+}
+
+func parseDTMF(req sip.Request) (string, bool) {
+	hdr, ok := req.ContentType()
+	if !ok || !strings.EqualFold(strings.TrimSpace(strings.SplitN(hdr.Value(), ";", 2)[0]), DTMFContentType) {
+		return "", false
+	}
+
+	for _, line := range strings.Split(req.Body(), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "Signal") {
+			if digit := strings.TrimSpace(parts[1]); digit != "" {
+				return digit, true
+			}
+		}
+	}
+
+	return "", false
+}
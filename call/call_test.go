@@ -0,0 +1,452 @@
+package call_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/call"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sdp"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+var logger = log.NewDefaultLogrusLogger()
+
+// remote answers the request sent to the remote party, handler receives provisional responses.
+type remote func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error)
+
+// fakeSender passes requests to the remote party and records everything.
+type fakeSender struct {
+	mu        sync.Mutex
+	remote    remote
+	requests  []sip.Request
+	sent      []sip.Message
+	responses []sip.Response
+}
+
+func (s *fakeSender) Send(msg sip.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *fakeSender) RequestWithContext(
+	ctx context.Context,
+	request sip.Request,
+	options ...gosip.RequestWithContextOption,
+) (sip.Response, error) {
+	opts := &gosip.RequestWithContextOptions{}
+	for _, opt := range options {
+		opt.ApplyRequestWithContext(opts)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	answer := s.remote
+	s.mu.Unlock()
+
+	if answer == nil {
+		answer = reply(200, nil)
+	}
+	return answer(ctx, request, func(res sip.Response) {
+		if opts.ResponseHandler != nil {
+			opts.ResponseHandler(res, request)
+		}
+	})
+}
+
+func (s *fakeSender) Respond(res sip.Response) (sip.ServerTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, res)
+	return nil, nil
+}
+
+func (s *fakeSender) RespondOnRequest(
+	request sip.Request,
+	status sip.StatusCode,
+	reason, body string,
+	headers []sip.Header,
+) (sip.ServerTransaction, error) {
+	res := sip.NewResponseFromRequest("", request, status, reason, body)
+	for _, header := range headers {
+		res.AppendHeader(header)
+	}
+	return s.Respond(res)
+}
+
+func (s *fakeSender) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+func (s *fakeSender) lastRequest(t *testing.T) sip.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.requests) == 0 {
+		t.Fatalf("no requests sent")
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func (s *fakeSender) lastResponse(t *testing.T) sip.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.responses) == 0 {
+		t.Fatalf("no responses sent")
+	}
+	return s.responses[len(s.responses)-1]
+}
+
+func (s *fakeSender) lastSent(t *testing.T) sip.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sent) == 0 {
+		t.Fatalf("no messages sent")
+	}
+	return s.sent[len(s.sent)-1]
+}
+
+func newResponse(req sip.Request, status sip.StatusCode, body *sdp.Session) sip.Response {
+	res := sip.NewResponseFromRequest("", req, status, "", "")
+	if to, ok := res.To(); ok && !to.Params.Has("tag") {
+		to.Params.Add("tag", sip.String{Str: "bob-tag"})
+	}
+	res.AppendHeader(&sip.ContactHeader{
+		Address: &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "bob.example.com"},
+	})
+	if body != nil {
+		sdp.SetBody(res, body)
+	}
+	return res
+}
+
+// reply answers with the final response at once, offer in the request is answered with session.
+func reply(status sip.StatusCode, session *sdp.Session) remote {
+	return func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+		var body *sdp.Session
+		if offer, err := sdp.FromMessage(req); err == nil && session != nil {
+			body, _ = sdp.NewAnswer(offer, session)
+		}
+		res := newResponse(req, status, body)
+		if status >= 300 {
+			return nil, sip.NewRequestError(uint(status), "", req, res)
+		}
+		return res, nil
+	}
+}
+
+func session(user, address string) *sdp.Session {
+	s := sdp.NewSession(user, 1000, address)
+	s.Media = append(s.Media, sdp.NewMedia("audio", 40000, "RTP/AVP", []sdp.Codec{
+		{PayloadType: 0, Name: "PCMU", ClockRate: 8000},
+	}))
+	return s
+}
+
+func parse(t *testing.T, data string) sip.Message {
+	msg, err := parser.ParseMessage([]byte(data), logger)
+	if err != nil {
+		t.Fatalf("failed to parse message: %s\n%s", err, data)
+	}
+	return msg
+}
+
+func newUA(sender *fakeSender) *call.UA {
+	contact := &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "alice.example.com"}}
+	return call.NewUA(sender, contact, logger)
+}
+
+func nextEvent(t *testing.T, c *call.Call) call.Event {
+	select {
+	case event := <-c.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no call event")
+		return call.Event{}
+	}
+}
+
+func TestDial(t *testing.T) {
+	bob := session("bob", "192.0.2.20")
+	sender := &fakeSender{
+		remote: func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+			handler(newResponse(req, 100, nil))
+			handler(newResponse(req, 180, nil))
+			return reply(200, bob)(ctx, req, handler)
+		},
+	}
+	ua := newUA(sender)
+
+	target := &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"}
+	c, err := ua.Dial(context.Background(), target, call.WithOffer(session("alice", "192.0.2.10")))
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+
+	if event := nextEvent(t, c); event.Type != call.Ringing || event.Response.StatusCode() != 180 {
+		t.Errorf("expected Ringing event, got %s", event.Type)
+	}
+	if event := nextEvent(t, c); event.Type != call.Answered {
+		t.Fatalf("expected Answered event, got %s", event.Type)
+	}
+	if c.State() != call.StateAnswered || c.RemoteSDP() == nil || len(ua.Calls()) != 1 {
+		t.Errorf("unexpected call state %s", c.State())
+	}
+	if ack := sender.lastSent(t).(sip.Request); !ack.IsAck() || ack.Recipient().Host() != "bob.example.com" {
+		t.Errorf("expected ACK to the callee:\n%s", ack)
+	}
+
+	if err := c.Hold(context.Background()); err != nil {
+		t.Fatalf("hold failed: %s", err)
+	}
+	reinvite := sender.lastRequest(t)
+	held, err := sdp.FromMessage(reinvite)
+	if err != nil || held.Media[0].Direction(held) != sdp.SendOnly {
+		t.Errorf("unexpected hold offer:\n%s", reinvite)
+	}
+	if dir := c.RemoteSDP().Media[0].Direction(c.RemoteSDP()); dir != sdp.RecvOnly {
+		t.Errorf("expected recvonly answer on hold, got %s", dir)
+	}
+	if err := c.Resume(context.Background()); err != nil {
+		t.Fatalf("resume failed: %s", err)
+	}
+	if dir := c.LocalSDP().Media[0].Direction(c.LocalSDP()); dir != sdp.SendRecv {
+		t.Errorf("expected sendrecv after resume, got %s", dir)
+	}
+	// the session before hold is offered again with the next version
+	resumed, err := sdp.FromMessage(sender.lastRequest(t))
+	if err != nil || resumed.Origin.SessionVersion != held.Origin.SessionVersion+1 {
+		t.Errorf("unexpected resume offer:\n%s", sender.lastRequest(t))
+	}
+	if !reflect.DeepEqual(resumed.Media, session("alice", "192.0.2.10").Media) {
+		t.Errorf("pre-hold session is not offered on resume:\n%s", resumed)
+	}
+	sent := sender.requestCount()
+	if err := c.Resume(context.Background()); err != nil || sender.requestCount() != sent {
+		t.Errorf("re-INVITE is sent to resume the call that is not on hold: %v", err)
+	}
+
+	if err := c.SendDTMF(context.Background(), "5x", 0); err == nil {
+		t.Errorf("invalid digit is sent")
+	}
+	if err := c.SendDTMF(context.Background(), "1#", 0); err != nil {
+		t.Fatalf("send DTMF failed: %s", err)
+	}
+	if info := sender.lastRequest(t); info.Method() != sip.INFO || info.Body() != "Signal=#\r\nDuration=160\r\n" {
+		t.Errorf("unexpected DTMF INFO:\n%s", info)
+	}
+
+	if err := c.Hangup(context.Background()); err != nil {
+		t.Fatalf("hangup failed: %s", err)
+	}
+	if bye := sender.lastRequest(t); bye.Method() != sip.BYE {
+		t.Errorf("expected BYE:\n%s", bye)
+	}
+	if event := nextEvent(t, c); event.Type != call.Terminated || event.Err != nil {
+		t.Errorf("expected Terminated event, got %s", event.Type)
+	}
+	if _, ok := <-c.Events(); ok {
+		t.Errorf("events channel is not closed")
+	}
+	if len(ua.Calls()) != 0 {
+		t.Errorf("terminated call is not removed")
+	}
+}
+
+func TestDialFailure(t *testing.T) {
+	sender := &fakeSender{remote: reply(486, nil)}
+	ua := newUA(sender)
+
+	c, err := ua.Dial(context.Background(), &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"})
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	event := nextEvent(t, c)
+	if event.Type != call.Terminated || event.Response == nil || event.Response.StatusCode() != 486 || event.Err == nil {
+		t.Errorf("expected Terminated event with 486 response, got %+v", event)
+	}
+	<-c.Done()
+	if c.State() != call.StateTerminated || c.Err() == nil {
+		t.Errorf("unexpected call state %s", c.State())
+	}
+}
+
+func TestDialHangupBeforeAnswer(t *testing.T) {
+	sender := &fakeSender{
+		remote: func(ctx context.Context, req sip.Request, handler func(res sip.Response)) (sip.Response, error) {
+			handler(newResponse(req, 180, nil))
+			<-ctx.Done()
+			return nil, sip.NewRequestError(487, "Request Terminated", req, newResponse(req, 487, nil))
+		},
+	}
+	ua := newUA(sender)
+
+	c, err := ua.Dial(context.Background(), &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"})
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	if event := nextEvent(t, c); event.Type != call.Ringing {
+		t.Fatalf("expected Ringing event, got %s", event.Type)
+	}
+	if err := c.Hangup(context.Background()); err != nil {
+		t.Fatalf("hangup failed: %s", err)
+	}
+	if event := nextEvent(t, c); event.Type != call.Terminated || event.Err != nil {
+		t.Errorf("expected Terminated event without error, got %+v", event)
+	}
+}
+
+func incomingInvite(t *testing.T, offer *sdp.Session) sip.Request {
+	req := parse(t, strings.Join([]string{
+		"INVITE sip:alice@alice.example.com SIP/2.0",
+		"Via: SIP/2.0/UDP bob.example.com;branch=z9hG4bK.call-1",
+		"From: <sip:bob@example.com>;tag=bob-tag",
+		"To: <sip:alice@example.com>",
+		"Call-ID: call-1",
+		"CSeq: 1 INVITE",
+		"Contact: <sip:bob@bob.example.com>",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")).(sip.Request)
+	if offer != nil {
+		sdp.SetBody(req, offer)
+	}
+	return req
+}
+
+type fakeTransaction struct {
+	sip.ServerTransaction
+	cancels chan sip.Request
+	done    chan bool
+}
+
+func (tx *fakeTransaction) Cancels() <-chan sip.Request {
+	return tx.cancels
+}
+
+func (tx *fakeTransaction) Done() <-chan bool {
+	return tx.done
+}
+
+func TestIncoming(t *testing.T) {
+	sender := &fakeSender{}
+	ua := newUA(sender)
+
+	req := incomingInvite(t, session("bob", "192.0.2.20"))
+	in, err := ua.NewIncoming(req, nil)
+	if err != nil {
+		t.Fatalf("failed to wrap INVITE: %s", err)
+	}
+	if in.Offer() == nil {
+		t.Fatalf("offer is not parsed")
+	}
+
+	if err := in.Ring(); err != nil {
+		t.Fatalf("ring failed: %s", err)
+	}
+	ringing := sender.lastResponse(t)
+	ringingTo, _ := ringing.To()
+	if ringing.StatusCode() != 180 || !ringingTo.Params.Has("tag") {
+		t.Errorf("unexpected ringing response:\n%s", ringing)
+	}
+
+	c, err := in.Answer(session("alice", "192.0.2.10"))
+	if err != nil {
+		t.Fatalf("answer failed: %s", err)
+	}
+	ok := sender.lastResponse(t)
+	if to, _ := ok.To(); ok.StatusCode() != 200 || !sdp.HasBody(ok) || to.Value() != ringingTo.Value() {
+		t.Errorf("unexpected answer:\n%s", ok)
+	}
+	if err := in.Reject(486, "Busy Here"); err != call.ErrFinished {
+		t.Errorf("expected ErrFinished, got %v", err)
+	}
+	if event := nextEvent(t, c); event.Type != call.Answered {
+		t.Errorf("expected Answered event, got %s", event.Type)
+	}
+
+	bob, err := sip.NewClientDialog(req, ok)
+	if err != nil {
+		t.Fatalf("failed to create dialog of the caller: %s", err)
+	}
+
+	// hold by the remote party
+	offer := session("bob", "192.0.2.20")
+	sdp.Hold(offer)
+	reinvite := bob.NewRequest(sip.INVITE)
+	sdp.SetBody(reinvite, offer)
+	if !ua.HandleRequest(parse(t, reinvite.String()).(sip.Request), nil) {
+		t.Fatalf("re-INVITE not matched")
+	}
+	answer, err := sdp.FromMessage(sender.lastResponse(t))
+	if err != nil || answer.Media[0].Direction(answer) != sdp.RecvOnly {
+		t.Errorf("unexpected answer on hold:\n%s", sender.lastResponse(t))
+	}
+	if answer.Origin.SessionVersion != c.LocalSDP().Origin.SessionVersion || answer.Origin.SessionVersion == 1000 {
+		t.Errorf("session version is not incremented:\n%s", answer)
+	}
+	if event := nextEvent(t, c); event.Type != call.Updated || !sdp.IsHold(c.RemoteSDP()) {
+		t.Errorf("expected Updated event, got %s", event.Type)
+	}
+
+	contentType := sip.ContentType(call.DTMFContentType)
+	info := bob.NewRequest(sip.INFO, &contentType)
+	info.SetBody("Signal=7\r\nDuration=100\r\n", true)
+	if !ua.HandleRequest(parse(t, info.String()).(sip.Request), nil) {
+		t.Fatalf("INFO not matched")
+	}
+	if event := nextEvent(t, c); event.Type != call.DTMF || event.Digit != "7" {
+		t.Errorf("expected DTMF event, got %+v", event)
+	}
+
+	if !ua.HandleRequest(parse(t, bob.NewRequest(sip.BYE).String()).(sip.Request), nil) {
+		t.Fatalf("BYE not matched")
+	}
+	if res := sender.lastResponse(t); res.StatusCode() != 200 {
+		t.Errorf("expected 200 on BYE, got %d", res.StatusCode())
+	}
+	if event := nextEvent(t, c); event.Type != call.Terminated || event.Request == nil {
+		t.Errorf("expected Terminated event, got %+v", event)
+	}
+}
+
+func TestIncomingCancel(t *testing.T) {
+	sender := &fakeSender{}
+	ua := newUA(sender)
+
+	req := incomingInvite(t, nil)
+	tx := &fakeTransaction{cancels: make(chan sip.Request, 1), done: make(chan bool)}
+	in, err := ua.NewIncoming(req, tx)
+	if err != nil {
+		t.Fatalf("failed to wrap INVITE: %s", err)
+	}
+	tx.cancels <- sip.NewCancelRequest("", req, nil)
+
+	select {
+	case <-in.Canceled():
+	case <-time.After(time.Second):
+		t.Fatalf("call is not canceled")
+	}
+	if res := sender.lastResponse(t); res.StatusCode() != 487 {
+		t.Errorf("expected 487 on INVITE, got %d", res.StatusCode())
+	}
+	if _, err := in.Answer(nil); err != call.ErrFinished {
+		t.Errorf("expected ErrFinished, got %v", err)
+	}
+}
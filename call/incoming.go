@@ -0,0 +1,213 @@
+package call
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sdp"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// ErrFinished is returned by Incoming methods when the final response is already sent.
+var ErrFinished = errors.New("final response is already sent")
+
+// Incoming is an incoming call that is not answered yet.
+type Incoming struct {
+	ua    *UA
+	req   sip.Request
+	tx    sip.ServerTransaction
+	offer *sdp.Session
+	toTag string
+
+	mu       sync.Mutex
+	finished bool
+	done     chan struct{}
+	canceled chan struct{}
+
+	log log.Logger
+}
+
+func newIncoming(ua *UA, req sip.Request, tx sip.ServerTransaction, offer *sdp.Session) *Incoming {
+	in := &Incoming{
+		ua:       ua,
+		req:      req,
+		tx:       tx,
+		offer:    offer,
+		toTag:    util.RandString(8),
+		done:     make(chan struct{}),
+		canceled: make(chan struct{}),
+	}
+	in.log = ua.Log().
+		WithPrefix("call.Incoming").
+		WithFields(req.Fields()).
+		WithFields(log.Fields{
+			"incoming_ptr": fmt.Sprintf("%p", in),
+		})
+
+	if tx != nil {
+		go in.serveCancel()
+	}
+
+	return in
+}
+
+func (in *Incoming) Log() log.Logger {
+	return in.log
+}
+
+// Request returns the incoming INVITE.
+func (in *Incoming) Request() sip.Request {
+	return in.req
+}
+
+// Offer returns the session description offered by the caller, it is nil on late offer.
+func (in *Incoming) Offer() *sdp.Session {
+	return in.offer
+}
+
+// Canceled returns channel that is closed when the caller has canceled the call.
+func (in *Incoming) Canceled() <-chan struct{} {
+	return in.canceled
+}
+
+// Ring sends 180 Ringing to the caller.
+func (in *Incoming) Ring() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.finished {
+		return ErrFinished
+	}
+
+	_, err := in.ua.sender.Respond(in.newResponse(180, "Ringing"))
+	return err
+}
+
+// Answer answers the call with 200 OK and returns the established call.
+// Session description of the answer is negotiated from the offer of the caller and the local one,
+// on late offer the local session description is sent as the offer.
+// The call is rejected with 488 if no offered media stream is acceptable.
+func (in *Incoming) Answer(local *sdp.Session) (*Call, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.finished {
+		return nil, ErrFinished
+	}
+
+	var answer *sdp.Session
+	switch {
+	case in.offer != nil && local != nil:
+		var err error
+		if answer, err = sdp.NewAnswer(in.offer, local); err != nil {
+			in.reject(488, "Not Acceptable Here")
+			return nil, err
+		}
+	case in.offer != nil:
+		return nil, fmt.Errorf("no local session description to answer the offer")
+	case local != nil:
+		answer = local.Clone()
+	}
+
+	res := in.newResponse(200, "OK")
+	if answer != nil {
+		sdp.SetBody(res, answer)
+	}
+	dialog, err := sip.NewServerDialog(in.req, res)
+	if err != nil {
+		return nil, err
+	}
+
+	call := newCall(in.ua, local, nil)
+	call.dialog = dialog
+	call.local = answer
+	call.remote = in.offer
+	call.state = StateAnswered
+	call.emit(Event{Type: Answered, Response: res})
+	in.ua.add(call)
+
+	if _, err := in.ua.sender.Respond(res); err != nil {
+		in.ua.remove(call)
+		return nil, fmt.Errorf("respond '200 OK': %w", err)
+	}
+	in.finish()
+
+	call.Log().Debug("call answered")
+
+	return call, nil
+}
+
+// Reject rejects the call with the failure response.
+func (in *Incoming) Reject(code sip.StatusCode, reason string) error {
+	if code < 300 {
+		return fmt.Errorf("invalid failure status code %d", code)
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.finished {
+		return ErrFinished
+	}
+
+	return in.reject(code, reason)
+}
+
+func (in *Incoming) reject(code sip.StatusCode, reason string) error {
+	_, err := in.ua.sender.Respond(in.newResponse(code, reason))
+	in.finish()
+
+	return err
+}
+
+func (in *Incoming) newResponse(code sip.StatusCode, reason string) sip.Response {
+	res := sip.NewResponseFromRequest("", in.req, code, reason, "")
+	if to, ok := res.To(); ok {
+		if to.Params == nil {
+			to.Params = sip.NewParams()
+		}
+		if !to.Params.Has("tag") {
+			to.Params.Add("tag", sip.String{Str: in.toTag})
+		}
+	}
+	if code < 300 {
+		res.AppendHeader(in.ua.contact.AsContactHeader())
+	}
+
+	return res
+}
+
+func (in *Incoming) finish() {
+	if !in.finished {
+		in.finished = true
+		close(in.done)
+	}
+}
+
+func (in *Incoming) serveCancel() {
+	select {
+	case <-in.done:
+	case <-in.tx.Done():
+	case cancel, ok := <-in.tx.Cancels():
+		if !ok {
+			return
+		}
+
+		in.ua.respond(sip.NewResponseFromRequest("", cancel, 200, "OK", ""), in.Log())
+
+		in.mu.Lock()
+		defer in.mu.Unlock()
+
+		if in.finished {
+			return
+		}
+
+		in.Log().Debug("call canceled by the caller")
+
+		in.reject(487, "Request Terminated")
+		close(in.canceled)
+	}
+}
@@ -0,0 +1,252 @@
+// call package implements high-level API of voice calls for UAC and UAS applications.
+//
+// UA places outgoing calls with Dial and wraps incoming INVITE requests into Incoming calls
+// that can be rung, answered or rejected. Established calls can be put on hold (RFC 3264 s. 8.4),
+// send DTMF with INFO (application/dtmf-relay) and be transferred with REFER (RFC 3515).
+// In-dialog requests received by the server must be passed to UA.HandleRequest.
+package call
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sdp"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transfer"
+)
+
+// DialOption modifies INVITE sent by UA.Dial.
+type DialOption interface {
+	ApplyDial(options *DialOptions)
+}
+
+type DialOptions struct {
+	// From is the caller address, the contact address of UA is used by default.
+	From *sip.Address
+	// Offer is the session description sent in INVITE.
+	// Without the offer the answer is expected in the response (late offer).
+	Offer *sdp.Session
+	// Headers are appended to the INVITE request.
+	Headers        []sip.Header
+	RequestOptions []gosip.RequestWithContextOption
+}
+
+type withFrom struct {
+	address *sip.Address
+}
+
+func (o withFrom) ApplyDial(options *DialOptions) {
+	options.From = o.address
+}
+
+// WithFrom sets the caller address.
+func WithFrom(address *sip.Address) DialOption {
+	return withFrom{address.Clone()}
+}
+
+type withOffer struct {
+	offer *sdp.Session
+}
+
+func (o withOffer) ApplyDial(options *DialOptions) {
+	options.Offer = o.offer
+}
+
+// WithOffer sets the session description offered in INVITE.
+func WithOffer(offer *sdp.Session) DialOption {
+	return withOffer{offer.Clone()}
+}
+
+type withHeaders struct {
+	headers []sip.Header
+}
+
+func (o withHeaders) ApplyDial(options *DialOptions) {
+	options.Headers = append(options.Headers, o.headers...)
+}
+
+// WithHeaders appends headers to INVITE request.
+func WithHeaders(headers ...sip.Header) DialOption {
+	return withHeaders{headers}
+}
+
+type withRequestOptions struct {
+	options []gosip.RequestWithContextOption
+}
+
+func (o withRequestOptions) ApplyDial(options *DialOptions) {
+	options.RequestOptions = append(options.RequestOptions, o.options...)
+}
+
+// WithRequestOptions passes options to gosip.Sender.RequestWithContext, e.g. gosip.WithAuthorizer.
+// The options are used for all requests of the call.
+func WithRequestOptions(options ...gosip.RequestWithContextOption) DialOption {
+	return withRequestOptions{options}
+}
+
+// UA places and receives calls.
+type UA struct {
+	sender     gosip.Sender
+	contact    *sip.Address
+	transferor *transfer.Transferor
+
+	mu sync.RWMutex
+	// established calls by dialog ID
+	calls map[string]*Call
+
+	log log.Logger
+}
+
+// NewUA creates UA that uses contact as Contact of all calls.
+func NewUA(sender gosip.Sender, contact *sip.Address, logger log.Logger) *UA {
+	ua := &UA{
+		sender:  sender,
+		contact: contact.Clone(),
+		calls:   make(map[string]*Call),
+	}
+	ua.log = logger.
+		WithPrefix("call.UA").
+		WithFields(log.Fields{
+			"ua_ptr": fmt.Sprintf("%p", ua),
+		})
+	ua.transferor = transfer.NewTransferor(sender, ua.log)
+
+	return ua
+}
+
+func (ua *UA) Log() log.Logger {
+	return ua.log
+}
+
+// Calls returns currently established calls.
+func (ua *UA) Calls() []*Call {
+	ua.mu.RLock()
+	defer ua.mu.RUnlock()
+
+	calls := make([]*Call, 0, len(ua.calls))
+	for _, call := range ua.calls {
+		calls = append(calls, call)
+	}
+
+	return calls
+}
+
+// Dial sends INVITE to the target and returns the call at once,
+// progress of the call is reported with Call.Events.
+// Cancellation of ctx before the call is answered cancels INVITE.
+func (ua *UA) Dial(ctx context.Context, target sip.Uri, options ...DialOption) (*Call, error) {
+	optionsHash := &DialOptions{}
+	for _, opt := range options {
+		opt.ApplyDial(optionsHash)
+	}
+
+	invite, err := ua.newInvite(target, optionsHash)
+	if err != nil {
+		return nil, fmt.Errorf("build INVITE: %w", err)
+	}
+
+	call := newCall(ua, optionsHash.Offer, optionsHash.RequestOptions)
+	call.invite = invite
+	call.local = optionsHash.Offer
+
+	ctx, cancel := context.WithCancel(ctx)
+	call.cancelDial = cancel
+
+	call.Log().Debugf("dialing %s", target)
+
+	go call.dial(ctx)
+
+	return call, nil
+}
+
+func (ua *UA) newInvite(target sip.Uri, options *DialOptions) (sip.Request, error) {
+	from := options.From
+	if from == nil {
+		from = ua.contact
+	}
+
+	builder := sip.NewRequestBuilderTo(sip.INVITE, target, from).
+		SetContact(ua.contact)
+	for _, header := range options.Headers {
+		builder.AddHeader(header)
+	}
+
+	invite, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	if options.Offer != nil {
+		sdp.SetBody(invite, options.Offer)
+	}
+
+	return invite, nil
+}
+
+// NewIncoming wraps the incoming INVITE, the offer of the caller is parsed from the body.
+// CANCEL of the caller is answered automatically and reported with Incoming.Canceled.
+func (ua *UA) NewIncoming(req sip.Request, tx sip.ServerTransaction) (*Incoming, error) {
+	if !req.IsInvite() {
+		return nil, fmt.Errorf("unexpected method %s", req.Method())
+	}
+
+	var offer *sdp.Session
+	if sdp.HasBody(req) {
+		var err error
+		if offer, err = sdp.FromMessage(req); err != nil {
+			if _, err := ua.sender.RespondOnRequest(req, 400, "Bad Request", "", nil); err != nil {
+				ua.Log().Errorf("respond '400 Bad Request' failed: %s", err)
+			}
+			return nil, fmt.Errorf("invalid offer: %w", err)
+		}
+	}
+
+	return newIncoming(ua, req, tx, offer), nil
+}
+
+// HandleRequest processes the request received within an established call and responds to it.
+// It returns false if the request does not belong to any call or the method is not handled
+// (e.g. REFER, that can be accepted with transfer.Transferee on Call.Dialog),
+// so it can be passed to other handlers.
+func (ua *UA) HandleRequest(req sip.Request, tx sip.ServerTransaction) bool {
+	if req.Method() == sip.NOTIFY && ua.transferor.HandleNotify(req) {
+		return true
+	}
+
+	id, err := sip.MakeDialogIDFromMessage(req)
+	if err != nil {
+		return false
+	}
+
+	ua.mu.RLock()
+	call, ok := ua.calls[id]
+	ua.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	return call.handleRequest(req)
+}
+
+func (ua *UA) add(call *Call) {
+	ua.mu.Lock()
+	ua.calls[call.dialog.ID()] = call
+	ua.mu.Unlock()
+}
+
+func (ua *UA) remove(call *Call) {
+	ua.mu.Lock()
+	if call.dialog != nil {
+		delete(ua.calls, call.dialog.ID())
+	}
+	ua.mu.Unlock()
+}
+
+func (ua *UA) respond(res sip.Response, logger log.Logger) {
+	if _, err := ua.sender.Respond(res); err != nil {
+		logger.Errorf("respond '%d %s' failed: %s", res.StatusCode(), res.Reason(), err)
+	}
+}
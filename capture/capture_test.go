@@ -0,0 +1,274 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+func newCapturedMessage(network string, dir transport.CaptureDirection) *transport.CapturedMessage {
+	msg, err := parser.ParseMessage([]byte(strings.Join([]string{
+		"OPTIONS sip:bob@example.com SIP/2.0",
+		"Via: SIP/2.0/" + network + " 10.0.0.1:5060;branch=z9hG4bK.1",
+		"From: <sip:alice@example.com>;tag=1",
+		"To: <sip:bob@example.com>",
+		"Call-ID: capture-test",
+		"CSeq: 1 OPTIONS",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		panic(err)
+	}
+
+	return &transport.CapturedMessage{
+		Direction:  dir,
+		Time:       time.Unix(1600000000, 123456000),
+		Network:    network,
+		LocalAddr:  "10.0.0.1:5060",
+		RemoteAddr: "10.0.0.2:5080",
+		Message:    msg,
+		Data:       []byte(msg.String()),
+	}
+}
+
+func TestPacketBuilder(t *testing.T) {
+	b := newPacketBuilder()
+
+	msg := newCapturedMessage("UDP", transport.CaptureOutbound)
+	pkt := b.build(msg)
+	if len(pkt) != 20+8+len(msg.Data) {
+		t.Fatalf("unexpected UDP packet length %d", len(pkt))
+	}
+	if checksum(pkt[:20], 0) != 0 {
+		t.Error("invalid IPv4 header checksum")
+	}
+	if !net.IP(pkt[12:16]).Equal(net.ParseIP("10.0.0.1")) || !net.IP(pkt[16:20]).Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("unexpected addresses %s > %s", net.IP(pkt[12:16]), net.IP(pkt[16:20]))
+	}
+	if port := binary.BigEndian.Uint16(pkt[22:]); port != 5080 {
+		t.Errorf("unexpected destination port %d", port)
+	}
+	if !bytes.Equal(pkt[28:], msg.Data) {
+		t.Error("payload mismatch")
+	}
+
+	msg = newCapturedMessage("TCP", transport.CaptureInbound)
+	first := b.build(msg)
+	second := b.build(msg)
+	if first[9] != ipProtoTCP {
+		t.Fatalf("unexpected protocol %d", first[9])
+	}
+	if port := binary.BigEndian.Uint16(first[20:]); port != 5080 {
+		t.Errorf("unexpected source port %d", port)
+	}
+	if seq := binary.BigEndian.Uint32(second[24:]); seq != uint32(len(msg.Data)) {
+		t.Errorf("unexpected TCP sequence number %d", seq)
+	}
+
+	msg = newCapturedMessage("UDP", transport.CaptureOutbound)
+	msg.LocalAddr, msg.RemoteAddr = "[::1]:5060", "[2001:db8::1]:5060"
+	pkt = b.build(msg)
+	if pkt[0]>>4 != 6 || len(pkt) != 40+8+len(msg.Data) {
+		t.Errorf("unexpected IPv6 packet, version %d, length %d", pkt[0]>>4, len(pkt))
+	}
+}
+
+func TestPacketBuilderFlows(t *testing.T) {
+	b := newPacketBuilder()
+
+	msg := newCapturedMessage("TCP", transport.CaptureInbound)
+	b.build(msg)
+	for i := 0; i < maxTCPFlows; i++ {
+		if seq := b.nextSeq(fmt.Sprintf("10.0.0.3:%d>10.0.0.1:5060", i), 10); seq != 0 {
+			t.Fatalf("unexpected sequence number %d of new flow", seq)
+		}
+	}
+	if len(b.seqs) != maxTCPFlows || b.flows.Len() != maxTCPFlows {
+		t.Fatalf("unexpected number of flows %d", len(b.seqs))
+	}
+
+	// the least recently used flow is evicted and starts over
+	pkt := b.build(msg)
+	if seq := binary.BigEndian.Uint32(pkt[24:]); seq != 0 {
+		t.Errorf("unexpected TCP sequence number %d of evicted flow", seq)
+	}
+	if seq := b.nextSeq("10.0.0.3:1>10.0.0.1:5060", 10); seq != 10 {
+		t.Errorf("unexpected sequence number %d of recently used flow", seq)
+	}
+	if _, ok := b.seqs["10.0.0.3:0>10.0.0.1:5060"]; ok {
+		t.Error("least recently used flow is not evicted")
+	}
+}
+
+func TestPcapWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	pw, err := NewPcapWriter(buf, log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := newCapturedMessage("UDP", transport.CaptureInbound)
+	pw.Capture(msg)
+
+	data := buf.Bytes()
+	if magic := binary.LittleEndian.Uint32(data); magic != 0xa1b2c3d4 {
+		t.Fatalf("unexpected magic %x", magic)
+	}
+	if lt := binary.LittleEndian.Uint32(data[20:]); lt != linkTypeRaw {
+		t.Errorf("unexpected link type %d", lt)
+	}
+	rec := data[24:]
+	if sec := binary.LittleEndian.Uint32(rec); sec != 1600000000 {
+		t.Errorf("unexpected timestamp %d", sec)
+	}
+	if usec := binary.LittleEndian.Uint32(rec[4:]); usec != 123456 {
+		t.Errorf("unexpected timestamp microseconds %d", usec)
+	}
+	if n := binary.LittleEndian.Uint32(rec[8:]); int(n) != len(rec)-16 {
+		t.Errorf("record length %d doesn't match packet length %d", n, len(rec)-16)
+	}
+}
+
+func TestPcapNGWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	pw, err := NewPcapNGWriter(buf, log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pw.Capture(newCapturedMessage("TCP", transport.CaptureOutbound))
+
+	var types []uint32
+	data := buf.Bytes()
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block")
+		}
+		typ := binary.LittleEndian.Uint32(data)
+		n := binary.LittleEndian.Uint32(data[4:])
+		if n%4 != 0 || int(n) > len(data) {
+			t.Fatalf("invalid block length %d", n)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[n-4:]); trailer != n {
+			t.Fatalf("block trailer length %d doesn't match %d", trailer, n)
+		}
+		if typ == 6 {
+			if flags := binary.LittleEndian.Uint32(data[n-12:]); flags != 2 {
+				t.Errorf("unexpected epb_flags %d", flags)
+			}
+		}
+		types = append(types, typ)
+		data = data[n:]
+	}
+
+	if len(types) != 3 || types[0] != 0x0a0d0d0a || types[1] != 1 || types[2] != 6 {
+		t.Errorf("unexpected blocks %x", types)
+	}
+}
+
+func decodeHEP(t *testing.T, data []byte) map[uint16][]byte {
+	t.Helper()
+
+	if string(data[:4]) != "HEP3" {
+		t.Fatalf("unexpected HEP magic %q", data[:4])
+	}
+	if n := binary.BigEndian.Uint16(data[4:]); int(n) != len(data) {
+		t.Fatalf("HEP length %d doesn't match %d", n, len(data))
+	}
+
+	chunks := make(map[uint16][]byte)
+	for data = data[6:]; len(data) > 0; {
+		typ := binary.BigEndian.Uint16(data[2:])
+		n := binary.BigEndian.Uint16(data[4:])
+		chunks[typ] = data[6:n]
+		data = data[n:]
+	}
+
+	return chunks
+}
+
+func TestEncodeHEP(t *testing.T) {
+	msg := newCapturedMessage("UDP", transport.CaptureInbound)
+	chunks := decodeHEP(t, EncodeHEP(msg, 2001, "secret"))
+
+	if !net.IP(chunks[hepChunkIPv4Src]).Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("unexpected source %s", net.IP(chunks[hepChunkIPv4Src]))
+	}
+	if port := binary.BigEndian.Uint16(chunks[hepChunkDstPort]); port != 5060 {
+		t.Errorf("unexpected destination port %d", port)
+	}
+	if proto := chunks[hepChunkIPProto]; proto[0] != ipProtoUDP {
+		t.Errorf("unexpected protocol %d", proto[0])
+	}
+	if id := binary.BigEndian.Uint32(chunks[hepChunkCaptureID]); id != 2001 {
+		t.Errorf("unexpected capture ID %d", id)
+	}
+	if key := string(chunks[hepChunkAuthKey]); key != "secret" {
+		t.Errorf("unexpected auth key %q", key)
+	}
+	if cid := string(chunks[hepChunkCorrelation]); cid != "capture-test" {
+		t.Errorf("unexpected correlation ID %q", cid)
+	}
+	if !bytes.Equal(chunks[hepChunkPayload], msg.Data) {
+		t.Error("payload mismatch")
+	}
+}
+
+func TestEncodeHEPTruncate(t *testing.T) {
+	msg := newCapturedMessage("TCP", transport.CaptureInbound)
+	msg.Data = bytes.Repeat([]byte("a"), 0x10000)
+
+	data := EncodeHEP(msg, 1, "")
+	if len(data) != maxHEPLen {
+		t.Fatalf("unexpected HEP length %d", len(data))
+	}
+
+	payload := decodeHEP(t, data)[hepChunkPayload]
+	if len(payload) == 0 || !bytes.Equal(payload, msg.Data[:len(payload)]) {
+		t.Error("payload mismatch")
+	}
+}
+
+func TestHEPSender(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender, err := NewHEPSender(conn.LocalAddr().String(), 1, "", log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	msg := newCapturedMessage("TCP", transport.CaptureOutbound)
+	sender.Capture(msg)
+
+	buf := make([]byte, 0xffff)
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := decodeHEP(t, buf[:n])
+	if _, ok := chunks[hepChunkAuthKey]; ok {
+		t.Error("unexpected auth key chunk")
+	}
+	if !bytes.Equal(chunks[hepChunkPayload], msg.Data) {
+		t.Error("payload mismatch")
+	}
+}
@@ -0,0 +1,146 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+// HEPv3 chunk types, vendor 0x0000 (generic).
+const (
+	hepChunkIPFamily    = 0x0001
+	hepChunkIPProto     = 0x0002
+	hepChunkIPv4Src     = 0x0003
+	hepChunkIPv4Dst     = 0x0004
+	hepChunkIPv6Src     = 0x0005
+	hepChunkIPv6Dst     = 0x0006
+	hepChunkSrcPort     = 0x0007
+	hepChunkDstPort     = 0x0008
+	hepChunkTsSec       = 0x0009
+	hepChunkTsUsec      = 0x000a
+	hepChunkProtoType   = 0x000b
+	hepChunkCaptureID   = 0x000c
+	hepChunkAuthKey     = 0x000e
+	hepChunkPayload     = 0x000f
+	hepChunkCorrelation = 0x0011
+
+	hepProtoSIP = 0x01
+
+	// HEP packet length is 16 bit, also it should fit into the UDP datagram over IPv4
+	maxHEPLen = 0xffff - 8 - 20
+)
+
+// EncodeHEP encodes captured message as HEPv3 packet.
+// Payload that doesn't fit into the maximum packet length is truncated.
+func EncodeHEP(msg *transport.CapturedMessage, captureID uint32, authKey string) []byte {
+	srcIP, srcPort := transport.SplitCaptureAddr(msg.SrcAddr())
+	dstIP, dstPort := transport.SplitCaptureAddr(msg.DstAddr())
+
+	buf := make([]byte, 6, 128+len(msg.Data))
+	copy(buf, "HEP3")
+
+	chunk := func(typ uint16, data []byte) {
+		left := maxHEPLen - len(buf) - 6
+		if left < 0 {
+			return
+		}
+		if len(data) > left {
+			data = data[:left]
+		}
+
+		var hdr [6]byte
+		binary.BigEndian.PutUint16(hdr[2:], typ)
+		binary.BigEndian.PutUint16(hdr[4:], uint16(6+len(data)))
+		buf = append(buf, hdr[:]...)
+		buf = append(buf, data...)
+	}
+	u16 := func(v uint16) []byte {
+		b := make([]byte, 2)
+		binary.BigEndian.PutUint16(b, v)
+		return b
+	}
+	u32 := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return b
+	}
+
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		chunk(hepChunkIPFamily, []byte{0x02})
+		chunk(hepChunkIPProto, []byte{ipProto(msg.Network)})
+		chunk(hepChunkIPv4Src, src4)
+		chunk(hepChunkIPv4Dst, dst4)
+	} else {
+		chunk(hepChunkIPFamily, []byte{0x0a})
+		chunk(hepChunkIPProto, []byte{ipProto(msg.Network)})
+		chunk(hepChunkIPv6Src, srcIP.To16())
+		chunk(hepChunkIPv6Dst, dstIP.To16())
+	}
+	chunk(hepChunkSrcPort, u16(srcPort))
+	chunk(hepChunkDstPort, u16(dstPort))
+	chunk(hepChunkTsSec, u32(uint32(msg.Time.Unix())))
+	chunk(hepChunkTsUsec, u32(uint32(msg.Time.Nanosecond()/1000)))
+	chunk(hepChunkProtoType, []byte{hepProtoSIP})
+	chunk(hepChunkCaptureID, u32(captureID))
+	if authKey != "" {
+		chunk(hepChunkAuthKey, []byte(authKey))
+	}
+	if msg.Message != nil {
+		if callID, ok := msg.Message.CallID(); ok {
+			chunk(hepChunkCorrelation, []byte(callID.Value()))
+		}
+	}
+	chunk(hepChunkPayload, msg.Data)
+
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(buf)))
+
+	return buf
+}
+
+// HEPSender sends captured messages to HEP collector (e.g. Homer) over UDP.
+type HEPSender struct {
+	conn      net.Conn
+	captureID uint32
+	authKey   string
+
+	log log.Logger
+}
+
+// NewHEPSender creates tap that sends HEPv3 packets to the collector address.
+func NewHEPSender(addr string, captureID uint32, authKey string, logger log.Logger) (*HEPSender, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial HEP collector %s: %w", addr, err)
+	}
+
+	s := &HEPSender{
+		conn:      conn,
+		captureID: captureID,
+		authKey:   authKey,
+	}
+	s.log = logger.
+		WithPrefix("capture.HEPSender").
+		WithFields(log.Fields{
+			"hep_sender_ptr": fmt.Sprintf("%p", s),
+			"hep_collector":  addr,
+		})
+
+	return s, nil
+}
+
+func (s *HEPSender) Log() log.Logger {
+	return s.log
+}
+
+func (s *HEPSender) Capture(msg *transport.CapturedMessage) {
+	if _, err := s.conn.Write(EncodeHEP(msg, s.captureID, s.authKey)); err != nil {
+		s.Log().Warnf("send HEP packet failed: %s", err)
+	}
+}
+
+func (s *HEPSender) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,182 @@
+// capture package implements sinks for the transport layer capture tap:
+// HEPv3 sender and pcap/pcapng writers.
+package capture
+
+import (
+	"container/list"
+	"encoding/binary"
+	"net"
+	"strings"
+
+	"github.com/ghettovoice/gosip/transport"
+)
+
+const (
+	ipProtoTCP = 6
+	ipProtoUDP = 17
+
+	maxPayloadLen = 0xffff - 60 - 20
+
+	// maxTCPFlows bounds tracked TCP flows, sequence numbers of evicted flows start over.
+	maxTCPFlows = 4096
+)
+
+func ipProto(network string) uint8 {
+	if strings.ToUpper(network) == "UDP" {
+		return ipProtoUDP
+	}
+
+	return ipProtoTCP
+}
+
+// packetBuilder synthesises IP/UDP/TCP headers for captured messages.
+type packetBuilder struct {
+	// next TCP sequence numbers by flow, the least recently used flows are evicted over maxTCPFlows
+	seqs  map[string]*list.Element
+	flows *list.List
+}
+
+type tcpFlow struct {
+	key string
+	seq uint32
+}
+
+func newPacketBuilder() *packetBuilder {
+	return &packetBuilder{
+		seqs:  make(map[string]*list.Element),
+		flows: list.New(),
+	}
+}
+
+// nextSeq returns sequence number of the segment with size bytes in the flow.
+func (b *packetBuilder) nextSeq(key string, size int) uint32 {
+	el, ok := b.seqs[key]
+	if ok {
+		b.flows.MoveToFront(el)
+	} else {
+		if b.flows.Len() >= maxTCPFlows {
+			oldest := b.flows.Back()
+			b.flows.Remove(oldest)
+			delete(b.seqs, oldest.Value.(*tcpFlow).key)
+		}
+		el = b.flows.PushFront(&tcpFlow{key: key})
+		b.seqs[key] = el
+	}
+
+	flow := el.Value.(*tcpFlow)
+	seq := flow.seq
+	flow.seq += uint32(size)
+
+	return seq
+}
+
+// build returns raw IP packet (LINKTYPE_RAW) with the captured message as payload.
+func (b *packetBuilder) build(msg *transport.CapturedMessage) []byte {
+	srcIP, srcPort := transport.SplitCaptureAddr(msg.SrcAddr())
+	dstIP, dstPort := transport.SplitCaptureAddr(msg.DstAddr())
+
+	// both addresses must be in the same family
+	src4, dst4 := srcIP.To4(), dstIP.To4()
+	if (src4 == nil) != (dst4 == nil) {
+		if src4 == nil {
+			srcIP = net.IPv6unspecified
+		} else {
+			dstIP = net.IPv6unspecified
+		}
+		src4, dst4 = nil, nil
+	}
+	if src4 != nil {
+		srcIP, dstIP = src4, dst4
+	} else {
+		srcIP, dstIP = srcIP.To16(), dstIP.To16()
+	}
+
+	payload := msg.Data
+	if len(payload) > maxPayloadLen {
+		payload = payload[:maxPayloadLen]
+	}
+
+	proto := ipProto(msg.Network)
+	var l4 []byte
+	if proto == ipProtoUDP {
+		l4 = make([]byte, 8+len(payload))
+		binary.BigEndian.PutUint16(l4[0:], srcPort)
+		binary.BigEndian.PutUint16(l4[2:], dstPort)
+		binary.BigEndian.PutUint16(l4[4:], uint16(len(l4)))
+		copy(l4[8:], payload)
+		binary.BigEndian.PutUint16(l4[6:], l4Checksum(srcIP, dstIP, proto, l4))
+	} else {
+		seq := b.nextSeq(msg.SrcAddr()+">"+msg.DstAddr(), len(payload))
+
+		l4 = make([]byte, 20+len(payload))
+		binary.BigEndian.PutUint16(l4[0:], srcPort)
+		binary.BigEndian.PutUint16(l4[2:], dstPort)
+		binary.BigEndian.PutUint32(l4[4:], seq)
+		// data offset 5 words, PSH+ACK flags
+		l4[12] = 5 << 4
+		l4[13] = 0x18
+		binary.BigEndian.PutUint16(l4[14:], 0xffff)
+		copy(l4[20:], payload)
+		binary.BigEndian.PutUint16(l4[16:], l4Checksum(srcIP, dstIP, proto, l4))
+	}
+
+	if len(srcIP) == net.IPv4len {
+		pkt := make([]byte, 20+len(l4))
+		pkt[0] = 0x45
+		binary.BigEndian.PutUint16(pkt[2:], uint16(len(pkt)))
+		// don't fragment
+		pkt[6] = 0x40
+		pkt[8] = 64
+		pkt[9] = proto
+		copy(pkt[12:], srcIP)
+		copy(pkt[16:], dstIP)
+		binary.BigEndian.PutUint16(pkt[10:], checksum(pkt[:20], 0))
+		copy(pkt[20:], l4)
+
+		return pkt
+	}
+
+	pkt := make([]byte, 40+len(l4))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(l4)))
+	pkt[6] = proto
+	pkt[7] = 64
+	copy(pkt[8:], srcIP)
+	copy(pkt[24:], dstIP)
+	copy(pkt[40:], l4)
+
+	return pkt
+}
+
+func l4Checksum(src, dst net.IP, proto uint8, l4 []byte) uint16 {
+	var sum uint32
+	for _, ip := range []net.IP{src, dst} {
+		for i := 0; i < len(ip); i += 2 {
+			sum += uint32(ip[i])<<8 | uint32(ip[i+1])
+		}
+	}
+	sum += uint32(proto)
+	sum += uint32(len(l4))
+
+	cs := checksum(l4, sum)
+	if cs == 0 && proto == ipProtoUDP {
+		cs = 0xffff
+	}
+
+	return cs
+}
+
+// checksum calculates Internet checksum (RFC 1071) of data with initial sum.
+func checksum(data []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return ^uint16(sum)
+}
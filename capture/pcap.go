@@ -0,0 +1,162 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+const (
+	linkTypeRaw = 101
+	snapLen     = 0xffff
+)
+
+// PcapWriter writes captured messages in the classic libpcap format.
+type PcapWriter struct {
+	w       io.Writer
+	packets *packetBuilder
+	mu      sync.Mutex
+
+	log log.Logger
+}
+
+// NewPcapWriter writes pcap file header to w and returns tap that writes captured messages as raw IP packets.
+func NewPcapWriter(w io.Writer, logger log.Logger) (*PcapWriter, error) {
+	pw := &PcapWriter{
+		w:       w,
+		packets: newPacketBuilder(),
+	}
+	pw.log = logger.
+		WithPrefix("capture.PcapWriter").
+		WithFields(log.Fields{
+			"pcap_writer_ptr": fmt.Sprintf("%p", pw),
+		})
+
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], snapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+
+	if _, err := w.Write(hdr); err != nil {
+		return nil, fmt.Errorf("write pcap header: %w", err)
+	}
+
+	return pw, nil
+}
+
+func (pw *PcapWriter) Log() log.Logger {
+	return pw.log
+}
+
+func (pw *PcapWriter) Capture(msg *transport.CapturedMessage) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pkt := pw.packets.build(msg)
+
+	rec := make([]byte, 16+len(pkt))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(msg.Time.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(msg.Time.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+	copy(rec[16:], pkt)
+
+	if _, err := pw.w.Write(rec); err != nil {
+		pw.Log().Errorf("write pcap record failed: %s", err)
+	}
+}
+
+// PcapNGWriter writes captured messages in the pcapng format.
+// Direction of each message is stored in the epb_flags option.
+type PcapNGWriter struct {
+	w       io.Writer
+	packets *packetBuilder
+	mu      sync.Mutex
+
+	log log.Logger
+}
+
+// NewPcapNGWriter writes pcapng section header and interface description blocks to w
+// and returns tap that writes captured messages as enhanced packet blocks.
+func NewPcapNGWriter(w io.Writer, logger log.Logger) (*PcapNGWriter, error) {
+	pw := &PcapNGWriter{
+		w:       w,
+		packets: newPacketBuilder(),
+	}
+	pw.log = logger.
+		WithPrefix("capture.PcapNGWriter").
+		WithFields(log.Fields{
+			"pcapng_writer_ptr": fmt.Sprintf("%p", pw),
+		})
+
+	// Section Header Block
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], 0x0a0d0d0a)
+	binary.LittleEndian.PutUint32(shb[4:], uint32(len(shb)))
+	binary.LittleEndian.PutUint32(shb[8:], 0x1a2b3c4d)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	// unknown section length
+	binary.LittleEndian.PutUint64(shb[16:], 0xffffffffffffffff)
+	binary.LittleEndian.PutUint32(shb[24:], uint32(len(shb)))
+
+	// Interface Description Block
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], 1)
+	binary.LittleEndian.PutUint32(idb[4:], uint32(len(idb)))
+	binary.LittleEndian.PutUint16(idb[8:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[12:], snapLen)
+	binary.LittleEndian.PutUint32(idb[16:], uint32(len(idb)))
+
+	if _, err := w.Write(append(shb, idb...)); err != nil {
+		return nil, fmt.Errorf("write pcapng header: %w", err)
+	}
+
+	return pw, nil
+}
+
+func (pw *PcapNGWriter) Log() log.Logger {
+	return pw.log
+}
+
+func (pw *PcapNGWriter) Capture(msg *transport.CapturedMessage) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pkt := pw.packets.build(msg)
+	padded := (len(pkt) + 3) &^ 3
+
+	// Enhanced Packet Block with epb_flags option and opt_endofopt
+	blockLen := 28 + padded + 8 + 4 + 4
+	epb := make([]byte, blockLen)
+	binary.LittleEndian.PutUint32(epb[0:], 6)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(blockLen))
+	binary.LittleEndian.PutUint32(epb[8:], 0)
+	ts := uint64(msg.Time.UnixNano() / 1000)
+	binary.LittleEndian.PutUint32(epb[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[20:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(epb[24:], uint32(len(pkt)))
+	copy(epb[28:], pkt)
+
+	opts := epb[28+padded:]
+	binary.LittleEndian.PutUint16(opts[0:], 2)
+	binary.LittleEndian.PutUint16(opts[2:], 4)
+	// direction: 01 - inbound, 10 - outbound
+	flags := uint32(1)
+	if msg.Direction == transport.CaptureOutbound {
+		flags = 2
+	}
+	binary.LittleEndian.PutUint32(opts[4:], flags)
+	binary.LittleEndian.PutUint32(epb[blockLen-4:], uint32(blockLen))
+
+	if _, err := pw.w.Write(epb); err != nil {
+		pw.Log().Errorf("write pcapng block failed: %s", err)
+	}
+}
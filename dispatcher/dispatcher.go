@@ -0,0 +1,504 @@
+// dispatcher package monitors health of peers and selects destinations for outbound requests.
+//
+// Destinations are grouped into named sets, e.g. a pool of media servers or a list of carriers.
+// Dispatcher periodically probes every destination with OPTIONS (or another method), marks it down
+// after a number of consecutive failed probes and up again after a number of successful ones.
+// Select picks one of the live destinations of a set with the algorithm of the set.
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+var (
+	// ErrUnknownSet is returned when there is no destination set with the given name.
+	ErrUnknownSet = errors.New("unknown destination set")
+	// ErrNoDestination is returned by Select when all destinations of the set are down or excluded.
+	ErrNoDestination = errors.New("no destination available")
+	// ErrNoCallID is returned by Select of CallIDHash set when the request has no Call-ID.
+	ErrNoCallID = errors.New("request has no Call-ID")
+)
+
+// State is the health state of a destination.
+type State int
+
+const (
+	// Destinations are up until probes prove otherwise.
+	StateUp State = iota
+	StateDown
+)
+
+func (state State) String() string {
+	switch state {
+	case StateUp:
+		return "Up"
+	case StateDown:
+		return "Down"
+	default:
+		return "Unknown"
+	}
+}
+
+// Algorithm selects a destination among the live destinations of a set.
+type Algorithm int
+
+const (
+	// RoundRobin cycles through destinations.
+	RoundRobin Algorithm = iota
+	// Weighted distributes requests proportionally to destination weights (smooth weighted round-robin).
+	Weighted
+	// CallIDHash sends requests with the same Call-ID to the same destination.
+	CallIDHash
+	// Priority uses destination with the lowest Priority value, others are used for failover.
+	Priority
+)
+
+func (alg Algorithm) String() string {
+	switch alg {
+	case RoundRobin:
+		return "RoundRobin"
+	case Weighted:
+		return "Weighted"
+	case CallIDHash:
+		return "CallIDHash"
+	case Priority:
+		return "Priority"
+	default:
+		return "Unknown"
+	}
+}
+
+// Destination is a peer of a destination set.
+type Destination struct {
+	Uri sip.Uri
+	// Weight is used by Weighted algorithm, non-positive weight is treated as 1.
+	Weight int
+	// Priority is used by Priority algorithm, lower value is preferred.
+	Priority int
+}
+
+func (d Destination) clone() Destination {
+	d.Uri = d.Uri.Clone()
+	return d
+}
+
+// Status is the health of a destination.
+type Status struct {
+	Destination
+	State State
+	// Checked is the time of the last probe, Err is the reason of the last failed probe.
+	Checked time.Time
+	Err     error
+}
+
+// StateChangeHandler is called when a destination of the set goes up or down.
+type StateChangeHandler func(set string, status Status)
+
+type destination struct {
+	Destination
+	state     State
+	successes int
+	failures  int
+	checked   time.Time
+	err       error
+	// current weight of smooth weighted round-robin
+	current int
+	timer   timing.Timer
+	removed bool
+}
+
+func (d *destination) status() Status {
+	return Status{
+		Destination: d.Destination.clone(),
+		State:       d.state,
+		Checked:     d.checked,
+		Err:         d.err,
+	}
+}
+
+func (d *destination) weight() int {
+	if d.Weight <= 0 {
+		return 1
+	}
+	return d.Weight
+}
+
+type destinationSet struct {
+	name         string
+	algorithm    Algorithm
+	destinations []*destination
+	next         int
+}
+
+// Must be called with the lock held.
+func (set *destinationSet) resetWeights() {
+	for _, dst := range set.destinations {
+		dst.current = 0
+	}
+}
+
+// Dispatcher keeps destination sets and health of their destinations.
+type Dispatcher struct {
+	sender gosip.Sender
+	opts   Options
+
+	mu       sync.Mutex
+	sets     map[string]*destinationSet
+	onChange StateChangeHandler
+	running  bool
+	// generation is incremented on every Start, probes of the previous runs are dropped
+	generation int
+
+	log log.Logger
+}
+
+// NewDispatcher creates dispatcher, probing starts with Start.
+func NewDispatcher(sender gosip.Sender, logger log.Logger, options ...Option) *Dispatcher {
+	d := &Dispatcher{
+		sender: sender,
+		sets:   make(map[string]*destinationSet),
+	}
+	for _, opt := range options {
+		opt.ApplyDispatcher(&d.opts)
+	}
+	if d.opts.Clock == nil {
+		d.opts.Clock = timing.NewRealClock()
+	}
+	if d.opts.Method == "" {
+		d.opts.Method = sip.OPTIONS
+	}
+	if d.opts.From == nil {
+		d.opts.From = &sip.Address{
+			Uri: &sip.SipUri{
+				FUser: sip.String{Str: "dispatcher"},
+				FHost: sip.DefaultHost,
+			},
+		}
+	}
+	if d.opts.Interval <= 0 {
+		d.opts.Interval = DefaultInterval
+	}
+	if d.opts.Timeout <= 0 {
+		d.opts.Timeout = DefaultTimeout
+	}
+	if d.opts.UpThreshold <= 0 {
+		d.opts.UpThreshold = DefaultUpThreshold
+	}
+	if d.opts.DownThreshold <= 0 {
+		d.opts.DownThreshold = DefaultDownThreshold
+	}
+	d.log = logger.
+		WithPrefix("dispatcher.Dispatcher").
+		WithFields(log.Fields{
+			"dispatcher_ptr": fmt.Sprintf("%p", d),
+		})
+
+	return d
+}
+
+func (d *Dispatcher) Log() log.Logger {
+	return d.log
+}
+
+// OnStateChange sets handler of destination state changes.
+func (d *Dispatcher) OnStateChange(handler StateChangeHandler) {
+	d.mu.Lock()
+	d.onChange = handler
+	d.mu.Unlock()
+}
+
+// AddSet adds destination set, it replaces the set with the same name.
+func (d *Dispatcher) AddSet(name string, algorithm Algorithm, destinations ...Destination) {
+	set := &destinationSet{
+		name:      name,
+		algorithm: algorithm,
+	}
+	for _, dst := range destinations {
+		set.destinations = append(set.destinations, &destination{Destination: dst.clone()})
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if old, ok := d.sets[name]; ok {
+		d.stopSet(old)
+	}
+	d.sets[name] = set
+	if d.running {
+		d.startSet(set)
+	}
+
+	d.Log().Debugf("destination set %s added with %d destinations", name, len(destinations))
+}
+
+// RemoveSet removes destination set and stops probing of its destinations.
+func (d *Dispatcher) RemoveSet(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if set, ok := d.sets[name]; ok {
+		d.stopSet(set)
+		delete(d.sets, name)
+	}
+}
+
+// Status returns health of all destinations of the set.
+func (d *Dispatcher) Status(name string) ([]Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	set, ok := d.sets[name]
+	if !ok {
+		return nil, ErrUnknownSet
+	}
+
+	statuses := make([]Status, 0, len(set.destinations))
+	for _, dst := range set.destinations {
+		statuses = append(statuses, dst.status())
+	}
+
+	return statuses, nil
+}
+
+// Start starts probing of all destinations, the first probe is sent immediately.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return
+	}
+	d.running = true
+	d.generation++
+	for _, set := range d.sets {
+		d.startSet(set)
+	}
+}
+
+// Stop stops probing, destinations keep their last state.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.running {
+		return
+	}
+	d.running = false
+	for _, set := range d.sets {
+		for _, dst := range set.destinations {
+			if dst.timer != nil {
+				dst.timer.Stop()
+				dst.timer = nil
+			}
+		}
+	}
+}
+
+// Select picks a live destination of the set for the request.
+// The request is used only by CallIDHash algorithm and may be nil for other ones.
+// Excluded destinations are skipped, that is used to fail over after the selected destination has failed.
+func (d *Dispatcher) Select(name string, req sip.Request, exclude ...sip.Uri) (Destination, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	set, ok := d.sets[name]
+	if !ok {
+		return Destination{}, ErrUnknownSet
+	}
+
+	candidates := make([]*destination, 0, len(set.destinations))
+	skipped := false
+	for _, dst := range set.destinations {
+		if dst.state != StateUp {
+			continue
+		}
+		if excluded(dst.Uri, exclude) {
+			skipped = true
+			continue
+		}
+		candidates = append(candidates, dst)
+	}
+	if len(candidates) == 0 {
+		return Destination{}, ErrNoDestination
+	}
+
+	var selected *destination
+	switch set.algorithm {
+	case Weighted:
+		// weights accumulated over another candidate list would skew the distribution
+		if skipped {
+			set.resetWeights()
+		}
+		total := 0
+		for _, dst := range candidates {
+			dst.current += dst.weight()
+			total += dst.weight()
+			if selected == nil || dst.current > selected.current {
+				selected = dst
+			}
+		}
+		selected.current -= total
+	case CallIDHash:
+		if req == nil {
+			return Destination{}, ErrNoCallID
+		}
+		callID, ok := req.CallID()
+		if !ok || callID.Value() == "" {
+			return Destination{}, ErrNoCallID
+		}
+		selected = candidates[crc32.ChecksumIEEE([]byte(callID.Value()))%uint32(len(candidates))]
+	case Priority:
+		for _, dst := range candidates {
+			if selected == nil || dst.Priority < selected.Priority {
+				selected = dst
+			}
+		}
+	default:
+		selected = candidates[set.next%len(candidates)]
+		set.next++
+	}
+
+	return selected.Destination.clone(), nil
+}
+
+// Must be called with the lock held.
+func (d *Dispatcher) startSet(set *destinationSet) {
+	for _, dst := range set.destinations {
+		d.scheduleProbe(set, dst, 0)
+	}
+}
+
+// Must be called with the lock held.
+func (d *Dispatcher) stopSet(set *destinationSet) {
+	for _, dst := range set.destinations {
+		dst.removed = true
+		if dst.timer != nil {
+			dst.timer.Stop()
+			dst.timer = nil
+		}
+	}
+}
+
+// Must be called with the lock held.
+func (d *Dispatcher) scheduleProbe(set *destinationSet, dst *destination, delay time.Duration) {
+	generation := d.generation
+	dst.timer = d.opts.Clock.AfterFunc(delay, func() {
+		d.probe(set, dst, generation)
+	})
+}
+
+func (d *Dispatcher) probe(set *destinationSet, dst *destination, generation int) {
+	d.mu.Lock()
+	if !d.active(dst, generation) {
+		d.mu.Unlock()
+		return
+	}
+	uri := dst.Uri.Clone()
+	d.mu.Unlock()
+
+	err := d.check(uri)
+
+	d.mu.Lock()
+	if !d.active(dst, generation) {
+		d.mu.Unlock()
+		return
+	}
+
+	logger := d.Log().WithFields(log.Fields{
+		"set":         set.name,
+		"destination": uri.String(),
+	})
+
+	prev := dst.state
+	dst.checked = d.opts.Clock.Now()
+	dst.err = err
+	if err == nil {
+		dst.successes++
+		dst.failures = 0
+		if dst.state == StateDown && dst.successes >= d.opts.UpThreshold {
+			dst.state = StateUp
+		}
+	} else {
+		logger.Debugf("probe failed: %s", err)
+
+		dst.failures++
+		dst.successes = 0
+		if dst.state == StateUp && dst.failures >= d.opts.DownThreshold {
+			dst.state = StateDown
+		}
+	}
+	d.scheduleProbe(set, dst, d.opts.Interval)
+
+	var status Status
+	onChange := d.onChange
+	changed := dst.state != prev
+	if changed {
+		set.resetWeights()
+		status = dst.status()
+	}
+	d.mu.Unlock()
+
+	if changed {
+		logger.Infof("destination is %s", status.State)
+
+		if onChange != nil {
+			onChange(set.name, status)
+		}
+	}
+}
+
+// Must be called with the lock held.
+func (d *Dispatcher) active(dst *destination, generation int) bool {
+	return d.running && d.generation == generation && !dst.removed
+}
+
+// Sends probing request, any final response except 2xx and configured reply codes is a failure.
+func (d *Dispatcher) check(uri sip.Uri) error {
+	req, err := d.newRequest(uri)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.opts.Timeout)
+	defer cancel()
+
+	_, err = d.sender.RequestWithContext(ctx, req, d.opts.RequestOptions...)
+	var reqErr *sip.RequestError
+	if errors.As(err, &reqErr) {
+		for _, code := range d.opts.ReplyCodes {
+			if uint(code) == reqErr.Code {
+				return nil
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Dispatcher) newRequest(uri sip.Uri) (sip.Request, error) {
+	req, err := sip.NewRequestBuilderTo(d.opts.Method, uri, d.opts.From).Build()
+	if err != nil {
+		return nil, fmt.Errorf("build %s: %w", d.opts.Method, err)
+	}
+
+	return req, nil
+}
+
+func excluded(uri sip.Uri, exclude []sip.Uri) bool {
+	for _, other := range exclude {
+		if uri.Equals(other) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package dispatcher_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/dispatcher"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+var logger = log.NewDefaultLogrusLogger()
+
+// fakeSender responds to probes with the status set per destination host, 200 OK by default.
+type fakeSender struct {
+	// methods that are not used by the tests panic
+	gosip.Sender
+
+	mu       sync.Mutex
+	statuses map[string]sip.StatusCode
+	methods  []sip.RequestMethod
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{statuses: make(map[string]sip.StatusCode)}
+}
+
+func (s *fakeSender) RequestWithContext(
+	ctx context.Context,
+	request sip.Request,
+	options ...gosip.RequestWithContextOption,
+) (sip.Response, error) {
+	s.mu.Lock()
+	status, ok := s.statuses[request.Recipient().Host()]
+	s.methods = append(s.methods, request.Method())
+	s.mu.Unlock()
+
+	if !ok {
+		status = 200
+	}
+	res := sip.NewResponseFromRequest("", request, status, "", "")
+	if status >= 300 {
+		return nil, sip.NewRequestError(uint(status), "", request, res)
+	}
+	return res, nil
+}
+
+func (s *fakeSender) setStatus(host string, status sip.StatusCode) {
+	s.mu.Lock()
+	s.statuses[host] = status
+	s.mu.Unlock()
+}
+
+func destination(host string) dispatcher.Destination {
+	return dispatcher.Destination{Uri: &sip.SipUri{FHost: host}}
+}
+
+func newRequest(t *testing.T) sip.Request {
+	uri := &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"}
+	req, err := sip.NewRequestBuilder().
+		SetMethod(sip.INVITE).
+		SetRecipient(uri).
+		AddVia(&sip.ViaHop{
+			Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		}).
+		SetFrom(&sip.Address{Uri: uri, Params: sip.NewParams().Add("tag", sip.String{Str: "1"})}).
+		SetTo(&sip.Address{Uri: uri, Params: sip.NewParams()}).
+		Build()
+	if err != nil {
+		t.Fatalf("failed to build request: %s", err)
+	}
+	return req
+}
+
+func selectHosts(t *testing.T, d *dispatcher.Dispatcher, set string, n int) []string {
+	hosts := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		dst, err := d.Select(set, nil)
+		if err != nil {
+			t.Fatalf("select failed: %s", err)
+		}
+		hosts = append(hosts, dst.Uri.Host())
+	}
+	return hosts
+}
+
+func TestHealth(t *testing.T) {
+	clock := timing.NewFakeClock(time.Now())
+	sender := newFakeSender()
+	d := dispatcher.NewDispatcher(sender, logger,
+		dispatcher.WithClock(clock),
+		dispatcher.WithInterval(10*time.Second, time.Second),
+		dispatcher.WithThresholds(2, 2),
+		dispatcher.WithReplyCodes(405),
+	)
+
+	changes := make(chan dispatcher.Status, 4)
+	d.OnStateChange(func(set string, status dispatcher.Status) {
+		if set != "media" {
+			t.Errorf("unexpected set %s", set)
+		}
+		changes <- status
+	})
+
+	d.AddSet("media", dispatcher.RoundRobin, destination("a"), destination("b"))
+	sender.setStatus("a", 405)
+	sender.setStatus("b", 503)
+
+	probe := func() {
+		clock.Advance(10 * time.Second)
+		clock.Settle()
+	}
+
+	d.Start()
+	defer d.Stop()
+	clock.Settle()
+	if len(changes) != 0 {
+		t.Fatalf("destination is down after a single failed probe")
+	}
+
+	probe()
+	status := <-changes
+	if status.Uri.Host() != "b" || status.State != dispatcher.StateDown || status.Err == nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if hosts := selectHosts(t, d, "media", 2); hosts[0] != "a" || hosts[1] != "a" {
+		t.Errorf("down destination is selected %v", hosts)
+	}
+
+	sender.setStatus("a", 503)
+	probe()
+	probe()
+	<-changes
+	if _, err := d.Select("media", nil); err != dispatcher.ErrNoDestination {
+		t.Errorf("expected ErrNoDestination, got %v", err)
+	}
+
+	sender.setStatus("b", 200)
+	probe()
+	probe()
+	if status := <-changes; status.Uri.Host() != "b" || status.State != dispatcher.StateUp || status.Err != nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	statuses, err := d.Status("media")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	if len(statuses) != 2 || statuses[0].State != dispatcher.StateDown || statuses[1].State != dispatcher.StateUp {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+
+	// no probes are sent after stop
+	d.Stop()
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Errorf("probes are scheduled after stop: %d", waiters)
+	}
+	sender.mu.Lock()
+	for _, method := range sender.methods {
+		if method != sip.OPTIONS {
+			t.Errorf("unexpected probe method %s", method)
+		}
+	}
+	sender.mu.Unlock()
+}
+
+func TestSelect(t *testing.T) {
+	d := dispatcher.NewDispatcher(newFakeSender(), logger)
+
+	d.AddSet("rr", dispatcher.RoundRobin, destination("a"), destination("b"), destination("c"))
+	if hosts := selectHosts(t, d, "rr", 4); hosts[0] != "a" || hosts[1] != "b" || hosts[2] != "c" || hosts[3] != "a" {
+		t.Errorf("unexpected round-robin order %v", hosts)
+	}
+
+	d.AddSet("weighted", dispatcher.Weighted,
+		dispatcher.Destination{Uri: &sip.SipUri{FHost: "a"}, Weight: 3},
+		dispatcher.Destination{Uri: &sip.SipUri{FHost: "b"}, Weight: 1},
+	)
+	counts := make(map[string]int)
+	for _, host := range selectHosts(t, d, "weighted", 8) {
+		counts[host]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("unexpected weighted distribution %v", counts)
+	}
+	// failover restarts the weighted round from scratch
+	heavy, _ := d.Select("weighted", nil)
+	if dst, _ := d.Select("weighted", nil, heavy.Uri); dst.Uri.Host() != "b" {
+		t.Errorf("unexpected failover destination %s", dst.Uri)
+	}
+	if hosts := selectHosts(t, d, "weighted", 4); strings.Join(hosts, "") != "aaba" {
+		t.Errorf("unexpected weighted order after failover %v", hosts)
+	}
+
+	d.AddSet("hash", dispatcher.CallIDHash, destination("a"), destination("b"), destination("c"))
+	req := newRequest(t)
+	first, err := d.Select("hash", req)
+	if err != nil {
+		t.Fatalf("select failed: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if dst, _ := d.Select("hash", req); !dst.Uri.Equals(first.Uri) {
+			t.Errorf("request with the same Call-ID is sent to %s instead of %s", dst.Uri, first.Uri)
+		}
+	}
+	if _, err := d.Select("hash", nil); err != dispatcher.ErrNoCallID {
+		t.Errorf("expected ErrNoCallID, got %v", err)
+	}
+
+	d.AddSet("failover", dispatcher.Priority,
+		dispatcher.Destination{Uri: &sip.SipUri{FHost: "backup"}, Priority: 2},
+		dispatcher.Destination{Uri: &sip.SipUri{FHost: "primary"}, Priority: 1},
+	)
+	primary, _ := d.Select("failover", nil)
+	if primary.Uri.Host() != "primary" {
+		t.Errorf("unexpected destination %s", primary.Uri)
+	}
+	if dst, _ := d.Select("failover", nil, primary.Uri); dst.Uri.Host() != "backup" {
+		t.Errorf("unexpected failover destination %s", dst.Uri)
+	}
+
+	if _, err := d.Select("unknown", nil); err != dispatcher.ErrUnknownSet {
+		t.Errorf("expected ErrUnknownSet, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+const (
+	DefaultInterval      = 30 * time.Second
+	DefaultTimeout       = 5 * time.Second
+	DefaultUpThreshold   = 1
+	DefaultDownThreshold = 3
+)
+
+// Option modifies Dispatcher.
+type Option interface {
+	ApplyDispatcher(opts *Options)
+}
+
+type Options struct {
+	Clock timing.Clock
+	// Method of the probing requests, default is OPTIONS.
+	Method sip.RequestMethod
+	// From address of the probing requests, default is sip:dispatcher@<sip.DefaultHost>.
+	From *sip.Address
+	// Interval between probes of a destination and timeout of a single probe.
+	Interval time.Duration
+	Timeout  time.Duration
+	// Number of consecutive successful probes to mark a destination up
+	// and number of consecutive failed probes to mark it down.
+	UpThreshold   int
+	DownThreshold int
+	// Response codes that count as successful probe in addition to 2xx.
+	ReplyCodes     []sip.StatusCode
+	RequestOptions []gosip.RequestWithContextOption
+}
+
+// WithClock sets clock that drives probing, default is the real clock.
+func WithClock(clock timing.Clock) Option {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock timing.Clock
+}
+
+func (o withClock) ApplyDispatcher(opts *Options) {
+	opts.Clock = o.clock
+}
+
+// WithMethod sets method of the probing requests.
+func WithMethod(method sip.RequestMethod) Option {
+	return withMethod{method}
+}
+
+type withMethod struct {
+	method sip.RequestMethod
+}
+
+func (o withMethod) ApplyDispatcher(opts *Options) {
+	opts.Method = o.method
+}
+
+// WithFrom sets From address of the probing requests.
+func WithFrom(from *sip.Address) Option {
+	return withFrom{from}
+}
+
+type withFrom struct {
+	from *sip.Address
+}
+
+func (o withFrom) ApplyDispatcher(opts *Options) {
+	opts.From = o.from
+}
+
+// WithInterval sets interval between probes and timeout of a single probe.
+func WithInterval(interval, timeout time.Duration) Option {
+	return withInterval{interval, timeout}
+}
+
+type withInterval struct {
+	interval, timeout time.Duration
+}
+
+func (o withInterval) ApplyDispatcher(opts *Options) {
+	opts.Interval = o.interval
+	opts.Timeout = o.timeout
+}
+
+// WithThresholds sets numbers of consecutive successful and failed probes
+// that change state of a destination.
+func WithThresholds(up, down int) Option {
+	return withThresholds{up, down}
+}
+
+type withThresholds struct {
+	up, down int
+}
+
+func (o withThresholds) ApplyDispatcher(opts *Options) {
+	opts.UpThreshold = o.up
+	opts.DownThreshold = o.down
+}
+
+// WithReplyCodes adds response codes that count as successful probe,
+// e.g. 404 or 405 from peers that do not implement the probing method.
+func WithReplyCodes(codes ...sip.StatusCode) Option {
+	return withReplyCodes{codes}
+}
+
+type withReplyCodes struct {
+	codes []sip.StatusCode
+}
+
+func (o withReplyCodes) ApplyDispatcher(opts *Options) {
+	opts.ReplyCodes = append(opts.ReplyCodes, o.codes...)
+}
+
+// WithRequestOptions passes options to gosip.Sender.RequestWithContext, e.g. gosip.WithAuthorizer.
+func WithRequestOptions(options ...gosip.RequestWithContextOption) Option {
+	return withRequestOptions{options}
+}
+
+type withRequestOptions struct {
+	options []gosip.RequestWithContextOption
+}
+
+func (o withRequestOptions) ApplyDispatcher(opts *Options) {
+	opts.RequestOptions = append(opts.RequestOptions, o.options...)
+}
@@ -0,0 +1,181 @@
+package messaging
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CPIMContentType is the media type of CPIM messages (RFC 3862).
+const CPIMContentType = "message/cpim"
+
+// CPIMHeader is a header of CPIM message or of the encapsulated content.
+type CPIMHeader struct {
+	// Name may be prefixed with the namespace declared by NS header, e.g. imdn.Message-ID.
+	Name  string
+	Value string
+}
+
+// CPIM is a message in Common Presence and Instant Messaging format (RFC 3862).
+type CPIM struct {
+	// Message headers in order, e.g. From, To, DateTime, NS, imdn.Message-ID.
+	Headers []CPIMHeader
+	// MIME headers of the encapsulated content, e.g. Content-Type.
+	ContentHeaders []CPIMHeader
+	Body           []byte
+}
+
+// NewCPIM creates CPIM message with the content of the given type.
+// DateTime header is set to the current time.
+func NewCPIM(from, to, contentType string, body []byte) *CPIM {
+	return newCPIM(from, to, contentType, body, time.Now())
+}
+
+func newCPIM(from, to, contentType string, body []byte, now time.Time) *CPIM {
+	msg := &CPIM{Body: body}
+	if from != "" {
+		msg.AddHeader("From", from)
+	}
+	if to != "" {
+		msg.AddHeader("To", to)
+	}
+	msg.AddHeader("DateTime", now.Format(time.RFC3339))
+	msg.ContentHeaders = append(msg.ContentHeaders, CPIMHeader{"Content-Type", contentType})
+
+	return msg
+}
+
+// Header returns value of the first message header with the given name.
+func (msg *CPIM) Header(name string) (string, bool) {
+	return findCPIMHeader(msg.Headers, name)
+}
+
+// AddHeader appends message header.
+func (msg *CPIM) AddHeader(name, value string) {
+	msg.Headers = append(msg.Headers, CPIMHeader{name, value})
+}
+
+// Namespace returns prefix declared for the namespace URN by NS header.
+func (msg *CPIM) Namespace(urn string) (string, bool) {
+	for _, hdr := range msg.Headers {
+		if !strings.EqualFold(hdr.Name, "NS") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(hdr.Value), "<", 2)
+		if len(parts) == 2 && strings.TrimSuffix(strings.TrimSpace(parts[1]), ">") == urn {
+			return strings.TrimSpace(parts[0]), true
+		}
+	}
+	return "", false
+}
+
+// AddNamespace declares the prefix of the namespace URN with NS header.
+func (msg *CPIM) AddNamespace(prefix, urn string) {
+	msg.AddHeader("NS", fmt.Sprintf("%s <%s>", prefix, urn))
+}
+
+// NSHeader returns value of the header from the namespace URN regardless of the prefix used by the sender.
+func (msg *CPIM) NSHeader(urn, name string) (string, bool) {
+	prefix, ok := msg.Namespace(urn)
+	if !ok {
+		return "", false
+	}
+	if prefix != "" {
+		name = prefix + "." + name
+	}
+	return msg.Header(name)
+}
+
+// ContentType returns media type of the encapsulated content.
+func (msg *CPIM) ContentType() string {
+	value, _ := findCPIMHeader(msg.ContentHeaders, "Content-Type")
+	return value
+}
+
+// ContentHeader returns value of the first MIME header of the encapsulated content with the given name.
+func (msg *CPIM) ContentHeader(name string) (string, bool) {
+	return findCPIMHeader(msg.ContentHeaders, name)
+}
+
+func (msg *CPIM) Marshal() []byte {
+	var buf bytes.Buffer
+	for _, hdr := range msg.Headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", hdr.Name, hdr.Value)
+	}
+	buf.WriteString("\r\n")
+	for _, hdr := range msg.ContentHeaders {
+		fmt.Fprintf(&buf, "%s: %s\r\n", hdr.Name, hdr.Value)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(msg.Body)
+
+	return buf.Bytes()
+}
+
+func (msg *CPIM) String() string {
+	return string(msg.Marshal())
+}
+
+// ParseCPIM parses CPIM message, both CRLF and LF line endings are accepted.
+func ParseCPIM(data []byte) (*CPIM, error) {
+	msg := &CPIM{}
+
+	rest := data
+	var err error
+	if msg.Headers, rest, err = parseCPIMHeaders(rest); err != nil {
+		return nil, fmt.Errorf("parse CPIM message headers: %w", err)
+	}
+	if msg.ContentHeaders, rest, err = parseCPIMHeaders(rest); err != nil {
+		return nil, fmt.Errorf("parse CPIM content headers: %w", err)
+	}
+	if len(msg.Headers) == 0 {
+		return nil, fmt.Errorf("parse CPIM message: no message headers")
+	}
+	msg.Body = rest
+
+	return msg, nil
+}
+
+// Parses header lines up to the empty line and returns the data after it.
+func parseCPIMHeaders(data []byte) ([]CPIMHeader, []byte, error) {
+	var headers []CPIMHeader
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			return headers, data, nil
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			// folded line
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(string(line))
+			continue
+		}
+
+		i := bytes.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("invalid header line %q", line)
+		}
+		headers = append(headers, CPIMHeader{
+			Name:  strings.TrimSpace(string(line[:i])),
+			Value: strings.TrimSpace(string(line[i+1:])),
+		})
+	}
+
+	return headers, nil, nil
+}
+
+func findCPIMHeader(headers []CPIMHeader, name string) (string, bool) {
+	for _, hdr := range headers {
+		if strings.EqualFold(hdr.Name, name) {
+			return hdr.Value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,146 @@
+package messaging
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// IMDNContentType is the media type of disposition notifications (RFC 5438).
+	IMDNContentType = "message/imdn+xml"
+	// IMDNNamespace is the CPIM namespace of IMDN headers.
+	IMDNNamespace = "urn:ietf:params:imdn"
+	imdnXMLNS     = "urn:ietf:params:xml:ns:imdn"
+)
+
+// Disposition is a type of the disposition notification.
+type Disposition string
+
+const (
+	PositiveDelivery Disposition = "positive-delivery"
+	NegativeDelivery Disposition = "negative-delivery"
+	Display          Disposition = "display"
+)
+
+// DispositionStatus is a status reported by the disposition notification.
+type DispositionStatus string
+
+const (
+	Delivered DispositionStatus = "delivered"
+	Failed    DispositionStatus = "failed"
+	Displayed DispositionStatus = "displayed"
+	Forbidden DispositionStatus = "forbidden"
+	Error     DispositionStatus = "error"
+)
+
+// IMDN is a disposition notification.
+type IMDN struct {
+	// MessageID is imdn.Message-ID of the message the notification is about.
+	MessageID            string
+	DateTime             time.Time
+	RecipientURI         string
+	OriginalRecipientURI string
+	// Delivery or display notification, positive and negative delivery are both reported as delivery.
+	Display bool
+	Status  DispositionStatus
+}
+
+type imdnStatus struct {
+	Value []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type imdnXML struct {
+	XMLName              xml.Name    `xml:"urn:ietf:params:xml:ns:imdn imdn"`
+	MessageID            string      `xml:"message-id"`
+	DateTime             string      `xml:"datetime"`
+	RecipientURI         string      `xml:"recipient-uri,omitempty"`
+	OriginalRecipientURI string      `xml:"original-recipient-uri,omitempty"`
+	Delivery             *imdnNotify `xml:"delivery-notification"`
+	Display              *imdnNotify `xml:"display-notification"`
+}
+
+type imdnNotify struct {
+	Status imdnStatus `xml:"status"`
+}
+
+func (n *IMDN) Marshal() ([]byte, error) {
+	doc := imdnXML{
+		MessageID:            n.MessageID,
+		DateTime:             n.DateTime.Format(time.RFC3339),
+		RecipientURI:         n.RecipientURI,
+		OriginalRecipientURI: n.OriginalRecipientURI,
+	}
+	notify := &imdnNotify{}
+	notify.Status.Value = append(notify.Status.Value, struct{ XMLName xml.Name }{
+		XMLName: xml.Name{Local: string(n.Status)},
+	})
+	if n.Display {
+		doc.Display = notify
+	} else {
+		doc.Delivery = notify
+	}
+
+	data, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseIMDN parses disposition notification document.
+func ParseIMDN(data []byte) (*IMDN, error) {
+	var doc imdnXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse IMDN: %w", err)
+	}
+
+	n := &IMDN{
+		MessageID:            strings.TrimSpace(doc.MessageID),
+		RecipientURI:         strings.TrimSpace(doc.RecipientURI),
+		OriginalRecipientURI: strings.TrimSpace(doc.OriginalRecipientURI),
+	}
+	if n.MessageID == "" {
+		return nil, fmt.Errorf("parse IMDN: missing message-id")
+	}
+	if doc.DateTime != "" {
+		var err error
+		if n.DateTime, err = time.Parse(time.RFC3339, strings.TrimSpace(doc.DateTime)); err != nil {
+			return nil, fmt.Errorf("parse IMDN datetime: %w", err)
+		}
+	}
+
+	notify := doc.Delivery
+	if doc.Display != nil {
+		n.Display = true
+		notify = doc.Display
+	}
+	if notify == nil || len(notify.Status.Value) == 0 {
+		return nil, fmt.Errorf("parse IMDN: missing notification status")
+	}
+	n.Status = DispositionStatus(notify.Status.Value[0].XMLName.Local)
+
+	return n, nil
+}
+
+// Parses imdn.Disposition-Notification header value.
+func parseDispositions(value string) []Disposition {
+	var dispositions []Disposition
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			dispositions = append(dispositions, Disposition(strings.ToLower(item)))
+		}
+	}
+	return dispositions
+}
+
+func formatDispositions(dispositions []Disposition) string {
+	items := make([]string, 0, len(dispositions))
+	for _, disposition := range dispositions {
+		items = append(items, string(disposition))
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,518 @@
+// messaging package implements pager-mode instant messaging with MESSAGE requests (RFC 3428),
+// CPIM message format (RFC 3862) and instant message disposition notifications (RFC 5438).
+//
+// Messenger sends messages, optionally wrapped into CPIM envelope that requests delivery and display notifications,
+// and processes incoming MESSAGE requests: CPIM envelopes are decoded, delivery notifications are sent automatically
+// and the received notifications are passed to the notification handler.
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// MaxUDPMessageSize is the size limit of MESSAGE requests sent over transports without congestion control (RFC 3428 s. 8).
+const MaxUDPMessageSize = 1300
+
+// ErrMessageTooLarge is returned by Messenger.Send when MESSAGE to be sent over UDP exceeds MaxUDPMessageSize
+// less the headroom set with WithUDPHeadroom.
+var ErrMessageTooLarge = errors.New("MESSAGE exceeds size limit of UDP")
+
+// Message is a sent or received instant message.
+type Message struct {
+	// Sender and recipient, taken from CPIM envelope of received messages if present.
+	From string
+	To   string
+	// ID is imdn.Message-ID, it is set only for messages in CPIM envelope.
+	ID       string
+	DateTime time.Time
+	// Notifications requested by the sender.
+	Notifications []Disposition
+	ContentType   string
+	Body          []byte
+	// CPIM envelope, nil if the message was sent without it.
+	CPIM    *CPIM
+	Request sip.Request
+}
+
+// Requests returns true if the sender has requested the disposition notification.
+func (msg *Message) Requests(disposition Disposition) bool {
+	for _, d := range msg.Notifications {
+		if d == disposition {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageHandler is called on every received message except disposition notifications.
+type MessageHandler func(msg *Message)
+
+// NotificationHandler is called on every received disposition notification.
+type NotificationHandler func(notification *IMDN, msg *Message)
+
+// MessengerOption modifies Messenger.
+type MessengerOption interface {
+	ApplyMessenger(opts *MessengerOptions)
+}
+
+type MessengerOptions struct {
+	Clock timing.Clock
+	// UDPHeadroom is reserved within MaxUDPMessageSize for headers that are added or rewritten
+	// after MESSAGE is built.
+	UDPHeadroom int
+}
+
+type withClock struct {
+	clock timing.Clock
+}
+
+func (o withClock) ApplyMessenger(opts *MessengerOptions) {
+	opts.Clock = o.clock
+}
+
+// WithClock sets clock that timestamps messages and notifications, default is the real clock.
+func WithClock(clock timing.Clock) MessengerOption {
+	return withClock{clock}
+}
+
+type withUDPHeadroom struct {
+	size int
+}
+
+func (o withUDPHeadroom) ApplyMessenger(opts *MessengerOptions) {
+	opts.UDPHeadroom = o.size
+}
+
+// WithUDPHeadroom reserves size bytes within MaxUDPMessageSize for headers that are added or rewritten
+// by gosip.Sender after MESSAGE is built: Via sent-by and rport, User-Agent, credentials on authentication challenge.
+// Default is 0, the built MESSAGE is checked against MaxUDPMessageSize as is.
+func WithUDPHeadroom(size int) MessengerOption {
+	return withUDPHeadroom{size}
+}
+
+// SendOption modifies MESSAGE sent by Messenger.
+type SendOption interface {
+	ApplySend(options *SendOptions)
+}
+
+type SendOptions struct {
+	// CPIM wraps the content into CPIM envelope.
+	CPIM bool
+	// Notifications requests disposition notifications, the content is wrapped into CPIM envelope.
+	Notifications []Disposition
+	// MessageID is imdn.Message-ID, it is generated if empty.
+	MessageID string
+	// Headers are appended to the MESSAGE request.
+	Headers        []sip.Header
+	RequestOptions []gosip.RequestWithContextOption
+}
+
+type withCPIM struct{}
+
+func (o withCPIM) ApplySend(options *SendOptions) {
+	options.CPIM = true
+}
+
+// WithCPIM wraps the content into CPIM envelope.
+func WithCPIM() SendOption {
+	return withCPIM{}
+}
+
+type withNotifications struct {
+	dispositions []Disposition
+}
+
+func (o withNotifications) ApplySend(options *SendOptions) {
+	options.CPIM = true
+	options.Notifications = append(options.Notifications, o.dispositions...)
+}
+
+// WithNotifications requests disposition notifications with imdn.Disposition-Notification CPIM header.
+func WithNotifications(dispositions ...Disposition) SendOption {
+	return withNotifications{dispositions}
+}
+
+type withMessageID struct {
+	id string
+}
+
+func (o withMessageID) ApplySend(options *SendOptions) {
+	options.MessageID = o.id
+}
+
+// WithMessageID sets imdn.Message-ID of the message in CPIM envelope.
+func WithMessageID(id string) SendOption {
+	return withMessageID{id}
+}
+
+type withHeaders struct {
+	headers []sip.Header
+}
+
+func (o withHeaders) ApplySend(options *SendOptions) {
+	options.Headers = append(options.Headers, o.headers...)
+}
+
+// WithHeaders appends headers to MESSAGE request.
+func WithHeaders(headers ...sip.Header) SendOption {
+	return withHeaders{headers}
+}
+
+type withRequestOptions struct {
+	options []gosip.RequestWithContextOption
+}
+
+func (o withRequestOptions) ApplySend(options *SendOptions) {
+	options.RequestOptions = append(options.RequestOptions, o.options...)
+}
+
+// WithRequestOptions passes options to gosip.Sender.RequestWithContext, e.g. gosip.WithAuthorizer.
+func WithRequestOptions(options ...gosip.RequestWithContextOption) SendOption {
+	return withRequestOptions{options}
+}
+
+// Messenger sends and receives instant messages on behalf of the local user.
+type Messenger struct {
+	sender gosip.Sender
+	from   *sip.Address
+	opts   MessengerOptions
+
+	mu                  sync.RWMutex
+	messageHandler      MessageHandler
+	notificationHandler NotificationHandler
+
+	log log.Logger
+}
+
+// NewMessenger creates messenger that sends messages from the given address.
+func NewMessenger(sender gosip.Sender, from *sip.Address, logger log.Logger, options ...MessengerOption) *Messenger {
+	m := &Messenger{
+		sender: sender,
+		from:   from.Clone(),
+	}
+	for _, opt := range options {
+		opt.ApplyMessenger(&m.opts)
+	}
+	if m.opts.Clock == nil {
+		m.opts.Clock = timing.NewRealClock()
+	}
+	m.log = logger.
+		WithPrefix("messaging.Messenger").
+		WithFields(log.Fields{
+			"messenger_ptr": fmt.Sprintf("%p", m),
+		})
+
+	return m
+}
+
+func (m *Messenger) Log() log.Logger {
+	return m.log
+}
+
+// OnMessage sets handler of received messages.
+func (m *Messenger) OnMessage(handler MessageHandler) {
+	m.mu.Lock()
+	m.messageHandler = handler
+	m.mu.Unlock()
+}
+
+// OnNotification sets handler of received disposition notifications.
+func (m *Messenger) OnNotification(handler NotificationHandler) {
+	m.mu.Lock()
+	m.notificationHandler = handler
+	m.mu.Unlock()
+}
+
+// Send sends MESSAGE with the content to the target.
+// MESSAGE larger than MaxUDPMessageSize less the headroom set with WithUDPHeadroom is not sent over UDP, ErrMessageTooLarge is returned instead.
+// Failure responses are returned as *sip.RequestError.
+func (m *Messenger) Send(
+	ctx context.Context,
+	target sip.Uri,
+	contentType string,
+	body []byte,
+	options ...SendOption,
+) (*Message, error) {
+	optionsHash := &SendOptions{}
+	for _, opt := range options {
+		opt.ApplySend(optionsHash)
+	}
+
+	msg := &Message{
+		From:          m.from.Uri.String(),
+		To:            target.String(),
+		DateTime:      m.opts.Clock.Now(),
+		Notifications: optionsHash.Notifications,
+		ContentType:   contentType,
+		Body:          body,
+	}
+	if optionsHash.CPIM {
+		msg.ID = optionsHash.MessageID
+		if msg.ID == "" {
+			msg.ID = util.RandString(16)
+		}
+		msg.CPIM = m.newEnvelope(m.from.String(), (&sip.Address{Uri: target}).String(), msg.ID, contentType, body)
+		if len(msg.Notifications) > 0 {
+			msg.CPIM.AddHeader("imdn.Disposition-Notification", formatDispositions(msg.Notifications))
+		}
+	}
+
+	req, err := m.newRequest(target, msg, optionsHash.Headers)
+	if err != nil {
+		return nil, err
+	}
+	msg.Request = req
+
+	logger := m.Log().WithFields(req.Fields())
+	logger.Debugf("sending MESSAGE to %s", target)
+
+	if _, err := m.sender.RequestWithContext(ctx, req, optionsHash.RequestOptions...); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// NotifyDisplayed sends display notification on the received message if the sender has requested it.
+func (m *Messenger) NotifyDisplayed(ctx context.Context, msg *Message) error {
+	if !msg.Requests(Display) {
+		return nil
+	}
+	return m.Notify(ctx, msg, &IMDN{
+		MessageID: msg.ID,
+		DateTime:  m.opts.Clock.Now(),
+		Display:   true,
+		Status:    Displayed,
+	})
+}
+
+// Notify sends the disposition notification on the received message to its sender.
+func (m *Messenger) Notify(ctx context.Context, msg *Message, notification *IMDN) error {
+	if msg.ID == "" {
+		return fmt.Errorf("message has no imdn.Message-ID")
+	}
+
+	target, err := replyTarget(msg)
+	if err != nil {
+		return err
+	}
+
+	if notification.RecipientURI == "" {
+		notification.RecipientURI = m.from.Uri.String()
+	}
+	if notification.DateTime.IsZero() {
+		notification.DateTime = m.opts.Clock.Now()
+	}
+	body, err := notification.Marshal()
+	if err != nil {
+		return fmt.Errorf("marshal IMDN: %w", err)
+	}
+
+	// notifications must not request notifications
+	envelope := m.newEnvelope(m.from.String(), (&sip.Address{Uri: target}).String(), util.RandString(16), IMDNContentType, body)
+	envelope.ContentHeaders = append(envelope.ContentHeaders, CPIMHeader{"Content-Disposition", "notification"})
+
+	req, err := m.newRequest(target, &Message{CPIM: envelope}, nil)
+	if err != nil {
+		return err
+	}
+
+	m.Log().WithFields(req.Fields()).Debugf("sending %s notification on message %s", notification.Status, msg.ID)
+
+	_, err = m.sender.RequestWithContext(ctx, req)
+	return err
+}
+
+func (m *Messenger) newRequest(target sip.Uri, msg *Message, headers []sip.Header) (sip.Request, error) {
+	contentType := sip.ContentType(msg.ContentType)
+	body := msg.Body
+	if msg.CPIM != nil {
+		contentType = CPIMContentType
+		body = msg.CPIM.Marshal()
+	}
+
+	builder := sip.NewRequestBuilderTo(sip.MESSAGE, target, m.from).
+		SetContentType(&contentType).
+		SetBody(string(body))
+	for _, header := range headers {
+		builder.AddHeader(header)
+	}
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("build MESSAGE: %w", err)
+	}
+
+	if strings.EqualFold(req.Transport(), "UDP") && len(req.String())+m.opts.UDPHeadroom > MaxUDPMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	return req, nil
+}
+
+// HandleRequest processes the incoming MESSAGE request and responds to it.
+// Delivery notifications requested by the sender are sent automatically once the message is passed to the handler.
+// It returns false if the request is not MESSAGE.
+func (m *Messenger) HandleRequest(req sip.Request, tx sip.ServerTransaction) bool {
+	if req.Method() != sip.MESSAGE {
+		return false
+	}
+
+	logger := m.Log().WithFields(req.Fields())
+
+	msg, err := decodeMessage(req, m.opts.Clock.Now())
+	if err != nil {
+		logger.Warnf("invalid MESSAGE: %s", err)
+
+		m.respond(req, 400, "Bad Request", logger)
+
+		return true
+	}
+
+	m.mu.RLock()
+	messageHandler, notificationHandler := m.messageHandler, m.notificationHandler
+	m.mu.RUnlock()
+
+	if msg.CPIM != nil && strings.EqualFold(mediaType(msg.ContentType), IMDNContentType) {
+		notification, err := ParseIMDN(msg.Body)
+		if err != nil {
+			logger.Warnf("invalid disposition notification: %s", err)
+
+			m.respond(req, 400, "Bad Request", logger)
+
+			return true
+		}
+
+		m.respond(req, 200, "OK", logger)
+
+		if notificationHandler != nil {
+			notificationHandler(notification, msg)
+		}
+
+		return true
+	}
+
+	if messageHandler == nil {
+		m.respond(req, 480, "Temporarily Unavailable", logger)
+		return true
+	}
+
+	m.respond(req, 200, "OK", logger)
+
+	messageHandler(msg)
+
+	if msg.Requests(PositiveDelivery) {
+		go func() {
+			if err := m.Notify(context.Background(), msg, &IMDN{MessageID: msg.ID, Status: Delivered}); err != nil {
+				logger.Warnf("send delivery notification failed: %s", err)
+			}
+		}()
+	}
+
+	return true
+}
+
+func (m *Messenger) respond(req sip.Request, status sip.StatusCode, reason string, logger log.Logger) {
+	if _, err := m.sender.RespondOnRequest(req, status, reason, "", nil); err != nil {
+		logger.Errorf("respond '%d %s' failed: %s", status, reason, err)
+	}
+}
+
+func (m *Messenger) newEnvelope(from, to, id, contentType string, body []byte) *CPIM {
+	envelope := newCPIM(from, to, contentType, body, m.opts.Clock.Now())
+	envelope.AddNamespace("imdn", IMDNNamespace)
+	envelope.AddHeader("imdn.Message-ID", id)
+	return envelope
+}
+
+// Received messages without CPIM DateTime are timestamped with now.
+func decodeMessage(req sip.Request, now time.Time) (*Message, error) {
+	msg := &Message{
+		Body:     []byte(req.Body()),
+		DateTime: now,
+		Request:  req,
+	}
+	if from, ok := req.From(); ok {
+		msg.From = from.Address.String()
+	}
+	if to, ok := req.To(); ok {
+		msg.To = to.Address.String()
+	}
+	if hdr, ok := req.ContentType(); ok {
+		msg.ContentType = hdr.Value()
+	}
+
+	if !strings.EqualFold(mediaType(msg.ContentType), CPIMContentType) {
+		return msg, nil
+	}
+
+	envelope, err := ParseCPIM(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	msg.CPIM = envelope
+	msg.ContentType = envelope.ContentType()
+	msg.Body = envelope.Body
+	if from, ok := envelope.Header("From"); ok {
+		msg.From = from
+	}
+	if to, ok := envelope.Header("To"); ok {
+		msg.To = to
+	}
+	if value, ok := envelope.Header("DateTime"); ok {
+		if dateTime, err := time.Parse(time.RFC3339, value); err == nil {
+			msg.DateTime = dateTime
+		}
+	}
+	msg.ID, _ = envelope.NSHeader(IMDNNamespace, "Message-ID")
+	if value, ok := envelope.NSHeader(IMDNNamespace, "Disposition-Notification"); ok {
+		msg.Notifications = parseDispositions(value)
+	}
+
+	return msg, nil
+}
+
+// Notifications are sent to the SIP URI of the sender, CPIM From is used when it is SIP URI too.
+func replyTarget(msg *Message) (sip.Uri, error) {
+	if msg.CPIM != nil {
+		if from, ok := msg.CPIM.Header("From"); ok {
+			if uri, err := parseAddressUri(from); err == nil {
+				return uri, nil
+			}
+		}
+	}
+	if msg.Request != nil {
+		if from, ok := msg.Request.From(); ok {
+			return from.Address.Clone(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown sender of the message")
+}
+
+func mediaType(contentType string) string {
+	return strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+}
+
+// Parses SIP URI from the name-addr of CPIM From header, im: and other URIs are not routable by SIP.
+func parseAddressUri(value string) (sip.Uri, error) {
+	_, uri, _, err := parser.ParseAddressValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := uri.(*sip.SipUri); !ok {
+		return nil, fmt.Errorf("%s is not SIP URI", uri)
+	}
+	return uri, nil
+}
@@ -0,0 +1,271 @@
+package messaging_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/messaging"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+var logger = log.NewDefaultLogrusLogger()
+
+// fakeSender accepts all sent requests with 200 OK and records responses.
+type fakeSender struct {
+	// methods that are not used by the tests panic
+	gosip.Sender
+
+	mu        sync.Mutex
+	responses []sip.StatusCode
+	sent      chan sip.Request
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{sent: make(chan sip.Request, 8)}
+}
+
+func (s *fakeSender) RequestWithContext(
+	ctx context.Context,
+	request sip.Request,
+	options ...gosip.RequestWithContextOption,
+) (sip.Response, error) {
+	s.sent <- request
+	return sip.NewResponseFromRequest("", request, 200, "OK", ""), nil
+}
+
+func (s *fakeSender) RespondOnRequest(
+	request sip.Request,
+	status sip.StatusCode,
+	reason, body string,
+	headers []sip.Header,
+) (sip.ServerTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, status)
+	return nil, nil
+}
+
+func (s *fakeSender) lastResponse(t *testing.T) sip.StatusCode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.responses) == 0 {
+		t.Fatalf("no responses sent")
+	}
+	return s.responses[len(s.responses)-1]
+}
+
+func (s *fakeSender) nextRequest(t *testing.T) sip.Request {
+	select {
+	case req := <-s.sent:
+		// deliver the request to the other side as it would be received from network
+		msg, err := parser.ParseMessage([]byte(req.String()), logger)
+		if err != nil {
+			t.Fatalf("failed to parse message: %s\n%s", err, req)
+		}
+		return msg.(sip.Request)
+	case <-time.After(time.Second):
+		t.Fatalf("no requests sent")
+		return nil
+	}
+}
+
+func address(user string) *sip.Address {
+	return &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: user}, FHost: "example.com"}}
+}
+
+func TestCPIM(t *testing.T) {
+	data := strings.Join([]string{
+		"From: MR SANDERS <im:piglet@100akerwood.com>",
+		"To: Depressed Donkey <im:eeyore@100akerwood.com>",
+		"DateTime: 2000-12-13T13:40:00-08:00",
+		"Subject: the weather",
+		"  will be fine today",
+		"NS: MyFeatures <mid:MessageFeatures@id.foo.com>",
+		"NS: im <urn:ietf:params:imdn>",
+		"im.Message-ID: 34jk324j",
+		"",
+		"Content-Type: text/plain",
+		"Content-ID: <1234567890@foo.com>",
+		"",
+		"Here is the text of my message.",
+	}, "\r\n")
+
+	msg, err := messaging.ParseCPIM([]byte(data))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	if subject, _ := msg.Header("Subject"); subject != "the weather will be fine today" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if id, ok := msg.NSHeader(messaging.IMDNNamespace, "Message-ID"); !ok || id != "34jk324j" {
+		t.Errorf("unexpected imdn.Message-ID %q", id)
+	}
+	if msg.ContentType() != "text/plain" || string(msg.Body) != "Here is the text of my message." {
+		t.Errorf("unexpected content %s: %q", msg.ContentType(), msg.Body)
+	}
+
+	reparsed, err := messaging.ParseCPIM(msg.Marshal())
+	if err != nil {
+		t.Fatalf("parse of marshalled message failed: %s", err)
+	}
+	if len(reparsed.Headers) != len(msg.Headers) || string(reparsed.Body) != string(msg.Body) {
+		t.Errorf("unexpected marshalled message:\n%s", msg)
+	}
+
+	if _, err := messaging.ParseCPIM([]byte("no header line\r\n\r\n")); err == nil {
+		t.Errorf("invalid CPIM is parsed")
+	}
+}
+
+func TestIMDN(t *testing.T) {
+	dateTime := time.Date(2008, 4, 4, 12, 16, 49, 0, time.UTC)
+	data, err := (&messaging.IMDN{
+		MessageID:    "34jk324j",
+		DateTime:     dateTime,
+		RecipientURI: "sip:bob@example.com",
+		Display:      true,
+		Status:       messaging.Displayed,
+	}).Marshal()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	if !strings.Contains(string(data), `<imdn xmlns="urn:ietf:params:xml:ns:imdn">`) ||
+		!strings.Contains(string(data), "<display-notification><status><displayed></displayed></status>") {
+		t.Errorf("unexpected IMDN document:\n%s", data)
+	}
+
+	n, err := messaging.ParseIMDN(data)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	if n.MessageID != "34jk324j" || !n.DateTime.Equal(dateTime) || !n.Display || n.Status != messaging.Displayed {
+		t.Errorf("unexpected notification %+v", n)
+	}
+
+	if _, err := messaging.ParseIMDN([]byte(`<imdn xmlns="urn:ietf:params:xml:ns:imdn"><message-id>x</message-id></imdn>`)); err == nil {
+		t.Errorf("notification without status is parsed")
+	}
+}
+
+func TestSendTooLarge(t *testing.T) {
+	messenger := messaging.NewMessenger(newFakeSender(), address("alice"), logger)
+
+	body := []byte(strings.Repeat("x", 800))
+	if _, err := messenger.Send(context.Background(), address("bob").Uri, "text/plain", body); err != nil {
+		t.Errorf("MESSAGE within the limit is not sent: %s", err)
+	}
+
+	// headers added by the sender do not fit into the limit
+	reserved := messaging.NewMessenger(newFakeSender(), address("alice"), logger, messaging.WithUDPHeadroom(300))
+	if _, err := reserved.Send(context.Background(), address("bob").Uri, "text/plain", body); err != messaging.ErrMessageTooLarge {
+		t.Errorf("expected ErrMessageTooLarge, got %v", err)
+	}
+
+	body = []byte(strings.Repeat("x", messaging.MaxUDPMessageSize))
+	if _, err := messenger.Send(context.Background(), address("bob").Uri, "text/plain", body); err != messaging.ErrMessageTooLarge {
+		t.Errorf("expected ErrMessageTooLarge, got %v", err)
+	}
+
+	target := address("bob").Uri.Clone()
+	target.SetUriParams(sip.NewParams().Add("transport", sip.String{Str: "tcp"}))
+	if _, err := messenger.Send(context.Background(), target, "text/plain", body); err != nil {
+		t.Errorf("large MESSAGE is not sent over TCP: %s", err)
+	}
+}
+
+func TestSendTimestamp(t *testing.T) {
+	clock := timing.NewFakeClock(time.Date(2000, 12, 13, 13, 40, 0, 0, time.UTC))
+	messenger := messaging.NewMessenger(newFakeSender(), address("alice"), logger, messaging.WithClock(clock))
+
+	msg, err := messenger.Send(context.Background(), address("bob").Uri, "text/plain", []byte("Hello"), messaging.WithCPIM())
+	if err != nil {
+		t.Fatalf("send failed: %s", err)
+	}
+	if !msg.DateTime.Equal(clock.Now()) {
+		t.Errorf("unexpected message time %s", msg.DateTime)
+	}
+	if dateTime, _ := msg.CPIM.Header("DateTime"); dateTime != "2000-12-13T13:40:00Z" {
+		t.Errorf("unexpected CPIM DateTime %s", dateTime)
+	}
+}
+
+func TestDeliveryNotification(t *testing.T) {
+	aliceSender, bobSender := newFakeSender(), newFakeSender()
+	alice := messaging.NewMessenger(aliceSender, address("alice"), logger)
+	bob := messaging.NewMessenger(bobSender, address("bob"), logger)
+
+	received := make(chan *messaging.Message, 1)
+	bob.OnMessage(func(msg *messaging.Message) {
+		received <- msg
+	})
+	notifications := make(chan *messaging.IMDN, 2)
+	alice.OnNotification(func(notification *messaging.IMDN, msg *messaging.Message) {
+		notifications <- notification
+	})
+
+	sent, err := alice.Send(context.Background(), address("bob").Uri, "text/plain", []byte("Hello"),
+		messaging.WithNotifications(messaging.PositiveDelivery, messaging.Display))
+	if err != nil {
+		t.Fatalf("send failed: %s", err)
+	}
+
+	req := aliceSender.nextRequest(t)
+	if hdr, _ := req.ContentType(); hdr.Value() != messaging.CPIMContentType {
+		t.Errorf("message is not wrapped into CPIM:\n%s", req)
+	}
+	if !bob.HandleRequest(req, nil) {
+		t.Fatalf("MESSAGE not handled")
+	}
+	if status := bobSender.lastResponse(t); status != 200 {
+		t.Errorf("expected 200 response, got %d", status)
+	}
+
+	msg := <-received
+	if msg.ID != sent.ID || string(msg.Body) != "Hello" || msg.ContentType != "text/plain" || !msg.Requests(messaging.Display) {
+		t.Errorf("unexpected received message %+v", msg)
+	}
+
+	// delivery notification is sent automatically
+	notify := bobSender.nextRequest(t)
+	if !alice.HandleRequest(notify, nil) {
+		t.Fatalf("notification not handled")
+	}
+	if n := <-notifications; n.MessageID != sent.ID || n.Display || n.Status != messaging.Delivered {
+		t.Errorf("unexpected delivery notification %+v", n)
+	}
+
+	if err := bob.NotifyDisplayed(context.Background(), msg); err != nil {
+		t.Fatalf("display notification failed: %s", err)
+	}
+	if !alice.HandleRequest(bobSender.nextRequest(t), nil) {
+		t.Fatalf("notification not handled")
+	}
+	if n := <-notifications; !n.Display || n.Status != messaging.Displayed {
+		t.Errorf("unexpected display notification %+v", n)
+	}
+}
+
+func TestHandleRequestWithoutHandler(t *testing.T) {
+	aliceSender, bobSender := newFakeSender(), newFakeSender()
+	alice := messaging.NewMessenger(aliceSender, address("alice"), logger)
+	bob := messaging.NewMessenger(bobSender, address("bob"), logger)
+
+	if _, err := alice.Send(context.Background(), address("bob").Uri, "text/plain", []byte("Hello")); err != nil {
+		t.Fatalf("send failed: %s", err)
+	}
+	if !bob.HandleRequest(aliceSender.nextRequest(t), nil) {
+		t.Fatalf("MESSAGE not handled")
+	}
+	if status := bobSender.lastResponse(t); status != 480 {
+		t.Errorf("expected 480 response, got %d", status)
+	}
+}
@@ -1,6 +1,9 @@
 package gosip
 
-import "github.com/ghettovoice/gosip/sip"
+import (
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/transaction"
+)
 
 type RequestWithContextOption interface {
 	ApplyRequestWithContext(options *RequestWithContextOptions)
@@ -9,6 +12,8 @@ type RequestWithContextOption interface {
 type RequestWithContextOptions struct {
 	ResponseHandler func(res sip.Response, request sip.Request)
 	Authorizer      sip.Authorizer
+	// TransactionOptions are passed to the client transaction of the request.
+	TransactionOptions []transaction.TxOption
 }
 
 type withResponseHandler struct {
@@ -34,3 +39,17 @@ func (o withAuthorizer) ApplyRequestWithContext(options *RequestWithContextOptio
 func WithAuthorizer(authorizer sip.Authorizer) RequestWithContextOption {
 	return withAuthorizer{authorizer}
 }
+
+type withTransactionTimings struct {
+	timings transaction.Timings
+}
+
+func (o withTransactionTimings) ApplyRequestWithContext(options *RequestWithContextOptions) {
+	options.TransactionOptions = append(options.TransactionOptions, transaction.WithTimings(o.timings))
+}
+
+// WithTransactionTimings overrides timers of the client transaction of the single request,
+// non-zero timers replace ServerConfig.TxTimings, others are kept.
+func WithTransactionTimings(timings transaction.Timings) RequestWithContextOption {
+	return withTransactionTimings{timings}
+}
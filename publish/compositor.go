@@ -0,0 +1,311 @@
+package publish
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/util"
+)
+
+const (
+	DefaultExpires    = time.Hour
+	DefaultMinExpires = time.Minute
+	DefaultMaxExpires = 24 * time.Hour
+)
+
+// State is the event state published by a single publication.
+type State struct {
+	Resource    string
+	Event       string
+	ETag        string
+	ContentType string
+	Body        []byte
+	// Published is the time of the initial publication, Expires is the time the publication expires.
+	Published time.Time
+	Expires   time.Time
+}
+
+// ChangeHandler is called when the composite state of the resource is changed,
+// states are all the current publications of the event package for the resource.
+type ChangeHandler func(resource, event string, states []State)
+
+type publication struct {
+	state State
+	timer timing.Timer
+}
+
+// Compositor stores event state published with PUBLISH requests.
+type Compositor struct {
+	sender gosip.Sender
+	opts   CompositorOptions
+
+	mu sync.Mutex
+	// publications by resource and event package key, then by entity tag
+	publications map[string]map[string]*publication
+	onChange     ChangeHandler
+
+	log log.Logger
+}
+
+func NewCompositor(sender gosip.Sender, logger log.Logger, options ...CompositorOption) *Compositor {
+	c := &Compositor{
+		sender:       sender,
+		publications: make(map[string]map[string]*publication),
+	}
+	for _, opt := range options {
+		opt.ApplyCompositor(&c.opts)
+	}
+	if c.opts.Clock == nil {
+		c.opts.Clock = timing.NewRealClock()
+	}
+	if c.opts.DefaultExpires <= 0 {
+		c.opts.DefaultExpires = DefaultExpires
+	}
+	if c.opts.MinExpires <= 0 {
+		c.opts.MinExpires = DefaultMinExpires
+	}
+	if c.opts.MaxExpires <= 0 {
+		c.opts.MaxExpires = DefaultMaxExpires
+	}
+	c.log = logger.
+		WithPrefix("publish.Compositor").
+		WithFields(log.Fields{
+			"compositor_ptr": fmt.Sprintf("%p", c),
+		})
+
+	return c
+}
+
+func (c *Compositor) Log() log.Logger {
+	return c.log
+}
+
+// OnChange sets handler of composite state changes.
+func (c *Compositor) OnChange(handler ChangeHandler) {
+	c.mu.Lock()
+	c.onChange = handler
+	c.mu.Unlock()
+}
+
+// State returns the composite state of the resource: all the current publications of the event package
+// in the order of the initial publication.
+func (c *Compositor) State(resource sip.Uri, event string) []State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.states(stateKey(resourceKey(resource), event))
+}
+
+// HandleRequest processes PUBLISH request and responds to it (RFC 3903 s. 6).
+// It returns false if the request is not PUBLISH.
+func (c *Compositor) HandleRequest(req sip.Request, tx sip.ServerTransaction) bool {
+	if req.Method() != sip.PUBLISH {
+		return false
+	}
+
+	logger := c.Log().WithFields(req.Fields())
+
+	event, ok := eventHeader(req)
+	if !ok || !c.supports(event.EventType) {
+		c.respond(req, 489, "Bad Event", logger)
+		return true
+	}
+
+	expires := c.opts.DefaultExpires
+	if _, ok := headerValue(req, "Expires"); ok {
+		if expires, ok = expiresHeader(req, "Expires"); !ok {
+			c.respond(req, 400, "Bad Request", logger)
+			return true
+		}
+	}
+	if expires > 0 && expires < c.opts.MinExpires {
+		minExpires := sip.GenericHeader{
+			HeaderName: "Min-Expires",
+			Contents:   fmt.Sprintf("%d", c.opts.MinExpires/time.Second),
+		}
+		c.respond(req, 423, "Interval Too Brief", logger, &minExpires)
+		return true
+	}
+	if expires > c.opts.MaxExpires {
+		expires = c.opts.MaxExpires
+	}
+
+	resource := resourceKey(req.Recipient())
+	key := stateKey(resource, event.EventType)
+	etag, conditional := headerValue(req, "SIP-If-Match")
+	hasBody := len(req.Body()) > 0
+
+	c.mu.Lock()
+
+	var pub *publication
+	if conditional {
+		if pub, ok = c.publications[key][etag]; !ok {
+			c.mu.Unlock()
+			c.respond(req, 412, "Conditional Request Failed", logger)
+			return true
+		}
+		c.remove(key, etag)
+	} else if !hasBody || expires == 0 {
+		c.mu.Unlock()
+		c.respond(req, 400, "Bad Request", logger)
+		return true
+	}
+
+	if expires == 0 {
+		logger.Debugf("publication %s removed", etag)
+
+		states, onChange := c.states(key), c.onChange
+		c.mu.Unlock()
+
+		c.respond(req, 200, "OK", logger, expiresHdr(0))
+		if onChange != nil {
+			onChange(resource, event.EventType, states)
+		}
+
+		return true
+	}
+
+	now := c.opts.Clock.Now()
+	state := State{
+		Resource:  resource,
+		Event:     event.EventType,
+		Published: now,
+	}
+	if pub != nil {
+		state = pub.state
+	}
+	// new entity tag on every successful publication
+	state.ETag = util.RandString(16)
+	state.Expires = now.Add(expires)
+	changed := pub == nil || hasBody
+	if hasBody {
+		state.Body = []byte(req.Body())
+		state.ContentType = ""
+		if hdr, ok := req.ContentType(); ok {
+			state.ContentType = hdr.Value()
+		}
+	}
+	c.add(key, state, expires)
+
+	states, onChange := c.states(key), c.onChange
+	c.mu.Unlock()
+
+	logger.Debugf("publication %s stored until %s", state.ETag, state.Expires)
+
+	c.respond(req, 200, "OK", logger,
+		&sip.GenericHeader{HeaderName: "SIP-ETag", Contents: state.ETag},
+		expiresHdr(expires),
+	)
+	if changed && onChange != nil {
+		onChange(resource, event.EventType, states)
+	}
+
+	return true
+}
+
+func (c *Compositor) supports(event string) bool {
+	if len(c.opts.Events) == 0 {
+		return true
+	}
+	for _, supported := range c.opts.Events {
+		if strings.EqualFold(supported, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Must be called with the lock held.
+func (c *Compositor) add(key string, state State, expires time.Duration) {
+	pubs, ok := c.publications[key]
+	if !ok {
+		pubs = make(map[string]*publication)
+		c.publications[key] = pubs
+	}
+
+	etag := state.ETag
+	pub := &publication{state: state}
+	pub.timer = c.opts.Clock.AfterFunc(expires, func() {
+		c.mu.Lock()
+		if current, ok := c.publications[key][etag]; !ok || current != pub {
+			c.mu.Unlock()
+			return
+		}
+		c.remove(key, etag)
+		states, onChange := c.states(key), c.onChange
+		c.mu.Unlock()
+
+		c.Log().Debugf("publication %s of %s expired", etag, key)
+
+		if onChange != nil {
+			onChange(state.Resource, state.Event, states)
+		}
+	})
+	pubs[etag] = pub
+}
+
+// Must be called with the lock held.
+func (c *Compositor) remove(key, etag string) {
+	pubs := c.publications[key]
+	if pub, ok := pubs[etag]; ok {
+		pub.timer.Stop()
+		delete(pubs, etag)
+	}
+	if len(pubs) == 0 {
+		delete(c.publications, key)
+	}
+}
+
+// Must be called with the lock held.
+func (c *Compositor) states(key string) []State {
+	pubs := c.publications[key]
+	states := make([]State, 0, len(pubs))
+	for _, pub := range pubs {
+		states = append(states, pub.state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Published.Before(states[j].Published)
+	})
+
+	return states
+}
+
+func (c *Compositor) respond(req sip.Request, status sip.StatusCode, reason string, logger log.Logger, headers ...sip.Header) {
+	if _, err := c.sender.RespondOnRequest(req, status, reason, "", headers); err != nil {
+		logger.Errorf("respond '%d %s' failed: %s", status, reason, err)
+	}
+}
+
+// Resource is identified by user and host of the Request-URI.
+func resourceKey(uri sip.Uri) string {
+	var user string
+	if uri.User() != nil {
+		user = uri.User().String()
+	}
+	return fmt.Sprintf("%s@%s", user, strings.ToLower(uri.Host()))
+}
+
+func stateKey(resource, event string) string {
+	return resource + "|" + strings.ToLower(event)
+}
+
+func expiresHdr(expires time.Duration) sip.Header {
+	hdr := sip.Expires(expires / time.Second)
+	return &hdr
+}
+
+func eventHeader(msg sip.Message) (*sip.EventHeader, bool) {
+	hdrs := msg.GetHeaders("Event")
+	if len(hdrs) == 0 {
+		return nil, false
+	}
+	event, ok := hdrs[0].(*sip.EventHeader)
+	return event, ok && event.EventType != ""
+}
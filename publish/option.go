@@ -0,0 +1,96 @@
+package publish
+
+import (
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// PublisherOption modifies Publisher.
+type PublisherOption interface {
+	ApplyPublisher(opts *PublisherOptions)
+}
+
+type PublisherOptions struct {
+	Clock          timing.Clock
+	RequestOptions []gosip.RequestWithContextOption
+}
+
+// CompositorOption modifies Compositor.
+type CompositorOption interface {
+	ApplyCompositor(opts *CompositorOptions)
+}
+
+type CompositorOptions struct {
+	Clock timing.Clock
+	// Event packages accepted by the compositor, all packages are accepted if empty.
+	Events []string
+	// Expiration intervals, defaults are DefaultExpires, DefaultMinExpires and DefaultMaxExpires.
+	DefaultExpires time.Duration
+	MinExpires     time.Duration
+	MaxExpires     time.Duration
+}
+
+// WithClock sets clock that drives publication refresh and expiry, default is the real clock.
+func WithClock(clock timing.Clock) interface {
+	PublisherOption
+	CompositorOption
+} {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock timing.Clock
+}
+
+func (o withClock) ApplyPublisher(opts *PublisherOptions) {
+	opts.Clock = o.clock
+}
+
+func (o withClock) ApplyCompositor(opts *CompositorOptions) {
+	opts.Clock = o.clock
+}
+
+// WithRequestOptions passes options to gosip.Sender.RequestWithContext, e.g. gosip.WithAuthorizer.
+func WithRequestOptions(options ...gosip.RequestWithContextOption) PublisherOption {
+	return withRequestOptions{options}
+}
+
+type withRequestOptions struct {
+	options []gosip.RequestWithContextOption
+}
+
+func (o withRequestOptions) ApplyPublisher(opts *PublisherOptions) {
+	opts.RequestOptions = append(opts.RequestOptions, o.options...)
+}
+
+// WithEvents limits event packages accepted by Compositor, PUBLISH of other packages is rejected with 489.
+func WithEvents(events ...string) CompositorOption {
+	return withEvents{events}
+}
+
+type withEvents struct {
+	events []string
+}
+
+func (o withEvents) ApplyCompositor(opts *CompositorOptions) {
+	opts.Events = append(opts.Events, o.events...)
+}
+
+// WithExpires sets expiration intervals of Compositor:
+// the default one is used when PUBLISH has no Expires header,
+// shorter intervals are rejected with 423, longer ones are reduced to max.
+func WithExpires(def, min, max time.Duration) CompositorOption {
+	return withExpires{def, min, max}
+}
+
+type withExpires struct {
+	def, min, max time.Duration
+}
+
+func (o withExpires) ApplyCompositor(opts *CompositorOptions) {
+	opts.DefaultExpires = o.def
+	opts.MinExpires = o.min
+	opts.MaxExpires = o.max
+}
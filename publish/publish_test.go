@@ -0,0 +1,275 @@
+package publish_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/publish"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+var logger = log.NewDefaultLogrusLogger()
+
+// loopback delivers PUBLISH requests to the compositor and returns its responses.
+type loopback struct {
+	// methods that are not used by the tests panic
+	gosip.Sender
+
+	mu         sync.Mutex
+	compositor *publish.Compositor
+	response   sip.Response
+	// requests are passed here and wait for cancellation if set
+	blocked chan sip.Request
+}
+
+func (l *loopback) RequestWithContext(
+	ctx context.Context,
+	request sip.Request,
+	options ...gosip.RequestWithContextOption,
+) (sip.Response, error) {
+	l.mu.Lock()
+	blocked := l.blocked
+	l.mu.Unlock()
+	if blocked != nil {
+		blocked <- request
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	msg, err := parser.ParseMessage([]byte(request.String()), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	compositor := l.compositor
+	l.mu.Unlock()
+
+	if !compositor.HandleRequest(msg.(sip.Request), nil) {
+		return nil, errors.New("request not handled")
+	}
+
+	l.mu.Lock()
+	res := l.response
+	l.mu.Unlock()
+
+	if res.StatusCode() >= 300 {
+		return nil, sip.NewRequestError(uint(res.StatusCode()), res.Reason(), request, res)
+	}
+	return res, nil
+}
+
+func (l *loopback) RespondOnRequest(
+	request sip.Request,
+	status sip.StatusCode,
+	reason, body string,
+	headers []sip.Header,
+) (sip.ServerTransaction, error) {
+	res := sip.NewResponseFromRequest("", request, status, reason, body)
+	for _, header := range headers {
+		res.AppendHeader(header)
+	}
+	// deliver the response as it would be received from network
+	msg, err := parser.ParseMessage([]byte(res.String()), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.response = msg.(sip.Response)
+	l.mu.Unlock()
+
+	return nil, nil
+}
+
+func (l *loopback) block(blocked chan sip.Request) {
+	l.mu.Lock()
+	l.blocked = blocked
+	l.mu.Unlock()
+}
+
+func (l *loopback) setCompositor(compositor *publish.Compositor) {
+	l.mu.Lock()
+	l.compositor = compositor
+	l.mu.Unlock()
+}
+
+var (
+	alice = &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "example.com"}}
+	pidf  = "application/pidf+xml"
+)
+
+func setup(clock timing.Clock, options ...publish.CompositorOption) (*loopback, *publish.Publisher) {
+	loop := &loopback{}
+	loop.setCompositor(publish.NewCompositor(loop, logger, append(options, publish.WithClock(clock))...))
+	return loop, publish.NewPublisher(loop, alice, logger, publish.WithClock(clock))
+}
+
+func TestPublication(t *testing.T) {
+	clock := timing.NewFakeClock(time.Now())
+	loop, publisher := setup(clock)
+
+	var changes int
+	loop.compositor.OnChange(func(resource, event string, states []publish.State) {
+		changes++
+	})
+
+	ctx := context.Background()
+	pub, err := publisher.Publish(ctx, alice.Uri, "presence", pidf, []byte("<open/>"), time.Hour)
+	if err != nil {
+		t.Fatalf("publish failed: %s", err)
+	}
+	states := loop.compositor.State(alice.Uri, "presence")
+	if len(states) != 1 || states[0].ETag != pub.ETag() || string(states[0].Body) != "<open/>" || states[0].ContentType != pidf {
+		t.Fatalf("unexpected composite state %+v", states)
+	}
+	if pub.Expires() != time.Hour {
+		t.Errorf("unexpected expires %s", pub.Expires())
+	}
+
+	etag := pub.ETag()
+	if err := pub.Refresh(ctx); err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if pub.ETag() == etag {
+		t.Errorf("entity tag is not changed on refresh")
+	}
+	if err := pub.Modify(ctx, pidf, []byte("<closed/>")); err != nil {
+		t.Fatalf("modify failed: %s", err)
+	}
+	if states := loop.compositor.State(alice.Uri, "presence"); len(states) != 1 || string(states[0].Body) != "<closed/>" {
+		t.Errorf("unexpected composite state %+v", states)
+	}
+
+	// the publication is refreshed before expiration
+	etag = pub.ETag()
+	clock.Advance(54 * time.Minute)
+	clock.Settle()
+	if pub.ETag() == etag {
+		t.Errorf("publication is not refreshed")
+	}
+
+	if err := pub.Remove(ctx); err != nil {
+		t.Fatalf("remove failed: %s", err)
+	}
+	<-pub.Done()
+	if states := loop.compositor.State(alice.Uri, "presence"); len(states) != 0 {
+		t.Errorf("removed publication is in composite state %+v", states)
+	}
+	if err := pub.Refresh(ctx); err != publish.ErrRemoved {
+		t.Errorf("expected ErrRemoved, got %v", err)
+	}
+	if changes != 3 {
+		t.Errorf("expected 3 state changes, got %d", changes)
+	}
+}
+
+func TestRemoveDuringRefresh(t *testing.T) {
+	clock := timing.NewFakeClock(time.Now())
+	loop, publisher := setup(clock)
+
+	ctx := context.Background()
+	pub, err := publisher.Publish(ctx, alice.Uri, "presence", pidf, []byte("<open/>"), time.Hour)
+	if err != nil {
+		t.Fatalf("publish failed: %s", err)
+	}
+
+	// the refresh hangs in the transaction
+	blocked := make(chan sip.Request, 1)
+	loop.block(blocked)
+	clock.Advance(54 * time.Minute)
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatalf("publication is not refreshed")
+	}
+	loop.block(nil)
+
+	removed := make(chan error, 1)
+	go func() {
+		pub.ETag()
+		removed <- pub.Remove(ctx)
+	}()
+	select {
+	case err := <-removed:
+		if err != nil {
+			t.Fatalf("remove failed: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("remove is blocked by the refresh")
+	}
+	if err := pub.Err(); err != nil {
+		t.Errorf("aborted refresh is reported as error: %s", err)
+	}
+	if states := loop.compositor.State(alice.Uri, "presence"); len(states) != 0 {
+		t.Errorf("removed publication is in composite state %+v", states)
+	}
+}
+
+func TestPublicationRecovery(t *testing.T) {
+	clock := timing.NewFakeClock(time.Now())
+	loop, publisher := setup(clock)
+
+	ctx := context.Background()
+	pub, err := publisher.Publish(ctx, alice.Uri, "presence", pidf, []byte("<open/>"), 10*time.Second)
+	if err != nil {
+		t.Fatalf("publish failed: %s", err)
+	}
+	if pub.Expires() != publish.DefaultMinExpires {
+		t.Errorf("expected Min-Expires to be used, got %s", pub.Expires())
+	}
+
+	// the compositor has lost the state
+	compositor := publish.NewCompositor(loop, logger, publish.WithClock(clock))
+	loop.setCompositor(compositor)
+
+	if err := pub.Refresh(ctx); err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if states := compositor.State(alice.Uri, "presence"); len(states) != 1 || string(states[0].Body) != "<open/>" {
+		t.Errorf("state is not recovered %+v", states)
+	}
+}
+
+func TestCompositor(t *testing.T) {
+	clock := timing.NewFakeClock(time.Now())
+	loop, publisher := setup(clock, publish.WithEvents("presence"))
+
+	ctx := context.Background()
+	_, err := publisher.Publish(ctx, alice.Uri, "dialog", "application/dialog-info+xml", []byte("<dialog-info/>"), time.Hour)
+	var reqErr *sip.RequestError
+	if !errors.As(err, &reqErr) || reqErr.Code != 489 {
+		t.Errorf("expected 489 response, got %v", err)
+	}
+
+	// publishers with the real clock are not refreshed while the compositor clock is advanced
+	first := publish.NewPublisher(loop, alice, logger)
+	second := publish.NewPublisher(loop, &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: "bob"}, FHost: "example.com"}}, logger)
+	if _, err := first.Publish(ctx, alice.Uri, "presence", pidf, []byte("<open/>"), time.Hour); err != nil {
+		t.Fatalf("publish failed: %s", err)
+	}
+	clock.Advance(time.Minute)
+	if _, err := second.Publish(ctx, alice.Uri, "presence", pidf, []byte("<busy/>"), 2*time.Hour); err != nil {
+		t.Fatalf("publish failed: %s", err)
+	}
+
+	states := loop.compositor.State(alice.Uri, "presence")
+	if len(states) != 2 || string(states[0].Body) != "<open/>" || string(states[1].Body) != "<busy/>" {
+		t.Fatalf("unexpected composite state %+v", states)
+	}
+
+	clock.Advance(30 * time.Minute)
+	clock.Settle()
+	clock.Advance(30 * time.Minute)
+	clock.Settle()
+	if states := loop.compositor.State(alice.Uri, "presence"); len(states) != 1 || string(states[0].Body) != "<busy/>" {
+		t.Errorf("expired publication is in composite state %+v", states)
+	}
+}
@@ -0,0 +1,387 @@
+// publish package implements event state publication with PUBLISH requests (RFC 3903).
+//
+// Publisher is the client side (Event Publication Agent): it publishes event state, refreshes it before expiration,
+// modifies and removes it using the entity tag returned by the server and recovers from 412 Conditional Request Failed
+// with the initial publication. Compositor is the server side (Event State Compositor): it stores publications
+// per resource and event package, expires them and exposes the composite state.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// ErrRemoved is returned by Publication methods after the publication is removed or expired.
+var ErrRemoved = errors.New("publication is removed")
+
+// Publisher publishes event state on behalf of the local user.
+type Publisher struct {
+	sender gosip.Sender
+	from   *sip.Address
+	opts   PublisherOptions
+	log    log.Logger
+}
+
+// NewPublisher creates publisher that sends PUBLISH from the given address.
+func NewPublisher(sender gosip.Sender, from *sip.Address, logger log.Logger, options ...PublisherOption) *Publisher {
+	p := &Publisher{
+		sender: sender,
+		from:   from.Clone(),
+	}
+	for _, opt := range options {
+		opt.ApplyPublisher(&p.opts)
+	}
+	if p.opts.Clock == nil {
+		p.opts.Clock = timing.NewRealClock()
+	}
+	p.log = logger.
+		WithPrefix("publish.Publisher").
+		WithFields(log.Fields{
+			"publisher_ptr": fmt.Sprintf("%p", p),
+		})
+
+	return p
+}
+
+func (p *Publisher) Log() log.Logger {
+	return p.log
+}
+
+// Publish sends the initial publication of the event state of the resource.
+// The publication is refreshed automatically until it is removed.
+// Failure responses are returned as *sip.RequestError.
+func (p *Publisher) Publish(
+	ctx context.Context,
+	resource sip.Uri,
+	event string,
+	contentType string,
+	body []byte,
+	expires time.Duration,
+) (*Publication, error) {
+	pub := &Publication{
+		publisher:   p,
+		resource:    resource.Clone(),
+		event:       event,
+		contentType: contentType,
+		body:        body,
+		expires:     expires,
+		done:        make(chan struct{}),
+	}
+	pub.ctx, pub.cancel = context.WithCancel(context.Background())
+	pub.log = p.Log().
+		WithPrefix("publish.Publication").
+		WithFields(log.Fields{
+			"publication_ptr": fmt.Sprintf("%p", pub),
+			"resource":        resource.String(),
+			"event":           event,
+		})
+
+	pub.sending.Lock()
+	defer pub.sending.Unlock()
+
+	if err := pub.publish(ctx, true); err != nil {
+		pub.cancel()
+		return nil, err
+	}
+
+	return pub, nil
+}
+
+// Publication is the event state published by Publisher.
+type Publication struct {
+	publisher *Publisher
+	resource  sip.Uri
+	event     string
+	// canceled when the publication is finished to abort the refresh in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// serializes PUBLISH transactions, it is taken before mu
+	sending sync.Mutex
+	mu      sync.Mutex
+	// published state is changed with both locks held
+	contentType string
+	body        []byte
+	// requested and granted expiration intervals
+	expires time.Duration
+	granted time.Duration
+	etag    string
+	// guarded by mu
+	timer    timing.Timer
+	finished bool
+	err      error
+	done     chan struct{}
+
+	log log.Logger
+}
+
+func (pub *Publication) Log() log.Logger {
+	return pub.log
+}
+
+// ETag returns the entity tag of the current publication.
+func (pub *Publication) ETag() string {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	return pub.etag
+}
+
+// Expires returns the expiration interval granted by the server.
+func (pub *Publication) Expires() time.Duration {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	return pub.granted
+}
+
+// Done returns channel that is closed when the publication is removed or its refresh has failed.
+func (pub *Publication) Done() <-chan struct{} {
+	return pub.done
+}
+
+// Err returns the reason of the refresh failure, it is valid after Done is closed.
+func (pub *Publication) Err() error {
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	return pub.err
+}
+
+// Refresh extends the publication without changing the event state.
+func (pub *Publication) Refresh(ctx context.Context) error {
+	pub.sending.Lock()
+	defer pub.sending.Unlock()
+
+	pub.mu.Lock()
+	finished := pub.finished
+	pub.mu.Unlock()
+	if finished {
+		return ErrRemoved
+	}
+
+	return pub.publish(ctx, false)
+}
+
+// Modify replaces the published event state.
+func (pub *Publication) Modify(ctx context.Context, contentType string, body []byte) error {
+	pub.sending.Lock()
+	defer pub.sending.Unlock()
+
+	pub.mu.Lock()
+	if pub.finished {
+		pub.mu.Unlock()
+		return ErrRemoved
+	}
+	pub.contentType, pub.body = contentType, body
+	pub.mu.Unlock()
+
+	return pub.publish(ctx, true)
+}
+
+// Remove removes the published event state with Expires: 0.
+// The refresh in progress is aborted.
+func (pub *Publication) Remove(ctx context.Context) error {
+	pub.mu.Lock()
+	if pub.finished {
+		pub.mu.Unlock()
+		return ErrRemoved
+	}
+	pub.finish(nil)
+	pub.mu.Unlock()
+
+	pub.sending.Lock()
+	defer pub.sending.Unlock()
+
+	_, err := pub.send(ctx, false, 0)
+	return err
+}
+
+// Sends PUBLISH and handles 423 Interval Too Brief and 412 Conditional Request Failed,
+// must be called with the sending lock held.
+func (pub *Publication) publish(ctx context.Context, withBody bool) error {
+	var res sip.Response
+	for attempt := 0; attempt < 3; attempt++ {
+		var err error
+		if res, err = pub.send(ctx, withBody, pub.expires); err == nil {
+			break
+		}
+
+		var reqErr *sip.RequestError
+		if !errors.As(err, &reqErr) || reqErr.Response == nil {
+			return err
+		}
+
+		switch reqErr.Response.StatusCode() {
+		case 412:
+			if pub.etag == "" {
+				return err
+			}
+
+			pub.Log().Debugf("entity tag %s is unknown to the server, sending initial publication", pub.etag)
+
+			pub.mu.Lock()
+			pub.etag = ""
+			pub.mu.Unlock()
+			withBody = true
+		case 423:
+			minExpires, ok := expiresHeader(reqErr.Response, "Min-Expires")
+			if !ok || minExpires <= pub.expires {
+				return err
+			}
+
+			pub.Log().Debugf("interval is too brief, using Min-Expires %s", minExpires)
+
+			pub.mu.Lock()
+			pub.expires = minExpires
+			pub.mu.Unlock()
+		default:
+			return err
+		}
+	}
+	if res == nil {
+		return fmt.Errorf("publication failed after retries")
+	}
+
+	etag, ok := headerValue(res, "SIP-ETag")
+	if !ok {
+		return fmt.Errorf("response '%d %s' has no SIP-ETag", res.StatusCode(), res.Reason())
+	}
+
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+
+	pub.etag = etag
+	pub.granted = pub.expires
+	if expires, ok := expiresHeader(res, "Expires"); ok {
+		pub.granted = expires
+	}
+	pub.scheduleRefresh()
+
+	return nil
+}
+
+func (pub *Publication) send(ctx context.Context, withBody bool, expires time.Duration) (sip.Response, error) {
+	req, err := pub.newRequest(withBody, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	pub.Log().WithFields(req.Fields()).Debugf("sending PUBLISH with expires %s", expires)
+
+	return pub.publisher.sender.RequestWithContext(ctx, req, pub.publisher.opts.RequestOptions...)
+}
+
+func (pub *Publication) newRequest(withBody bool, expires time.Duration) (sip.Request, error) {
+	expiresHdr := sip.Expires(expires / time.Second)
+
+	builder := sip.NewRequestBuilderTo(sip.PUBLISH, pub.resource, pub.publisher.from).
+		SetExpires(&expiresHdr).
+		AddHeader(&sip.EventHeader{EventType: pub.event, Params: sip.NewParams()})
+	if pub.etag != "" {
+		builder.AddHeader(&sip.GenericHeader{HeaderName: "SIP-If-Match", Contents: pub.etag})
+	}
+	if withBody {
+		contentType := sip.ContentType(pub.contentType)
+		builder.SetContentType(&contentType).SetBody(string(pub.body))
+	}
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("build PUBLISH: %w", err)
+	}
+
+	return req, nil
+}
+
+// Refresh is scheduled before the publication expires, must be called with the lock held.
+func (pub *Publication) scheduleRefresh() {
+	if pub.timer != nil {
+		pub.timer.Stop()
+	}
+	if pub.finished || pub.granted <= 0 {
+		return
+	}
+
+	pub.timer = pub.publisher.opts.Clock.AfterFunc(refreshInterval(pub.granted), func() {
+		pub.sending.Lock()
+		defer pub.sending.Unlock()
+
+		pub.mu.Lock()
+		finished := pub.finished
+		pub.mu.Unlock()
+		if finished {
+			return
+		}
+
+		err := pub.publish(pub.ctx, false)
+		if err == nil {
+			return
+		}
+
+		pub.mu.Lock()
+		defer pub.mu.Unlock()
+
+		// aborted by Remove
+		if pub.finished {
+			return
+		}
+
+		pub.Log().Warnf("refresh publication failed: %s", err)
+
+		pub.finish(err)
+	})
+}
+
+// Must be called with the lock held.
+func (pub *Publication) finish(err error) {
+	if pub.finished {
+		return
+	}
+	if pub.timer != nil {
+		pub.timer.Stop()
+	}
+	pub.finished = true
+	pub.err = err
+	pub.cancel()
+	close(pub.done)
+}
+
+// The publication is refreshed a bit earlier than it expires, intervals shorter than a minute are halved.
+func refreshInterval(expires time.Duration) time.Duration {
+	if expires < time.Minute {
+		return expires / 2
+	}
+	return expires - expires/10
+}
+
+func headerValue(msg sip.Message, name string) (string, bool) {
+	hdrs := msg.GetHeaders(name)
+	if len(hdrs) == 0 {
+		return "", false
+	}
+	value := strings.TrimSpace(hdrs[0].Value())
+	return value, value != ""
+}
+
+func expiresHeader(msg sip.Message, name string) (time.Duration, bool) {
+	value, ok := headerValue(msg, name)
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,323 @@
+package gosip
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+const (
+	DefaultBanWindow = time.Minute
+	DefaultBanTime   = 5 * time.Minute
+)
+
+// RateKey extracts the key of a rate limit bucket from the request, empty key is not limited.
+type RateKey func(req sip.Request) string
+
+// SourceIPKey limits requests per source IP address.
+func SourceIPKey(req sip.Request) string {
+	host := req.Source()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// FromUserKey limits requests per user of the From URI.
+func FromUserKey(req sip.Request) string {
+	from, ok := req.From()
+	if !ok || from.Address == nil || from.Address.User() == nil {
+		return ""
+	}
+	return from.Address.User().String() + "@" + strings.ToLower(from.Address.Host())
+}
+
+// MethodKey limits requests per method.
+func MethodKey(req sip.Request) string {
+	return string(req.Method())
+}
+
+// RateRule is a token bucket rule: every key may send Burst requests at once
+// and Rate requests per second on average.
+type RateRule struct {
+	Key RateKey
+	// Methods limited by the rule, empty list limits all methods.
+	Methods []sip.RequestMethod
+	Rate    float64
+	Burst   int
+}
+
+func (rule *RateRule) applies(req sip.Request) bool {
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, method := range rule.Methods {
+		if method == req.Method() {
+			return true
+		}
+	}
+	return false
+}
+
+// RateAction is applied to requests over the limit.
+type RateAction int
+
+const (
+	// RateReject responds with 503 Service Unavailable and Retry-After.
+	RateReject RateAction = iota
+	// RateDrop silently drops requests, that is preferable against scanners.
+	RateDrop
+)
+
+// Ban is a key temporarily banned by RateLimiter.
+type Ban struct {
+	Key   string
+	Until time.Time
+}
+
+type rateBucket struct {
+	tokens  float64
+	burst   float64
+	rate    float64
+	updated time.Time
+}
+
+type rateViolations struct {
+	count int
+	since time.Time
+}
+
+// RateLimiter limits rate of incoming requests with token bucket rules before server transactions are created for them.
+// Keys that exceed the limits BanThreshold times within BanWindow are banned for BanTime (pike-style flood protection),
+// all their requests are refused until the ban expires. ACK requests are never limited.
+type RateLimiter struct {
+	Rules  []RateRule
+	Action RateAction
+	// BanThreshold enables banning, zero disables it.
+	BanThreshold int
+	// BanWindow and BanTime default to DefaultBanWindow and DefaultBanTime.
+	BanWindow time.Duration
+	BanTime   time.Duration
+	// Exempt returns true for requests that are never limited, e.g. from trusted peers.
+	Exempt func(req sip.Request) bool
+	// OnBan is called when the key is banned, e.g. to export it to a firewall.
+	OnBan func(ban Ban)
+	// Clock defaults to ServerConfig.Clock of the server that uses the limiter, to the real clock otherwise.
+	Clock timing.Clock
+
+	mu         sync.Mutex
+	buckets    map[string]*rateBucket
+	violations map[string]*rateViolations
+	bans       map[string]time.Time
+	swept      time.Time
+}
+
+// Allow checks the request against the rules. It returns false with the interval
+// after which the sender may retry when the request is over the limit or its key is banned.
+func (rl *RateLimiter) Allow(req sip.Request) (bool, time.Duration) {
+	if req.IsAck() || (rl.Exempt != nil && rl.Exempt(req)) {
+		return true, 0
+	}
+
+	var banned []Ban
+
+	rl.mu.Lock()
+	now := rl.now()
+	rl.init(now)
+	rl.sweep(now)
+
+	allowed, retryAfter := true, time.Duration(0)
+	for i := range rl.Rules {
+		rule := &rl.Rules[i]
+		if rule.Key == nil || !rule.applies(req) {
+			continue
+		}
+		key := rule.Key(req)
+		if key == "" {
+			continue
+		}
+
+		if until, ok := rl.bans[key]; ok {
+			if wait := until.Sub(now); wait > 0 {
+				allowed = false
+				if wait > retryAfter {
+					retryAfter = wait
+				}
+				continue
+			}
+			delete(rl.bans, key)
+		}
+
+		if wait, ok := rl.take(i, key, now); !ok {
+			allowed = false
+			if ban, ok := rl.violate(key, now); ok {
+				banned = append(banned, ban)
+				wait = ban.Until.Sub(now)
+			}
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	onBan := rl.OnBan
+	rl.mu.Unlock()
+
+	if onBan != nil {
+		for _, ban := range banned {
+			onBan(ban)
+		}
+	}
+
+	return allowed, retryAfter
+}
+
+// Bans returns the current bans.
+func (rl *RateLimiter) Bans() []Ban {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	bans := make([]Ban, 0, len(rl.bans))
+	for key, until := range rl.bans {
+		if until.After(now) {
+			bans = append(bans, Ban{Key: key, Until: until})
+		}
+	}
+
+	return bans
+}
+
+// Ban bans the key for the duration, e.g. to import bans from a firewall or another server.
+func (rl *RateLimiter) Ban(key string, d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.init(now)
+	rl.bans[key] = now.Add(d)
+}
+
+// Unban lifts the ban of the key.
+func (rl *RateLimiter) Unban(key string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	delete(rl.bans, key)
+	delete(rl.violations, key)
+}
+
+func (rl *RateLimiter) now() time.Time {
+	if rl.Clock == nil {
+		return time.Now()
+	}
+	return rl.Clock.Now()
+}
+
+// Must be called with the lock held.
+func (rl *RateLimiter) init(now time.Time) {
+	if rl.buckets != nil {
+		return
+	}
+	rl.buckets = make(map[string]*rateBucket)
+	rl.violations = make(map[string]*rateViolations)
+	rl.bans = make(map[string]time.Time)
+	rl.swept = now
+}
+
+// Takes a token from the bucket of the rule and key, otherwise returns time until the next token.
+// Must be called with the lock held.
+func (rl *RateLimiter) take(rule int, key string, now time.Time) (time.Duration, bool) {
+	burst := float64(rl.Rules[rule].Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	rate := rl.Rules[rule].Rate
+
+	id := strconv.Itoa(rule) + "|" + key
+	bucket, ok := rl.buckets[id]
+	if !ok {
+		bucket = &rateBucket{tokens: burst, burst: burst, rate: rate, updated: now}
+		rl.buckets[id] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * rate
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+	if rate <= 0 {
+		return 0, false
+	}
+
+	return time.Duration((1 - bucket.tokens) / rate * float64(time.Second)), false
+}
+
+// Counts the violation of the key and bans the key when the threshold is reached.
+// Must be called with the lock held.
+func (rl *RateLimiter) violate(key string, now time.Time) (Ban, bool) {
+	if rl.BanThreshold <= 0 {
+		return Ban{}, false
+	}
+
+	window := rl.BanWindow
+	if window <= 0 {
+		window = DefaultBanWindow
+	}
+	v, ok := rl.violations[key]
+	if !ok || now.Sub(v.since) > window {
+		v = &rateViolations{since: now}
+		rl.violations[key] = v
+	}
+	v.count++
+	if v.count < rl.BanThreshold {
+		return Ban{}, false
+	}
+
+	banTime := rl.BanTime
+	if banTime <= 0 {
+		banTime = DefaultBanTime
+	}
+	delete(rl.violations, key)
+	ban := Ban{Key: key, Until: now.Add(banTime)}
+	rl.bans[key] = ban.Until
+
+	return ban, true
+}
+
+// Removes refilled buckets, stale violations and expired bans once per ban window to bound memory
+// under floods from many sources. Must be called with the lock held.
+func (rl *RateLimiter) sweep(now time.Time) {
+	window := rl.BanWindow
+	if window <= 0 {
+		window = DefaultBanWindow
+	}
+	if now.Sub(rl.swept) < window {
+		return
+	}
+	rl.swept = now
+
+	for id, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*bucket.rate >= bucket.burst {
+			delete(rl.buckets, id)
+		}
+	}
+	for key, v := range rl.violations {
+		if now.Sub(v.since) > window {
+			delete(rl.violations, key)
+		}
+	}
+	for key, until := range rl.bans {
+		if !until.After(now) {
+			delete(rl.bans, key)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package gosip_test
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("RateLimiter", func() {
+	var (
+		clock *timing.FakeClock
+		rl    *gosip.RateLimiter
+	)
+
+	request := func(method, source string) sip.Request {
+		req := testutils.Request([]string{
+			method + " sip:example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + source + ";branch=z9hG4bK.limit",
+			"From: <sip:scanner@example.com>;tag=s1",
+			"To: <sip:example.com>",
+			"Call-ID: limit",
+			"CSeq: 1 " + method,
+			"Content-Length: 0",
+			"",
+			"",
+		})
+		req.SetSource(source)
+		return req
+	}
+
+	BeforeEach(func() {
+		clock = timing.NewFakeClock(time.Now())
+		rl = &gosip.RateLimiter{
+			Rules: []gosip.RateRule{
+				{Key: gosip.SourceIPKey, Methods: []sip.RequestMethod{sip.REGISTER}, Rate: 1, Burst: 2},
+			},
+			Clock: clock,
+		}
+	})
+
+	It("should limit requests with token bucket", func() {
+		for i := 0; i < 2; i++ {
+			allowed, _ := rl.Allow(request("REGISTER", "192.0.2.1:5060"))
+			Expect(allowed).To(BeTrue())
+		}
+		allowed, retryAfter := rl.Allow(request("REGISTER", "192.0.2.1:5061"))
+		Expect(allowed).To(BeFalse())
+		Expect(retryAfter).To(Equal(time.Second))
+
+		// other sources, methods and ACK are not limited
+		allowed, _ = rl.Allow(request("REGISTER", "192.0.2.2:5060"))
+		Expect(allowed).To(BeTrue())
+		allowed, _ = rl.Allow(request("INVITE", "192.0.2.1:5060"))
+		Expect(allowed).To(BeTrue())
+		allowed, _ = rl.Allow(request("ACK", "192.0.2.1:5060"))
+		Expect(allowed).To(BeTrue())
+
+		clock.Advance(time.Second)
+		allowed, _ = rl.Allow(request("REGISTER", "192.0.2.1:5060"))
+		Expect(allowed).To(BeTrue())
+	})
+
+	It("should ban flooding source", func() {
+		var bans []gosip.Ban
+		rl.BanThreshold = 3
+		rl.BanTime = 10 * time.Minute
+		rl.OnBan = func(ban gosip.Ban) {
+			bans = append(bans, ban)
+		}
+
+		for i := 0; i < 5; i++ {
+			rl.Allow(request("REGISTER", "192.0.2.1:5060"))
+		}
+		Expect(bans).To(HaveLen(1))
+		Expect(bans[0].Key).To(Equal("192.0.2.1"))
+		Expect(bans[0].Until).To(Equal(clock.Now().Add(10 * time.Minute)))
+		Expect(rl.Bans()).To(ConsistOf(bans[0]))
+
+		// banned source is refused even after the bucket is refilled
+		clock.Advance(time.Minute)
+		allowed, retryAfter := rl.Allow(request("REGISTER", "192.0.2.1:5060"))
+		Expect(allowed).To(BeFalse())
+		Expect(retryAfter).To(Equal(9 * time.Minute))
+
+		rl.Unban("192.0.2.1")
+		allowed, _ = rl.Allow(request("REGISTER", "192.0.2.1:5060"))
+		Expect(allowed).To(BeTrue())
+
+		rl.Ban("192.0.2.3", time.Minute)
+		allowed, _ = rl.Allow(request("REGISTER", "192.0.2.3:5060"))
+		Expect(allowed).To(BeFalse())
+		clock.Advance(time.Minute)
+		allowed, _ = rl.Allow(request("REGISTER", "192.0.2.3:5060"))
+		Expect(allowed).To(BeTrue())
+		Expect(rl.Bans()).To(BeEmpty())
+	})
+
+	It("should not limit exempt requests", func() {
+		rl.Exempt = func(req sip.Request) bool {
+			return gosip.SourceIPKey(req) == "10.0.0.1"
+		}
+		for i := 0; i < 5; i++ {
+			allowed, _ := rl.Allow(request("REGISTER", "10.0.0.1:5060"))
+			Expect(allowed).To(BeTrue())
+		}
+	})
+
+	It("should extract rate keys", func() {
+		req := request("REGISTER", "[2001:db8::1]:5060")
+		Expect(gosip.SourceIPKey(req)).To(Equal("2001:db8::1"))
+		Expect(gosip.FromUserKey(req)).To(Equal("scanner@example.com"))
+		Expect(gosip.MethodKey(req)).To(Equal("REGISTER"))
+	})
+
+	It("should use the server clock when the clock is not set", func() {
+		rl.Clock = nil
+		rl.Rules = []gosip.RateRule{{Key: gosip.SourceIPKey, Rate: 1, Burst: 1}}
+		srv := gosip.NewServer(gosip.ServerConfig{Clock: clock, RateLimiter: rl}, nil, nil, testutils.NewLogrusLogger())
+		defer srv.Shutdown()
+
+		allowed, _ := rl.Allow(request("OPTIONS", "192.0.2.1:5060"))
+		Expect(allowed).To(BeTrue())
+		allowed, _ = rl.Allow(request("OPTIONS", "192.0.2.1:5060"))
+		Expect(allowed).To(BeFalse())
+
+		clock.Advance(time.Second)
+		allowed, _ = rl.Allow(request("OPTIONS", "192.0.2.1:5060"))
+		Expect(allowed).To(BeTrue())
+	})
+
+	Context("with server", func() {
+		var (
+			srv     gosip.Server
+			client  net.PacketConn
+			handled int32
+		)
+
+		srvAddr := "127.0.0.1:5070"
+		clientAddr := "127.0.0.1:9011"
+		logger := testutils.NewLogrusLogger()
+
+		send := func(branch string) {
+			raddr, err := net.ResolveUDPAddr("udp", srvAddr)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.WriteTo([]byte(strings.Join([]string{
+				"OPTIONS sip:example.com SIP/2.0",
+				"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+				"From: <sip:scanner@example.com>;tag=s1",
+				"To: <sip:example.com>",
+				"Call-ID: " + branch,
+				"CSeq: 1 OPTIONS",
+				"Max-Forwards: 70",
+				"Content-Length: 0",
+				"",
+				"",
+			}, "\r\n")), raddr)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		// receive returns nil if nothing is received within the timeout
+		receive := func(timeout time.Duration) sip.Response {
+			buf := make([]byte, transport.MTU)
+			Expect(client.SetReadDeadline(time.Now().Add(timeout))).To(Succeed())
+			num, _, err := client.ReadFrom(buf)
+			if err != nil {
+				return nil
+			}
+			msg, err := parser.ParseMessage(buf[:num], logger)
+			Expect(err).ToNot(HaveOccurred())
+			return msg.(sip.Response)
+		}
+
+		BeforeEach(func() {
+			rl.Rules = []gosip.RateRule{{Key: gosip.SourceIPKey, Rate: 1, Burst: 1}}
+		})
+		JustBeforeEach(func() {
+			atomic.StoreInt32(&handled, 0)
+			srv = gosip.NewServer(gosip.ServerConfig{RateLimiter: rl}, nil, nil, logger)
+			Expect(srv.Listen("udp", srvAddr)).To(Succeed())
+			Expect(srv.OnRequest(sip.OPTIONS, func(req sip.Request, tx sip.ServerTransaction) {
+				atomic.AddInt32(&handled, 1)
+				_, err := srv.RespondOnRequest(req, 200, "OK", "", nil)
+				Expect(err).ToNot(HaveOccurred())
+			})).To(Succeed())
+			var err error
+			client, err = net.ListenPacket("udp", clientAddr)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			client.Close()
+			srv.Shutdown()
+		})
+
+		It("should reject requests over the limit with 503 and Retry-After", func() {
+			send("z9hG4bK.limit1")
+			Expect(receive(time.Second).StatusCode()).To(BeEquivalentTo(200))
+			// retransmission is matched to the transaction and is not limited
+			send("z9hG4bK.limit1")
+			Expect(receive(time.Second).StatusCode()).To(BeEquivalentTo(200))
+
+			send("z9hG4bK.limit2")
+			res := receive(time.Second)
+			Expect(res.StatusCode()).To(BeEquivalentTo(503))
+			Expect(res.GetHeaders("Retry-After")).To(HaveLen(1))
+			Expect(res.GetHeaders("Retry-After")[0].Value()).To(Equal("1"))
+			Expect(atomic.LoadInt32(&handled)).To(BeEquivalentTo(1))
+		})
+
+		Context("when action is drop", func() {
+			BeforeEach(func() {
+				rl.Action = gosip.RateDrop
+			})
+
+			It("should silently drop requests over the limit", func() {
+				send("z9hG4bK.limit1")
+				Expect(receive(time.Second).StatusCode()).To(BeEquivalentTo(200))
+
+				send("z9hG4bK.limit2")
+				Expect(receive(200 * time.Millisecond)).To(BeNil())
+				Expect(atomic.LoadInt32(&handled)).To(BeEquivalentTo(1))
+			})
+		})
+	})
+})
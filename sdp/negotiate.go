@@ -0,0 +1,238 @@
+package sdp
+
+import (
+	"errors"
+	"net"
+)
+
+// NewSession creates session description with mandatory lines filled in.
+// Address type is detected from the address.
+func NewSession(username string, sessionID uint64, address string) *Session {
+	netType, addrType := addrTypes(address)
+	return &Session{
+		Origin: Origin{
+			Username:       username,
+			SessionID:      sessionID,
+			SessionVersion: sessionID,
+			NetType:        netType,
+			AddrType:       addrType,
+			Address:        address,
+		},
+		Name: "-",
+		Connection: &Connection{
+			NetType:  netType,
+			AddrType: addrType,
+			Address:  address,
+		},
+		Timings: []Timing{{}},
+	}
+}
+
+// NewMedia creates RTP media description with the given codecs in the order of preference.
+func NewMedia(typ string, port int, proto string, codecs []Codec) *Media {
+	m := &Media{
+		Type:  typ,
+		Port:  port,
+		Proto: proto,
+	}
+	m.SetCodecs(codecs)
+	return m
+}
+
+func addrTypes(address string) (netType, addrType string) {
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		return "IN", "IP6"
+	}
+	return "IN", "IP4"
+}
+
+// IncrementVersion increments origin session version, it must be done on every modification
+// of the session description sent in the same dialog (RFC 3264 s. 8).
+func (s *Session) IncrementVersion() {
+	s.Origin.SessionVersion++
+}
+
+// IntersectCodecs returns offered codecs supported locally, in the order of the offer.
+// Payload types of the offer are kept, format parameters are taken from the supported codec when present.
+func IntersectCodecs(offered, supported []Codec) []Codec {
+	var codecs []Codec
+	for _, offer := range offered {
+		for _, local := range supported {
+			if !offer.Matches(local) {
+				continue
+			}
+			codec := offer
+			if local.Fmtp != "" {
+				codec.Fmtp = local.Fmtp
+			}
+			codecs = append(codecs, codec)
+			break
+		}
+	}
+	return codecs
+}
+
+// ErrNotAcceptable is returned by NewAnswer together with the answer when all offered media streams were rejected,
+// in SIP it usually ends up with 488 Not Acceptable Here.
+var ErrNotAcceptable = errors.New("no acceptable media")
+
+// NewAnswer creates answer to the offer from the local session description according to RFC 3264 s. 6.
+//
+// The answer takes origin, connection and media ports from the local description.
+// Every offered media stream gets a stream in the answer, in the same order.
+// The stream is paired with the first unused local media of the same type and transport protocol;
+// codecs are intersected with IntersectCodecs, direction is the intersection of the offered direction
+// as seen by the answerer and the local one.
+// Streams that have no local counterpart or common codecs are rejected with port 0.
+func NewAnswer(offer, local *Session) (*Session, error) {
+	answer := &Session{
+		Version:    local.Version,
+		Origin:     local.Origin,
+		Name:       local.Name,
+		Connection: local.Connection.clone(),
+		Bandwidths: append([]Bandwidth(nil), local.Bandwidths...),
+		Timings:    cloneTimings(offer.Timings),
+		Attributes: withoutDirection(local.Attributes),
+	}
+	if len(answer.Timings) == 0 {
+		answer.Timings = []Timing{{}}
+	}
+
+	accepted := false
+	used := make([]bool, len(local.Media))
+	for _, om := range offer.Media {
+		var lm *Media
+		if !om.Rejected() {
+			for i, m := range local.Media {
+				if !used[i] && !m.Rejected() && m.Type == om.Type && m.Proto == om.Proto {
+					lm = m
+					used[i] = true
+					break
+				}
+			}
+		}
+
+		am := answerMedia(offer, om, local, lm)
+		if !am.Rejected() {
+			accepted = true
+		}
+		answer.Media = append(answer.Media, am)
+	}
+
+	if len(offer.Media) > 0 && !accepted {
+		return answer, ErrNotAcceptable
+	}
+
+	return answer, nil
+}
+
+func answerMedia(offer *Session, om *Media, local *Session, lm *Media) *Media {
+	rejected := &Media{
+		Type:    om.Type,
+		Port:    0,
+		Proto:   om.Proto,
+		Formats: append([]string(nil), om.Formats...),
+	}
+	if lm == nil {
+		return rejected
+	}
+
+	am := lm.Clone()
+	if om.IsRTP() {
+		codecs := IntersectCodecs(om.Codecs(), lm.Codecs())
+		if len(codecs) == 0 {
+			return rejected
+		}
+		am.SetCodecs(codecs)
+	} else {
+		am.Formats = intersectFormats(om.Formats, lm.Formats)
+		if len(am.Formats) == 0 {
+			return rejected
+		}
+	}
+
+	// as seen by answerer
+	remote := om.Direction(offer).Reverse()
+	mine := lm.Direction(local)
+	var dir Direction
+	switch {
+	case remote.CanSend() && mine.CanSend() && remote.CanRecv() && mine.CanRecv():
+		dir = SendRecv
+	case remote.CanSend() && mine.CanSend():
+		dir = SendOnly
+	case remote.CanRecv() && mine.CanRecv():
+		dir = RecvOnly
+	default:
+		dir = Inactive
+	}
+	am.SetDirection(dir)
+
+	return am
+}
+
+func intersectFormats(offered, supported []string) []string {
+	var formats []string
+	for _, f := range offered {
+		for _, sf := range supported {
+			if f == sf {
+				formats = append(formats, f)
+				break
+			}
+		}
+	}
+	return formats
+}
+
+// Hold puts active media streams on hold (RFC 3264 s. 8.4):
+// sendrecv becomes sendonly, recvonly becomes inactive. Session version is incremented.
+func Hold(s *Session) {
+	for _, m := range s.Media {
+		if m.Rejected() {
+			continue
+		}
+		switch m.Direction(s) {
+		case SendRecv:
+			m.SetDirection(SendOnly)
+		case RecvOnly:
+			m.SetDirection(Inactive)
+		}
+	}
+	s.IncrementVersion()
+}
+
+// Resume takes media streams off hold, reverting Hold.
+// Session version is incremented.
+func Resume(s *Session) {
+	for _, m := range s.Media {
+		if m.Rejected() {
+			continue
+		}
+		switch m.Direction(s) {
+		case SendOnly:
+			m.SetDirection(SendRecv)
+		case Inactive:
+			m.SetDirection(RecvOnly)
+		}
+	}
+	s.IncrementVersion()
+}
+
+// IsHold returns true if the remote party has put the session on hold,
+// i.e. it does not want to receive any of active media streams.
+// Legacy RFC 2543 hold with connection address 0.0.0.0 is detected too.
+func IsHold(s *Session) bool {
+	active := false
+	for _, m := range s.Media {
+		if m.Rejected() {
+			continue
+		}
+		active = true
+		if conn := s.ConnectionFor(m); conn != nil && conn.Address == "0.0.0.0" {
+			continue
+		}
+		if m.Direction(s).CanRecv() {
+			return false
+		}
+	}
+	return active
+}
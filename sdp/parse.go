@@ -0,0 +1,463 @@
+package sdp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError is returned when session description is malformed.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (err *ParseError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("ParseError: line %d: %s", err.Line, err.Msg)
+}
+
+// Parse parses session description.
+// Both CRLF and LF line endings are accepted, unknown line types are ignored as RFC 8866 s. 5 requires.
+func Parse(data string) (*Session, error) {
+	s := &Session{}
+	var media *Media
+	seen := make(map[byte]bool)
+
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		num := i + 1
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			// allow trailing empty lines
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, &ParseError{num, fmt.Sprintf("invalid line '%s'", line)}
+		}
+
+		typ, value := line[0], line[2:]
+		if num == 1 && typ != 'v' {
+			return nil, &ParseError{num, "session description must start with v= line"}
+		}
+
+		errorf := func(format string, args ...interface{}) error {
+			return &ParseError{num, fmt.Sprintf("%c=: ", typ) + fmt.Sprintf(format, args...)}
+		}
+
+		if media == nil {
+			switch typ {
+			case 'v', 'o', 's', 'i', 'u', 'c', 'k', 'z':
+				if seen[typ] && typ != 'i' {
+					return nil, errorf("duplicate line")
+				}
+				seen[typ] = true
+			}
+		}
+
+		switch typ {
+		case 'v':
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errorf("invalid version '%s'", value)
+			}
+			s.Version = v
+		case 'o':
+			origin, err := parseOrigin(value)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			s.Origin = origin
+		case 's':
+			s.Name = value
+		case 'i':
+			if media != nil {
+				media.Info = value
+			} else {
+				s.Info = value
+			}
+		case 'u':
+			s.URI = value
+		case 'e':
+			s.Emails = append(s.Emails, value)
+		case 'p':
+			s.Phones = append(s.Phones, value)
+		case 'c':
+			conn, err := parseConnection(value)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			if media != nil {
+				media.Connection = conn
+			} else {
+				s.Connection = conn
+			}
+		case 'b':
+			bw, err := parseBandwidth(value)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			if media != nil {
+				media.Bandwidths = append(media.Bandwidths, bw)
+			} else {
+				s.Bandwidths = append(s.Bandwidths, bw)
+			}
+		case 't':
+			fields := strings.Fields(value)
+			if len(fields) != 2 {
+				return nil, errorf("invalid timing '%s'", value)
+			}
+			start, err1 := strconv.ParseUint(fields[0], 10, 64)
+			stop, err2 := strconv.ParseUint(fields[1], 10, 64)
+			if err1 != nil || err2 != nil {
+				return nil, errorf("invalid timing '%s'", value)
+			}
+			s.Timings = append(s.Timings, Timing{Start: start, Stop: stop})
+		case 'r':
+			if len(s.Timings) == 0 {
+				return nil, errorf("repeat time without t= line")
+			}
+			t := &s.Timings[len(s.Timings)-1]
+			t.Repeats = append(t.Repeats, value)
+		case 'z':
+			s.TimeZones = value
+		case 'k':
+			if media != nil {
+				media.Key = value
+			} else {
+				s.Key = value
+			}
+		case 'a':
+			attr := parseAttribute(value)
+			if media != nil {
+				media.Attributes = append(media.Attributes, attr)
+			} else {
+				s.Attributes = append(s.Attributes, attr)
+			}
+		case 'm':
+			m, err := parseMedia(value)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			s.Media = append(s.Media, m)
+			media = m
+		}
+	}
+
+	for _, typ := range []byte{'v', 'o', 's'} {
+		if !seen[typ] {
+			return nil, &ParseError{len(lines), fmt.Sprintf("missing mandatory %c= line", typ)}
+		}
+	}
+
+	return s, nil
+}
+
+func parseOrigin(value string) (Origin, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 6 {
+		return Origin{}, fmt.Errorf("invalid origin '%s'", value)
+	}
+	id, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return Origin{}, fmt.Errorf("invalid session id '%s'", fields[1])
+	}
+	version, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return Origin{}, fmt.Errorf("invalid session version '%s'", fields[2])
+	}
+
+	return Origin{
+		Username:       fields[0],
+		SessionID:      id,
+		SessionVersion: version,
+		NetType:        fields[3],
+		AddrType:       fields[4],
+		Address:        fields[5],
+	}, nil
+}
+
+func parseConnection(value string) (*Connection, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid connection '%s'", value)
+	}
+	return &Connection{
+		NetType:  fields[0],
+		AddrType: fields[1],
+		Address:  fields[2],
+	}, nil
+}
+
+func parseBandwidth(value string) (Bandwidth, error) {
+	i := strings.Index(value, ":")
+	if i < 1 {
+		return Bandwidth{}, fmt.Errorf("invalid bandwidth '%s'", value)
+	}
+	v, err := strconv.ParseUint(value[i+1:], 10, 64)
+	if err != nil {
+		return Bandwidth{}, fmt.Errorf("invalid bandwidth '%s'", value)
+	}
+	return Bandwidth{Type: value[:i], Value: v}, nil
+}
+
+func parseAttribute(value string) Attribute {
+	if i := strings.Index(value, ":"); i != -1 {
+		return Attribute{Name: value[:i], Value: value[i+1:]}
+	}
+	return Attribute{Name: value}
+}
+
+func parseMedia(value string) (*Media, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid media '%s'", value)
+	}
+
+	m := &Media{
+		Type:    fields[0],
+		Proto:   fields[2],
+		Formats: fields[3:],
+	}
+
+	port := fields[1]
+	if i := strings.Index(port, "/"); i != -1 {
+		count, err := strconv.Atoi(port[i+1:])
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid port count '%s'", port)
+		}
+		m.PortCount = count
+		port = port[:i]
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return nil, fmt.Errorf("invalid port '%s'", port)
+	}
+	m.Port = p
+
+	return m, nil
+}
+
+// ParseRTPMap parses a=rtpmap value, e.g. "96 opus/48000/2".
+func ParseRTPMap(value string) (Codec, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), " ", 2)
+	if len(parts) != 2 {
+		return Codec{}, fmt.Errorf("invalid rtpmap '%s'", value)
+	}
+	pt, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil || pt > 127 {
+		return Codec{}, fmt.Errorf("invalid rtpmap payload type '%s'", parts[0])
+	}
+
+	enc := strings.Split(strings.TrimSpace(parts[1]), "/")
+	if len(enc) < 2 || len(enc) > 3 || enc[0] == "" {
+		return Codec{}, fmt.Errorf("invalid rtpmap encoding '%s'", parts[1])
+	}
+	rate, err := strconv.ParseUint(enc[1], 10, 32)
+	if err != nil {
+		return Codec{}, fmt.Errorf("invalid rtpmap clock rate '%s'", enc[1])
+	}
+
+	codec := Codec{
+		PayloadType: uint8(pt),
+		Name:        enc[0],
+		ClockRate:   uint32(rate),
+	}
+	if len(enc) == 3 {
+		ch, err := strconv.ParseUint(enc[2], 10, 16)
+		if err != nil {
+			return Codec{}, fmt.Errorf("invalid rtpmap channels '%s'", enc[2])
+		}
+		codec.Channels = uint16(ch)
+	}
+
+	return codec, nil
+}
+
+// Candidate is an ICE candidate from a=candidate attribute (RFC 8839 s. 5.1).
+type Candidate struct {
+	Foundation string
+	Component  int
+	Transport  string
+	Priority   uint32
+	Address    string
+	Port       int
+	Type       string
+	RelAddr    string
+	RelPort    int
+	// extension attributes, e.g. generation, ufrag
+	Extensions []Attribute
+}
+
+// ParseCandidate parses a=candidate value.
+func ParseCandidate(value string) (Candidate, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 8 || fields[6] != "typ" {
+		return Candidate{}, fmt.Errorf("invalid candidate '%s'", value)
+	}
+
+	c := Candidate{
+		Foundation: fields[0],
+		Transport:  fields[2],
+		Address:    fields[4],
+		Type:       fields[7],
+	}
+
+	var err error
+	if c.Component, err = strconv.Atoi(fields[1]); err != nil || c.Component < 1 || c.Component > 256 {
+		return Candidate{}, fmt.Errorf("invalid candidate component '%s'", fields[1])
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("invalid candidate priority '%s'", fields[3])
+	}
+	c.Priority = uint32(priority)
+	if c.Port, err = strconv.Atoi(fields[5]); err != nil || c.Port < 0 || c.Port > 65535 {
+		return Candidate{}, fmt.Errorf("invalid candidate port '%s'", fields[5])
+	}
+
+	rest := fields[8:]
+	if len(rest)%2 != 0 {
+		return Candidate{}, fmt.Errorf("invalid candidate extensions '%s'", value)
+	}
+	for i := 0; i < len(rest); i += 2 {
+		switch rest[i] {
+		case "raddr":
+			c.RelAddr = rest[i+1]
+		case "rport":
+			if c.RelPort, err = strconv.Atoi(rest[i+1]); err != nil {
+				return Candidate{}, fmt.Errorf("invalid candidate rport '%s'", rest[i+1])
+			}
+		default:
+			c.Extensions = append(c.Extensions, Attribute{rest[i], rest[i+1]})
+		}
+	}
+
+	return c, nil
+}
+
+func (c Candidate) String() string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "%s %d %s %d %s %d typ %s", c.Foundation, c.Component, c.Transport, c.Priority,
+		c.Address, c.Port, c.Type)
+	if c.RelAddr != "" {
+		fmt.Fprintf(&buffer, " raddr %s rport %d", c.RelAddr, c.RelPort)
+	}
+	for _, ext := range c.Extensions {
+		fmt.Fprintf(&buffer, " %s %s", ext.Name, ext.Value)
+	}
+	return buffer.String()
+}
+
+// Marshal returns session description with CRLF line endings and lines in the order required by RFC 8866 s. 5.
+func (s *Session) Marshal() []byte {
+	var buffer bytes.Buffer
+
+	line := func(typ byte, value string) {
+		buffer.WriteByte(typ)
+		buffer.WriteByte('=')
+		buffer.WriteString(value)
+		buffer.WriteString("\r\n")
+	}
+
+	line('v', strconv.Itoa(s.Version))
+	line('o', fmt.Sprintf("%s %d %d %s %s %s", orDash(s.Origin.Username), s.Origin.SessionID,
+		s.Origin.SessionVersion, s.Origin.NetType, s.Origin.AddrType, s.Origin.Address))
+	name := s.Name
+	if name == "" {
+		// s= must not be empty
+		name = "-"
+	}
+	line('s', name)
+	if s.Info != "" {
+		line('i', s.Info)
+	}
+	if s.URI != "" {
+		line('u', s.URI)
+	}
+	for _, e := range s.Emails {
+		line('e', e)
+	}
+	for _, p := range s.Phones {
+		line('p', p)
+	}
+	if s.Connection != nil {
+		line('c', s.Connection.String())
+	}
+	for _, bw := range s.Bandwidths {
+		line('b', bw.String())
+	}
+	if len(s.Timings) == 0 {
+		line('t', "0 0")
+	}
+	for _, t := range s.Timings {
+		line('t', fmt.Sprintf("%d %d", t.Start, t.Stop))
+		for _, r := range t.Repeats {
+			line('r', r)
+		}
+	}
+	if s.TimeZones != "" {
+		line('z', s.TimeZones)
+	}
+	if s.Key != "" {
+		line('k', s.Key)
+	}
+	for _, attr := range s.Attributes {
+		line('a', attr.String())
+	}
+
+	for _, m := range s.Media {
+		line('m', m.mediaLine())
+		if m.Info != "" {
+			line('i', m.Info)
+		}
+		if m.Connection != nil {
+			line('c', m.Connection.String())
+		}
+		for _, bw := range m.Bandwidths {
+			line('b', bw.String())
+		}
+		if m.Key != "" {
+			line('k', m.Key)
+		}
+		for _, attr := range m.Attributes {
+			line('a', attr.String())
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+func (s *Session) String() string {
+	return string(s.Marshal())
+}
+
+func (m *Media) mediaLine() string {
+	port := strconv.Itoa(m.Port)
+	if m.PortCount > 0 {
+		port += "/" + strconv.Itoa(m.PortCount)
+	}
+	v := m.Type + " " + port + " " + m.Proto
+	if len(m.Formats) > 0 {
+		v += " " + strings.Join(m.Formats, " ")
+	}
+	return v
+}
+
+func (c *Connection) String() string {
+	return c.NetType + " " + c.AddrType + " " + c.Address
+}
+
+func (bw Bandwidth) String() string {
+	return bw.Type + ":" + strconv.FormatUint(bw.Value, 10)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
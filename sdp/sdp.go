@@ -0,0 +1,429 @@
+// sdp package implements Session Description Protocol (RFC 8866) parsing and serialisation,
+// offer/answer negotiation (RFC 3264) and helpers to carry session descriptions in SIP messages.
+package sdp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Session is a session description.
+type Session struct {
+	// v=
+	Version int
+	// o=
+	Origin Origin
+	// s=
+	Name string
+	// i=
+	Info string
+	// u=
+	URI string
+	// e=
+	Emails []string
+	// p=
+	Phones []string
+	// c=
+	Connection *Connection
+	// b=
+	Bandwidths []Bandwidth
+	// t= and r=
+	Timings []Timing
+	// z=
+	TimeZones string
+	// k=
+	Key string
+	// a=
+	Attributes Attributes
+	// m= sections
+	Media []*Media
+}
+
+// Origin is the o= line.
+type Origin struct {
+	Username       string
+	SessionID      uint64
+	SessionVersion uint64
+	NetType        string
+	AddrType       string
+	Address        string
+}
+
+// Connection is the c= line.
+// Address may contain TTL and number of addresses for multicast sessions, e.g. 224.2.36.42/127.
+type Connection struct {
+	NetType  string
+	AddrType string
+	Address  string
+}
+
+// Bandwidth is the b= line.
+type Bandwidth struct {
+	Type  string
+	Value uint64
+}
+
+// Timing is the t= line with following r= lines.
+type Timing struct {
+	Start   uint64
+	Stop    uint64
+	Repeats []string
+}
+
+// Media is a media description (m= section).
+type Media struct {
+	// media type: audio, video, text, application, message
+	Type string
+	// Port 0 means rejected or disabled media stream.
+	Port int
+	// Number of ports, 0 if not specified.
+	PortCount int
+	// RTP/AVP, RTP/SAVP, UDP/TLS/RTP/SAVPF etc.
+	Proto string
+	// Formats are RTP payload types for RTP based protocols.
+	Formats []string
+	// i=
+	Info string
+	// c=
+	Connection *Connection
+	// b=
+	Bandwidths []Bandwidth
+	// k=
+	Key string
+	// a=
+	Attributes Attributes
+}
+
+// Attribute is the a= line.
+// Property attributes (a=recvonly) have empty Value.
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+func (attr Attribute) String() string {
+	if attr.Value == "" {
+		return attr.Name
+	}
+	return attr.Name + ":" + attr.Value
+}
+
+// Attributes is an ordered list of attributes.
+type Attributes []Attribute
+
+// Get returns value of the first attribute with the given name.
+func (attrs Attributes) Get(name string) (string, bool) {
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns values of all attributes with the given name.
+func (attrs Attributes) GetAll(name string) []string {
+	var values []string
+	for _, attr := range attrs {
+		if attr.Name == name {
+			values = append(values, attr.Value)
+		}
+	}
+	return values
+}
+
+// Has returns true if there is attribute with the given name.
+func (attrs Attributes) Has(name string) bool {
+	_, ok := attrs.Get(name)
+	return ok
+}
+
+// Add appends attribute.
+func (attrs Attributes) Add(name, value string) Attributes {
+	return append(attrs, Attribute{name, value})
+}
+
+// Remove removes all attributes with the given name.
+func (attrs Attributes) Remove(name string) Attributes {
+	var res Attributes
+	for _, attr := range attrs {
+		if attr.Name != name {
+			res = append(res, attr)
+		}
+	}
+	return res
+}
+
+// Set replaces all attributes with the given name with the single one.
+// The attribute keeps position of the first replaced one.
+func (attrs Attributes) Set(name, value string) Attributes {
+	for i, attr := range attrs {
+		if attr.Name == name {
+			res := append(Attributes(nil), attrs[:i]...)
+			res = res.Add(name, value)
+			return append(res, attrs[i+1:].Remove(name)...)
+		}
+	}
+	return attrs.Add(name, value)
+}
+
+// Direction is a media stream direction attribute.
+type Direction string
+
+const (
+	SendRecv Direction = "sendrecv"
+	SendOnly Direction = "sendonly"
+	RecvOnly Direction = "recvonly"
+	Inactive Direction = "inactive"
+)
+
+// Reverse returns direction as seen by the remote side.
+func (dir Direction) Reverse() Direction {
+	switch dir {
+	case SendOnly:
+		return RecvOnly
+	case RecvOnly:
+		return SendOnly
+	}
+	return dir
+}
+
+// CanSend returns true if direction allows sending media.
+func (dir Direction) CanSend() bool {
+	return dir == SendRecv || dir == SendOnly
+}
+
+// CanRecv returns true if direction allows receiving media.
+func (dir Direction) CanRecv() bool {
+	return dir == SendRecv || dir == RecvOnly
+}
+
+func directionOf(attrs Attributes) (Direction, bool) {
+	for _, attr := range attrs {
+		switch dir := Direction(attr.Name); dir {
+		case SendRecv, SendOnly, RecvOnly, Inactive:
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+func withoutDirection(attrs Attributes) Attributes {
+	return attrs.
+		Remove(string(SendRecv)).
+		Remove(string(SendOnly)).
+		Remove(string(RecvOnly)).
+		Remove(string(Inactive))
+}
+
+// Direction returns session-level direction attribute, default is sendrecv.
+func (s *Session) Direction() Direction {
+	if dir, ok := directionOf(s.Attributes); ok {
+		return dir
+	}
+	return SendRecv
+}
+
+// Direction returns direction of the media stream in the session,
+// media-level attribute overrides session-level one, default is sendrecv.
+func (m *Media) Direction(s *Session) Direction {
+	if dir, ok := directionOf(m.Attributes); ok {
+		return dir
+	}
+	if s != nil {
+		return s.Direction()
+	}
+	return SendRecv
+}
+
+// SetDirection replaces media-level direction attribute.
+func (m *Media) SetDirection(dir Direction) {
+	m.Attributes = withoutDirection(m.Attributes).Add(string(dir), "")
+}
+
+// ConnectionFor returns media-level connection, falls back to the session-level one.
+func (s *Session) ConnectionFor(m *Media) *Connection {
+	if m.Connection != nil {
+		return m.Connection
+	}
+	return s.Connection
+}
+
+// Rejected returns true if media stream is rejected or disabled (port 0).
+func (m *Media) Rejected() bool {
+	return m.Port == 0
+}
+
+// IsRTP returns true if media is transported over RTP, so formats are payload types.
+func (m *Media) IsRTP() bool {
+	return strings.Contains(m.Proto, "RTP/")
+}
+
+// Codec describes RTP payload format.
+type Codec struct {
+	PayloadType uint8
+	Name        string
+	ClockRate   uint32
+	// Number of audio channels, 0 if not specified.
+	Channels uint16
+	// Format parameters from a=fmtp.
+	Fmtp string
+}
+
+// Matches returns true if codecs have the same encoding, case-insensitive, clock rate and number of channels.
+func (c Codec) Matches(other Codec) bool {
+	channels, otherChannels := c.Channels, other.Channels
+	if channels == 0 {
+		channels = 1
+	}
+	if otherChannels == 0 {
+		otherChannels = 1
+	}
+	return strings.EqualFold(c.Name, other.Name) && c.ClockRate == other.ClockRate && channels == otherChannels
+}
+
+// RTPMap returns a=rtpmap value.
+func (c Codec) RTPMap() string {
+	v := strconv.Itoa(int(c.PayloadType)) + " " + c.Name + "/" + strconv.FormatUint(uint64(c.ClockRate), 10)
+	if c.Channels > 0 {
+		v += "/" + strconv.Itoa(int(c.Channels))
+	}
+	return v
+}
+
+// static payload types, RFC 3551
+var staticCodecs = map[uint8]Codec{
+	0:  {0, "PCMU", 8000, 1, ""},
+	3:  {3, "GSM", 8000, 1, ""},
+	4:  {4, "G723", 8000, 1, ""},
+	8:  {8, "PCMA", 8000, 1, ""},
+	9:  {9, "G722", 8000, 1, ""},
+	13: {13, "CN", 8000, 1, ""},
+	18: {18, "G729", 8000, 1, ""},
+	26: {26, "JPEG", 90000, 0, ""},
+	31: {31, "H261", 90000, 0, ""},
+	34: {34, "H263", 90000, 0, ""},
+}
+
+// Codecs returns RTP payload formats of the media in the order of preference.
+// Static payload types without a=rtpmap are resolved from RFC 3551.
+func (m *Media) Codecs() []Codec {
+	if !m.IsRTP() {
+		return nil
+	}
+
+	rtpmaps := make(map[uint8]Codec)
+	for _, v := range m.Attributes.GetAll("rtpmap") {
+		if codec, err := ParseRTPMap(v); err == nil {
+			rtpmaps[codec.PayloadType] = codec
+		}
+	}
+	fmtps := make(map[uint8]string)
+	for _, v := range m.Attributes.GetAll("fmtp") {
+		parts := strings.SplitN(v, " ", 2)
+		if pt, err := strconv.ParseUint(parts[0], 10, 8); err == nil && len(parts) == 2 {
+			fmtps[uint8(pt)] = parts[1]
+		}
+	}
+
+	codecs := make([]Codec, 0, len(m.Formats))
+	for _, f := range m.Formats {
+		pt, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			continue
+		}
+		codec, ok := rtpmaps[uint8(pt)]
+		if !ok {
+			if codec, ok = staticCodecs[uint8(pt)]; !ok {
+				continue
+			}
+		}
+		codec.Fmtp = fmtps[uint8(pt)]
+		codecs = append(codecs, codec)
+	}
+
+	return codecs
+}
+
+// SetCodecs replaces formats, a=rtpmap and a=fmtp attributes of the media.
+func (m *Media) SetCodecs(codecs []Codec) {
+	m.Formats = make([]string, 0, len(codecs))
+	m.Attributes = m.Attributes.Remove("rtpmap").Remove("fmtp")
+	for _, codec := range codecs {
+		pt := strconv.Itoa(int(codec.PayloadType))
+		m.Formats = append(m.Formats, pt)
+		m.Attributes = m.Attributes.Add("rtpmap", codec.RTPMap())
+		if codec.Fmtp != "" {
+			m.Attributes = m.Attributes.Add("fmtp", pt+" "+codec.Fmtp)
+		}
+	}
+}
+
+// Candidates returns ICE candidates of the media (RFC 8839).
+func (m *Media) Candidates() ([]Candidate, error) {
+	var candidates []Candidate
+	for _, v := range m.Attributes.GetAll("candidate") {
+		c, err := ParseCandidate(v)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// Clone returns deep copy of the session.
+func (s *Session) Clone() *Session {
+	if s == nil {
+		return nil
+	}
+
+	c := *s
+	c.Emails = append([]string(nil), s.Emails...)
+	c.Phones = append([]string(nil), s.Phones...)
+	c.Connection = s.Connection.clone()
+	c.Bandwidths = append([]Bandwidth(nil), s.Bandwidths...)
+	c.Timings = cloneTimings(s.Timings)
+	c.Attributes = append(Attributes(nil), s.Attributes...)
+	c.Media = make([]*Media, len(s.Media))
+	for i, m := range s.Media {
+		c.Media[i] = m.Clone()
+	}
+
+	return &c
+}
+
+// Clone returns deep copy of the media.
+func (m *Media) Clone() *Media {
+	if m == nil {
+		return nil
+	}
+
+	c := *m
+	c.Formats = append([]string(nil), m.Formats...)
+	c.Connection = m.Connection.clone()
+	c.Bandwidths = append([]Bandwidth(nil), m.Bandwidths...)
+	c.Attributes = append(Attributes(nil), m.Attributes...)
+
+	return &c
+}
+
+func cloneTimings(timings []Timing) []Timing {
+	if timings == nil {
+		return nil
+	}
+	c := make([]Timing, len(timings))
+	for i, t := range timings {
+		t.Repeats = append([]string(nil), t.Repeats...)
+		c[i] = t
+	}
+	return c
+}
+
+func (c *Connection) clone() *Connection {
+	if c == nil {
+		return nil
+	}
+	cc := *c
+	return &cc
+}
@@ -0,0 +1,322 @@
+package sdp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sdp"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+var offerLines = []string{
+	"v=0",
+	"o=alice 2890844526 2890844526 IN IP4 atlanta.example.com",
+	"s=-",
+	"c=IN IP4 192.0.2.10",
+	"b=AS:128",
+	"t=0 0",
+	"a=ice-ufrag:8hhY",
+	"m=audio 49170 RTP/AVP 0 8 96 101",
+	"a=rtpmap:96 opus/48000/2",
+	"a=fmtp:96 useinbandfec=1",
+	"a=rtpmap:101 telephone-event/8000",
+	"a=fmtp:101 0-16",
+	"a=candidate:1 1 UDP 2130706431 192.0.2.10 49170 typ host",
+	"a=candidate:2 1 UDP 1694498815 198.51.100.1 49170 typ srflx raddr 192.0.2.10 rport 49170 generation 0",
+	"a=sendrecv",
+	"m=video 51372 RTP/AVP 31 97",
+	"a=rtpmap:97 H264/90000",
+	"",
+}
+
+func mustParse(t *testing.T, data string) *sdp.Session {
+	t.Helper()
+	s, err := sdp.Parse(data)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	s := mustParse(t, strings.Join(offerLines, "\r\n"))
+
+	if s.Origin.Username != "alice" || s.Origin.SessionVersion != 2890844526 || s.Origin.Address != "atlanta.example.com" {
+		t.Errorf("unexpected origin %+v", s.Origin)
+	}
+	if s.Connection == nil || s.Connection.Address != "192.0.2.10" {
+		t.Errorf("unexpected connection %+v", s.Connection)
+	}
+	if len(s.Bandwidths) != 1 || s.Bandwidths[0] != (sdp.Bandwidth{Type: "AS", Value: 128}) {
+		t.Errorf("unexpected bandwidths %+v", s.Bandwidths)
+	}
+	if v, ok := s.Attributes.Get("ice-ufrag"); !ok || v != "8hhY" {
+		t.Errorf("unexpected ice-ufrag %q", v)
+	}
+	if len(s.Media) != 2 {
+		t.Fatalf("expected 2 media, got %d", len(s.Media))
+	}
+
+	audio := s.Media[0]
+	if audio.Type != "audio" || audio.Port != 49170 || audio.Proto != "RTP/AVP" {
+		t.Errorf("unexpected media %+v", audio)
+	}
+	if audio.Direction(s) != sdp.SendRecv {
+		t.Errorf("unexpected direction %s", audio.Direction(s))
+	}
+
+	codecs := audio.Codecs()
+	expected := []sdp.Codec{
+		{PayloadType: 0, Name: "PCMU", ClockRate: 8000, Channels: 1},
+		{PayloadType: 8, Name: "PCMA", ClockRate: 8000, Channels: 1},
+		{PayloadType: 96, Name: "opus", ClockRate: 48000, Channels: 2, Fmtp: "useinbandfec=1"},
+		{PayloadType: 101, Name: "telephone-event", ClockRate: 8000, Fmtp: "0-16"},
+	}
+	if len(codecs) != len(expected) {
+		t.Fatalf("expected codecs %+v, got %+v", expected, codecs)
+	}
+	for i := range expected {
+		if codecs[i] != expected[i] {
+			t.Errorf("codec %d: expected %+v, got %+v", i, expected[i], codecs[i])
+		}
+	}
+
+	candidates, err := audio.Candidates()
+	if err != nil {
+		t.Fatalf("failed to parse candidates: %s", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(candidates))
+	}
+	srflx := candidates[1]
+	if srflx.Type != "srflx" || srflx.Priority != 1694498815 || srflx.RelAddr != "192.0.2.10" || srflx.RelPort != 49170 {
+		t.Errorf("unexpected candidate %+v", srflx)
+	}
+	if srflx.String() != strings.TrimPrefix(offerLines[13], "a=candidate:") {
+		t.Errorf("unexpected candidate string %q", srflx.String())
+	}
+
+	if s.Media[1].Direction(s) != sdp.SendRecv {
+		t.Errorf("expected default sendrecv direction, got %s", s.Media[1].Direction(s))
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	data := strings.Join(offerLines, "\r\n")
+	s := mustParse(t, data)
+	if s.String() != data {
+		t.Errorf("expected\n%s\ngot\n%s", data, s.String())
+	}
+
+	// LF line endings are accepted too
+	s = mustParse(t, strings.Join(offerLines, "\n"))
+	if s.String() != data {
+		t.Errorf("expected\n%s\ngot\n%s", data, s.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"empty":             "",
+		"no version first":  "o=- 1 1 IN IP4 127.0.0.1\r\nv=0\r\ns=-\r\n",
+		"missing origin":    "v=0\r\ns=-\r\nt=0 0\r\n",
+		"bad origin":        "v=0\r\no=- x 1 IN IP4 127.0.0.1\r\ns=-\r\n",
+		"bad line":          "v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=-\r\nfoo\r\n",
+		"bad media port":    "v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=-\r\nm=audio x RTP/AVP 0\r\n",
+		"duplicate session": "v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=-\r\ns=-\r\n",
+	}
+	for name, data := range cases {
+		if _, err := sdp.Parse(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if _, ok := err.(*sdp.ParseError); !ok {
+			t.Errorf("%s: expected *sdp.ParseError, got %T", name, err)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	var attrs sdp.Attributes
+	attrs = attrs.Add("ptime", "20").Add("rtpmap", "0 PCMU/8000").Add("ptime", "30")
+
+	attrs = attrs.Set("ptime", "40")
+	if len(attrs) != 2 || attrs[0] != (sdp.Attribute{Name: "ptime", Value: "40"}) {
+		t.Errorf("unexpected attributes %+v", attrs)
+	}
+
+	attrs = attrs.Remove("ptime")
+	if attrs.Has("ptime") || !attrs.Has("rtpmap") {
+		t.Errorf("unexpected attributes %+v", attrs)
+	}
+}
+
+func newLocal() *sdp.Session {
+	local := sdp.NewSession("bob", 1000, "2001:db8::1")
+	audio := sdp.NewMedia("audio", 40000, "RTP/AVP", []sdp.Codec{
+		{PayloadType: 111, Name: "OPUS", ClockRate: 48000, Channels: 2, Fmtp: "minptime=10"},
+		{PayloadType: 8, Name: "PCMA", ClockRate: 8000},
+		{PayloadType: 100, Name: "telephone-event", ClockRate: 8000, Fmtp: "0-15"},
+	})
+	audio.Attributes = audio.Attributes.Add("ptime", "20")
+	local.Media = append(local.Media, audio)
+	return local
+}
+
+func TestNewAnswer(t *testing.T) {
+	offer := mustParse(t, strings.Join(offerLines, "\r\n"))
+	local := newLocal()
+
+	answer, err := sdp.NewAnswer(offer, local)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if answer.Origin.Username != "bob" || answer.Origin.AddrType != "IP6" {
+		t.Errorf("unexpected origin %+v", answer.Origin)
+	}
+	if len(answer.Media) != 2 {
+		t.Fatalf("expected 2 media, got %d", len(answer.Media))
+	}
+
+	audio := answer.Media[0]
+	if audio.Port != 40000 {
+		t.Errorf("unexpected port %d", audio.Port)
+	}
+	if strings.Join(audio.Formats, " ") != "8 96 101" {
+		t.Errorf("expected offerer's payload types, got %v", audio.Formats)
+	}
+	codecs := audio.Codecs()
+	if codecs[1].Fmtp != "minptime=10" || codecs[2].Fmtp != "0-15" {
+		t.Errorf("expected local format parameters, got %+v", codecs)
+	}
+	if v, _ := audio.Attributes.Get("ptime"); v != "20" {
+		t.Errorf("expected local attributes to be kept, got %+v", audio.Attributes)
+	}
+	if audio.Direction(answer) != sdp.SendRecv {
+		t.Errorf("unexpected direction %s", audio.Direction(answer))
+	}
+
+	video := answer.Media[1]
+	if !video.Rejected() || video.Type != "video" || len(video.Formats) == 0 {
+		t.Errorf("expected video to be rejected, got %+v", video)
+	}
+
+	// local session must not be modified
+	if len(local.Media[0].Formats) != 3 || local.Media[0].Formats[0] != "111" {
+		t.Errorf("local session modified: %+v", local.Media[0])
+	}
+}
+
+func TestNewAnswerNotAcceptable(t *testing.T) {
+	offer := mustParse(t, strings.Join(offerLines, "\r\n"))
+	local := sdp.NewSession("bob", 1000, "192.0.2.20")
+	local.Media = append(local.Media, sdp.NewMedia("audio", 40000, "RTP/AVP", []sdp.Codec{
+		{PayloadType: 18, Name: "G729", ClockRate: 8000},
+	}))
+
+	answer, err := sdp.NewAnswer(offer, local)
+	if err != sdp.ErrNotAcceptable {
+		t.Fatalf("expected ErrNotAcceptable, got %v", err)
+	}
+	if len(answer.Media) != 2 || !answer.Media[0].Rejected() || !answer.Media[1].Rejected() {
+		t.Errorf("expected all media to be rejected, got %s", answer)
+	}
+}
+
+func TestHoldResume(t *testing.T) {
+	offer := mustParse(t, strings.Join(offerLines, "\r\n"))
+	local := newLocal()
+	version := offer.Origin.SessionVersion
+
+	sdp.Hold(offer)
+	if offer.Origin.SessionVersion != version+1 {
+		t.Errorf("expected session version to be incremented")
+	}
+	if offer.Media[0].Direction(offer) != sdp.SendOnly {
+		t.Errorf("expected sendonly, got %s", offer.Media[0].Direction(offer))
+	}
+	if !sdp.IsHold(offer) {
+		t.Errorf("expected session to be on hold")
+	}
+
+	answer, err := sdp.NewAnswer(offer, local)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if answer.Media[0].Direction(answer) != sdp.RecvOnly {
+		t.Errorf("expected recvonly answer to hold, got %s", answer.Media[0].Direction(answer))
+	}
+
+	sdp.Resume(offer)
+	if offer.Media[0].Direction(offer) != sdp.SendRecv {
+		t.Errorf("expected sendrecv, got %s", offer.Media[0].Direction(offer))
+	}
+	if sdp.IsHold(offer) {
+		t.Errorf("expected session to be resumed")
+	}
+
+	legacy := mustParse(t, strings.Replace(strings.Join(offerLines, "\r\n"), "c=IN IP4 192.0.2.10", "c=IN IP4 0.0.0.0", 1))
+	if !sdp.IsHold(legacy) {
+		t.Errorf("expected legacy hold to be detected")
+	}
+}
+
+func TestMessageBody(t *testing.T) {
+	msg, err := parser.ParseMessage([]byte(strings.Join([]string{
+		"INVITE sip:bob@example.com SIP/2.0",
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK.1",
+		"From: <sip:alice@example.com>;tag=1",
+		"To: <sip:bob@example.com>",
+		"Call-ID: sdp-test",
+		"CSeq: 1 INVITE",
+		"Content-Type: text/plain",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("failed to parse message: %s", err)
+	}
+
+	if _, err := sdp.FromMessage(msg); err == nil {
+		t.Errorf("expected error for message without SDP")
+	}
+
+	offer := mustParse(t, strings.Join(offerLines, "\r\n"))
+	sdp.SetBody(msg, offer)
+
+	if hdrs := msg.GetHeaders("Content-Type"); len(hdrs) != 1 || hdrs[0].Value() != sdp.ContentType {
+		t.Errorf("unexpected Content-Type %v", hdrs)
+	}
+	if hdr, ok := msg.ContentLength(); !ok || int(*hdr) != len(offer.String()) {
+		t.Errorf("unexpected Content-Length %v", hdr)
+	}
+
+	ct := sip.ContentType("Application/SDP; charset=utf-8")
+	msg.ReplaceHeaders("Content-Type", []sip.Header{&ct})
+	s, err := sdp.FromMessage(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s.String() != offer.String() {
+		t.Errorf("expected\n%s\ngot\n%s", offer, s)
+	}
+}
+
+func TestMultipartMessageBody(t *testing.T) {
+	offer := mustParse(t, strings.Join(offerLines, "\r\n"))
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	sip.SetMultipartBody(req, sip.NewMultipartBody(
+		sip.NewBodyPart("application/pidf+xml", []byte("<presence/>")),
+		sip.NewBodyPart(sdp.ContentType, offer.Marshal()),
+	))
+
+	s, err := sdp.FromMessage(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s.String() != offer.String() {
+		t.Errorf("expected\n%s\ngot\n%s", offer, s)
+	}
+}
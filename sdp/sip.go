@@ -0,0 +1,57 @@
+package sdp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// ContentType is the media type of session descriptions.
+const ContentType = "application/sdp"
+
+// SetBody sets session description as the message body
+// and updates Content-Type and Content-Length headers.
+func SetBody(msg sip.Message, s *Session) {
+	contentType := sip.ContentType(ContentType)
+	if hdrs := msg.GetHeaders("Content-Type"); len(hdrs) == 0 {
+		msg.AppendHeader(&contentType)
+	} else {
+		msg.ReplaceHeaders("Content-Type", []sip.Header{&contentType})
+	}
+	msg.SetBody(s.String(), true)
+}
+
+// HasBody returns true if the message has session description in the body.
+func HasBody(msg sip.Message) bool {
+	if msg.Body() == "" {
+		return false
+	}
+	hdr, ok := msg.ContentType()
+	if !ok {
+		return false
+	}
+	mediaType := strings.TrimSpace(strings.SplitN(hdr.Value(), ";", 2)[0])
+	return strings.EqualFold(mediaType, ContentType)
+}
+
+// FromMessage parses session description from the message body.
+// Content-Type of the message is checked ignoring media type parameters,
+// session description is looked up in the parts of multipart bodies too.
+func FromMessage(msg sip.Message) (*Session, error) {
+	if HasBody(msg) {
+		return Parse(msg.Body())
+	}
+
+	if hdr, ok := msg.ContentType(); ok && strings.HasPrefix(strings.ToLower(hdr.Value()), "multipart/") {
+		body, err := sip.MultipartBodyFromMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		if part, ok := body.Part(ContentType); ok {
+			return Parse(string(part.Body))
+		}
+	}
+
+	return nil, fmt.Errorf("message %s has no %s body", msg.Short(), ContentType)
+}
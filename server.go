@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/tracing"
 	"github.com/ghettovoice/gosip/transaction"
 	"github.com/ghettovoice/gosip/transport"
 	"github.com/ghettovoice/gosip/util"
@@ -26,16 +32,24 @@ type Server interface {
 	Shutdown()
 
 	Listen(network, addr string, options ...transport.ListenOption) error
-	Send(msg sip.Message) error
+	// WsHandler returns http.Handler that accepts SIP over WebSocket connections,
+	// see transport.Layer.
+	WsHandler(network string, options ...transport.WsHandlerOption) (http.Handler, error)
 
+	Sender
 	Request(req sip.Request) (sip.ClientTransaction, error)
+	OnRequest(method sip.RequestMethod, handler RequestHandler) error
+}
+
+// Sender sends requests and responses, it is the part of Server
+// used by the dialog usages and services built on top of it.
+type Sender interface {
+	Send(msg sip.Message) error
 	RequestWithContext(
 		ctx context.Context,
 		request sip.Request,
 		options ...RequestWithContextOption,
 	) (sip.Response, error)
-	OnRequest(method sip.RequestMethod, handler RequestHandler) error
-
 	Respond(res sip.Response) (sip.ServerTransaction, error)
 	RespondOnRequest(
 		request sip.Request,
@@ -50,9 +64,14 @@ type TransportLayerFactory func(
 	dnsResolver *net.Resolver,
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...transport.LayerOption,
 ) transport.Layer
 
-type TransactionLayerFactory func(tpl sip.Transport, logger log.Logger) transaction.Layer
+type TransactionLayerFactory func(
+	tpl sip.Transport,
+	logger log.Logger,
+	options ...transaction.LayerOption,
+) transaction.Layer
 
 // ServerConfig describes available options
 type ServerConfig struct {
@@ -63,6 +82,30 @@ type ServerConfig struct {
 	Extensions []string
 	MsgMapper  sip.MessageMapper
 	UserAgent  string
+	// TxTimings is a set of transaction timers, zero values fallback to RFC 3261 defaults.
+	TxTimings transaction.Timings
+	// TxObserver receives transaction lifecycle events, see transaction.Metrics.
+	TxObserver transaction.Observer
+	// Tracer records spans of transactions, request handlers and DNS lookups.
+	Tracer tracing.Tracer
+	// CaptureTap receives copies of all sent and received messages, see capture package.
+	CaptureTap transport.CaptureTap
+	// Clock drives transaction and connection timers, default is the real clock.
+	Clock timing.Clock
+	// TrustDomain enables enforcement of asserted identity and privacy, see TrustDomain.
+	TrustDomain *TrustDomain
+	// ParserLimits bounds the size of incoming messages, nil means parser.DefaultLimits.
+	ParserLimits *parser.Limits
+	// WsKeepAlive configures pings of WebSocket connections, nil means transport.DefaultWsKeepAlive.
+	WsKeepAlive *transport.WsKeepAlive
+	// AcceptContentTypes are media types accepted in request bodies, see RequestValidator.
+	// Empty list accepts any body.
+	AcceptContentTypes []string
+	// DisableRequestValidation turns off RequestValidator checks,
+	// requests are passed to request handlers as they are received.
+	DisableRequestValidation bool
+	// RateLimiter limits rate of incoming requests before server transactions are created for them.
+	RateLimiter *RateLimiter
 }
 
 // Server is a SIP server
@@ -77,10 +120,19 @@ type server struct {
 	requestHandlers map[sip.RequestMethod]RequestHandler
 	extensions      []string
 	userAgent       string
+	tracer          tracing.Tracer
+	trustDomain     *TrustDomain
+	validator       *RequestValidator
+	rateLimiter     *RateLimiter
+	rejects         chan sip.Response
 
 	log log.Logger
 }
 
+// rateRejectQueueSize bounds 503 responses to requests over the rate limit waiting to be sent,
+// further rejected requests are dropped until the queue drains.
+const rateRejectQueueSize = 256
+
 // NewServer creates new instance of SIP server.
 func NewServer(
 	config ServerConfig,
@@ -138,6 +190,25 @@ func NewServer(
 		userAgent = "GoSIP"
 	}
 
+	tracer := config.Tracer
+	if tracer == nil {
+		tracer = tracing.NoopTracer()
+	}
+
+	clock := config.Clock
+	if clock == nil {
+		clock = timing.NewRealClock()
+	}
+
+	txObserver := config.TxObserver
+	if config.Tracer != nil {
+		if txObserver == nil {
+			txObserver = transaction.NewTracingObserver(config.Tracer)
+		} else {
+			txObserver = transaction.Observers(txObserver, transaction.NewTracingObserver(config.Tracer))
+		}
+	}
+
 	srv := &server{
 		host:            host,
 		ip:              ip,
@@ -146,16 +217,49 @@ func NewServer(
 		requestHandlers: make(map[sip.RequestMethod]RequestHandler),
 		extensions:      extensions,
 		userAgent:       userAgent,
+		tracer:          tracer,
+		trustDomain:     config.TrustDomain,
+		rateLimiter:     config.RateLimiter,
+	}
+	if !config.DisableRequestValidation {
+		srv.validator = &RequestValidator{
+			Extensions:   extensions,
+			ContentTypes: config.AcceptContentTypes,
+		}
 	}
 	srv.log = logger.WithFields(log.Fields{
 		"sip_server_ptr": fmt.Sprintf("%p", srv),
 	})
-	srv.tp = tpFactory(ip, dnsResolver, config.MsgMapper, srv.Log())
+	tpOptions := []transport.LayerOption{transport.WithTracer(tracer), transport.WithClock(clock)}
+	if config.CaptureTap != nil {
+		tpOptions = append(tpOptions, transport.WithCaptureTap(config.CaptureTap))
+	}
+	if config.ParserLimits != nil {
+		tpOptions = append(tpOptions, transport.WithParserLimits(*config.ParserLimits))
+	}
+	if config.WsKeepAlive != nil {
+		tpOptions = append(tpOptions, transport.WithWsKeepAlive(*config.WsKeepAlive))
+	}
+	srv.tp = tpFactory(ip, dnsResolver, config.MsgMapper, srv.Log(), tpOptions...)
 	sipTp := &sipTransport{
 		tpl: srv.tp,
 		srv: srv,
 	}
-	srv.tx = txFactory(sipTp, log.AddFieldsFrom(srv.Log(), srv.tp))
+	txOptions := []transaction.LayerOption{
+		transaction.WithTimings(config.TxTimings),
+		transaction.WithObserver(txObserver),
+		transaction.WithClock(clock),
+	}
+	if srv.rateLimiter != nil {
+		if srv.rateLimiter.Clock == nil {
+			srv.rateLimiter.Clock = clock
+		}
+		srv.rejects = make(chan sip.Response, rateRejectQueueSize)
+		srv.hwg.Add(1)
+		go srv.sendRejects()
+		txOptions = append(txOptions, transaction.WithAdmission(srv.admit))
+	}
+	srv.tx = txFactory(sipTp, log.AddFieldsFrom(srv.Log(), srv.tp), txOptions...)
 
 	srv.running.Set()
 	go srv.serve()
@@ -172,6 +276,10 @@ func (srv *server) Listen(network string, listenAddr string, options ...transpor
 	return srv.tp.Listen(network, listenAddr, options...)
 }
 
+func (srv *server) WsHandler(network string, options ...transport.WsHandlerOption) (http.Handler, error) {
+	return srv.tp.WsHandler(network, options...)
+}
+
 func (srv *server) serve() {
 	defer srv.Shutdown()
 
@@ -225,12 +333,82 @@ func (srv *server) serve() {
 	}
 }
 
+// admit checks the request against the rate limit before a server transaction is created for it.
+// Requests over the limit are dropped or rejected statelessly, the response is queued to be sent
+// off the transaction layer loop, the request is dropped if the queue is full.
+func (srv *server) admit(req sip.Request) bool {
+	allowed, retryAfter := srv.rateLimiter.Allow(req)
+	if allowed {
+		return true
+	}
+
+	logger := srv.Log().WithFields(req.Fields())
+
+	if srv.rateLimiter.Action == RateDrop {
+		logger.Debug("drop SIP request over the rate limit")
+
+		return false
+	}
+
+	logger.Debug("reject SIP request over the rate limit")
+
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	res := sip.NewResponseFromRequest("", req, 503, "Service Unavailable", "")
+	res.AppendHeader(&sip.GenericHeader{
+		HeaderName: "Retry-After",
+		Contents:   strconv.FormatInt(seconds, 10),
+	})
+
+	select {
+	case srv.rejects <- res:
+	default:
+		logger.Debug("drop SIP request over the rate limit, reject queue is full")
+	}
+
+	return false
+}
+
+func (srv *server) sendRejects() {
+	defer srv.hwg.Done()
+
+	for res := range srv.rejects {
+		if err := srv.Send(res); err != nil {
+			srv.Log().WithFields(res.Fields()).Errorf("respond '503 Service Unavailable' failed: %s", err)
+		}
+	}
+}
+
+func (srv *server) validate(req sip.Request, tx sip.ServerTransaction) sip.Response {
+	if srv.validator == nil {
+		return nil
+	}
+
+	return srv.validator.Validate(req, tx)
+}
+
 func (srv *server) handleRequest(req sip.Request, tx sip.ServerTransaction) {
 	defer srv.hwg.Done()
 
 	logger := srv.Log().WithFields(req.Fields())
 	logger.Debug("routing incoming SIP request...")
 
+	if res := srv.validate(req, tx); res != nil {
+		logger.Warnf("reject invalid SIP request with '%d %s'", res.StatusCode(), res.Reason())
+
+		if _, err := srv.Respond(res); err != nil {
+			logger.Errorf("respond '%d %s' failed: %s", res.StatusCode(), res.Reason(), err)
+		}
+
+		return
+	}
+
+	if srv.trustDomain != nil {
+		srv.trustDomain.Inbound(req)
+	}
+
 	srv.hmu.RLock()
 	handler, ok := srv.requestHandlers[req.Method()]
 	srv.hmu.RUnlock()
@@ -267,16 +445,30 @@ func (srv *server) handleRequest(req sip.Request, tx sip.ServerTransaction) {
 		return
 	}
 
-	go handler(req, tx)
+	go func() {
+		_, span := srv.tracer.Start(
+			tracing.ContextFromMessage(context.Background(), req),
+			"SIP handler "+string(req.Method()),
+			tracing.SpanKindInternal,
+			tracing.String("sip.method", string(req.Method())),
+		)
+		defer span.End()
+
+		handler(req, tx)
+	}()
 }
 
 // Send SIP message
 func (srv *server) Request(req sip.Request) (sip.ClientTransaction, error) {
+	return srv.request(req)
+}
+
+func (srv *server) request(req sip.Request, options ...transaction.TxOption) (sip.ClientTransaction, error) {
 	if !srv.running.IsSet() {
 		return nil, fmt.Errorf("can not send through stopped server")
 	}
 
-	return srv.tx.Request(srv.prepareRequest(req))
+	return srv.tx.Request(srv.prepareRequest(req), options...)
 }
 
 func (srv *server) RequestWithContext(
@@ -293,16 +485,21 @@ func (srv *server) requestWithContext(
 	attempt int,
 	options ...RequestWithContextOption,
 ) (sip.Response, error) {
-	tx, err := srv.Request(request)
-	if err != nil {
-		return nil, err
-	}
-
 	optionsHash := &RequestWithContextOptions{}
 	for _, opt := range options {
 		opt.ApplyRequestWithContext(optionsHash)
 	}
 
+	// continue trace from the context, client transaction span becomes its child
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		tracing.Inject(request, sc)
+	}
+
+	tx, err := srv.request(request, optionsHash.TransactionOptions...)
+	if err != nil {
+		return nil, err
+	}
+
 	txResponses := tx.Responses()
 	txErrs := tx.Errors()
 	responses := make(chan sip.Response, 1)
@@ -429,6 +626,9 @@ func (srv *server) requestWithContext(
 
 func (srv *server) prepareRequest(req sip.Request) sip.Request {
 	srv.appendAutoHeaders(req)
+	if srv.trustDomain != nil {
+		srv.trustDomain.Outbound(req)
+	}
 
 	return req
 }
@@ -477,6 +677,9 @@ func (srv *server) Send(msg sip.Message) error {
 
 func (srv *server) prepareResponse(res sip.Response) sip.Response {
 	srv.appendAutoHeaders(res)
+	if srv.trustDomain != nil {
+		srv.trustDomain.Outbound(res)
+	}
 
 	return res
 }
@@ -490,6 +693,10 @@ func (srv *server) Shutdown() {
 	// stop transaction layer
 	srv.tx.Cancel()
 	<-srv.tx.Done()
+	// no more requests are admitted
+	if srv.rejects != nil {
+		close(srv.rejects)
+	}
 	// stop transport layer
 	srv.tp.Cancel()
 	<-srv.tp.Done()
@@ -553,7 +760,7 @@ func (srv *server) appendAutoHeaders(msg sip.Message) {
 	}
 
 	if hdrs := msg.GetHeaders("Content-Length"); len(hdrs) == 0 {
-		msg.SetBody(msg.Body(), true)
+		msg.SetBodyBytes(msg.BodyBytes(), true)
 	}
 }
 
@@ -55,7 +55,9 @@ var _ = Describe("GoSIP Server", func() {
 			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + inviteBranch,
 			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
 			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: " + sip.GenerateBranch(),
 			"CSeq: 1 INVITE",
+			"Max-Forwards: 70",
 			"Content-Length: 0",
 			"",
 			"",
@@ -92,7 +94,9 @@ var _ = Describe("GoSIP Server", func() {
 			"Via: SIP/2.0/TCP " + clientAddr + ";branch=" + sip.GenerateBranch(),
 			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
 			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: " + sip.GenerateBranch(),
 			"CSeq: 1 INVITE",
+			"Max-Forwards: 70",
 			"Content-Length: 0",
 			"",
 			"",
@@ -143,7 +147,9 @@ var _ = Describe("GoSIP Server", func() {
 			"Via: SIP/2.0/WS " + clientAddr + ";branch=" + sip.GenerateBranch(),
 			"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
 			"To: \"Bob\" <sip:bob@far-far-away.com>",
+			"Call-ID: " + sip.GenerateBranch(),
 			"CSeq: 1 INVITE",
+			"Max-Forwards: 70",
 			"Content-Length: 0",
 			"",
 			"",
@@ -177,6 +183,55 @@ var _ = Describe("GoSIP Server", func() {
 		wg.Wait()
 	}, 3)
 
+	It("should reject invalid requests via UDP transport", func(done Done) {
+		defer close(done)
+
+		client, err := net.ListenPacket("udp", clientAddr)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer func() {
+			Expect(client.Close()).To(BeNil())
+		}()
+		raddr, err := net.ResolveUDPAddr("udp", localTarget.Addr())
+		Expect(err).ShouldNot(HaveOccurred())
+
+		handled := int32(0)
+		Expect(srv.OnRequest(sip.INFO, func(req sip.Request, tx sip.ServerTransaction) {
+			atomic.AddInt32(&handled, 1)
+		})).To(Succeed())
+
+		for _, c := range []struct {
+			headers []string
+			status  sip.StatusCode
+		}{
+			{[]string{"Max-Forwards: 70"}, 400},
+			{[]string{"Call-ID: " + sip.GenerateBranch(), "Max-Forwards: 70", "Require: foo"}, 420},
+			{[]string{"Call-ID: " + sip.GenerateBranch(), "Max-Forwards: 0"}, 483},
+		} {
+			lines := []string{
+				"INFO sip:bob@example.com SIP/2.0",
+				"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+				"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774",
+				"To: \"Bob\" <sip:bob@far-far-away.com>",
+				"CSeq: 1 INFO",
+			}
+			lines = append(lines, c.headers...)
+			lines = append(lines, "Content-Length: 0", "", "")
+			_, err = client.WriteTo([]byte(testutils.Request(lines).String()), raddr)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			buf := make([]byte, transport.MTU)
+			Expect(client.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			n, _, err := client.ReadFrom(buf)
+			Expect(err).ShouldNot(HaveOccurred())
+			msg, err := parser.ParseMessage(buf[:n], logger)
+			Expect(err).ShouldNot(HaveOccurred())
+			res, ok := msg.(sip.Response)
+			Expect(ok).Should(BeTrue())
+			Expect(res.StatusCode()).Should(Equal(c.status))
+		}
+		Expect(atomic.LoadInt32(&handled)).To(BeZero())
+	}, 3)
+
 	It("should send INVITE request through TX layer with UDP transport", func(done Done) {
 		defer close(done)
 
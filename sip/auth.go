@@ -21,9 +21,46 @@ type Authorization struct {
 	qop       string
 	nc        string
 	cnonce    string
+	opaque    string
 	other     map[string]string
 }
 
+// AuthFromParams creates Authorization from params of the Digest challenge.
+func AuthFromParams(params AuthParams) *Authorization {
+	auth := &Authorization{
+		algorithm: "MD5",
+		other:     make(map[string]string),
+	}
+
+	for _, param := range params {
+		switch strings.ToLower(param.Name) {
+		case "realm":
+			auth.realm = param.Value
+		case "algorithm":
+			auth.algorithm = param.Value
+		case "nonce":
+			auth.nonce = param.Value
+		case "opaque":
+			auth.opaque = param.Value
+		case "qop":
+			for _, v := range strings.Split(param.Value, ",") {
+				v = strings.Trim(v, " ")
+				if v == "auth" || v == "auth-int" {
+					auth.qop = "auth"
+					break
+				}
+			}
+		default:
+			auth.other[param.Name] = param.Value
+		}
+	}
+
+	return auth
+}
+
+// AuthFromValue parses the challenge from the raw header value.
+//
+// Deprecated: only quoted params are recognized, use AuthFromParams with typed headers instead.
 func AuthFromValue(value string) *Authorization {
 	auth := &Authorization{
 		algorithm: "MD5",
@@ -58,6 +95,8 @@ func AuthFromValue(value string) *Authorization {
 			auth.nc = match[2]
 		case "cnonce":
 			auth.cnonce = match[2]
+		case "opaque":
+			auth.opaque = match[2]
 		default:
 			auth.other[match[1]] = match[2]
 		}
@@ -142,6 +181,10 @@ func (auth *Authorization) SetCNonce(cnonce string) {
 	auth.cnonce = cnonce
 }
 
+func (auth *Authorization) Opaque() string {
+	return auth.opaque
+}
+
 func (auth *Authorization) CalcResponse() string {
 	return calcResponse(
 		auth.username,
@@ -156,25 +199,36 @@ func (auth *Authorization) CalcResponse() string {
 	)
 }
 
+// Params returns params of the Digest credentials.
+func (auth *Authorization) Params() AuthParams {
+	params := AuthParams{
+		{Name: "realm", Value: auth.realm, Quoted: true},
+		{Name: "algorithm", Value: auth.algorithm},
+		{Name: "nonce", Value: auth.nonce, Quoted: true},
+		{Name: "username", Value: auth.username, Quoted: true},
+		{Name: "uri", Value: auth.uri, Quoted: true},
+		{Name: "response", Value: auth.response, Quoted: true},
+	}
+	if auth.opaque != "" {
+		params = append(params, AuthParam{Name: "opaque", Value: auth.opaque, Quoted: true})
+	}
+	if auth.qop == "auth" {
+		params = append(params,
+			AuthParam{Name: "qop", Value: auth.qop},
+			AuthParam{Name: "nc", Value: auth.nc},
+			AuthParam{Name: "cnonce", Value: auth.cnonce, Quoted: true},
+		)
+	}
+
+	return params
+}
+
 func (auth *Authorization) String() string {
 	if auth == nil {
 		return "<nil>"
 	}
 
-	str := fmt.Sprintf(
-		`Digest realm="%s",algorithm=%s,nonce="%s",username="%s",uri="%s",response="%s"`,
-		auth.realm,
-		auth.algorithm,
-		auth.nonce,
-		auth.username,
-		auth.uri,
-		auth.response,
-	)
-	if auth.qop == "auth" {
-		str += fmt.Sprintf(`,qop=%s,nc=%s,cnonce="%s"`, auth.qop, auth.nc, auth.cnonce)
-	}
-
-	return str
+	return authValue("Digest", auth.Params())
 }
 
 // calculates Authorization response https://www.ietf.org/rfc/rfc2617.txt
@@ -208,20 +262,51 @@ func AuthorizeRequest(request Request, response Response, user, password MaybeSt
 	}
 
 	var authenticateHeaderName, authorizeHeaderName string
+	var newCredentials func(params AuthParams) Header
 	if response.StatusCode() == 401 {
 		// on 401 Unauthorized increase request seq num, add Authorization header and send once again
 		authenticateHeaderName = "WWW-Authenticate"
 		authorizeHeaderName = "Authorization"
+		newCredentials = func(params AuthParams) Header {
+			return &AuthorizationHeader{Scheme: "Digest", Params: params}
+		}
 	} else {
 		// 407 Proxy authentication
 		authenticateHeaderName = "Proxy-Authenticate"
 		authorizeHeaderName = "Proxy-Authorization"
+		newCredentials = func(params AuthParams) Header {
+			return &ProxyAuthorizationHeader{Scheme: "Digest", Params: params}
+		}
 	}
 
-	if hdrs := response.GetHeaders(authenticateHeaderName); len(hdrs) > 0 {
-		authenticateHeader := hdrs[0].(*GenericHeader)
-		auth := AuthFromValue(authenticateHeader.Contents).
-			SetMethod(string(request.Method())).
+	hdrs := response.GetHeaders(authenticateHeaderName)
+	if len(hdrs) == 0 {
+		return fmt.Errorf("authorize request: header '%s' not found in response", authenticateHeaderName)
+	}
+
+	// forking proxies may aggregate challenges of several realms, each one requires own credentials
+	credentials := make([]Header, 0, len(hdrs))
+	realms := make(map[string]bool)
+	for _, hdr := range hdrs {
+		var auth *Authorization
+		switch h := hdr.(type) {
+		case *WWWAuthenticateHeader:
+			if strings.EqualFold(h.Scheme, "Digest") {
+				auth = AuthFromParams(h.Params)
+			}
+		case *ProxyAuthenticateHeader:
+			if strings.EqualFold(h.Scheme, "Digest") {
+				auth = AuthFromParams(h.Params)
+			}
+		case *GenericHeader:
+			auth = AuthFromValue(h.Contents)
+		}
+		if auth == nil || !strings.EqualFold(auth.Algorithm(), "MD5") || realms[auth.Realm()] {
+			continue
+		}
+		realms[auth.Realm()] = true
+
+		auth.SetMethod(string(request.Method())).
 			SetUri(request.Recipient().String()).
 			SetUsername(user.String())
 		if password != nil {
@@ -238,18 +323,18 @@ func AuthorizeRequest(request Request, response Response, user, password MaybeSt
 		}
 		auth.SetResponse(auth.CalcResponse())
 
-		if hdrs = request.GetHeaders(authorizeHeaderName); len(hdrs) > 0 {
-			authorizationHeader := hdrs[0].Clone().(*GenericHeader)
-			authorizationHeader.Contents = auth.String()
-			request.ReplaceHeaders(authorizationHeader.Name(), []Header{authorizationHeader})
-		} else {
-			request.AppendHeader(&GenericHeader{
-				HeaderName: authorizeHeaderName,
-				Contents:   auth.String(),
-			})
-		}
+		credentials = append(credentials, newCredentials(auth.Params()))
+	}
+	if len(credentials) == 0 {
+		return fmt.Errorf("authorize request: no supported challenge in '%s' header", authenticateHeaderName)
+	}
+
+	if len(request.GetHeaders(authorizeHeaderName)) > 0 {
+		request.ReplaceHeaders(authorizeHeaderName, credentials)
 	} else {
-		return fmt.Errorf("authorize request: header '%s' not found in response", authenticateHeaderName)
+		for _, header := range credentials {
+			request.AppendHeader(header)
+		}
 	}
 
 	if viaHop, ok := request.ViaHop(); ok {
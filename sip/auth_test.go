@@ -0,0 +1,108 @@
+package sip_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func md5hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	logger := log.NewDefaultLogrusLogger()
+	msg, err := parser.ParseMessage([]byte(strings.Join([]string{
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 1 INVITE",
+		"Proxy-Authorization: Digest username=\"alice\", realm=\"old\", nonce=\"x\", uri=\"sip:bob@biloxi.com\", response=\"y\"",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), logger)
+	if err != nil {
+		t.Fatalf("failed to parse request: %s", err)
+	}
+	req := msg.(sip.Request)
+
+	msg, err = parser.ParseMessage([]byte(strings.Join([]string{
+		"SIP/2.0 407 Proxy Authentication Required",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"From: <sip:alice@atlanta.com>;tag=1928301774",
+		"To: <sip:bob@biloxi.com>;tag=8321234356",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 1 INVITE",
+		"Proxy-Authenticate: Digest realm=\"atlanta.com, inc\", nonce=\"n1\", opaque=\"o1\", qop=\"auth\", algorithm=MD5",
+		"Proxy-Authenticate: Digest realm=\"biloxi.com\", nonce=\"n2\", stale=FALSE, NTLM realm=\"biloxi.com\"",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), logger)
+	if err != nil {
+		t.Fatalf("failed to parse response: %s", err)
+	}
+	res := msg.(sip.Response)
+
+	if err := sip.AuthorizeRequest(req, res, sip.String{Str: "alice"}, sip.String{Str: "secret"}); err != nil {
+		t.Fatalf("authorize request failed: %s", err)
+	}
+
+	// the request is sent, so check it as it is received by proxy
+	msg, err = parser.ParseMessage([]byte(req.String()), logger)
+	if err != nil {
+		t.Fatalf("failed to parse authorized request: %s\n%s", err, req)
+	}
+	hdrs := msg.GetHeaders("Proxy-Authorization")
+	if len(hdrs) != 2 {
+		t.Fatalf("expected credentials for 2 realms, got:\n%s", msg)
+	}
+
+	ha2 := md5hex("INVITE:sip:bob@biloxi.com")
+
+	first := hdrs[0].(*sip.ProxyAuthorizationHeader)
+	cnonce, _ := first.Params.Get("cnonce")
+	expected := md5hex(md5hex("alice:atlanta.com, inc:secret") + ":n1:00000001:" + cnonce + ":auth:" + ha2)
+	if response, _ := first.Params.Get("response"); response != expected {
+		t.Errorf("unexpected response %q, expected %q", response, expected)
+	}
+	if opaque, _ := first.Params.Get("opaque"); opaque != "o1" {
+		t.Errorf("opaque must be echoed, got %q", opaque)
+	}
+	if qop, _ := first.Params.Get("qop"); qop != "auth" {
+		t.Errorf("unexpected qop %q", qop)
+	}
+
+	second := hdrs[1].(*sip.ProxyAuthorizationHeader)
+	expected = md5hex(md5hex("alice:biloxi.com:secret") + ":n2:" + ha2)
+	if response, _ := second.Params.Get("response"); response != expected {
+		t.Errorf("unexpected response %q, expected %q", response, expected)
+	}
+
+	if cseq, _ := msg.CSeq(); cseq.SeqNo != 2 {
+		t.Errorf("CSeq must be incremented, got %d", cseq.SeqNo)
+	}
+}
+
+func TestAuthorizeRequestUnsupportedChallenge(t *testing.T) {
+	req := sip.NewRequest("", sip.REGISTER, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", []sip.Header{}, "", nil)
+	res := sip.NewResponse("", "SIP/2.0", 401, "Unauthorized", []sip.Header{
+		&sip.WWWAuthenticateHeader{
+			Scheme: "Digest",
+			Params: sip.AuthParams{{Name: "realm", Value: "example.com", Quoted: true}, {Name: "algorithm", Value: "SHA-512-256"}},
+		},
+	}, "", nil)
+
+	if err := sip.AuthorizeRequest(req, res, sip.String{Str: "alice"}, nil); err == nil {
+		t.Errorf("expected error for unsupported algorithm")
+	}
+}
@@ -0,0 +1,266 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// AuthParam is a single auth-param of the challenge or credentials (RFC 3261 s. 25.1).
+type AuthParam struct {
+	Name  string
+	Value string
+	// Quoted is true if the value is a quoted-string.
+	Quoted bool
+}
+
+func (param AuthParam) String() string {
+	if !param.Quoted {
+		return param.Name + "=" + param.Value
+	}
+
+	value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(param.Value)
+	return param.Name + "=\"" + value + "\""
+}
+
+// AuthParams is an ordered list of auth-params, the order and quoting of values are kept as received.
+type AuthParams []AuthParam
+
+// Get returns value of the param, names are case-insensitive.
+func (params AuthParams) Get(name string) (string, bool) {
+	for _, param := range params {
+		if strings.EqualFold(param.Name, name) {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces value of the param or appends a new one.
+func (params *AuthParams) Set(name, value string, quoted bool) {
+	for i, param := range *params {
+		if strings.EqualFold(param.Name, name) {
+			(*params)[i].Value = value
+			(*params)[i].Quoted = quoted
+			return
+		}
+	}
+	*params = append(*params, AuthParam{Name: name, Value: value, Quoted: quoted})
+}
+
+func (params AuthParams) String() string {
+	var buffer bytes.Buffer
+	for i, param := range params {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(param.String())
+	}
+	return buffer.String()
+}
+
+func (params AuthParams) Clone() AuthParams {
+	if params == nil {
+		return nil
+	}
+	return append(AuthParams{}, params...)
+}
+
+// Equals compares params regardless of the order.
+func (params AuthParams) Equals(other AuthParams) bool {
+	if len(params) != len(other) {
+		return false
+	}
+	for _, param := range params {
+		value, ok := other.Get(param.Name)
+		if !ok || value != param.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func authValue(scheme string, params AuthParams) string {
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + params.String()
+}
+
+// WWWAuthenticateHeader introduces SIP 'WWW-Authenticate' header (RFC 3261 s. 20.44).
+// Each challenge is represented by a separate header.
+type WWWAuthenticateHeader struct {
+	// Scheme is the authentication scheme, e.g. Digest.
+	Scheme string
+	Params AuthParams
+}
+
+func (auth *WWWAuthenticateHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *WWWAuthenticateHeader) Name() string { return "WWW-Authenticate" }
+
+func (auth *WWWAuthenticateHeader) Value() string {
+	return authValue(auth.Scheme, auth.Params)
+}
+
+func (auth *WWWAuthenticateHeader) Clone() Header {
+	var newAuth *WWWAuthenticateHeader
+	if auth == nil {
+		return newAuth
+	}
+
+	return &WWWAuthenticateHeader{
+		Scheme: auth.Scheme,
+		Params: auth.Params.Clone(),
+	}
+}
+
+func (auth *WWWAuthenticateHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*WWWAuthenticateHeader); ok {
+		if auth == h {
+			return true
+		}
+		if auth == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(auth.Scheme, h.Scheme) && auth.Params.Equals(h.Params)
+	}
+
+	return false
+}
+
+// ProxyAuthenticateHeader introduces SIP 'Proxy-Authenticate' header (RFC 3261 s. 20.27).
+// Each challenge is represented by a separate header.
+type ProxyAuthenticateHeader struct {
+	// Scheme is the authentication scheme, e.g. Digest.
+	Scheme string
+	Params AuthParams
+}
+
+func (auth *ProxyAuthenticateHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *ProxyAuthenticateHeader) Name() string { return "Proxy-Authenticate" }
+
+func (auth *ProxyAuthenticateHeader) Value() string {
+	return authValue(auth.Scheme, auth.Params)
+}
+
+func (auth *ProxyAuthenticateHeader) Clone() Header {
+	var newAuth *ProxyAuthenticateHeader
+	if auth == nil {
+		return newAuth
+	}
+
+	return &ProxyAuthenticateHeader{
+		Scheme: auth.Scheme,
+		Params: auth.Params.Clone(),
+	}
+}
+
+func (auth *ProxyAuthenticateHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ProxyAuthenticateHeader); ok {
+		if auth == h {
+			return true
+		}
+		if auth == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(auth.Scheme, h.Scheme) && auth.Params.Equals(h.Params)
+	}
+
+	return false
+}
+
+// AuthorizationHeader introduces SIP 'Authorization' header (RFC 3261 s. 20.7).
+type AuthorizationHeader struct {
+	// Scheme is the authentication scheme, e.g. Digest.
+	Scheme string
+	Params AuthParams
+}
+
+func (auth *AuthorizationHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *AuthorizationHeader) Name() string { return "Authorization" }
+
+func (auth *AuthorizationHeader) Value() string {
+	return authValue(auth.Scheme, auth.Params)
+}
+
+func (auth *AuthorizationHeader) Clone() Header {
+	var newAuth *AuthorizationHeader
+	if auth == nil {
+		return newAuth
+	}
+
+	return &AuthorizationHeader{
+		Scheme: auth.Scheme,
+		Params: auth.Params.Clone(),
+	}
+}
+
+func (auth *AuthorizationHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*AuthorizationHeader); ok {
+		if auth == h {
+			return true
+		}
+		if auth == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(auth.Scheme, h.Scheme) && auth.Params.Equals(h.Params)
+	}
+
+	return false
+}
+
+// ProxyAuthorizationHeader introduces SIP 'Proxy-Authorization' header (RFC 3261 s. 20.28).
+type ProxyAuthorizationHeader struct {
+	// Scheme is the authentication scheme, e.g. Digest.
+	Scheme string
+	Params AuthParams
+}
+
+func (auth *ProxyAuthorizationHeader) String() string {
+	return fmt.Sprintf("%s: %s", auth.Name(), auth.Value())
+}
+
+func (auth *ProxyAuthorizationHeader) Name() string { return "Proxy-Authorization" }
+
+func (auth *ProxyAuthorizationHeader) Value() string {
+	return authValue(auth.Scheme, auth.Params)
+}
+
+func (auth *ProxyAuthorizationHeader) Clone() Header {
+	var newAuth *ProxyAuthorizationHeader
+	if auth == nil {
+		return newAuth
+	}
+
+	return &ProxyAuthorizationHeader{
+		Scheme: auth.Scheme,
+		Params: auth.Params.Clone(),
+	}
+}
+
+func (auth *ProxyAuthorizationHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ProxyAuthorizationHeader); ok {
+		if auth == h {
+			return true
+		}
+		if auth == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(auth.Scheme, h.Scheme) && auth.Params.Equals(h.Params)
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package sip
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/ghettovoice/gosip/util"
 )
@@ -30,6 +31,8 @@ type RequestBuilder struct {
 	accept          *Accept
 	route           *RouteHeader
 	generic         map[string]Header
+	// set transport on the built request instead of deriving it
+	pinTransport bool
 }
 
 func NewRequestBuilder() *RequestBuilder {
@@ -53,6 +56,38 @@ func NewRequestBuilder() *RequestBuilder {
 	return rb
 }
 
+// NewRequestBuilderTo creates RequestBuilder of the out-of-dialog request to the target.
+// Transport is taken from the transport parameter of the target URI and is set on the built request,
+// so it is not switched to TCP by message size. From is cloned and gets a random tag, Via gets a new branch.
+func NewRequestBuilderTo(method RequestMethod, target Uri, from *Address) *RequestBuilder {
+	transport := DefaultProtocol
+	if params := target.UriParams(); params != nil {
+		if val, ok := params.Get("transport"); ok && val != nil && val.String() != "" {
+			transport = strings.ToUpper(val.String())
+		}
+	}
+
+	from = from.Clone()
+	if from.Params == nil {
+		from.Params = NewParams()
+	}
+	from.Params.Add("tag", String{Str: util.RandString(8)})
+
+	rb := NewRequestBuilder()
+	rb.pinTransport = true
+
+	return rb.
+		SetTransport(transport).
+		SetHost(DefaultHost).
+		SetMethod(method).
+		SetRecipient(target).
+		AddVia(&ViaHop{
+			Params: NewParams().Add("branch", String{Str: GenerateBranch()}),
+		}).
+		SetFrom(from).
+		SetTo(&Address{Uri: target.Clone(), Params: NewParams()})
+}
+
 func (rb *RequestBuilder) SetTransport(transport string) *RequestBuilder {
 	if transport == "" {
 		rb.transport = "UDP"
@@ -331,6 +366,9 @@ func (rb *RequestBuilder) Build() (Request, error) {
 	// basic request
 	req := NewRequest("", rb.method, rb.recipient, sipVersion, hdrs, "", nil)
 	req.SetBody(rb.body, true)
+	if rb.pinTransport {
+		req.SetTransport(rb.transport)
+	}
 
 	return req, nil
 }
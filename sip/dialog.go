@@ -0,0 +1,298 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+// Dialog is a peer-to-peer relationship between two UAs (RFC 3261 s. 12).
+// It keeps the state required to build requests within the dialog, e.g. REFER, NOTIFY or BYE.
+type Dialog struct {
+	mu           sync.Mutex
+	callID       CallID
+	local        *Address
+	remote       *Address
+	remoteTarget Uri
+	routeSet     []Uri
+	contact      *ContactHeader
+	localSeq     uint32
+	remoteSeq    uint32
+	transport    string
+}
+
+// NewClientDialog creates dialog of UAC from the sent request and received response with To tag.
+func NewClientDialog(req Request, res Response) (*Dialog, error) {
+	callID, ok := req.CallID()
+	if !ok {
+		return nil, fmt.Errorf("missing 'Call-ID' header")
+	}
+	from, ok := req.From()
+	if !ok {
+		return nil, fmt.Errorf("missing 'From' header")
+	}
+	to, ok := res.To()
+	if !ok {
+		return nil, fmt.Errorf("missing 'To' header")
+	}
+	if _, ok := to.Params.Get("tag"); !ok {
+		return nil, fmt.Errorf("missing tag param in 'To' header")
+	}
+	contact, ok := res.Contact()
+	if !ok {
+		return nil, fmt.Errorf("missing 'Contact' header")
+	}
+	cseq, ok := req.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("missing 'CSeq' header")
+	}
+
+	dialog := &Dialog{
+		callID:       *callID,
+		local:        NewAddressFromFromHeader(from),
+		remote:       NewAddressFromToHeader(to),
+		remoteTarget: contact.Address.Clone(),
+		localSeq:     cseq.SeqNo,
+		transport:    req.Transport(),
+	}
+	if hdr, ok := req.Contact(); ok {
+		dialog.contact = hdr.Clone().(*ContactHeader)
+	}
+	// route set is taken from Record-Route in reverse order
+	hdrs := res.GetHeaders("Record-Route")
+	for i := len(hdrs) - 1; i >= 0; i-- {
+		addrs := hdrs[i].(*RecordRouteHeader).Addresses
+		for j := len(addrs) - 1; j >= 0; j-- {
+			dialog.routeSet = append(dialog.routeSet, addrs[j].Clone())
+		}
+	}
+
+	return dialog, nil
+}
+
+// NewServerDialog creates dialog of UAS from the received request and sent response with To tag.
+func NewServerDialog(req Request, res Response) (*Dialog, error) {
+	callID, ok := req.CallID()
+	if !ok {
+		return nil, fmt.Errorf("missing 'Call-ID' header")
+	}
+	from, ok := req.From()
+	if !ok {
+		return nil, fmt.Errorf("missing 'From' header")
+	}
+	to, ok := res.To()
+	if !ok {
+		return nil, fmt.Errorf("missing 'To' header")
+	}
+	if _, ok := to.Params.Get("tag"); !ok {
+		return nil, fmt.Errorf("missing tag param in 'To' header")
+	}
+	contact, ok := req.Contact()
+	if !ok {
+		return nil, fmt.Errorf("missing 'Contact' header")
+	}
+	cseq, ok := req.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("missing 'CSeq' header")
+	}
+
+	dialog := &Dialog{
+		callID:       *callID,
+		local:        NewAddressFromToHeader(to),
+		remote:       NewAddressFromFromHeader(from),
+		remoteTarget: contact.Address.Clone(),
+		remoteSeq:    cseq.SeqNo,
+		transport:    req.Transport(),
+	}
+	if hdr, ok := res.Contact(); ok {
+		dialog.contact = hdr.Clone().(*ContactHeader)
+	}
+	for _, hdr := range req.GetHeaders("Record-Route") {
+		for _, addr := range hdr.(*RecordRouteHeader).Addresses {
+			dialog.routeSet = append(dialog.routeSet, addr.Clone())
+		}
+	}
+
+	return dialog, nil
+}
+
+// ID returns dialog ID in the form used by MakeDialogIDFromMessage for incoming requests.
+func (dialog *Dialog) ID() string {
+	return MakeDialogID(string(dialog.callID), dialog.LocalTag(), dialog.RemoteTag())
+}
+
+func (dialog *Dialog) CallID() CallID {
+	return dialog.callID
+}
+
+func (dialog *Dialog) LocalTag() string {
+	return paramValue(dialog.local.Params, "tag")
+}
+
+func (dialog *Dialog) RemoteTag() string {
+	return paramValue(dialog.remote.Params, "tag")
+}
+
+// LocalAddress returns local URI with tag.
+func (dialog *Dialog) LocalAddress() *Address {
+	return dialog.local.Clone()
+}
+
+// RemoteAddress returns remote URI with tag.
+func (dialog *Dialog) RemoteAddress() *Address {
+	return dialog.remote.Clone()
+}
+
+// RemoteTarget returns URI of the remote party from its Contact.
+func (dialog *Dialog) RemoteTarget() Uri {
+	dialog.mu.Lock()
+	defer dialog.mu.Unlock()
+
+	return dialog.remoteTarget.Clone()
+}
+
+// LocalContact returns local Contact header.
+func (dialog *Dialog) LocalContact() (*ContactHeader, bool) {
+	if dialog.contact == nil {
+		return nil, false
+	}
+	return dialog.contact.Clone().(*ContactHeader), true
+}
+
+// Transport returns transport of the dialog.
+func (dialog *Dialog) Transport() string {
+	return dialog.transport
+}
+
+// Matches returns true if the incoming request belongs to the dialog.
+func (dialog *Dialog) Matches(req Request) bool {
+	id, err := MakeDialogIDFromMessage(req)
+	return err == nil && id == dialog.ID()
+}
+
+// ReceiveRequest updates the dialog state with the incoming in-dialog request.
+// It returns false if the request is out of order and must be rejected with 500 (RFC 3261 s. 12.2.2).
+// Target refresh requests update the remote target.
+func (dialog *Dialog) ReceiveRequest(req Request) bool {
+	cseq, ok := req.CSeq()
+	if !ok {
+		return false
+	}
+
+	dialog.mu.Lock()
+	defer dialog.mu.Unlock()
+
+	if req.IsAck() {
+		return true
+	}
+	if dialog.remoteSeq != 0 && cseq.SeqNo <= dialog.remoteSeq {
+		return false
+	}
+	dialog.remoteSeq = cseq.SeqNo
+
+	switch req.Method() {
+	case INVITE, UPDATE, SUBSCRIBE, NOTIFY, REFER:
+		if contact, ok := req.Contact(); ok && contact.Address != nil {
+			dialog.remoteTarget = contact.Address.Clone()
+		}
+	}
+
+	return true
+}
+
+// NewRequest creates request within the dialog with the next local CSeq.
+// Via header has to be completed by the transport layer, Route headers are built from the route set.
+// If the first route is a strict router (without lr parameter), it is put into the Request-URI
+// and the remote target is appended to the Route headers (RFC 3261 s. 12.2.1.1).
+func (dialog *Dialog) NewRequest(method RequestMethod, hdrs ...Header) Request {
+	dialog.mu.Lock()
+	dialog.localSeq++
+	seq := dialog.localSeq
+	dialog.mu.Unlock()
+
+	return dialog.newRequest(method, seq, hdrs...)
+}
+
+// NewAck creates ACK on 2xx response to the INVITE sent within the dialog (RFC 3261 s. 13.2.2.4).
+// ACK has CSeq number of the INVITE, so the local CSeq is not changed.
+func (dialog *Dialog) NewAck(invite Request, hdrs ...Header) (Request, error) {
+	cseq, ok := invite.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("missing 'CSeq' header")
+	}
+
+	return dialog.newRequest(ACK, cseq.SeqNo, hdrs...), nil
+}
+
+func (dialog *Dialog) newRequest(method RequestMethod, seq uint32, hdrs ...Header) Request {
+	dialog.mu.Lock()
+	target := dialog.remoteTarget.Clone()
+	dialog.mu.Unlock()
+
+	routes := make([]Uri, 0, len(dialog.routeSet)+1)
+	for _, uri := range dialog.routeSet {
+		routes = append(routes, uri.Clone())
+	}
+	strict := len(routes) > 0 && (routes[0].UriParams() == nil || !routes[0].UriParams().Has("lr"))
+	if strict {
+		target, routes = routes[0], append(routes[1:], target)
+		// parameters not allowed in the Request-URI are stripped
+		target.SetHeaders(nil)
+		if target.UriParams() != nil {
+			target.UriParams().Remove("method")
+		}
+	}
+
+	req := NewRequest(
+		"",
+		method,
+		target,
+		"SIP/2.0",
+		[]Header{},
+		"",
+		log.Fields{
+			"dialog_id": dialog.ID(),
+		},
+	)
+
+	req.AppendHeader(ViaHeader{
+		&ViaHop{
+			ProtocolName:    "SIP",
+			ProtocolVersion: "2.0",
+			Transport:       dialog.transport,
+			Host:            DefaultHost,
+			Params:          NewParams().Add("branch", String{Str: GenerateBranch()}),
+		},
+	})
+	if len(routes) > 0 {
+		req.AppendHeader(&RouteHeader{Addresses: routes})
+	}
+	maxForwards := MaxForwards(70)
+	req.AppendHeader(&maxForwards)
+	req.AppendHeader(dialog.local.AsFromHeader())
+	req.AppendHeader(dialog.remote.AsToHeader())
+	callID := dialog.callID
+	req.AppendHeader(&callID)
+	req.AppendHeader(&CSeq{SeqNo: seq, MethodName: method})
+	if dialog.contact != nil {
+		req.AppendHeader(dialog.contact.Clone())
+	}
+	for _, header := range hdrs {
+		req.AppendHeader(header)
+	}
+	req.SetBody("", true)
+	req.SetTransport(dialog.transport)
+	if strict {
+		// the request is sent to the strict router in the Request-URI rather than to the top route
+		if uri, ok := target.(*SipUri); ok {
+			port := DefaultPort(dialog.transport)
+			if uri.FPort != nil {
+				port = *uri.FPort
+			}
+			req.SetDestination(fmt.Sprintf("%v:%v", uri.FHost, port))
+		}
+	}
+
+	return req
+}
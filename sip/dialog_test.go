@@ -0,0 +1,80 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func newRoutedDialog(t *testing.T, recordRoute string) *sip.Dialog {
+	parse := func(lines ...string) sip.Message {
+		msg, err := parser.ParseMessage([]byte(strings.Join(append(lines, "", ""), "\r\n")), log.NewDefaultLogrusLogger())
+		if err != nil {
+			t.Fatalf("failed to parse message: %s", err)
+		}
+		return msg
+	}
+
+	invite := parse(
+		"INVITE sip:bob@example.com SIP/2.0",
+		"Via: SIP/2.0/UDP alice.example.com;branch=z9hG4bK.dialog",
+		"From: <sip:alice@example.com>;tag=a1",
+		"To: <sip:bob@example.com>",
+		"Call-ID: dialog",
+		"CSeq: 1 INVITE",
+		"Contact: <sip:alice@alice.example.com>",
+		"Content-Length: 0",
+	).(sip.Request)
+	ok := parse(
+		"SIP/2.0 200 OK",
+		"Via: SIP/2.0/UDP alice.example.com;branch=z9hG4bK.dialog",
+		"Record-Route: "+recordRoute,
+		"From: <sip:alice@example.com>;tag=a1",
+		"To: <sip:bob@example.com>;tag=b1",
+		"Call-ID: dialog",
+		"CSeq: 1 INVITE",
+		"Contact: <sip:bob@bob.example.com>",
+		"Content-Length: 0",
+	).(sip.Response)
+
+	dialog, err := sip.NewClientDialog(invite, ok)
+	if err != nil {
+		t.Fatalf("failed to create dialog: %s", err)
+	}
+	return dialog
+}
+
+func TestDialogLooseRouting(t *testing.T) {
+	dialog := newRoutedDialog(t, "<sip:p2.example.com;lr>, <sip:p1.example.com:5070;lr>")
+
+	req := dialog.NewRequest(sip.BYE)
+	if req.Recipient().String() != "sip:bob@bob.example.com" {
+		t.Errorf("unexpected Request-URI %s", req.Recipient())
+	}
+	route := req.GetHeaders("Route")
+	if len(route) != 1 || route[0].Value() != "<sip:p1.example.com:5070;lr>, <sip:p2.example.com;lr>" {
+		t.Errorf("unexpected Route %v", route)
+	}
+	if req.Destination() != "p1.example.com:5070" {
+		t.Errorf("unexpected destination %s", req.Destination())
+	}
+}
+
+func TestDialogStrictRouting(t *testing.T) {
+	dialog := newRoutedDialog(t, "<sip:p2.example.com;lr>, <sip:p1.example.com:5070;method=INVITE>")
+
+	req := dialog.NewRequest(sip.BYE)
+	if req.Recipient().String() != "sip:p1.example.com:5070" {
+		t.Errorf("unexpected Request-URI %s", req.Recipient())
+	}
+	route := req.GetHeaders("Route")
+	if len(route) != 1 || route[0].Value() != "<sip:p2.example.com;lr>, <sip:bob@bob.example.com>" {
+		t.Errorf("unexpected Route %v", route)
+	}
+	if req.Destination() != "p1.example.com:5070" {
+		t.Errorf("unexpected destination %s", req.Destination())
+	}
+}
@@ -0,0 +1,163 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EventHeader introduces SIP 'Event' header (RFC 6665).
+type EventHeader struct {
+	// Event package, e.g. refer, presence, dialog.
+	EventType string
+	// Any parameters present in the header, e.g. id.
+	Params Params
+}
+
+func (event *EventHeader) String() string {
+	return fmt.Sprintf("%s: %s", event.Name(), event.Value())
+}
+
+func (event *EventHeader) Name() string { return "Event" }
+
+func (event *EventHeader) Value() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(event.EventType)
+
+	if event.Params != nil && event.Params.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(event.Params.ToString(';'))
+	}
+
+	return buffer.String()
+}
+
+// ID returns value of the id parameter.
+func (event *EventHeader) ID() string {
+	return paramValue(event.Params, "id")
+}
+
+func (event *EventHeader) Clone() Header {
+	var newEvent *EventHeader
+	if event == nil {
+		return newEvent
+	}
+
+	return &EventHeader{
+		EventType: event.EventType,
+		Params:    cloneWithNil(event.Params),
+	}
+}
+
+// Equals compares event types case-insensitively, parameters have to match.
+func (event *EventHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*EventHeader); ok {
+		if event == h {
+			return true
+		}
+		if event == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(event.EventType, h.EventType) && paramsEqual(event.Params, h.Params)
+	}
+
+	return false
+}
+
+// Subscription states (RFC 6665 s. 8.2.3).
+const (
+	SubscriptionActive     = "active"
+	SubscriptionPending    = "pending"
+	SubscriptionTerminated = "terminated"
+)
+
+// SubscriptionStateHeader introduces SIP 'Subscription-State' header (RFC 6665).
+type SubscriptionStateHeader struct {
+	// active, pending or terminated
+	State string
+	// Any parameters present in the header, e.g. expires, reason, retry-after.
+	Params Params
+}
+
+func (state *SubscriptionStateHeader) String() string {
+	return fmt.Sprintf("%s: %s", state.Name(), state.Value())
+}
+
+func (state *SubscriptionStateHeader) Name() string { return "Subscription-State" }
+
+func (state *SubscriptionStateHeader) Value() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(state.State)
+
+	if state.Params != nil && state.Params.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(state.Params.ToString(';'))
+	}
+
+	return buffer.String()
+}
+
+// IsTerminated returns true if the subscription is terminated.
+func (state *SubscriptionStateHeader) IsTerminated() bool {
+	return strings.EqualFold(state.State, SubscriptionTerminated)
+}
+
+// Reason returns value of the reason parameter.
+func (state *SubscriptionStateHeader) Reason() string {
+	return paramValue(state.Params, "reason")
+}
+
+// Expires returns value of the expires parameter in seconds, false if it is missing or invalid.
+func (state *SubscriptionStateHeader) Expires() (uint32, bool) {
+	seconds, err := strconv.ParseUint(paramValue(state.Params, "expires"), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(seconds), true
+}
+
+func (state *SubscriptionStateHeader) Clone() Header {
+	var newState *SubscriptionStateHeader
+	if state == nil {
+		return newState
+	}
+
+	return &SubscriptionStateHeader{
+		State:  state.State,
+		Params: cloneWithNil(state.Params),
+	}
+}
+
+func (state *SubscriptionStateHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*SubscriptionStateHeader); ok {
+		if state == h {
+			return true
+		}
+		if state == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(state.State, h.State) && paramsEqual(state.Params, h.Params)
+	}
+
+	return false
+}
+
+func paramValue(params Params, name string) string {
+	if params == nil {
+		return ""
+	}
+	if val, ok := params.Get(name); ok && val != nil {
+		return val.String()
+	}
+	return ""
+}
+
+func paramsEqual(params, other Params) bool {
+	if params == nil || params.Length() == 0 {
+		return other == nil || other.Length() == 0
+	}
+	return params.Equals(other)
+}
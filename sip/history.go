@@ -0,0 +1,369 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ReasonHeader introduces SIP 'Reason' header (RFC 3326).
+type ReasonHeader struct {
+	// Protocol of the cause, e.g. SIP or Q.850.
+	Protocol string
+	// Cause is the status code of the protocol, 0 if omitted.
+	Cause uint16
+	// Text is an optional human readable description.
+	Text string
+	// Other parameters present in the header.
+	Params Params
+}
+
+// NewSIPReason creates Reason header with the SIP status code.
+func NewSIPReason(code StatusCode, text string) *ReasonHeader {
+	return &ReasonHeader{
+		Protocol: "SIP",
+		Cause:    uint16(code),
+		Text:     text,
+	}
+}
+
+func (reason *ReasonHeader) String() string {
+	return fmt.Sprintf("%s: %s", reason.Name(), reason.Value())
+}
+
+func (reason *ReasonHeader) Name() string { return "Reason" }
+
+func (reason *ReasonHeader) Value() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(reason.Protocol)
+	if reason.Cause != 0 {
+		buffer.WriteString(fmt.Sprintf(";cause=%d", reason.Cause))
+	}
+	if reason.Text != "" {
+		buffer.WriteString(fmt.Sprintf(";text=\"%s\"", reason.Text))
+	}
+	if reason.Params != nil && reason.Params.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(reason.Params.ToString(';'))
+	}
+
+	return buffer.String()
+}
+
+func (reason *ReasonHeader) Clone() Header {
+	var newReason *ReasonHeader
+	if reason == nil {
+		return newReason
+	}
+
+	newReason = &ReasonHeader{
+		Protocol: reason.Protocol,
+		Cause:    reason.Cause,
+		Text:     reason.Text,
+	}
+	if reason.Params != nil {
+		newReason.Params = reason.Params.Clone()
+	}
+	return newReason
+}
+
+func (reason *ReasonHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ReasonHeader); ok {
+		if reason == h {
+			return true
+		}
+		if reason == nil || h == nil {
+			return false
+		}
+
+		return strings.EqualFold(reason.Protocol, h.Protocol) &&
+			reason.Cause == h.Cause &&
+			reason.Text == h.Text &&
+			paramsEqual(reason.Params, h.Params)
+	}
+
+	return false
+}
+
+// History-Info target parameters, they refer to the index of the entry that was retargeted (RFC 7044 s. 4.2.1).
+const (
+	// HistoryRC is set when the target was changed by retargeting.
+	HistoryRC = "rc"
+	// HistoryMP is set when the target was mapped to another user.
+	HistoryMP = "mp"
+	// HistoryNP is set when the target was not changed.
+	HistoryNP = "np"
+)
+
+// HistoryInfoHeader introduces SIP 'History-Info' header (RFC 7044).
+// Comma separated values are parsed into separate headers, one per hi-entry.
+type HistoryInfoHeader struct {
+	// The display name from the header, may be omitted.
+	DisplayName MaybeString
+	// Address is hi-targeted-to-uri without embedded Reason.
+	Address Uri
+	// Any parameters present in the header: index, rc, mp, np and others.
+	Params Params
+	// Reason of retargeting embedded into the URI as a header.
+	Reason *ReasonHeader
+}
+
+func (hi *HistoryInfoHeader) String() string {
+	return fmt.Sprintf("%s: %s", hi.Name(), hi.Value())
+}
+
+func (hi *HistoryInfoHeader) Name() string { return "History-Info" }
+
+func (hi *HistoryInfoHeader) Value() string {
+	// SipUri renders URI headers with whitespace in quotes like header params,
+	// so Reason is escaped here to keep the URI valid.
+	if _, ok := hi.Address.(*SipUri); !ok || hi.Reason == nil {
+		return addressValue(hi.DisplayName, hi.Address, hi.Params)
+	}
+
+	sep := "?"
+	if headers := hi.Address.Headers(); headers != nil && headers.Length() > 0 {
+		sep = "&"
+	}
+	reason := strings.ReplaceAll(Escape(hi.Reason.Value(), EncodeQueryComponent), " ", "%20")
+
+	return nameAddrValue(hi.DisplayName, hi.Address.String()+sep+"Reason="+reason, hi.Params)
+}
+
+// Index returns value of the index parameter, e.g. 1.1.2.
+func (hi *HistoryInfoHeader) Index() string {
+	return paramValue(hi.Params, "index")
+}
+
+// Target returns the target parameter (rc, mp or np) and index of the entry it refers to.
+func (hi *HistoryInfoHeader) Target() (string, string) {
+	for _, name := range []string{HistoryRC, HistoryMP, HistoryNP} {
+		if hi.Params != nil && hi.Params.Has(name) {
+			return name, paramValue(hi.Params, name)
+		}
+	}
+	return "", ""
+}
+
+func (hi *HistoryInfoHeader) Clone() Header {
+	var newHi *HistoryInfoHeader
+	if hi == nil {
+		return newHi
+	}
+
+	newHi = &HistoryInfoHeader{
+		DisplayName: hi.DisplayName,
+		Params:      cloneWithNil(hi.Params),
+	}
+	if hi.Address != nil {
+		newHi.Address = hi.Address.Clone()
+	}
+	if hi.Reason != nil {
+		newHi.Reason = hi.Reason.Clone().(*ReasonHeader)
+	}
+	return newHi
+}
+
+func (hi *HistoryInfoHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*HistoryInfoHeader); ok {
+		if hi == h {
+			return true
+		}
+		if hi == nil || h == nil {
+			return false
+		}
+
+		return addressEqual(hi.DisplayName, hi.Address, hi.Params, h.DisplayName, h.Address, h.Params) &&
+			(hi.Reason == h.Reason || hi.Reason != nil && hi.Reason.Equals(h.Reason))
+	}
+
+	return false
+}
+
+// Diversion reasons (RFC 5806 s. 4).
+const (
+	DiversionUnknown       = "unknown"
+	DiversionUserBusy      = "user-busy"
+	DiversionNoAnswer      = "no-answer"
+	DiversionUnavailable   = "unavailable"
+	DiversionUnconditional = "unconditional"
+	DiversionTimeOfDay     = "time-of-day"
+	DiversionDoNotDisturb  = "do-not-disturb"
+	DiversionDeflection    = "deflection"
+	DiversionFollowMe      = "follow-me"
+	DiversionOutOfService  = "out-of-service"
+	DiversionAway          = "away"
+)
+
+// DiversionHeader introduces legacy SIP 'Diversion' header (RFC 5806).
+// The most recent diversion comes first.
+type DiversionHeader struct {
+	// The display name from the header, may be omitted.
+	DisplayName MaybeString
+	// Address of the diverting party.
+	Address Uri
+	// Any parameters present in the header: reason, counter, limit, privacy, screen and others.
+	Params Params
+}
+
+func (diversion *DiversionHeader) String() string {
+	return fmt.Sprintf("%s: %s", diversion.Name(), diversion.Value())
+}
+
+func (diversion *DiversionHeader) Name() string { return "Diversion" }
+
+func (diversion *DiversionHeader) Value() string {
+	return addressValue(diversion.DisplayName, diversion.Address, diversion.Params)
+}
+
+// Reason returns value of the reason parameter.
+func (diversion *DiversionHeader) Reason() string {
+	return paramValue(diversion.Params, "reason")
+}
+
+// Counter returns number of diversions represented by the header, it is 1 if the counter parameter is omitted.
+func (diversion *DiversionHeader) Counter() int {
+	if counter, err := strconv.Atoi(paramValue(diversion.Params, "counter")); err == nil && counter > 0 {
+		return counter
+	}
+	return 1
+}
+
+func (diversion *DiversionHeader) Clone() Header {
+	var newDiversion *DiversionHeader
+	if diversion == nil {
+		return newDiversion
+	}
+
+	newDiversion = &DiversionHeader{
+		DisplayName: diversion.DisplayName,
+		Params:      cloneWithNil(diversion.Params),
+	}
+	if diversion.Address != nil {
+		newDiversion.Address = diversion.Address.Clone()
+	}
+	return newDiversion
+}
+
+func (diversion *DiversionHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*DiversionHeader); ok {
+		if diversion == h {
+			return true
+		}
+		if diversion == nil || h == nil {
+			return false
+		}
+
+		return addressEqual(diversion.DisplayName, diversion.Address, diversion.Params,
+			h.DisplayName, h.Address, h.Params)
+	}
+
+	return false
+}
+
+// DiversionReasonFromStatus maps final response that caused retargeting to the diversion reason.
+func DiversionReasonFromStatus(code StatusCode) string {
+	switch code {
+	case 486, 600:
+		return DiversionUserBusy
+	case 408, 480, 487:
+		return DiversionNoAnswer
+	case 302:
+		return DiversionUnconditional
+	case 404, 410:
+		return DiversionUnavailable
+	case 503:
+		return DiversionOutOfService
+	default:
+		return DiversionUnknown
+	}
+}
+
+// RetargetRequest replaces Request-URI of the request with the target
+// and records the change in History-Info (RFC 7044 s. 10.1).
+// Entry of the current Request-URI is added if it is missing, the reason is embedded into it.
+// The new entry is indexed as the next child of the current one and refers to it with the mechanism
+// parameter, usually HistoryRC or HistoryMP, empty mechanism omits the parameter.
+func RetargetRequest(req Request, target Uri, mechanism string, reason *ReasonHeader) *HistoryInfoHeader {
+	var entries []*HistoryInfoHeader
+	for _, hdr := range req.GetHeaders("History-Info") {
+		if hi, ok := hdr.(*HistoryInfoHeader); ok {
+			entries = append(entries, hi)
+		}
+	}
+
+	recipient := uriWithoutHeaders(req.Recipient())
+	var parent *HistoryInfoHeader
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Address != nil && uriWithoutHeaders(entries[i].Address).String() == recipient.String() {
+			parent = entries[i]
+			break
+		}
+	}
+	if parent == nil {
+		index := "1"
+		if len(entries) > 0 {
+			index = nextHistoryIndex(entries, entries[len(entries)-1].Index())
+		}
+		parent = &HistoryInfoHeader{
+			Address: recipient,
+			Params:  NewParams().Add("index", String{Str: index}),
+		}
+		req.AppendHeader(parent)
+		entries = append(entries, parent)
+	}
+	if reason != nil {
+		parent.Reason = reason
+	}
+
+	entry := &HistoryInfoHeader{
+		Address: uriWithoutHeaders(target),
+		Params:  NewParams().Add("index", String{Str: nextHistoryIndex(entries, parent.Index())}),
+	}
+	if mechanism != "" {
+		entry.Params.Add(mechanism, String{Str: parent.Index()})
+	}
+	req.AppendHeader(entry)
+	req.SetRecipient(target.Clone())
+
+	return entry
+}
+
+// AddDiversion records diversion from the current Request-URI of the request with Diversion header (RFC 5806).
+// It must be called before the Request-URI is changed.
+func AddDiversion(req Request, reason string) *DiversionHeader {
+	diversion := &DiversionHeader{
+		Address: uriWithoutHeaders(req.Recipient()),
+		Params:  NewParams().Add("reason", String{Str: reason}),
+	}
+	if len(req.GetHeaders("Diversion")) > 0 {
+		req.PrependHeader(diversion)
+	} else {
+		req.AppendHeader(diversion)
+	}
+
+	return diversion
+}
+
+// nextHistoryIndex returns index of the next child of the parent entry.
+func nextHistoryIndex(entries []*HistoryInfoHeader, parent string) string {
+	last := 0
+	for _, hi := range entries {
+		index := hi.Index()
+		if !strings.HasPrefix(index, parent+".") {
+			continue
+		}
+		if n, err := strconv.Atoi(index[len(parent)+1:]); err == nil && n > last {
+			last = n
+		}
+	}
+
+	return fmt.Sprintf("%s.%d", parent, last+1)
+}
+
+func uriWithoutHeaders(uri Uri) Uri {
+	uri = uri.Clone()
+	uri.SetHeaders(nil)
+	return uri
+}
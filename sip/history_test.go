@@ -0,0 +1,70 @@
+package sip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+func TestRetargetRequest(t *testing.T) {
+	msg, err := parser.ParseMessage([]byte(strings.Join([]string{
+		"INVITE sip:alice@example.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.example.com;branch=z9hG4bK776asdhds",
+		"From: <sip:bob@example.com>;tag=1928301774",
+		"To: <sip:alice@example.com>",
+		"Call-ID: a84b4c76e66710",
+		"CSeq: 314159 INVITE",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("failed to parse request: %s", err)
+	}
+	req := msg.(sip.Request)
+
+	busy := &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "192.0.2.10"}
+	voicemail := &sip.SipUri{FUser: sip.String{Str: "vm-alice"}, FHost: "voicemail.example.com"}
+
+	sip.AddDiversion(req, sip.DiversionReasonFromStatus(302))
+	sip.RetargetRequest(req, busy, sip.HistoryMP, nil)
+	sip.AddDiversion(req, sip.DiversionReasonFromStatus(486))
+	entry := sip.RetargetRequest(req, voicemail, sip.HistoryRC, sip.NewSIPReason(486, "Busy Here"))
+
+	if req.Recipient().String() != voicemail.String() {
+		t.Errorf("unexpected Request-URI %s", req.Recipient())
+	}
+	if entry.Index() != "1.1.1" {
+		t.Errorf("unexpected index of the last entry %s", entry.Index())
+	}
+
+	// check what is sent on the wire
+	msg, err = parser.ParseMessage([]byte(req.String()), log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("failed to parse retargeted request: %s\n%s", err, req)
+	}
+	hdrs := msg.GetHeaders("History-Info")
+	expected := []string{
+		"<sip:alice@example.com>;index=1",
+		"<sip:alice@192.0.2.10?Reason=SIP%3Bcause%3D486%3Btext%3D%22Busy%20Here%22>;index=1.1;mp=1",
+		"<sip:vm-alice@voicemail.example.com>;index=1.1.1;rc=1.1",
+	}
+	if len(hdrs) != len(expected) {
+		t.Fatalf("expected %d History-Info entries, got:\n%s", len(expected), msg)
+	}
+	for i, hdr := range hdrs {
+		if hdr.Value() != expected[i] {
+			t.Errorf("unexpected History-Info entry %d: expected %q, got %q", i, expected[i], hdr.Value())
+		}
+	}
+
+	hdrs = msg.GetHeaders("Diversion")
+	if len(hdrs) != 2 ||
+		hdrs[0].Value() != "<sip:alice@192.0.2.10>;reason=user-busy" ||
+		hdrs[1].Value() != "<sip:alice@example.com>;reason=unconditional" {
+		t.Errorf("unexpected Diversion headers %v", hdrs)
+	}
+}
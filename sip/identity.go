@@ -0,0 +1,191 @@
+package sip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PAssertedIdentityHeader introduces SIP 'P-Asserted-Identity' header (RFC 3325).
+// It carries identity of the user asserted by a member of the trust domain.
+// Comma separated values are parsed into separate headers, one per identity.
+type PAssertedIdentityHeader struct {
+	// The display name from the header, may be omitted.
+	DisplayName MaybeString
+	Address     Uri
+	// Any parameters present in the header.
+	Params Params
+}
+
+func (pai *PAssertedIdentityHeader) String() string {
+	return fmt.Sprintf("%s: %s", pai.Name(), pai.Value())
+}
+
+func (pai *PAssertedIdentityHeader) Name() string { return "P-Asserted-Identity" }
+
+func (pai *PAssertedIdentityHeader) Value() string {
+	return addressValue(pai.DisplayName, pai.Address, pai.Params)
+}
+
+func (pai *PAssertedIdentityHeader) Clone() Header {
+	var newPai *PAssertedIdentityHeader
+	if pai == nil {
+		return newPai
+	}
+
+	newPai = &PAssertedIdentityHeader{
+		DisplayName: pai.DisplayName,
+		Params:      cloneWithNil(pai.Params),
+	}
+	if pai.Address != nil {
+		newPai.Address = pai.Address.Clone()
+	}
+	return newPai
+}
+
+func (pai *PAssertedIdentityHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*PAssertedIdentityHeader); ok {
+		if pai == h {
+			return true
+		}
+		if pai == nil || h == nil {
+			return false
+		}
+
+		return addressEqual(pai.DisplayName, pai.Address, pai.Params, h.DisplayName, h.Address, h.Params)
+	}
+
+	return false
+}
+
+// PPreferredIdentityHeader introduces SIP 'P-Preferred-Identity' header (RFC 3325).
+// It is sent by the user agent to a trusted proxy to choose one of its identities.
+type PPreferredIdentityHeader struct {
+	// The display name from the header, may be omitted.
+	DisplayName MaybeString
+	Address     Uri
+	// Any parameters present in the header.
+	Params Params
+}
+
+func (ppi *PPreferredIdentityHeader) String() string {
+	return fmt.Sprintf("%s: %s", ppi.Name(), ppi.Value())
+}
+
+func (ppi *PPreferredIdentityHeader) Name() string { return "P-Preferred-Identity" }
+
+func (ppi *PPreferredIdentityHeader) Value() string {
+	return addressValue(ppi.DisplayName, ppi.Address, ppi.Params)
+}
+
+func (ppi *PPreferredIdentityHeader) Clone() Header {
+	var newPpi *PPreferredIdentityHeader
+	if ppi == nil {
+		return newPpi
+	}
+
+	newPpi = &PPreferredIdentityHeader{
+		DisplayName: ppi.DisplayName,
+		Params:      cloneWithNil(ppi.Params),
+	}
+	if ppi.Address != nil {
+		newPpi.Address = ppi.Address.Clone()
+	}
+	return newPpi
+}
+
+func (ppi *PPreferredIdentityHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*PPreferredIdentityHeader); ok {
+		if ppi == h {
+			return true
+		}
+		if ppi == nil || h == nil {
+			return false
+		}
+
+		return addressEqual(ppi.DisplayName, ppi.Address, ppi.Params, h.DisplayName, h.Address, h.Params)
+	}
+
+	return false
+}
+
+// Privacy values, priv-value in RFC 3323 s. 4.2 and RFC 3325 s. 9.3.
+const (
+	PrivNone     = "none"
+	PrivHeader   = "header"
+	PrivSession  = "session"
+	PrivUser     = "user"
+	PrivID       = "id"
+	PrivCritical = "critical"
+)
+
+// PrivacyHeader introduces SIP 'Privacy' header (RFC 3323).
+type PrivacyHeader struct {
+	Values []string
+}
+
+func (privacy *PrivacyHeader) String() string {
+	return fmt.Sprintf("%s: %s", privacy.Name(), privacy.Value())
+}
+
+func (privacy *PrivacyHeader) Name() string { return "Privacy" }
+
+func (privacy *PrivacyHeader) Value() string {
+	return strings.Join(privacy.Values, ";")
+}
+
+// Has returns true if the privacy value is requested.
+func (privacy *PrivacyHeader) Has(value string) bool {
+	for _, v := range privacy.Values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (privacy *PrivacyHeader) Clone() Header {
+	var newPrivacy *PrivacyHeader
+	if privacy == nil {
+		return newPrivacy
+	}
+
+	newPrivacy = &PrivacyHeader{}
+	if privacy.Values != nil {
+		newPrivacy.Values = append([]string{}, privacy.Values...)
+	}
+	return newPrivacy
+}
+
+func (privacy *PrivacyHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*PrivacyHeader); ok {
+		if privacy == h {
+			return true
+		}
+		if privacy == nil || h == nil {
+			return false
+		}
+		if len(privacy.Values) != len(h.Values) {
+			return false
+		}
+		for i, v := range privacy.Values {
+			if !strings.EqualFold(v, h.Values[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// AnonymousAddress returns address recommended for anonymous From header (RFC 3323 s. 4.1.1.3).
+func AnonymousAddress() *Address {
+	return &Address{
+		DisplayName: String{Str: "Anonymous"},
+		Uri: &SipUri{
+			FUser: String{Str: "anonymous"},
+			FHost: "anonymous.invalid",
+		},
+		Params: NewParams(),
+	}
+}
@@ -82,11 +82,20 @@ type Message interface {
 	// RemoveHeader removes header from message.
 	RemoveHeader(name string)
 	ReplaceHeaders(name string, headers []Header)
+	// AppendRawHeader appends headers parsed from the raw header line,
+	// the line is written as is while the headers stay unmodified.
+	AppendRawHeader(raw []byte, headers ...Header)
+	// GetRawHeaders returns the unmodified header lines with the given name as they were received from the wire.
+	GetRawHeaders(name string) [][]byte
 
 	// Body returns message body.
 	Body() string
 	// SetBody sets message body.
 	SetBody(body string, setContentLength bool)
+	// BodyBytes returns raw message body.
+	BodyBytes() []byte
+	// SetBodyBytes sets raw message body, e.g. binary or multipart payload.
+	SetBodyBytes(body []byte, setContentLength bool)
 
 	/* Helper getters for common headers */
 	// CallID returns 'Call-ID' header.
@@ -122,16 +131,27 @@ type Message interface {
 // headers is a struct with methods to work with SIP headers.
 type headers struct {
 	mu sync.RWMutex
-	// The logical SIP headers attached to this message.
-	headers map[string][]Header
-	// The order the headers should be displayed in.
-	headerOrder []string
+	// The logical SIP headers attached to this message in the order they should be displayed in.
+	entries []headerEntry
+}
+
+type headerEntry struct {
+	// lowercased header name
+	name   string
+	header Header
+	// the line the header was parsed from, shared by all headers of the line
+	raw *rawHeader
+}
+
+// rawHeader is a header line as received from the wire.
+type rawHeader struct {
+	line []byte
+	// values of the headers parsed from the line, used to detect modified headers
+	values []string
 }
 
 func newHeaders(hdrs []Header) *headers {
 	hs := new(headers)
-	hs.headers = make(map[string][]Header)
-	hs.headerOrder = make([]string, 0)
 	for _, header := range hdrs {
 		hs.AppendHeader(header)
 	}
@@ -141,111 +161,165 @@ func newHeaders(hdrs []Header) *headers {
 func (hs *headers) String() string {
 	buffer := bytes.Buffer{}
 	hs.mu.RLock()
-	// Construct each header in turn and add it to the message.
-	for typeIdx, name := range hs.headerOrder {
-		headers := hs.headers[name]
-		for idx, header := range headers {
-			buffer.WriteString(header.String())
-			if typeIdx < len(hs.headerOrder) || idx < len(headers) {
-				buffer.WriteString("\r\n")
-			}
+	// Construct each header in turn and add it to the message,
+	// unmodified headers parsed from the wire are written as they were received.
+	for i := 0; i < len(hs.entries); {
+		if n := hs.rawRun(i); n > 0 {
+			buffer.Write(hs.entries[i].raw.line)
+			i += n
+		} else {
+			buffer.WriteString(hs.entries[i].header.String())
+			i++
 		}
+		buffer.WriteString("\r\n")
 	}
 	hs.mu.RUnlock()
 	return buffer.String()
 }
 
+// Returns the number of entries starting from i that are written as one raw line
+// or zero if the entry has no raw line or some of the line headers were modified or removed.
+func (hs *headers) rawRun(i int) int {
+	raw := hs.entries[i].raw
+	if raw == nil || i+len(raw.values) > len(hs.entries) {
+		return 0
+	}
+	for k, value := range raw.values {
+		entry := hs.entries[i+k]
+		if entry.raw != raw || entry.header.String() != value {
+			return 0
+		}
+	}
+	return len(raw.values)
+}
+
 // Add the given header.
+// The header is placed after the last header with the same name or at the end of all headers.
 func (hs *headers) AppendHeader(header Header) {
 	name := strings.ToLower(header.Name())
 	hs.mu.Lock()
-	if _, ok := hs.headers[name]; ok {
-		hs.headers[name] = append(hs.headers[name], header)
-	} else {
-		hs.headers[name] = []Header{header}
-		hs.headerOrder = append(hs.headerOrder, name)
+	idx := len(hs.entries)
+	for i := len(hs.entries) - 1; i >= 0; i-- {
+		if hs.entries[i].name == name {
+			idx = i + 1
+			break
+		}
 	}
+	hs.insert(idx, headerEntry{name: name, header: header})
 	hs.mu.Unlock()
 }
 
+// AppendRawHeader adds headers parsed from the raw header line to the end of all headers.
+// The line is written as is while the headers stay unmodified.
+func (hs *headers) AppendRawHeader(raw []byte, headers ...Header) {
+	if len(headers) == 0 {
+		return
+	}
+
+	rh := &rawHeader{
+		line:   append([]byte(nil), raw...),
+		values: make([]string, len(headers)),
+	}
+	for i, header := range headers {
+		rh.values[i] = header.String()
+	}
+
+	hs.mu.Lock()
+	for _, header := range headers {
+		hs.entries = append(hs.entries, headerEntry{
+			name:   strings.ToLower(header.Name()),
+			header: header,
+			raw:    rh,
+		})
+	}
+	hs.mu.Unlock()
+}
+
+func (hs *headers) insert(idx int, entries ...headerEntry) {
+	newEntries := make([]headerEntry, 0, len(hs.entries)+len(entries))
+	newEntries = append(newEntries, hs.entries[:idx]...)
+	newEntries = append(newEntries, entries...)
+	newEntries = append(newEntries, hs.entries[idx:]...)
+	hs.entries = newEntries
+}
+
+func (hs *headers) index(name string) int {
+	for i, entry := range hs.entries {
+		if entry.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // AddFrontHeader adds header to the front of header list
 // if there is no header has h's name, add h to the font of all headers
 // if there are some headers have h's name, add h to front of the sublist
 func (hs *headers) PrependHeader(header Header) {
 	name := strings.ToLower(header.Name())
 	hs.mu.Lock()
-	if hdrs, ok := hs.headers[name]; ok {
-		hs.headers[name] = append([]Header{header}, hdrs...)
-	} else {
-		hs.headers[name] = []Header{header}
-		newOrder := make([]string, 1, len(hs.headerOrder)+1)
-		newOrder[0] = name
-		hs.headerOrder = append(newOrder, hs.headerOrder...)
+	idx := hs.index(name)
+	if idx == -1 {
+		idx = 0
 	}
+	hs.insert(idx, headerEntry{name: name, header: header})
 	hs.mu.Unlock()
 }
 
+// PrependHeaderAfter adds header to the front of the headers with the same name
+// and moves them right after the headers with afterName.
+// Header is prepended to all headers if there are no headers with afterName.
 func (hs *headers) PrependHeaderAfter(header Header, afterName string) {
 	headerName := strings.ToLower(header.Name())
 	afterName = strings.ToLower(afterName)
 	hs.mu.Lock()
-	if _, ok := hs.headers[afterName]; ok {
-		afterIdx := -1
-		headerIdx := -1
-		for i, name := range hs.headerOrder {
-			if name == afterName {
-				afterIdx = i
-			}
-			if name == headerName {
-				headerIdx = i
-			}
-		}
+	if hs.index(afterName) == -1 {
+		hs.mu.Unlock()
+		hs.PrependHeader(header)
+		return
+	}
 
-		if headerIdx == -1 {
-			hs.headers[headerName] = []Header{header}
-			newOrder := make([]string, 0)
-			newOrder = append(newOrder, hs.headerOrder[:afterIdx+1]...)
-			newOrder = append(newOrder, headerName)
-			newOrder = append(newOrder, hs.headerOrder[afterIdx+1:]...)
-			hs.headerOrder = newOrder
+	group := []headerEntry{{name: headerName, header: header}}
+	rest := make([]headerEntry, 0, len(hs.entries))
+	for _, entry := range hs.entries {
+		if entry.name == headerName {
+			group = append(group, entry)
 		} else {
-			hs.headers[headerName] = append([]Header{header}, hs.headers[headerName]...)
-			newOrder := make([]string, 0)
-			if afterIdx < headerIdx {
-				newOrder = append(newOrder, hs.headerOrder[:afterIdx+1]...)
-				newOrder = append(newOrder, headerName)
-				newOrder = append(newOrder, hs.headerOrder[afterIdx+1:headerIdx]...)
-				newOrder = append(newOrder, hs.headerOrder[headerIdx+1:]...)
-			} else {
-				newOrder = append(newOrder, hs.headerOrder[:headerIdx]...)
-				newOrder = append(newOrder, hs.headerOrder[headerIdx+1:afterIdx+1]...)
-				newOrder = append(newOrder, headerName)
-				newOrder = append(newOrder, hs.headerOrder[afterIdx+1:]...)
-			}
-			hs.headerOrder = newOrder
+			rest = append(rest, entry)
 		}
-		hs.mu.Unlock()
-	} else {
-		hs.mu.Unlock()
-		hs.PrependHeader(header)
 	}
+	afterIdx := 0
+	for i, entry := range rest {
+		if entry.name == afterName {
+			afterIdx = i + 1
+		}
+	}
+	hs.entries = rest
+	hs.insert(afterIdx, group...)
+	hs.mu.Unlock()
 }
 
+// ReplaceHeaders replaces the headers with the given name in place, nothing is done if there are no such headers.
 func (hs *headers) ReplaceHeaders(name string, headers []Header) {
 	name = strings.ToLower(name)
 	hs.mu.Lock()
-	if _, ok := hs.headers[name]; ok {
-		hs.headers[name] = headers
+	if idx := hs.index(name); idx != -1 {
+		entries := make([]headerEntry, 0, len(headers))
+		for _, header := range headers {
+			entries = append(entries, headerEntry{name: strings.ToLower(header.Name()), header: header})
+		}
+		hs.removeEntries(name)
+		hs.insert(idx, entries...)
 	}
 	hs.mu.Unlock()
 }
 
 // Gets some headers.
 func (hs *headers) Headers() []Header {
-	hdrs := make([]Header, 0)
 	hs.mu.RLock()
-	for _, key := range hs.headerOrder {
-		hdrs = append(hdrs, hs.headers[key]...)
+	hdrs := make([]Header, 0, len(hs.entries))
+	for _, entry := range hs.entries {
+		hdrs = append(hdrs, entry.header)
 	}
 	hs.mu.RUnlock()
 
@@ -256,29 +330,69 @@ func (hs *headers) GetHeaders(name string) []Header {
 	name = strings.ToLower(name)
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
-	if hs.headers == nil {
-		hs.headers = map[string][]Header{}
-		hs.headerOrder = []string{}
+
+	hdrs := make([]Header, 0)
+	for _, entry := range hs.entries {
+		if entry.name == name {
+			hdrs = append(hdrs, entry.header)
+		}
 	}
-	if headers, ok := hs.headers[name]; ok {
-		return headers
+
+	return hdrs
+}
+
+// GetRawHeaders returns the lines of the headers with the given name as they were received from the wire.
+// Modified headers and headers that were not parsed from the wire are skipped.
+func (hs *headers) GetRawHeaders(name string) [][]byte {
+	name = strings.ToLower(name)
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	lines := make([][]byte, 0)
+	for i := 0; i < len(hs.entries); i++ {
+		if hs.entries[i].name != name {
+			continue
+		}
+		if n := hs.rawRun(i); n > 0 {
+			lines = append(lines, append([]byte(nil), hs.entries[i].raw.line...))
+			i += n - 1
+		}
 	}
 
-	return []Header{}
+	return lines
 }
 
 func (hs *headers) RemoveHeader(name string) {
 	name = strings.ToLower(name)
 	hs.mu.Lock()
-	delete(hs.headers, name)
-	// update order slice
-	for idx, entry := range hs.headerOrder {
-		if entry == name {
-			hs.headerOrder = append(hs.headerOrder[:idx], hs.headerOrder[idx+1:]...)
-			break
+	hs.removeEntries(name)
+	hs.mu.Unlock()
+}
+
+func (hs *headers) removeEntries(name string) {
+	entries := make([]headerEntry, 0, len(hs.entries))
+	for _, entry := range hs.entries {
+		if entry.name != name {
+			entries = append(entries, entry)
 		}
 	}
-	hs.mu.Unlock()
+	hs.entries = entries
+}
+
+// Clones the headers keeping their raw lines.
+func (hs *headers) clone() *headers {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	newHs := &headers{
+		entries: make([]headerEntry, len(hs.entries)),
+	}
+	for i, entry := range hs.entries {
+		entry.header = entry.header.Clone()
+		newHs.entries[i] = entry
+	}
+
+	return newHs
 }
 
 // CloneHeaders returns all cloned headers in slice.
@@ -286,6 +400,17 @@ func (hs *headers) CloneHeaders() []Header {
 	return cloneHeaders(hs)
 }
 
+// Clones the message headers keeping their raw lines if the message is implemented by this package.
+func cloneMessageHeaders(msg Message) *headers {
+	switch m := msg.(type) {
+	case *request:
+		return m.headers.clone()
+	case *response:
+		return m.headers.clone()
+	}
+	return newHeaders(cloneHeaders(msg))
+}
+
 func cloneHeaders(msg interface{ Headers() []Header }) []Header {
 	hdrs := make([]Header, 0)
 	for _, header := range msg.Headers() {
@@ -411,7 +536,7 @@ type message struct {
 	mu         sync.RWMutex
 	messID     MessageID
 	sipVersion string
-	body       string
+	body       []byte
 	startLine  func() string
 	tp         string
 	src        string
@@ -447,7 +572,8 @@ func (msg *message) String() string {
 	buffer.WriteString(msg.headers.String())
 	msg.mu.RUnlock()
 	// message body
-	buffer.WriteString("\r\n" + msg.Body())
+	buffer.WriteString("\r\n")
+	buffer.Write(msg.BodyBytes())
 
 	return buffer.String()
 }
@@ -467,13 +593,32 @@ func (msg *message) SetSipVersion(version string) {
 func (msg *message) Body() string {
 	msg.mu.RLock()
 	defer msg.mu.RUnlock()
-	return msg.body
+	return string(msg.body)
 }
 
 // SetBody sets message body, calculates it length and add 'Content-Length' header.
 func (msg *message) SetBody(body string, setContentLength bool) {
+	msg.SetBodyBytes([]byte(body), setContentLength)
+}
+
+// BodyBytes returns copy of the message body, so it can not be changed behind Content-Length.
+func (msg *message) BodyBytes() []byte {
+	msg.mu.RLock()
+	defer msg.mu.RUnlock()
+	if msg.body == nil {
+		return nil
+	}
+	return append([]byte(nil), msg.body...)
+}
+
+// SetBodyBytes sets copy of raw message body, calculates it length in bytes and add 'Content-Length' header.
+func (msg *message) SetBodyBytes(body []byte, setContentLength bool) {
 	msg.mu.Lock()
-	msg.body = body
+	if body == nil {
+		msg.body = nil
+	} else {
+		msg.body = append([]byte(nil), body...)
+	}
 	msg.mu.Unlock()
 	if setContentLength {
 		hdrs := msg.GetHeaders("Content-Length")
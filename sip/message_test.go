@@ -86,6 +86,19 @@ func TestMessage_String(t *testing.T) {
 	}, t)
 }
 
+func TestMessage_BodyBytes(t *testing.T) {
+	body := []byte("Hello world!")
+	req := sip.NewRequest("", "MESSAGE", &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+	req.SetBodyBytes(body, true)
+
+	body[0] = 'J'
+	got := req.BodyBytes()
+	got[1] = 'a'
+	if req.Body() != "Hello world!" {
+		t.Errorf("body is changed through the shared slice: %q", req.Body())
+	}
+}
+
 func TestSipUri_String(t *testing.T) {
 	doTests([]stringTest{
 		{
@@ -0,0 +1,211 @@
+package sip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/ghettovoice/gosip/util"
+)
+
+// BodyPart is a single part of multipart message body (RFC 5621).
+type BodyPart struct {
+	ContentType string
+	// e.g. "session", "render;handling=optional", "signal;handling=required"
+	ContentDisposition string
+	// Content-ID without angle brackets, referenced by cid: URIs.
+	ContentID string
+	// Other part headers, e.g. Content-Transfer-Encoding.
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+// NewBodyPart creates body part with the given content type and payload.
+func NewBodyPart(contentType string, body []byte) *BodyPart {
+	return &BodyPart{
+		ContentType: contentType,
+		Body:        body,
+	}
+}
+
+// MultipartBody is a multipart message body, e.g. SDP with ISUP for SIP-I or SDP with PIDF-LO for emergency calls.
+type MultipartBody struct {
+	// multipart/mixed, multipart/related, multipart/alternative
+	MediaType string
+	Boundary  string
+	Parts     []*BodyPart
+}
+
+// NewMultipartBody creates multipart/mixed body with random boundary.
+func NewMultipartBody(parts ...*BodyPart) *MultipartBody {
+	return &MultipartBody{
+		MediaType: "multipart/mixed",
+		Parts:     parts,
+	}
+}
+
+// ContentType returns value of Content-Type header for the body including boundary parameter.
+// Boundary is generated if it is empty.
+func (body *MultipartBody) ContentType() string {
+	if body.Boundary == "" {
+		body.Boundary = body.newBoundary()
+	}
+
+	mediaType := body.MediaType
+	if mediaType == "" {
+		mediaType = "multipart/mixed"
+	}
+
+	return mime.FormatMediaType(mediaType, map[string]string{"boundary": body.Boundary})
+}
+
+func (body *MultipartBody) newBoundary() string {
+	for {
+		boundary := "boundary-" + util.RandString(24)
+		ok := true
+		for _, part := range body.Parts {
+			if bytes.Contains(part.Body, []byte(boundary)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return boundary
+		}
+	}
+}
+
+// Bytes encodes body to RFC 2046 multipart form. Boundary is generated if it is empty.
+func (body *MultipartBody) Bytes() []byte {
+	if body.Boundary == "" {
+		body.Boundary = body.newBoundary()
+	}
+
+	var buffer bytes.Buffer
+	for _, part := range body.Parts {
+		buffer.WriteString("--" + body.Boundary + "\r\n")
+		if part.ContentType != "" {
+			buffer.WriteString("Content-Type: " + part.ContentType + "\r\n")
+		}
+		if part.ContentDisposition != "" {
+			buffer.WriteString("Content-Disposition: " + part.ContentDisposition + "\r\n")
+		}
+		if part.ContentID != "" {
+			buffer.WriteString("Content-ID: <" + part.ContentID + ">\r\n")
+		}
+		keys := make([]string, 0, len(part.Header))
+		for key := range part.Header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range part.Header[key] {
+				buffer.WriteString(key + ": " + value + "\r\n")
+			}
+		}
+		buffer.WriteString("\r\n")
+		buffer.Write(part.Body)
+		buffer.WriteString("\r\n")
+	}
+	buffer.WriteString("--" + body.Boundary + "--\r\n")
+
+	return buffer.Bytes()
+}
+
+// Part returns the first part with the given content type, parameters are ignored.
+func (body *MultipartBody) Part(contentType string) (*BodyPart, bool) {
+	for _, part := range body.Parts {
+		if mediaType, _, err := mime.ParseMediaType(part.ContentType); err == nil &&
+			strings.EqualFold(mediaType, contentType) {
+			return part, true
+		}
+	}
+	return nil, false
+}
+
+// ParseMultipartBody decodes multipart body with boundary taken from the Content-Type value.
+func ParseMultipartBody(contentType string, data []byte) (*MultipartBody, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("parse content type '%s': %w", contentType, err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("content type '%s' is not multipart", contentType)
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("missing boundary in content type '%s'", contentType)
+	}
+
+	body := &MultipartBody{
+		MediaType: mediaType,
+		Boundary:  boundary,
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("read body part: %w", err)
+		}
+
+		payload, err := ioutil.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("read body part: %w", err)
+		}
+
+		part := &BodyPart{
+			ContentType:        p.Header.Get("Content-Type"),
+			ContentDisposition: p.Header.Get("Content-Disposition"),
+			ContentID:          strings.Trim(p.Header.Get("Content-ID"), "<>"),
+			Body:               payload,
+		}
+		for key, values := range p.Header {
+			switch key {
+			case "Content-Type", "Content-Disposition", "Content-Id":
+				continue
+			}
+			if part.Header == nil {
+				part.Header = make(textproto.MIMEHeader)
+			}
+			part.Header[key] = values
+		}
+		body.Parts = append(body.Parts, part)
+	}
+
+	if len(body.Parts) == 0 {
+		return nil, errors.New("multipart body has no parts")
+	}
+
+	return body, nil
+}
+
+// SetMultipartBody sets multipart body to the message and updates Content-Type and Content-Length headers.
+func SetMultipartBody(msg Message, body *MultipartBody) {
+	contentType := ContentType(body.ContentType())
+	if hdrs := msg.GetHeaders("Content-Type"); len(hdrs) == 0 {
+		msg.AppendHeader(&contentType)
+	} else {
+		msg.ReplaceHeaders("Content-Type", []Header{&contentType})
+	}
+	msg.SetBodyBytes(body.Bytes(), true)
+}
+
+// MultipartBodyFromMessage decodes multipart body of the message.
+func MultipartBodyFromMessage(msg Message) (*MultipartBody, error) {
+	contentType, ok := msg.ContentType()
+	if !ok {
+		return nil, fmt.Errorf("missing 'Content-Type' header in message %s", msg.Short())
+	}
+	return ParseMultipartBody(contentType.Value(), msg.BodyBytes())
+}
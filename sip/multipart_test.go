@@ -0,0 +1,122 @@
+package sip_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+// ISUP IAM with bytes that are not valid UTF-8 and CRLF inside
+var isup = []byte{0x01, 0x00, 0x49, 0x00, 0x00, 0x03, 0x02, 0x00, 0x07, 0x04, 0x10, 0x00, 0x33, 0x63, 0x21, 0x43, 0x00, 0x0d, 0x0a, 0xff, 0xfe}
+
+const sdpBody = "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\nm=audio 4000 RTP/AVP 0\r\n"
+
+func TestMultipartBody(t *testing.T) {
+	body := sip.NewMultipartBody(
+		sip.NewBodyPart("application/sdp", []byte(sdpBody)),
+		&sip.BodyPart{
+			ContentType:        "application/ISUP;version=itu-t92+",
+			ContentDisposition: "signal;handling=required",
+			ContentID:          "isup@example.com",
+			Body:               isup,
+		},
+	)
+
+	contentType := body.ContentType()
+	if !strings.HasPrefix(contentType, "multipart/mixed; boundary=") {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+
+	decoded, err := sip.ParseMultipartBody(contentType, body.Bytes())
+	if err != nil {
+		t.Fatalf("failed to decode body: %s", err)
+	}
+	if len(decoded.Parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(decoded.Parts))
+	}
+	if string(decoded.Parts[0].Body) != sdpBody {
+		t.Errorf("unexpected SDP part %q", decoded.Parts[0].Body)
+	}
+
+	part, ok := decoded.Part("application/isup")
+	if !ok {
+		t.Fatalf("ISUP part not found")
+	}
+	if !bytes.Equal(part.Body, isup) {
+		t.Errorf("unexpected ISUP part % x", part.Body)
+	}
+	if part.ContentDisposition != "signal;handling=required" || part.ContentID != "isup@example.com" {
+		t.Errorf("unexpected ISUP part headers %+v", part)
+	}
+}
+
+func TestParseMultipartBodyErrors(t *testing.T) {
+	cases := map[string]string{
+		"not multipart":    "application/sdp",
+		"missing boundary": "multipart/mixed",
+		"no parts":         "multipart/mixed;boundary=foo",
+	}
+	for name, contentType := range cases {
+		if _, err := sip.ParseMultipartBody(contentType, []byte("--bar--\r\n")); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMultipartMessage(t *testing.T) {
+	body := &sip.MultipartBody{
+		MediaType: "multipart/mixed",
+		Boundary:  "unique-boundary-1",
+		Parts: []*sip.BodyPart{
+			sip.NewBodyPart("application/sdp", []byte(sdpBody)),
+			sip.NewBodyPart("application/ISUP;version=itu-t92+", isup),
+		},
+	}
+	data := body.Bytes()
+
+	raw := append([]byte(strings.Join([]string{
+		"INVITE sip:+15555550123@example.com;user=phone SIP/2.0",
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK.1",
+		"From: <sip:alice@example.com>;tag=1",
+		"To: <sip:+15555550123@example.com;user=phone>",
+		"Call-ID: multipart-test",
+		"CSeq: 1 INVITE",
+		"Content-Type: " + body.ContentType(),
+		"Content-Length: " + strconv.Itoa(len(data)),
+		"",
+		"",
+	}, "\r\n")), data...)
+
+	msg, err := parser.ParseMessage(raw, log.NewDefaultLogrusLogger())
+	if err != nil {
+		t.Fatalf("failed to parse message: %s", err)
+	}
+	if !bytes.Equal(msg.BodyBytes(), data) {
+		t.Fatalf("unexpected body % x", msg.BodyBytes())
+	}
+	if msg.String() != string(raw) {
+		t.Errorf("message is not serialised back as is")
+	}
+
+	decoded, err := sip.MultipartBodyFromMessage(msg)
+	if err != nil {
+		t.Fatalf("failed to decode body: %s", err)
+	}
+	if len(decoded.Parts) != 2 || !bytes.Equal(decoded.Parts[1].Body, isup) {
+		t.Errorf("unexpected parts %+v", decoded.Parts)
+	}
+
+	req := sip.NewRequest("", sip.INVITE, msg.(sip.Request).Recipient(), "SIP/2.0", nil, "", nil)
+	sip.SetMultipartBody(req, body)
+	if hdr, ok := req.ContentLength(); !ok || int(*hdr) != len(data) {
+		t.Errorf("unexpected Content-Length %v, expected %d", hdr, len(data))
+	}
+	if hdr, ok := req.ContentType(); !ok || hdr.Value() != body.ContentType() {
+		t.Errorf("unexpected Content-Type %v", hdr)
+	}
+}
@@ -1,5 +1,11 @@
 package parser
 
+import (
+	"fmt"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
 type Error interface {
 	error
 	// Syntax indicates that this is syntax error
@@ -24,3 +30,46 @@ type WriteError string
 
 func (err WriteError) Syntax() bool  { return false }
 func (err WriteError) Error() string { return "parser.WriteError: " + string(err) }
+
+// LimitError is returned when a message exceeds one of the parser Limits.
+// In streamed mode the parser can not find the start of the next message after it,
+// so the rest of the input is discarded until the parser is reset.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, one of Limit* constants.
+	Limit string
+	// Max is the configured value of the limit.
+	Max int
+	// Msg is the part of the message parsed before the limit was hit, can be nil.
+	Msg sip.Message
+}
+
+func (err *LimitError) Syntax() bool { return false }
+
+// StatusCode returns the response code that should be sent back on the rejected request.
+func (err *LimitError) StatusCode() sip.StatusCode {
+	if err.Limit == LimitBodySize {
+		return 413
+	}
+	return 513
+}
+
+// Reason returns the reason phrase matching StatusCode.
+func (err *LimitError) Reason() string {
+	if err.Limit == LimitBodySize {
+		return "Request Entity Too Large"
+	}
+	return "Message Too Large"
+}
+
+func (err *LimitError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	s := fmt.Sprintf("parser.LimitError: %s of %d exceeded", err.Limit, err.Max)
+	if err.Msg != nil {
+		s += fmt.Sprintf(" by message %s", err.Msg.Short())
+	}
+
+	return s
+}
@@ -0,0 +1,129 @@
+//go:build go1.18
+// +build go1.18
+
+package parser_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+// Run with: go test -run XXX -fuzz FuzzParseMessage ./sip/parser/
+
+func fuzzLogger() log.Logger {
+	logger := log.NewDefaultLogrusLogger()
+	logger.SetLevel(log.PanicLevel)
+	return logger
+}
+
+func addRFC4475Seeds(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "rfc4475", "*.dat"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzParseMessage(f *testing.F) {
+	addRFC4475Seeds(f)
+	logger := fuzzLogger()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := parser.ParseMessage(data, logger)
+		if err != nil {
+			return
+		}
+		_ = msg.String()
+	})
+}
+
+func FuzzStreamParser(f *testing.F) {
+	addRFC4475Seeds(f)
+	logger := fuzzLogger()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		output := make(chan sip.Message)
+		errs := make(chan error)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case msg := <-output:
+					_ = msg.String()
+				case <-errs:
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		p := parser.NewParser(output, errs, true, logger)
+		for len(data) > 0 {
+			n := 7
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := p.Write(data[:n]); err != nil {
+				t.Fatalf("write failed: %s", err)
+			}
+			data = data[n:]
+		}
+		p.Stop()
+	})
+}
+
+func FuzzParseUri(f *testing.F) {
+	for _, seed := range []string{
+		"sip:alice@atlanta.com",
+		"sips:bob:secret@[2001:db8::1]:5061;transport=tcp;lr?subject=hi&priority=urgent",
+		"sip:user;par=u%40example.net@example.com",
+		"tel:+1-201-555-0123;ext=1234",
+		"tel:7042;phone-context=example.com",
+		"urn:service:sos",
+		"*",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		uri, err := parser.ParseUri(s)
+		if err != nil {
+			return
+		}
+		_ = uri.String()
+	})
+}
+
+func FuzzParseAddressValue(f *testing.F) {
+	for _, seed := range []string{
+		`"Alice" <sip:alice@atlanta.com>;tag=1928301774`,
+		`sip:bob@biloxi.com;tag=a6c85cf`,
+		`"J Rosenberg \\\"" <sip:jdrosen@example.com>;tag=98asjd8`,
+		`Bob <sips:bob@biloxi.com;transport=tls?Subject=hi>;expires=3600;q=0.7`,
+		`<tel:+12015550123>;param="quoted, value"`,
+		`*`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		_, uri, params, err := parser.ParseAddressValue(s)
+		if err != nil {
+			return
+		}
+		_ = uri.String()
+		_ = params.String()
+	})
+}
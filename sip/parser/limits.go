@@ -0,0 +1,35 @@
+package parser
+
+// Limits bounds the resources the parser may spend on a single message.
+// Zero value of any field means no limit.
+type Limits struct {
+	// MaxMessageSize is the maximum size of the whole message in bytes.
+	MaxMessageSize int
+	// MaxHeaderCount is the maximum number of header fields.
+	MaxHeaderCount int
+	// MaxLineLength is the maximum length of the start line or a single header line in bytes.
+	MaxLineLength int
+	// MaxBodySize is the maximum size of the message body in bytes.
+	MaxBodySize int
+	// MaxViaCount is the maximum number of Via hops.
+	MaxViaCount int
+}
+
+// DefaultLimits are sane limits for messages received from the network.
+// Message size is capped at the maximum UDP datagram size.
+var DefaultLimits = Limits{
+	MaxMessageSize: 65535,
+	MaxHeaderCount: 256,
+	MaxLineLength:  8192,
+	MaxBodySize:    65535,
+	MaxViaCount:    70,
+}
+
+// Names of the limits reported in LimitError.
+const (
+	LimitMessageSize = "MaxMessageSize"
+	LimitHeaderCount = "MaxHeaderCount"
+	LimitLineLength  = "MaxLineLength"
+	LimitBodySize    = "MaxBodySize"
+	LimitViaCount    = "MaxViaCount"
+)
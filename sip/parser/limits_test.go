@@ -0,0 +1,160 @@
+package parser_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+)
+
+func limitsTestMessage(extraHeaders []string, body string) string {
+	return strings.Join(append([]string{
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+		"To: Bob <sip:bob@biloxi.com>",
+		"From: Alice <sip:alice@atlanta.com>;tag=1928301774",
+		"Call-ID: a84b4c76e66710@pc33.atlanta.com",
+		"CSeq: 314159 INVITE",
+		fmt.Sprintf("Content-Length: %d", len(body)),
+	}, extraHeaders...), "\r\n") + "\r\n\r\n" + body
+}
+
+func repeatHeader(header string, n int) []string {
+	headers := make([]string, n)
+	for i := range headers {
+		headers[i] = header
+	}
+	return headers
+}
+
+var limitsTests = []struct {
+	name   string
+	limits parser.Limits
+	msg    string
+	limit  string
+	code   sip.StatusCode
+}{
+	{
+		"line length",
+		parser.Limits{MaxLineLength: 100},
+		limitsTestMessage([]string{"Subject: " + strings.Repeat("a", 100)}, ""),
+		parser.LimitLineLength,
+		513,
+	},
+	{
+		"header count",
+		parser.Limits{MaxHeaderCount: 10},
+		limitsTestMessage(repeatHeader("Subject: hi", 5), ""),
+		parser.LimitHeaderCount,
+		513,
+	},
+	{
+		"via count",
+		parser.Limits{MaxViaCount: 3},
+		limitsTestMessage(repeatHeader("Via: SIP/2.0/UDP proxy.atlanta.com;branch=z9hG4bK1", 3), ""),
+		parser.LimitViaCount,
+		513,
+	},
+	{
+		"body size",
+		parser.Limits{MaxBodySize: 10},
+		limitsTestMessage(nil, strings.Repeat("b", 11)),
+		parser.LimitBodySize,
+		413,
+	},
+	{
+		"message size",
+		parser.Limits{MaxMessageSize: 300},
+		limitsTestMessage(nil, strings.Repeat("b", 100)),
+		parser.LimitMessageSize,
+		513,
+	},
+}
+
+func TestLimits(t *testing.T) {
+	for _, tt := range limitsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp := parser.NewPacketParser(testutils.NewLogrusLogger())
+			defer pp.Stop()
+			pp.SetLimits(tt.limits)
+
+			_, err := pp.ParseMessage([]byte(tt.msg))
+			var lerr *parser.LimitError
+			if !errors.As(err, &lerr) {
+				t.Fatalf("expected LimitError, got %v", err)
+			}
+			if lerr.Limit != tt.limit || lerr.StatusCode() != tt.code {
+				t.Errorf("unexpected error: %s, code %d", lerr, lerr.StatusCode())
+			}
+			if tt.limit != parser.LimitLineLength {
+				if req, ok := lerr.Msg.(sip.Request); !ok {
+					t.Errorf("expected partially parsed request, got %v", lerr.Msg)
+				} else if _, ok := req.CallID(); !ok {
+					t.Errorf("expected Call-ID in partially parsed request:\n%s", req)
+				}
+			}
+
+			// the parser keeps working after the rejected datagram
+			msg, err := pp.ParseMessage([]byte(limitsTestMessage(nil, "")))
+			if err != nil {
+				t.Fatalf("parse failed: %s", err)
+			}
+			if _, ok := msg.(sip.Request); !ok {
+				t.Errorf("expected request, got %v", msg)
+			}
+		})
+	}
+}
+
+func TestLimitsStreamed(t *testing.T) {
+	output := make(chan sip.Message)
+	errs := make(chan error)
+	p := parser.NewParser(output, errs, true, testutils.NewLogrusLogger())
+	defer p.Stop()
+	p.SetLimits(parser.Limits{MaxLineLength: 1024, MaxBodySize: 1024})
+
+	valid := limitsTestMessage(nil, "")
+	go func() {
+		p.Write([]byte(valid))
+		// the huge Content-Length must not be allocated
+		p.Write([]byte(strings.Replace(valid, "Content-Length: 0", "Content-Length: 2000000000", 1)))
+		p.Write([]byte(valid))
+	}()
+
+	select {
+	case msg := <-output:
+		if _, ok := msg.(sip.Request); !ok {
+			t.Fatalf("expected request, got %v", msg)
+		}
+	case err := <-errs:
+		t.Fatalf("unexpected error: %s", err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	select {
+	case msg := <-output:
+		t.Fatalf("unexpected message: %v", msg)
+	case err := <-errs:
+		var lerr *parser.LimitError
+		if !errors.As(err, &lerr) || lerr.Limit != parser.LimitBodySize {
+			t.Fatalf("expected body size LimitError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+
+	// the rest of the stream is discarded
+	select {
+	case msg := <-output:
+		t.Fatalf("unexpected message: %v", msg)
+	case err := <-errs:
+		t.Fatalf("unexpected error: %s", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -39,6 +39,12 @@ type Parser interface {
 	// This will overwrite any existing registered parser for that header type.
 	// If a parser is not available for a header type in a message, the parser will produce a core.GenericHeader struct.
 	SetHeaderParser(headerName string, headerParser HeaderParser)
+	// SetLimits sets resource limits applied to the messages parsed after the call.
+	// Messages exceeding them are rejected with LimitError.
+	SetLimits(limits Limits)
+	// SetRawHandler sets the handler called with each parsed message and the bytes it was parsed from,
+	// before the message is sent down the output chan.
+	SetRawHandler(handler RawHandler)
 
 	Stop()
 
@@ -49,6 +55,9 @@ type Parser interface {
 	ParseHeader(headerText string) (headers []sip.Header, err error)
 }
 
+// A RawHandler receives the parsed message along with the bytes it was parsed from.
+type RawHandler func(msg sip.Message, data []byte)
+
 // A HeaderParser is any function that turns raw header data into one or more Header objects.
 // The HeaderParser will receive arguments of the form ("max-forwards", "70").
 // It should return a slice of headers, which should have length > 1 unless it also returns an error.
@@ -56,31 +65,50 @@ type HeaderParser func(headerName string, headerData string) ([]sip.Header, erro
 
 func defaultHeaderParsers() map[string]HeaderParser {
 	return map[string]HeaderParser{
-		"to":             parseAddressHeader,
-		"t":              parseAddressHeader,
-		"from":           parseAddressHeader,
-		"f":              parseAddressHeader,
-		"contact":        parseAddressHeader,
-		"m":              parseAddressHeader,
-		"call-id":        parseCallId,
-		"i":              parseCallId,
-		"cseq":           parseCSeq,
-		"via":            parseViaHeader,
-		"v":              parseViaHeader,
-		"max-forwards":   parseMaxForwards,
-		"content-length": parseContentLength,
-		"l":              parseContentLength,
-		"expires":        parseExpires,
-		"user-agent":     parseUserAgent,
-		"allow":          parseAllow,
-		"content-type":   parseContentType,
-		"c":              parseContentType,
-		"accept":         parseAccept,
-		"require":        parseRequire,
-		"supported":      parseSupported,
-		"k":              parseSupported,
-		"route":          parseRouteHeader,
-		"record-route":   parseRecordRouteHeader,
+		"to":                 parseAddressHeader,
+		"t":                  parseAddressHeader,
+		"from":               parseAddressHeader,
+		"f":                  parseAddressHeader,
+		"contact":            parseAddressHeader,
+		"m":                  parseAddressHeader,
+		"call-id":            parseCallId,
+		"i":                  parseCallId,
+		"cseq":               parseCSeq,
+		"via":                parseViaHeader,
+		"v":                  parseViaHeader,
+		"max-forwards":       parseMaxForwards,
+		"content-length":     parseContentLength,
+		"l":                  parseContentLength,
+		"expires":            parseExpires,
+		"user-agent":         parseUserAgent,
+		"allow":              parseAllow,
+		"content-type":       parseContentType,
+		"c":                  parseContentType,
+		"accept":             parseAccept,
+		"require":            parseRequire,
+		"supported":          parseSupported,
+		"k":                  parseSupported,
+		"route":              parseRouteHeader,
+		"record-route":       parseRecordRouteHeader,
+		"refer-to":           parseReferTo,
+		"r":                  parseReferTo,
+		"referred-by":        parseReferredBy,
+		"b":                  parseReferredBy,
+		"replaces":           parseReplaces,
+		"refer-sub":          parseReferSub,
+		"event":              parseEvent,
+		"o":                  parseEvent,
+		"subscription-state": parseSubscriptionState,
+		"p-asserted-identity":  parsePAssertedIdentity,
+		"p-preferred-identity": parsePPreferredIdentity,
+		"privacy":              parsePrivacy,
+		"reason":               parseReason,
+		"history-info":         parseHistoryInfo,
+		"diversion":            parseDiversion,
+		"www-authenticate":     parseWWWAuthenticate,
+		"proxy-authenticate":   parseProxyAuthenticate,
+		"authorization":        parseAuthorization,
+		"proxy-authorization":  parseProxyAuthorization,
 		//"content-encoding","e"
 		//"subject":          "s",
 	}
@@ -141,6 +169,11 @@ func (pp *PacketParser) ParseMessage(msgData []byte) (sip.Message, error) {
 	}
 }
 
+// SetLimits sets resource limits of the underlying parser.
+func (pp *PacketParser) SetLimits(limits Limits) {
+	pp.p.SetLimits(limits)
+}
+
 func (pp *PacketParser) Stop() {
 	if pp == nil {
 		return
@@ -203,6 +236,8 @@ type parser struct {
 	headerParsers map[string]HeaderParser
 	streamed      bool
 	input         *parserBuffer
+	limits        Limits
+	rawHandler    RawHandler
 
 	output chan<- sip.Message
 	errs   chan<- error
@@ -307,7 +342,7 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 		var bodyLen, msgLen int
 		if !p.streamed {
 			// extract body/msg len
-			line, err := p.input.NextLine()
+			line, err := p.input.NextLine(0)
 			if err != nil {
 				break
 			}
@@ -324,9 +359,21 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 				continue
 			}
 		}
+		p.mu.Lock()
+		limits := p.limits
+		rawHandler := p.rawHandler
+		p.mu.Unlock()
+		p.input.StartMessage(rawHandler != nil)
+
 		// Parse the StartLine.
-		startLine, err := p.input.NextLine()
-		if err != nil {
+		startLine, err := p.input.NextLine(limits.MaxLineLength)
+		if err == errLineTooLong {
+			if p.rejectMessage(&LimitError{Limit: LimitLineLength, Max: limits.MaxLineLength}, msgLen) {
+				break
+			}
+
+			continue
+		} else if err != nil {
 			break
 		}
 
@@ -383,24 +430,55 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 		// Headers can be split across lines (marked by whitespace at the start of subsequent lines),
 		// so store lines into a buffer, and then flush and parse it when we hit the end of the header.
 		var buffer bytes.Buffer
-		headers := make([]sip.Header, 0)
+		// The header lines as received, kept for transparent forwarding.
+		var rawBuffer bytes.Buffer
+		type rawHeaders struct {
+			raw     []byte
+			headers []sip.Header
+		}
+		headers := make([]rawHeaders, 0)
+		// The first error in the headers that the message can not be handled without.
+		var headerErr error
+		var headerCount, viaCount int
 
 		flushBuffer := func() {
 			if buffer.Len() > 0 {
 				newHeaders, err := p.ParseHeader(buffer.String())
 				if err == nil {
-					headers = append(headers, newHeaders...)
+					headers = append(headers, rawHeaders{
+						raw:     append([]byte(nil), rawBuffer.Bytes()...),
+						headers: newHeaders,
+					})
+					for _, header := range newHeaders {
+						if via, ok := header.(sip.ViaHeader); ok {
+							viaCount += len(via)
+						}
+					}
+				} else if isMandatoryHeader(buffer.String()) {
+					if headerErr == nil {
+						headerErr = fmt.Errorf("malformed header '%s': %w", buffer.String(), err)
+					}
 				} else {
-					p.Log().Warnf("skip header '%s' due to error: %s", buffer, err)
+					p.Log().Warnf("skip header '%s' due to error: %s", buffer.String(), err)
 				}
 				buffer.Reset()
+				rawBuffer.Reset()
 			}
 		}
 
+		var limitErr *LimitError
 		for {
-			line, err := p.input.NextLine()
+			line, err := p.input.NextLine(limits.MaxLineLength)
 
-			if err != nil {
+			if err == errLineTooLong {
+				limitErr = &LimitError{Limit: LimitLineLength, Max: limits.MaxLineLength}
+				break
+			} else if err != nil {
+				break
+			}
+
+			if limits.MaxMessageSize > 0 && p.input.consumed > limits.MaxMessageSize {
+				limitErr = &LimitError{Limit: LimitMessageSize, Max: limits.MaxMessageSize}
 				break
 			}
 
@@ -416,11 +494,21 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 				// This line starts a new header.
 				// Parse anything currently in the buffer, then store the new header line in the buffer.
 				flushBuffer()
+
+				headerCount++
+				if limits.MaxHeaderCount > 0 && headerCount > limits.MaxHeaderCount {
+					limitErr = &LimitError{Limit: LimitHeaderCount, Max: limits.MaxHeaderCount}
+					break
+				}
+
 				buffer.WriteString(line)
+				rawBuffer.WriteString(line)
 			} else if buffer.Len() > 0 {
 				// This is a continuation line, so just add it to the buffer.
 				buffer.WriteString(" ")
 				buffer.WriteString(line)
+				rawBuffer.WriteString("\r\n")
+				rawBuffer.WriteString(line)
 			} else {
 				// This is a continuation line, but also the first line of the whole header section.
 				// Discard it and log.
@@ -432,14 +520,42 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 			}
 		}
 
+		if limitErr != nil {
+			// keep the headers read so far, they are enough to respond in most cases
+			flushBuffer()
+		} else if limits.MaxViaCount > 0 && viaCount > limits.MaxViaCount {
+			limitErr = &LimitError{Limit: LimitViaCount, Max: limits.MaxViaCount}
+		}
+
 		// Store the headers in the message object.
-		for _, header := range headers {
-			msg.AppendHeader(header)
+		for _, hdrs := range headers {
+			msg.AppendRawHeader(hdrs.raw, hdrs.headers...)
+		}
+
+		if limitErr != nil {
+			limitErr.Msg = msg
+			if p.rejectMessage(limitErr, msgLen) {
+				break
+			}
+
+			continue
 		}
 
 		var contentLength int
 		// Determine the length of the body, so we know when to stop parsing this message.
 		if p.streamed {
+			if headerErr != nil && len(msg.GetHeaders("Content-Length")) != 1 {
+				// Content-Length is broken, so the end of the message can not be found.
+				skipStreamedErr = true
+
+				p.errs <- &sip.MalformedMessageError{
+					Err: headerErr,
+					Msg: msg.String(),
+				}
+
+				continue
+			}
+
 			// Use the content-length header to identify the end of the message.
 			contentLengthHeaders := msg.GetHeaders("Content-Length")
 			if len(contentLengthHeaders) == 0 {
@@ -477,6 +593,30 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 			contentLength = bodyLen
 		}
 
+		if limits.MaxBodySize > 0 && contentLength > limits.MaxBodySize {
+			limitErr = &LimitError{Limit: LimitBodySize, Max: limits.MaxBodySize, Msg: msg}
+		} else if limits.MaxMessageSize > 0 && p.input.consumed+contentLength > limits.MaxMessageSize {
+			limitErr = &LimitError{Limit: LimitMessageSize, Max: limits.MaxMessageSize, Msg: msg}
+		}
+		if limitErr != nil {
+			if p.rejectMessage(limitErr, msgLen) {
+				break
+			}
+
+			continue
+		}
+
+		if headerErr != nil {
+			p.input.NextChunk(contentLength)
+
+			p.errs <- &sip.MalformedMessageError{
+				Err: headerErr,
+				Msg: msg.String(),
+			}
+
+			continue
+		}
+
 		// Extract the message body.
 		p.Log().Tracef("%s reads body with length = %d bytes", p, contentLength)
 		body, err := p.input.NextChunk(contentLength)
@@ -500,8 +640,37 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 			continue
 		}
 
-		if strings.TrimSpace(body) != "" {
-			msg.SetBody(body, false)
+		if !p.streamed {
+			// Content-Length is optional for datagrams, but when present it must fit into the datagram.
+			// Any octets past the Content-Length are discarded (RFC 3261 18.3).
+			contentLengthHeaders := msg.GetHeaders("Content-Length")
+			if len(contentLengthHeaders) > 1 {
+				p.errs <- &sip.MalformedMessageError{
+					Err: fmt.Errorf("multiple 'Content-Length' headers"),
+					Msg: msg.String(),
+				}
+
+				continue
+			} else if len(contentLengthHeaders) == 1 {
+				if n := int(*(contentLengthHeaders[0].(*sip.ContentLength))); n > len(body) {
+					p.errs <- &sip.BrokenMessageError{
+						Err: fmt.Errorf("incomplete message body: read %d bytes, expected %d bytes", len(body), n),
+						Msg: msg.String(),
+					}
+
+					continue
+				} else {
+					body = body[:n]
+				}
+			}
+		}
+
+		if len(bytes.TrimSpace(body)) != 0 {
+			msg.SetBodyBytes(body, false)
+		}
+
+		if rawHandler != nil {
+			rawHandler(msg, p.input.Raw())
 		}
 
 		p.output <- msg
@@ -509,6 +678,65 @@ func (p *parser) parse(requireContentLength bool, done chan<- struct{}) {
 	return
 }
 
+// Sends the limit error and skips the rest of the rejected message.
+// Streamed input can not be resynchronized, so all further data is discarded
+// until the parser is stopped or reset, in this case true is returned.
+func (p *parser) rejectMessage(err *LimitError, msgLen int) bool {
+	p.Log().Debugf("reject message: %s", err)
+
+	if p.streamed {
+		p.errs <- err
+		p.input.Drain()
+
+		return true
+	}
+
+	if skip := msgLen - p.input.consumed; skip > 0 {
+		if err := p.input.Discard(skip); err != nil {
+			p.Log().Errorf("skip failed: %s", err)
+		}
+	}
+	p.errs <- err
+
+	return false
+}
+
+// Checks whether the message can be handled with the header dropped.
+// Malformed headers that identify the transaction and dialog, or frame the message,
+// make the whole message invalid (RFC 4475 s. 3.1.2), other ones are skipped.
+func isMandatoryHeader(headerText string) bool {
+	colonIdx := strings.Index(headerText, ":")
+	if colonIdx == -1 {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(headerText[:colonIdx])) {
+	case "via", "v",
+		"from", "f",
+		"to", "t",
+		"call-id", "i",
+		"cseq",
+		"content-length", "l",
+		"max-forwards",
+		"contact", "m":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *parser) SetLimits(limits Limits) {
+	p.mu.Lock()
+	p.limits = limits
+	p.mu.Unlock()
+}
+
+func (p *parser) SetRawHandler(handler RawHandler) {
+	p.mu.Lock()
+	p.rawHandler = handler
+	p.mu.Unlock()
+}
+
 // Implements ParserFactory.SetHeaderParser.
 func (p *parser) SetHeaderParser(headerName string, headerParser HeaderParser) {
 	headerName = strings.ToLower(headerName)
@@ -581,13 +809,31 @@ func ParseRequestLine(requestLine string) (
 		return
 	}
 
-	method = sip.RequestMethod(strings.ToUpper(parts[0]))
+	if !isToken(parts[0]) {
+		err = fmt.Errorf("invalid method in request line: '%s'", requestLine)
+		return
+	}
+	if !isSipVersion(parts[2]) {
+		err = fmt.Errorf("invalid SIP version in request line: '%s'", requestLine)
+		return
+	}
+
+	// Method names are case-sensitive (RFC 3261 7.1).
+	method = sip.RequestMethod(parts[0])
 	recipient, err = ParseUri(parts[1])
 	sipVersion = parts[2]
+	if err != nil {
+		return
+	}
 
 	switch recipient.(type) {
-	case *sip.WildcardUri:
+	case sip.WildcardUri, *sip.WildcardUri:
 		err = fmt.Errorf("wildcard URI '*' not permitted in request line: '%s'", requestLine)
+	default:
+		// RFC 3261 19.1.1: headers are not allowed in the Request-URI.
+		if headers := recipient.Headers(); headers != nil && headers.Length() > 0 {
+			err = fmt.Errorf("headers not permitted in Request-URI: '%s'", requestLine)
+		}
 	}
 
 	return
@@ -604,14 +850,60 @@ func ParseStatusLine(statusLine string) (
 		return
 	}
 
+	if !isSipVersion(parts[0]) {
+		err = fmt.Errorf("invalid SIP version in status line: '%s'", statusLine)
+		return
+	}
+	// Status-Code is 3DIGIT.
+	if len(parts[1]) != 3 {
+		err = fmt.Errorf("invalid status code in status line: '%s'", statusLine)
+		return
+	}
+
 	sipVersion = parts[0]
 	statusCodeRaw, err := strconv.ParseUint(parts[1], 10, 16)
+	if err == nil && statusCodeRaw < 100 {
+		err = fmt.Errorf("invalid status code in status line: '%s'", statusLine)
+	}
 	statusCode = sip.StatusCode(statusCodeRaw)
 	reasonPhrase = strings.Join(parts[2:], " ")
 
 	return
 }
 
+// Checks that the string is a token as defined in RFC 3261 25.1, e.g. a method name.
+func isToken(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.IndexByte("-.!%*_+`'~", c) != -1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks the SIP-Version syntax: "SIP" "/" 1*DIGIT "." 1*DIGIT.
+// Unsupported versions should be rejected by the application with 505 Version Not Supported.
+func isSipVersion(s string) bool {
+	if len(s) < 7 || !strings.EqualFold(s[:4], "SIP/") {
+		return false
+	}
+	dot := strings.IndexByte(s[4:], '.')
+	if dot < 1 || dot == len(s[4:])-1 {
+		return false
+	}
+	for i := 4; i < len(s); i++ {
+		if i != 4+dot && (s[i] < '0' || s[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
 // parseUri converts a string representation of a URI into a Uri object.
 // If the URI is malformed, or the URI schema is not recognised, an error is returned.
 // URIs have the general form of schema:address.
@@ -637,10 +929,99 @@ func ParseUri(uriStr string) (uri sip.Uri, err error) {
 		var sipUri sip.SipUri
 		sipUri, err = ParseSipUri(uriStr)
 		uri = &sipUri
+	case "tel":
+		var telUri sip.TelUri
+		telUri, err = ParseTelUri(uriStr)
+		uri = &telUri
 	default:
-		err = fmt.Errorf("unsupported URI schema %s", uriStr[:colonIdx])
+		var absUri sip.AbsoluteUri
+		absUri, err = ParseAbsoluteUri(uriStr)
+		uri = &absUri
+	}
+
+	return
+}
+
+// ParseTelUri converts a string representation of a tel URI (RFC 3966) into a TelUri object.
+func ParseTelUri(uriStr string) (uri sip.TelUri, err error) {
+	if len(uriStr) < 4 || strings.ToLower(uriStr[:4]) != "tel:" {
+		err = fmt.Errorf("invalid tel uri protocol name in '%s'", uriStr)
+		return
+	}
+
+	number := uriStr[4:]
+	paramsStr := ""
+	if i := strings.Index(number, ";"); i != -1 {
+		number, paramsStr = number[:i], number[i:]
+	}
+
+	global := strings.HasPrefix(number, "+")
+	digits := number
+	if global {
+		digits = number[1:]
+	}
+
+	hasDigits := false
+	for _, c := range digits {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigits = true
+		case c == '-' || c == '.' || c == '(' || c == ')':
+		case !global && (c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' || c == '*' || c == '#'):
+			hasDigits = true
+		default:
+			err = fmt.Errorf("invalid character '%c' in tel uri number '%s'", c, uriStr)
+			return
+		}
+	}
+	if !hasDigits {
+		err = fmt.Errorf("no digits in tel uri number '%s'", uriStr)
+		return
+	}
+
+	uri.FNumber = number
+	uri.FUriParams, _, err = ParseParams(paramsStr, ';', ';', 0, true, true)
+	if err != nil {
+		return
+	}
+
+	if _, ok := uri.PhoneContext(); !global && !ok {
+		err = fmt.Errorf("local number without phone-context in tel uri '%s'", uriStr)
+	}
+
+	return
+}
+
+// ParseAbsoluteUri converts a string representation of an arbitrary absolute URI into AbsoluteUri object.
+func ParseAbsoluteUri(uriStr string) (uri sip.AbsoluteUri, err error) {
+	colonIdx := strings.Index(uriStr, ":")
+	if colonIdx < 1 {
+		err = fmt.Errorf("no schema in URI '%s'", uriStr)
+		return
+	}
+
+	// scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+	for i, c := range uriStr[:colonIdx] {
+		isAlpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !isAlpha && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			err = fmt.Errorf("invalid character '%c' in URI schema '%s'", c, uriStr)
+			return
+		}
+	}
+
+	opaque := uriStr[colonIdx+1:]
+	if opaque == "" {
+		err = fmt.Errorf("empty URI '%s'", uriStr)
+		return
+	}
+	if strings.ContainsAny(opaque, " \t\r\n<>\"") {
+		err = fmt.Errorf("invalid character in URI '%s'", uriStr)
+		return
 	}
 
+	uri.FScheme = uriStr[:colonIdx]
+	uri.FOpaque = opaque
+
 	return
 }
 
@@ -650,7 +1031,7 @@ func ParseSipUri(uriStr string) (uri sip.SipUri, err error) {
 	uriStrCopy := uriStr
 
 	// URI should start 'sip' or 'sips'. Check the first 3 chars.
-	if strings.ToLower(uriStr[:3]) != "sip" {
+	if len(uriStr) < 4 || strings.ToLower(uriStr[:3]) != "sip" {
 		err = fmt.Errorf("invalid SIP uri protocol name in '%s'", uriStrCopy)
 		return
 	}
@@ -663,7 +1044,7 @@ func ParseSipUri(uriStr string) (uri sip.SipUri, err error) {
 	}
 
 	// The 'sip' or 'sips' protocol name should be followed by a ':' character.
-	if uriStr[0] != ':' {
+	if len(uriStr) == 0 || uriStr[0] != ':' {
 		err = fmt.Errorf("no ':' after protocol name in SIP uri '%s'", uriStrCopy)
 		return
 	}
@@ -768,29 +1149,34 @@ func ParseSipUri(uriStr string) (uri sip.SipUri, err error) {
 // and return 'nil' if no port was present.
 func ParseHostPort(rawText string) (host string, port *sip.Port, err error) {
 	var rawHost, rawPort string
-	if i := strings.LastIndex(rawText, ":"); i == -1 {
+	if i := strings.LastIndex(rawText, ":"); i == -1 || i < strings.LastIndex(rawText, "]") {
+		// No port, colons of IPv6 reference are skipped.
 		rawHost = rawText
 	} else {
 		rawHost = rawText[:i]
 		rawPort = rawText[i+1:]
 	}
+	if rawHost == "" {
+		err = fmt.Errorf("empty host in '%s'", rawText)
+		return
+	}
 
 	if strings.HasPrefix(rawHost, "[") {
 		// IPv6 with zone
 		if zone := strings.Index(rawHost, "%25"); zone >= 0 {
 			host1, er := sip.Unescape(rawHost[:zone], sip.EncodeHost)
 			if er != nil {
-				err = fmt.Errorf("unescape host: %w", err)
+				err = fmt.Errorf("unescape host: %w", er)
 				return
 			}
 			host2, er := sip.Unescape(rawHost[zone:len(rawHost)-1], sip.EncodeZone)
 			if er != nil {
-				err = fmt.Errorf("unescape zone: %w", err)
+				err = fmt.Errorf("unescape zone: %w", er)
 				return
 			}
 			host3, er := sip.Unescape(rawHost[len(rawHost)-1:], sip.EncodeHost)
 			if er != nil {
-				err = fmt.Errorf("unescape host: %w", err)
+				err = fmt.Errorf("unescape host: %w", er)
 				return
 			}
 			host = host1 + host2 + host3
@@ -801,7 +1187,7 @@ func ParseHostPort(rawText string) (host string, port *sip.Port, err error) {
 		if h, er := sip.Unescape(rawHost, sip.EncodeHost); er == nil {
 			host = h
 		} else {
-			err = fmt.Errorf("unescape host: %w", err)
+			err = fmt.Errorf("unescape host: %w", er)
 			return
 		}
 	}
@@ -839,6 +1225,21 @@ func ParseParams(
 	end uint8,
 	quoteValues bool,
 	permitSingletons bool,
+) (params sip.Params, consumed int, err error) {
+	return parseParams(source, start, sep, end, quoteValues, permitSingletons, true)
+}
+
+// parseParams is ParseParams that optionally tolerates '%' which does not start a valid escape sequence.
+// Escaping is defined for URI parameters only, in header parameters '%' is an ordinary token
+// character (RFC 4475 s. 3.1.1.5), so such values are kept as is.
+func parseParams(
+	source string,
+	start uint8,
+	sep uint8,
+	end uint8,
+	quoteValues bool,
+	permitSingletons bool,
+	strictEscapes bool,
 ) (params sip.Params, consumed int, err error) {
 	params = sip.NewParams()
 
@@ -886,8 +1287,12 @@ parseLoop:
 				buffer.WriteString(string(sep))
 				continue
 			}
+			if parsingKey && buffer.Len() == 0 {
+				err = fmt.Errorf("empty parameter name in params \"%s\"", source)
+				return
+			}
 			if parsingKey && permitSingletons {
-				if k, er := sip.Unescape(buffer.String(), sip.EncodeQueryComponent); er == nil {
+				if k, er := unescapeParam(buffer.String(), strictEscapes); er == nil {
 					params.Add(k, nil)
 				} else {
 					err = fmt.Errorf("unescape params: %w", er)
@@ -901,8 +1306,8 @@ parseLoop:
 				)
 				return
 			} else {
-				if k, er := sip.Unescape(key, sip.EncodeQueryComponent); er == nil {
-					if v, er := sip.Unescape(buffer.String(), sip.EncodeQueryComponent); er == nil {
+				if k, er := unescapeParam(key, strictEscapes); er == nil {
+					if v, er := unescapeParam(buffer.String(), strictEscapes); er == nil {
 						params.Add(k, sip.String{Str: v})
 					} else {
 						err = fmt.Errorf("unescape params: %w", er)
@@ -935,14 +1340,15 @@ parseLoop:
 				return
 			}
 
-			if inQuotes &&
-				consumed != len(source)-1 &&
-				source[consumed+1] != sep {
-				// We hit an end-quote midway through a value; that's not allowed.
-				err = fmt.Errorf("unexpected character %c after quoted param in \"%s\"",
-					source[consumed+1], source)
+			if inQuotes && consumed != len(source)-1 {
+				// Only whitespace or the end of the param may follow the end-quote.
+				if next := strings.TrimLeft(source[consumed+1:], abnfWs); next != "" &&
+					next[0] != sep && (end == 0 || next[0] != end) {
+					err = fmt.Errorf("unexpected character %c after quoted param in \"%s\"",
+						next[0], source)
 
-				return
+					return
+				}
 			}
 
 			inQuotes = !inQuotes
@@ -960,13 +1366,21 @@ parseLoop:
 			buffer.Reset()
 			parsingKey = false
 
+		case '\\':
+			if inQuotes && consumed != len(source)-1 {
+				// The quoted-pair is kept as is.
+				buffer.WriteByte(source[consumed])
+				consumed++
+			}
+			buffer.WriteByte(source[consumed])
+
 		default:
 			if !inQuotes && strings.Contains(abnfWs, string(source[consumed])) {
 				// Skip unquoted whitespace.
 				continue
 			}
 
-			buffer.WriteString(string(source[consumed]))
+			buffer.WriteByte(source[consumed])
 		}
 	}
 
@@ -974,8 +1388,11 @@ parseLoop:
 	// contents of the buffer.
 	if inQuotes {
 		err = fmt.Errorf("unclosed quotes in parameter string: %s", source)
+	} else if parsingKey && buffer.Len() == 0 {
+		// Trailing separator, e.g. "<sip:bob@b.com>;", is sent by some UAs and is tolerated.
+		return
 	} else if parsingKey && permitSingletons {
-		if k, er := sip.Unescape(buffer.String(), sip.EncodeQueryComponent); er == nil {
+		if k, er := unescapeParam(buffer.String(), strictEscapes); er == nil {
 			params.Add(k, nil)
 		} else {
 			err = fmt.Errorf("unescape params: %w", er)
@@ -985,8 +1402,8 @@ parseLoop:
 		err = fmt.Errorf("singleton param '%s' when parsing params which disallow singletons: \"%s\"",
 			buffer.String(), source)
 	} else {
-		if k, er := sip.Unescape(key, sip.EncodeQueryComponent); er == nil {
-			if v, er := sip.Unescape(buffer.String(), sip.EncodeQueryComponent); er == nil {
+		if k, er := unescapeParam(key, strictEscapes); er == nil {
+			if v, er := unescapeParam(buffer.String(), strictEscapes); er == nil {
 				params.Add(k, sip.String{Str: v})
 			} else {
 				err = fmt.Errorf("unescape params: %w", er)
@@ -1277,7 +1694,7 @@ func parseViaHeader(headerName string, headerText string) (
 		var port *sip.Port
 		if paramsIdx == -1 {
 			// There are no header parameters, so the rest of the Via body is part of the host[:post].
-			host, port, err = ParseHostPort(viaBody)
+			host, port, err = ParseHostPort(strings.TrimSpace(viaBody))
 			hop.Host = host
 			hop.Port = port
 			if err != nil {
@@ -1285,15 +1702,18 @@ func parseViaHeader(headerName string, headerText string) (
 			}
 			hop.Params = sip.NewParams()
 		} else {
-			host, port, err = ParseHostPort(viaBody[:paramsIdx])
+			host, port, err = ParseHostPort(strings.TrimSpace(viaBody[:paramsIdx]))
 			if err != nil {
 				return
 			}
 			hop.Host = host
 			hop.Port = port
 
-			hop.Params, _, err = ParseParams(viaBody[paramsIdx:],
-				';', ';', 0, true, true)
+			hop.Params, _, err = parseParams(viaBody[paramsIdx:],
+				';', ';', 0, true, true, false)
+			if err != nil {
+				return
+			}
 		}
 		via = append(via, &hop)
 	}
@@ -1417,8 +1837,12 @@ func ParseAddressValues(addresses string) (
 	// on commas, so use a comma to signify the end of the final address section.
 	addresses = addresses + ","
 
-	for idx, char := range addresses {
-		if char == '<' && !inQuotes {
+	for idx := 0; idx < len(addresses); idx++ {
+		char := addresses[idx]
+		if char == '\\' && inQuotes {
+			// Skip quoted-pair, e.g. \" in the display name.
+			idx++
+		} else if char == '<' && !inQuotes {
 			inBrackets = true
 		} else if char == '>' && !inQuotes {
 			inBrackets = false
@@ -1440,6 +1864,12 @@ func ParseAddressValues(addresses string) (
 		}
 	}
 
+	if inQuotes {
+		err = fmt.Errorf("unclosed quotes in address list: %s", addresses[:len(addresses)-1])
+	} else if inBrackets {
+		err = fmt.Errorf("'<' without closing '>' in address list: %s", addresses[:len(addresses)-1])
+	}
+
 	return
 }
 
@@ -1468,6 +1898,10 @@ func ParseAddressValue(addressText string) (
 
 	addressTextCopy := addressText
 	addressText = strings.TrimSpace(addressText)
+	if len(addressText) == 0 {
+		err = fmt.Errorf("address-type header has empty body")
+		return
+	}
 
 	firstAngleBracket := findUnescaped(addressText, '<', quotesDelim)
 	displayName = nil
@@ -1478,8 +1912,8 @@ func ParseAddressValue(addressText string) (
 		if addressText[0] == '"' {
 			// The display name is within quotations.
 			// So it is comprised of all text until the closing quote.
-			addressText = addressText[1:]
-			nextQuote := strings.Index(addressText, "\"")
+			// Quoted-pairs are kept escaped, so the name can be written back as is.
+			nextQuote := findQuoteEnd(addressText)
 
 			if nextQuote == -1 {
 				// Unclosed quotes - parse error.
@@ -1488,7 +1922,7 @@ func ParseAddressValue(addressText string) (
 				return
 			}
 
-			nameField := addressText[:nextQuote]
+			nameField := addressText[1:nextQuote]
 			displayName = sip.String{Str: nameField}
 			addressText = addressText[nextQuote+1:]
 		} else {
@@ -1506,7 +1940,11 @@ func ParseAddressValue(addressText string) (
 
 	// Work out where the SIP URI starts and ends.
 	addressText = strings.TrimSpace(addressText)
-	var endOfUri int
+	if len(addressText) == 0 {
+		err = fmt.Errorf("no URI in address line: %s", addressTextCopy)
+		return
+	}
+	var uriText string
 	var startOfParams int
 	if addressText[0] != '<' {
 		if displayName != nil {
@@ -1521,37 +1959,49 @@ func ParseAddressValue(addressText string) (
 			return
 		}
 
-		endOfUri = strings.Index(addressText, ";")
+		endOfUri := strings.Index(addressText, ";")
 		if endOfUri == -1 {
 			endOfUri = len(addressText)
 		}
+		uriText = strings.TrimRight(addressText[:endOfUri], abnfWs)
 		startOfParams = endOfUri
 
+		// RFC 3261 20: URI containing a comma, question mark or semicolon
+		// must be enclosed in angle brackets.
+		if strings.Contains(uriText, "?") {
+			err = fmt.Errorf("URI with headers must be enclosed in '<>' in address %s",
+				addressTextCopy)
+			return
+		}
+
 	} else {
 		addressText = addressText[1:]
-		endOfUri = strings.Index(addressText, ">")
-		if endOfUri == 0 {
+		endOfUri := strings.Index(addressText, ">")
+		if endOfUri == -1 {
 			err = fmt.Errorf("'<' without closing '>' in address %s",
 				addressTextCopy)
 			return
+		} else if endOfUri == 0 {
+			err = fmt.Errorf("empty URI in address %s", addressTextCopy)
+			return
 		}
+		uriText = addressText[:endOfUri]
 		startOfParams = endOfUri + 1
 
 	}
 
 	// Now parse the SIP URI.
-	uri, err = ParseUri(addressText[:endOfUri])
+	uri, err = ParseUri(uriText)
 	if err != nil {
 		return
 	}
 
-	if startOfParams >= len(addressText) {
+	// Finally, parse any header parameters and then return.
+	addressText = strings.TrimLeft(addressText[startOfParams:], abnfWs)
+	if len(addressText) == 0 {
 		return
 	}
-
-	// Finally, parse any header parameters and then return.
-	addressText = addressText[startOfParams:]
-	headerParams, _, err = ParseParams(addressText, ';', ';', ',', true, true)
+	headerParams, _, err = parseParams(addressText, ';', ';', ',', true, true, false)
 	return
 }
 
@@ -1577,6 +2027,488 @@ func parseRecordRouteHeader(headerName string, headerText string) (headers []sip
 	return []sip.Header{&routeHeader}, nil
 }
 
+func parseReferTo(headerName string, headerText string) (headers []sip.Header, err error) {
+	displayName, uri, params, err := ParseAddressValue(headerText)
+	if err != nil {
+		return nil, err
+	}
+	if uri.IsWildcard() {
+		return nil, fmt.Errorf("wildcard uri not permitted in refer-to: header: %s", headerText)
+	}
+
+	return []sip.Header{&sip.ReferToHeader{
+		DisplayName: displayName,
+		Address:     uri,
+		Params:      params,
+	}}, nil
+}
+
+func parseReferredBy(headerName string, headerText string) (headers []sip.Header, err error) {
+	displayName, uri, params, err := ParseAddressValue(headerText)
+	if err != nil {
+		return nil, err
+	}
+	if uri.IsWildcard() {
+		return nil, fmt.Errorf("wildcard uri not permitted in referred-by: header: %s", headerText)
+	}
+
+	return []sip.Header{&sip.ReferredByHeader{
+		DisplayName: displayName,
+		Address:     uri,
+		Params:      params,
+	}}, nil
+}
+
+func parsePAssertedIdentity(headerName string, headerText string) (headers []sip.Header, err error) {
+	displayNames, uris, paramSets, err := ParseAddressValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, uri := range uris {
+		if uri.IsWildcard() {
+			return nil, fmt.Errorf("wildcard uri not permitted in p-asserted-identity: header: %s", headerText)
+		}
+		headers = append(headers, &sip.PAssertedIdentityHeader{
+			DisplayName: displayNames[idx],
+			Address:     uri,
+			Params:      paramSets[idx],
+		})
+	}
+
+	return headers, nil
+}
+
+func parsePPreferredIdentity(headerName string, headerText string) (headers []sip.Header, err error) {
+	displayNames, uris, paramSets, err := ParseAddressValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, uri := range uris {
+		if uri.IsWildcard() {
+			return nil, fmt.Errorf("wildcard uri not permitted in p-preferred-identity: header: %s", headerText)
+		}
+		headers = append(headers, &sip.PPreferredIdentityHeader{
+			DisplayName: displayNames[idx],
+			Address:     uri,
+			Params:      paramSets[idx],
+		})
+	}
+
+	return headers, nil
+}
+
+func parsePrivacy(headerName string, headerText string) (headers []sip.Header, err error) {
+	var privacy sip.PrivacyHeader
+	privacy.Values = make([]string, 0)
+	for _, value := range strings.Split(headerText, ";") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("empty value in privacy: header: %s", headerText)
+		}
+		privacy.Values = append(privacy.Values, value)
+	}
+	headers = []sip.Header{&privacy}
+
+	return
+}
+
+func parseReplaces(headerName string, headerText string) (headers []sip.Header, err error) {
+	replaces, err := ParseReplaces(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	return []sip.Header{replaces}, nil
+}
+
+// ParseReplaces parses value of the Replaces header,
+// it is also used for Replaces embedded into the Refer-To URI.
+func ParseReplaces(headerText string) (*sip.ReplacesHeader, error) {
+	headerText = strings.TrimSpace(headerText)
+	i := strings.Index(headerText, ";")
+	if i == -1 {
+		return nil, fmt.Errorf("missing tags in replaces: header: %s", headerText)
+	}
+
+	replaces := &sip.ReplacesHeader{
+		CallID: strings.TrimSpace(headerText[:i]),
+	}
+	if replaces.CallID == "" {
+		return nil, fmt.Errorf("empty call-id in replaces: header: %s", headerText)
+	}
+
+	params, _, err := parseParams(headerText[i:], ';', ';', 0, true, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("parse replaces: header params: %w", err)
+	}
+	for _, key := range params.Keys() {
+		val, _ := params.Get(key)
+		switch strings.ToLower(key) {
+		case "to-tag":
+			if val != nil {
+				replaces.ToTag = val.String()
+			}
+		case "from-tag":
+			if val != nil {
+				replaces.FromTag = val.String()
+			}
+		case "early-only":
+			replaces.EarlyOnly = true
+		default:
+			if replaces.Params == nil {
+				replaces.Params = sip.NewParams()
+			}
+			replaces.Params.Add(key, val)
+		}
+	}
+	if replaces.ToTag == "" || replaces.FromTag == "" {
+		return nil, fmt.Errorf("missing tags in replaces: header: %s", headerText)
+	}
+
+	return replaces, nil
+}
+
+func parseReferSub(headerName string, headerText string) (headers []sip.Header, err error) {
+	value, params, err := parseTokenWithParams(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	var referSub sip.ReferSubHeader
+	switch strings.ToLower(value) {
+	case "true":
+		referSub.Enabled = true
+	case "false":
+		referSub.Enabled = false
+	default:
+		return nil, fmt.Errorf("invalid refer-sub: header value: %s", headerText)
+	}
+	referSub.Params = params
+
+	return []sip.Header{&referSub}, nil
+}
+
+func parseEvent(headerName string, headerText string) (headers []sip.Header, err error) {
+	value, params, err := parseTokenWithParams(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	return []sip.Header{&sip.EventHeader{
+		EventType: value,
+		Params:    params,
+	}}, nil
+}
+
+func parseSubscriptionState(headerName string, headerText string) (headers []sip.Header, err error) {
+	value, params, err := parseTokenWithParams(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	return []sip.Header{&sip.SubscriptionStateHeader{
+		State:  value,
+		Params: params,
+	}}, nil
+}
+
+func parseReason(headerName string, headerText string) (headers []sip.Header, err error) {
+	for _, value := range splitQuoted(headerText, ',') {
+		reason, err := ParseReason(value)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, reason)
+	}
+
+	return headers, nil
+}
+
+// ParseReason parses single value of the Reason header,
+// it is also used for Reason embedded into the History-Info URI.
+func ParseReason(headerText string) (*sip.ReasonHeader, error) {
+	protocol, params, err := parseTokenWithParams(headerText)
+	if err != nil {
+		return nil, fmt.Errorf("parse reason: header: %w", err)
+	}
+
+	reason := &sip.ReasonHeader{Protocol: protocol}
+	if cause, ok := params.Get("cause"); ok {
+		if cause == nil {
+			return nil, fmt.Errorf("empty cause in reason: header: %s", headerText)
+		}
+		value, err := strconv.ParseUint(cause.String(), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cause in reason: header: %s", headerText)
+		}
+		reason.Cause = uint16(value)
+		params.Remove("cause")
+	}
+	if text, ok := params.Get("text"); ok {
+		if text != nil {
+			reason.Text = text.String()
+		}
+		params.Remove("text")
+	}
+	if params.Length() > 0 {
+		reason.Params = params
+	}
+
+	return reason, nil
+}
+
+func parseHistoryInfo(headerName string, headerText string) (headers []sip.Header, err error) {
+	displayNames, uris, paramSets, err := ParseAddressValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, uri := range uris {
+		if uri.IsWildcard() {
+			return nil, fmt.Errorf("wildcard uri not permitted in history-info: header: %s", headerText)
+		}
+
+		hi := &sip.HistoryInfoHeader{
+			DisplayName: displayNames[idx],
+			Address:     uri,
+			Params:      paramSets[idx],
+		}
+		if uriHeaders := uri.Headers(); uriHeaders != nil {
+			if val, ok := uriHeaders.Get("Reason"); ok && val != nil {
+				hi.Reason, err = ParseReason(val.String())
+				if err != nil {
+					return nil, fmt.Errorf("invalid reason in history-info: header: %w", err)
+				}
+				uriHeaders.Remove("Reason")
+			}
+		}
+		headers = append(headers, hi)
+	}
+
+	return headers, nil
+}
+
+func parseDiversion(headerName string, headerText string) (headers []sip.Header, err error) {
+	displayNames, uris, paramSets, err := ParseAddressValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, uri := range uris {
+		if uri.IsWildcard() {
+			return nil, fmt.Errorf("wildcard uri not permitted in diversion: header: %s", headerText)
+		}
+		headers = append(headers, &sip.DiversionHeader{
+			DisplayName: displayNames[idx],
+			Address:     uri,
+			Params:      paramSets[idx],
+		})
+	}
+
+	return headers, nil
+}
+
+func parseWWWAuthenticate(headerName string, headerText string) (headers []sip.Header, err error) {
+	schemes, paramSets, err := ParseAuthValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+	for idx, scheme := range schemes {
+		headers = append(headers, &sip.WWWAuthenticateHeader{Scheme: scheme, Params: paramSets[idx]})
+	}
+
+	return headers, nil
+}
+
+func parseProxyAuthenticate(headerName string, headerText string) (headers []sip.Header, err error) {
+	schemes, paramSets, err := ParseAuthValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+	for idx, scheme := range schemes {
+		headers = append(headers, &sip.ProxyAuthenticateHeader{Scheme: scheme, Params: paramSets[idx]})
+	}
+
+	return headers, nil
+}
+
+func parseAuthorization(headerName string, headerText string) (headers []sip.Header, err error) {
+	schemes, paramSets, err := ParseAuthValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+	for idx, scheme := range schemes {
+		headers = append(headers, &sip.AuthorizationHeader{Scheme: scheme, Params: paramSets[idx]})
+	}
+
+	return headers, nil
+}
+
+func parseProxyAuthorization(headerName string, headerText string) (headers []sip.Header, err error) {
+	schemes, paramSets, err := ParseAuthValues(headerText)
+	if err != nil {
+		return nil, err
+	}
+	for idx, scheme := range schemes {
+		headers = append(headers, &sip.ProxyAuthorizationHeader{Scheme: scheme, Params: paramSets[idx]})
+	}
+
+	return headers, nil
+}
+
+// ParseAuthValues parses value of the authentication header 'scheme param=value, ...'.
+// Several challenges may be combined into one header separated by commas,
+// the next one starts with a token that is not followed by '='.
+// Values may be tokens or quoted strings, commas in quoted strings are preserved.
+func ParseAuthValues(headerText string) (schemes []string, paramSets []sip.AuthParams, err error) {
+	text := headerText
+	idx := 0
+
+	skipWs := func() {
+		for idx < len(text) && strings.IndexByte(abnfWs, text[idx]) != -1 {
+			idx++
+		}
+	}
+	readToken := func() string {
+		start := idx
+		for idx < len(text) && isAuthTokenChar(text[idx]) {
+			idx++
+		}
+		return text[start:idx]
+	}
+	// checks that the next item after comma is a param, not a new challenge
+	nextIsParam := func() bool {
+		start := idx
+		defer func() { idx = start }()
+
+		if readToken() == "" {
+			return false
+		}
+		skipWs()
+		return idx < len(text) && text[idx] == '='
+	}
+
+	skipWs()
+	for idx < len(text) {
+		scheme := readToken()
+		if scheme == "" {
+			return nil, nil, fmt.Errorf("expected auth scheme at position %d: %s", idx, headerText)
+		}
+		params := make(sip.AuthParams, 0)
+
+		skipWs()
+		for idx < len(text) {
+			if text[idx] == ',' {
+				// challenge without params
+				idx++
+				skipWs()
+				break
+			}
+
+			name := readToken()
+			skipWs()
+			if name == "" || idx >= len(text) || text[idx] != '=' {
+				return nil, nil, fmt.Errorf("expected auth param at position %d: %s", idx, headerText)
+			}
+			idx++
+			skipWs()
+
+			param := sip.AuthParam{Name: name}
+			if idx < len(text) && text[idx] == '"' {
+				param.Quoted = true
+				var buffer bytes.Buffer
+				idx++
+				for ; idx < len(text) && text[idx] != '"'; idx++ {
+					if text[idx] == '\\' && idx+1 < len(text) {
+						idx++
+					}
+					buffer.WriteByte(text[idx])
+				}
+				if idx >= len(text) {
+					return nil, nil, fmt.Errorf("unclosed quotes in auth param '%s': %s", name, headerText)
+				}
+				idx++
+				param.Value = buffer.String()
+			} else {
+				start := idx
+				for idx < len(text) && text[idx] != ',' && strings.IndexByte(abnfWs, text[idx]) == -1 {
+					idx++
+				}
+				param.Value = text[start:idx]
+				if param.Value == "" {
+					return nil, nil, fmt.Errorf("empty value of auth param '%s': %s", name, headerText)
+				}
+			}
+			params = append(params, param)
+
+			skipWs()
+			if idx >= len(text) {
+				break
+			}
+			if text[idx] != ',' {
+				return nil, nil, fmt.Errorf("expected ',' at position %d: %s", idx, headerText)
+			}
+			idx++
+			skipWs()
+			if !nextIsParam() {
+				break
+			}
+		}
+
+		schemes = append(schemes, scheme)
+		paramSets = append(paramSets, params)
+	}
+	if len(schemes) == 0 {
+		return nil, nil, fmt.Errorf("empty auth header value")
+	}
+
+	return schemes, paramSets, nil
+}
+
+func isAuthTokenChar(c uint8) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("-.!%*_+`'~", c) != -1
+}
+
+// Splits text by the separator outside of double quotes.
+func splitQuoted(text string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	prevIdx := 0
+	for idx, char := range text {
+		switch {
+		case char == '"':
+			inQuotes = !inQuotes
+		case char == sep && !inQuotes:
+			parts = append(parts, text[prevIdx:idx])
+			prevIdx = idx + 1
+		}
+	}
+
+	return append(parts, text[prevIdx:])
+}
+
+// Parses header values in the form 'token;param=value;...'.
+func parseTokenWithParams(headerText string) (value string, params sip.Params, err error) {
+	headerText = strings.TrimSpace(headerText)
+	value = headerText
+	params = sip.NewParams()
+	if i := strings.Index(headerText, ";"); i != -1 {
+		value = strings.TrimSpace(headerText[:i])
+		params, _, err = parseParams(headerText[i:], ';', ';', 0, true, true, false)
+		if err != nil {
+			return "", nil, fmt.Errorf("parse params: %w", err)
+		}
+	}
+	if value == "" || strings.ContainsAny(value, abnfWs) {
+		return "", nil, fmt.Errorf("invalid header value: %s", headerText)
+	}
+
+	return value, params, nil
+}
+
 // Extract the next logical header line from the message.
 // This may run over several actual lines; lines that start with whitespace are
 // a continuation of the previous line.
@@ -1608,6 +2540,32 @@ func GetNextHeaderLine(contents []string) (headerText string, consumed int) {
 	return
 }
 
+// Unescapes the parameter name or value, '%' that does not start an escape sequence
+// is kept as a literal character unless strict is true.
+func unescapeParam(s string, strict bool) (string, error) {
+	res, err := sip.Unescape(s, sip.EncodeQueryComponent)
+	if err != nil && !strict {
+		return s, nil
+	}
+	return res, err
+}
+
+// Find the index of the quote that closes the quoted-string starting at text[0].
+// Quoted-pairs (backslash followed by any char) are skipped.
+// Returns -1 if the quoted-string is not terminated.
+func findQuoteEnd(text string) int {
+	for idx := 1; idx < len(text); idx++ {
+		switch text[idx] {
+		case '\\':
+			idx++
+		case '"':
+			return idx
+		}
+	}
+
+	return -1
+}
+
 // A delimiter is any pair of characters used for quoting text (i.e. bulk escaping literals).
 type delimiter struct {
 	start uint8
@@ -1642,6 +2600,11 @@ func findAnyUnescaped(text string, targets string, delims ...delimiter) int {
 		}
 
 		if escaped {
+			if endEscape == '"' && text[idx] == '\\' {
+				// Skip quoted-pair.
+				idx++
+				continue
+			}
 			escaped = text[idx] != endEscape
 			continue
 		} else {
@@ -290,6 +290,71 @@ func TestSipUris(t *testing.T) {
 	}, t)
 }
 
+func TestTelUris(t *testing.T) {
+	doTests([]test{
+		{uriInput("tel:+1-201-555-0123"), &uriResult{pass, &sip.TelUri{FNumber: "+1-201-555-0123", FUriParams: noParams}}},
+		{uriInput("tel:+12015550123"), &uriResult{pass, &sip.TelUri{FNumber: "+1-201-555-0123", FUriParams: noParams}}},
+		{uriInput("TEL:+4930123456;phone-context=+49"), &uriResult{pass, &sip.TelUri{FNumber: "+4930123456",
+			FUriParams: sip.NewParams().Add("phone-context", sip.String{"+49"})}}},
+		{uriInput("tel:7042;phone-context=example.com"), &uriResult{pass, &sip.TelUri{FNumber: "7042",
+			FUriParams: sip.NewParams().Add("phone-context", sip.String{"EXAMPLE.com"})}}},
+		{uriInput("tel:+1-201-555-0123;ext=1234;isub=5678"), &uriResult{pass, &sip.TelUri{FNumber: "+12015550123",
+			FUriParams: sip.NewParams().Add("isub", sip.String{"5678"}).Add("ext", sip.String{"12-34"})}}},
+		{uriInput("tel:*21#;phone-context=+1"), &uriResult{pass, &sip.TelUri{FNumber: "*21#",
+			FUriParams: sip.NewParams().Add("phone-context", sip.String{"+1"})}}},
+		{uriInput("tel:7042"), &uriResult{fail, nil}},
+		{uriInput("tel:+1-201-ABC"), &uriResult{fail, nil}},
+		{uriInput("tel:+"), &uriResult{fail, nil}},
+		{uriInput("tel:"), &uriResult{fail, nil}},
+	}, t)
+}
+
+func TestUriComparison(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"tel:+1-201-555-0123", "tel:+1(201)555.0123", true},
+		{"tel:7042;phone-context=example.com", "tel:7042;PHONE-CONTEXT=Example.COM", true},
+		{"tel:+1-201-555-0123;ext=1;isub=2", "tel:+12015550123;isub=2;ext=1", true},
+		{"tel:+1-201-555-0123", "tel:+1-201-555-0124", false},
+		{"tel:+1-201-555-0123", "tel:+1-201-555-0123;ext=1", false},
+		{"tel:7042;phone-context=+1", "tel:+17042", false},
+		{"tel:7042;phone-context=example.com", "tel:7042;phone-context=example.org", false},
+		{"urn:service:sos", "URN:SERVICE:SOS", true},
+		{"urn:ietf:params:foo", "urn:IETF:params:foo", true},
+		{"urn:ietf:params:foo", "urn:ietf:params:Foo", false},
+		{"mailto:bob@example.com", "MAILTO:bob@example.com", true},
+		{"mailto:bob@example.com", "sip:bob@example.com", false},
+	}
+
+	for _, test := range tests {
+		a, err := parser.ParseUri(test.a)
+		if err != nil {
+			t.Fatalf("parse %s: %s", test.a, err)
+		}
+		b, err := parser.ParseUri(test.b)
+		if err != nil {
+			t.Fatalf("parse %s: %s", test.b, err)
+		}
+		if a.Equals(b) != test.equal || b.Equals(a) != test.equal {
+			t.Errorf("expected comparison of %s and %s to be %v", test.a, test.b, test.equal)
+		}
+	}
+}
+
+func TestAbsoluteUris(t *testing.T) {
+	doTests([]test{
+		{uriInput("urn:service:sos"), &uriResult{pass, &sip.AbsoluteUri{FScheme: "urn", FOpaque: "service:sos"}}},
+		{uriInput("URN:Service:SOS.fire"), &uriResult{pass, &sip.AbsoluteUri{FScheme: "urn", FOpaque: "service:sos.fire"}}},
+		{uriInput("mailto:bob@example.com"), &uriResult{pass, &sip.AbsoluteUri{FScheme: "mailto", FOpaque: "bob@example.com"}}},
+		{uriInput("http://example.com/alice?x=1"), &uriResult{pass, &sip.AbsoluteUri{FScheme: "http", FOpaque: "//example.com/alice?x=1"}}},
+		{uriInput("1http://example.com"), &uriResult{fail, nil}},
+		{uriInput("mailto:"), &uriResult{fail, nil}},
+		{uriInput("mailto:bob @example.com"), &uriResult{fail, nil}},
+	}, t)
+}
+
 func TestHostPort(t *testing.T) {
 	doTests([]test{
 		{hostPortInput("example.com"), &hostPortResult{pass, "example.com", nil}},
@@ -333,6 +398,16 @@ func TestToHeaders(t *testing.T) {
 				Address: &sip.SipUri{false, sip.String{"alice"}, nil, "wonderland.com", nil, noParams, noParams},
 				Params:  noParams}}},
 
+		{toHeaderInput("To: <tel:+4930123456;phone-context=+49>;tag=1"), &toHeaderResult{pass,
+			&sip.ToHeader{DisplayName: nil,
+				Address: &sip.TelUri{FNumber: "+4930123456", FUriParams: sip.NewParams().Add("phone-context", sip.String{"+49"})},
+				Params:  sip.NewParams().Add("tag", sip.String{"1"})}}},
+
+		{toHeaderInput("To: \"Emergency\" <urn:service:sos>"), &toHeaderResult{pass,
+			&sip.ToHeader{DisplayName: sip.String{"Emergency"},
+				Address: &sip.AbsoluteUri{FScheme: "urn", FOpaque: "service:sos"},
+				Params:  noParams}}},
+
 		{toHeaderInput("To : \"Alice Liddell\" <sip:alice@wonderland.com>"), &toHeaderResult{pass,
 			&sip.ToHeader{DisplayName: sip.String{"Alice Liddell"},
 				Address: &sip.SipUri{false, sip.String{"alice"}, nil, "wonderland.com", nil, noParams, noParams},
@@ -1098,6 +1173,234 @@ func TestSupported(t *testing.T) {
 	}, t)
 }
 
+func TestReferHeaders(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected sip.Header
+	}{
+		{
+			"Refer-To: <sip:carol@example.com?Replaces=abc%40host%3Bto-tag%3D1%3Bfrom-tag%3D2>",
+			&sip.ReferToHeader{Address: &sip.SipUri{
+				FUser:    sip.String{Str: "carol"},
+				FHost:    "example.com",
+				FHeaders: sip.NewParams().Add("Replaces", sip.String{Str: "abc@host;to-tag=1;from-tag=2"}),
+			}},
+		},
+		{
+			"r: sip:carol@example.com",
+			&sip.ReferToHeader{Address: &sip.SipUri{FUser: sip.String{Str: "carol"}, FHost: "example.com"}},
+		},
+		{
+			"Referred-By: \"Alice\" <sip:alice@example.com>;cid=\"20398823.2UWQFN309shb3@example.com\"",
+			&sip.ReferredByHeader{
+				DisplayName: sip.String{Str: "Alice"},
+				Address:     &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "example.com"},
+				Params:      sip.NewParams().Add("cid", sip.String{Str: "20398823.2UWQFN309shb3@example.com"}),
+			},
+		},
+		{
+			"Replaces: 98732@sip.example.com;from-tag=r33th4x0r;to-tag=ff87ff;early-only",
+			&sip.ReplacesHeader{CallID: "98732@sip.example.com", ToTag: "ff87ff", FromTag: "r33th4x0r", EarlyOnly: true},
+		},
+		{"Refer-Sub: false", &sip.ReferSubHeader{Enabled: false}},
+		{"Event: refer;id=93809824", &sip.EventHeader{EventType: "refer", Params: sip.NewParams().Add("id", sip.String{Str: "93809824"})}},
+		{"o: presence", &sip.EventHeader{EventType: "presence"}},
+		{
+			"Subscription-State: terminated;reason=noresource",
+			&sip.SubscriptionStateHeader{State: "terminated", Params: sip.NewParams().Add("reason", sip.String{Str: "noresource"})},
+		},
+	}
+
+	for _, c := range cases {
+		headers, err := parseHeader(c.input)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", c.input, err)
+			continue
+		}
+		if len(headers) != 1 || !c.expected.Equals(headers[0]) {
+			t.Errorf("unexpected result of %q: expected %s, got %v", c.input, c.expected, headers)
+		}
+	}
+
+	for _, input := range []string{
+		"Refer-To: *",
+		"Replaces: 98732@sip.example.com;from-tag=r33th4x0r",
+		"Refer-Sub: maybe",
+		"Event: ;id=1",
+	} {
+		if _, err := parseHeader(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	headers, err := parseHeader("P-Asserted-Identity: \"Cullen Jennings\" <sip:fluffy@cisco.com>, tel:+14085264000")
+	if err != nil {
+		t.Fatalf("failed to parse P-Asserted-Identity: %s", err)
+	}
+	expected := []sip.Header{
+		&sip.PAssertedIdentityHeader{
+			DisplayName: sip.String{Str: "Cullen Jennings"},
+			Address:     &sip.SipUri{FUser: sip.String{Str: "fluffy"}, FHost: "cisco.com"},
+		},
+		&sip.PAssertedIdentityHeader{Address: &sip.TelUri{FNumber: "+14085264000"}},
+	}
+	if len(headers) != len(expected) {
+		t.Fatalf("expected %d headers, got %v", len(expected), headers)
+	}
+	for i := range expected {
+		if expected[i].String() != headers[i].String() {
+			t.Errorf("unexpected header: expected %q, got %q", expected[i], headers[i])
+		}
+	}
+
+	headers, err = parseHeader("P-Preferred-Identity: <sip:alice@example.com>")
+	if err != nil || len(headers) != 1 {
+		t.Fatalf("failed to parse P-Preferred-Identity: %v, %v", headers, err)
+	}
+	if ppi, ok := headers[0].(*sip.PPreferredIdentityHeader); !ok || ppi.Address.String() != "sip:alice@example.com" {
+		t.Errorf("unexpected P-Preferred-Identity %v", headers[0])
+	}
+
+	headers, err = parseHeader("Privacy: id; header")
+	if err != nil || len(headers) != 1 {
+		t.Fatalf("failed to parse Privacy: %v, %v", headers, err)
+	}
+	privacy := headers[0].(*sip.PrivacyHeader)
+	if !privacy.Has(sip.PrivID) || !privacy.Has(sip.PrivHeader) || privacy.Has(sip.PrivUser) {
+		t.Errorf("unexpected Privacy %v", privacy)
+	}
+	if privacy.String() != "Privacy: id;header" {
+		t.Errorf("unexpected Privacy string %q", privacy)
+	}
+
+	if _, err := parseHeader("Privacy: id;;user"); err == nil {
+		t.Errorf("expected error for empty privacy value")
+	}
+}
+
+func TestHistoryHeaders(t *testing.T) {
+	headers, err := parseHeader("History-Info: <sip:bob@example.com?Reason=SIP%3Bcause%3D302%3Btext%3D%22Moved%20Temporarily%22>;index=1," +
+		" <sip:bob@192.0.2.5>;index=1.1;rc=1")
+	if err != nil {
+		t.Fatalf("failed to parse History-Info: %s", err)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 headers, got %v", headers)
+	}
+	hi := headers[0].(*sip.HistoryInfoHeader)
+	if hi.Index() != "1" || hi.Reason == nil || hi.Reason.Cause != 302 || hi.Reason.Text != "Moved Temporarily" {
+		t.Errorf("unexpected History-Info %v", hi)
+	}
+	if hi.Address.String() != "sip:bob@example.com" {
+		t.Errorf("Reason must be removed from the URI, got %s", hi.Address)
+	}
+	if mechanism, index := headers[1].(*sip.HistoryInfoHeader).Target(); mechanism != sip.HistoryRC || index != "1" {
+		t.Errorf("unexpected History-Info target %s=%s", mechanism, index)
+	}
+
+	// embedded Reason survives serialization
+	again, err := parseHeader(hi.String())
+	if err != nil || len(again) != 1 || !hi.Equals(again[0]) {
+		t.Errorf("History-Info round trip failed: %s -> %v, %v", hi, again, err)
+	}
+
+	headers, err = parseHeader("Reason: SIP ;cause=200 ;text=\"Call completed elsewhere\", Q.850;cause=16")
+	if err != nil || len(headers) != 2 {
+		t.Fatalf("failed to parse Reason: %v, %v", headers, err)
+	}
+	if headers[0].Value() != "SIP;cause=200;text=\"Call completed elsewhere\"" || headers[1].Value() != "Q.850;cause=16" {
+		t.Errorf("unexpected Reason %v", headers)
+	}
+
+	headers, err = parseHeader("Diversion: <sip:alice@example.com>;reason=user-busy;counter=2;privacy=off")
+	if err != nil || len(headers) != 1 {
+		t.Fatalf("failed to parse Diversion: %v, %v", headers, err)
+	}
+	diversion := headers[0].(*sip.DiversionHeader)
+	if diversion.Reason() != sip.DiversionUserBusy || diversion.Counter() != 2 {
+		t.Errorf("unexpected Diversion %v", diversion)
+	}
+
+	for _, input := range []string{
+		"Reason: SIP;cause=abc",
+		"History-Info: <sip:bob@example.com?Reason=SIP%3Bcause%3Dx>;index=1",
+	} {
+		if _, err := parseHeader(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestAuthHeaders(t *testing.T) {
+	input := `WWW-Authenticate: Digest realm="atlanta.com, inc", domain="sip:ss1.carrier.com", qop="auth,auth-int",` +
+		` nonce="f84f1cec41e6cbe5aea9c8e88d359", opaque="", stale=TRUE, algorithm=MD5,` +
+		` Digest realm="biloxi.com",nonce="a\"b",algorithm=MD5`
+	headers, err := parseHeader(input)
+	if err != nil {
+		t.Fatalf("failed to parse WWW-Authenticate: %s", err)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 challenges, got %v", headers)
+	}
+
+	first := headers[0].(*sip.WWWAuthenticateHeader)
+	if first.Scheme != "Digest" || len(first.Params) != 7 {
+		t.Fatalf("unexpected first challenge %v", first)
+	}
+	if realm, _ := first.Params.Get("realm"); realm != "atlanta.com, inc" {
+		t.Errorf("unexpected realm %q", realm)
+	}
+	if qop, _ := first.Params.Get("qop"); qop != "auth,auth-int" {
+		t.Errorf("unexpected qop %q", qop)
+	}
+	if stale, _ := first.Params.Get("stale"); stale != "TRUE" || first.Params[5].Quoted {
+		t.Errorf("unexpected stale %q", stale)
+	}
+	expected := `Digest realm="atlanta.com, inc", domain="sip:ss1.carrier.com", qop="auth,auth-int",` +
+		` nonce="f84f1cec41e6cbe5aea9c8e88d359", opaque="", stale=TRUE, algorithm=MD5`
+	if first.Value() != expected {
+		t.Errorf("unexpected value:\n%s\nexpected:\n%s", first.Value(), expected)
+	}
+
+	second := headers[1].(*sip.WWWAuthenticateHeader)
+	if nonce, _ := second.Params.Get("nonce"); nonce != `a"b` {
+		t.Errorf("unexpected nonce %q", nonce)
+	}
+	if second.Value() != `Digest realm="biloxi.com", nonce="a\"b", algorithm=MD5` {
+		t.Errorf("unexpected value %s", second.Value())
+	}
+
+	// round trip
+	for _, hdr := range headers {
+		again, err := parseHeader(hdr.String())
+		if err != nil || len(again) != 1 || again[0].String() != hdr.String() {
+			t.Errorf("round trip of %s failed: %v, %v", hdr, again, err)
+		}
+	}
+
+	headers, err = parseHeader(`Proxy-Authorization: Digest username="bob", realm="biloxi.com", nonce="dcd98b",` +
+		` uri="sip:bob@biloxi.com", qop=auth, nc=00000001, cnonce="0a4f113b", response="6629fae4"`)
+	if err != nil || len(headers) != 1 {
+		t.Fatalf("failed to parse Proxy-Authorization: %v, %v", headers, err)
+	}
+	if nc, _ := headers[0].(*sip.ProxyAuthorizationHeader).Params.Get("nc"); nc != "00000001" {
+		t.Errorf("unexpected nc %q", nc)
+	}
+
+	for _, input := range []string{
+		"Authorization: ",
+		`Authorization: Digest realm="unclosed`,
+		"Authorization: Digest realm",
+		"Authorization: Digest realm=a b=c",
+	} {
+		if _, err := parseHeader(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
 // Basic test of unstreamed parsing, using empty INVITE.
 func TestUnstreamedParse1(t *testing.T) {
 	test := ParserTest{false, []parserTestStep{
@@ -1130,6 +1433,32 @@ func TestUnstreamedParse1(t *testing.T) {
 	test.Test(t)
 }
 
+// Test unstreamed parsing of a request with tel Request-URI.
+func TestUnstreamedParseTelUri(t *testing.T) {
+	test := ParserTest{false, []parserTestStep{
+		{
+			"INVITE tel:+4930123456;phone-context=+49 SIP/2.0\r\n" +
+				"\r\n",
+			sip.NewRequest(
+				"",
+				sip.INVITE,
+				&sip.TelUri{
+					FNumber:    "+4930123456",
+					FUriParams: sip.NewParams().Add("phone-context", sip.String{"+49"}),
+				},
+				"SIP/2.0",
+				make([]sip.Header, 0),
+				"",
+				nil,
+			),
+			nil,
+			nil,
+		},
+	}}
+
+	test.Test(t)
+}
+
 // Test unstreamed parsing with a header and body.
 func TestUnstreamedParse2(t *testing.T) {
 	body := "I am a banana"
@@ -1348,6 +1677,36 @@ func TestUnstreamedParse8(t *testing.T) {
 	test.Test(t)
 }
 
+// Trailing parameter separator is tolerated in mandatory headers.
+func TestUnstreamedParseTrailingSeparator(t *testing.T) {
+	msg, err := parser.ParseMessage([]byte("INVITE sip:bob@b.com SIP/2.0\r\n"+
+		"Via: SIP/2.0/UDP 1.2.3.4;branch=z9hG4bK.trailing\r\n"+
+		"From: <sip:alice@a.com>;tag=1\r\n"+
+		"To: <sip:bob@b.com>;\r\n"+
+		"Call-ID: trailing\r\n"+
+		"CSeq: 1 INVITE\r\n"+
+		"Contact: <sip:a@1.2.3.4;transport=udp;>\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n"), testutils.NewLogrusLogger())
+	if err != nil {
+		t.Fatalf("failed to parse message: %s", err)
+	}
+
+	to, _ := msg.To()
+	if to.Address.Host() != "b.com" || to.Params.Length() != 0 {
+		t.Errorf("unexpected To header %s", to)
+	}
+	contact, _ := msg.Contact()
+	if transport, ok := contact.Address.UriParams().Get("transport"); !ok || transport.String() != "udp" ||
+		contact.Address.UriParams().Length() != 1 {
+		t.Errorf("unexpected Contact header %s", contact)
+	}
+
+	if _, err := parseHeader("To: <sip:bob@b.com>;;tag=1"); err == nil {
+		t.Errorf("expected error for empty parameter name")
+	}
+}
+
 // TODO: Error cases for unstreamed parse.
 // TODO: Multiple writes on unstreamed parse.
 
@@ -1527,6 +1886,51 @@ func TestStreamedParse4(t *testing.T) {
 	test.Test(t)
 }
 
+func TestStreamedParseRawHandler(t *testing.T) {
+	first := "INVITE sip:bob@biloxi.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP 1.2.3.4;branch=z9hG4bK.raw;\r\n" +
+		"Subject: folded\r\n" +
+		" header\r\n" +
+		"Content-Length: 4\r\n" +
+		"\r\n" +
+		"body"
+	second := "BYE sip:bob@biloxi.com SIP/2.0\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	output := make(chan sip.Message)
+	errs := make(chan error)
+	p := parser.NewParser(output, errs, true, testutils.NewLogrusLogger())
+	defer p.Stop()
+
+	raws := make(chan string, 2)
+	p.SetRawHandler(func(msg sip.Message, data []byte) {
+		raws <- string(data)
+	})
+
+	// split data between writes to check that message bytes are collected across them
+	data := first + second
+	if _, err := p.Write([]byte(data[:10])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Write([]byte(data[10:])); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{first, second} {
+		select {
+		case <-output:
+		case err := <-errs:
+			t.Fatalf("unexpected error: %s", err)
+		case <-time.After(time.Second):
+			t.Fatal("message is not parsed")
+		}
+		if raw := <-raws; raw != expected {
+			t.Errorf("unexpected raw message:\n%q\nexpected:\n%q", raw, expected)
+		}
+	}
+}
+
 type paramInput struct {
 	paramString      string
 	start            uint8
@@ -1614,6 +2018,39 @@ func (expected *sipUriResult) equals(other result) (equal bool, reason string) {
 	return
 }
 
+type uriInput string
+
+func (data uriInput) String() string {
+	return string(data)
+}
+func (data uriInput) evaluate() result {
+	output, err := parser.ParseUri(string(data))
+	return &uriResult{err, output}
+}
+
+type uriResult struct {
+	err error
+	uri sip.Uri
+}
+
+func (expected *uriResult) equals(other result) (equal bool, reason string) {
+	actual := *(other.(*uriResult))
+	if expected.err == nil && actual.err != nil {
+		return false, fmt.Sprintf("unexpected error: %s", actual.err.Error())
+	} else if expected.err != nil && actual.err == nil {
+		return false, fmt.Sprintf("unexpected success: got \"%s\"", actual.uri.String())
+	} else if actual.err != nil {
+		// Expected error. Test passes immediately.
+		return true, ""
+	}
+
+	equal = expected.uri.Equals(actual.uri)
+	if !equal {
+		reason = fmt.Sprintf("expected result %s, but got %s", expected.uri.String(), actual.uri.String())
+	}
+	return
+}
+
 type hostPortInput string
 
 func (data hostPortInput) String() string {
@@ -1747,9 +2184,8 @@ func (expected *toHeaderResult) equals(other result) (equal bool, reason string)
 	}
 
 	switch expected.header.Address.(type) {
-	case *sip.SipUri:
-		uri := *(expected.header.Address.(*sip.SipUri))
-		urisEqual := uri.Equals(actual.header.Address)
+	case *sip.SipUri, *sip.TelUri, *sip.AbsoluteUri:
+		urisEqual := expected.header.Address.Equals(actual.header.Address)
 		msg := ""
 		if !urisEqual {
 			msg = fmt.Sprintf("unexpected result: expected %s, got %s",
@@ -1815,9 +2251,8 @@ func (expected *fromHeaderResult) equals(other result) (equal bool, reason strin
 	}
 
 	switch expected.header.Address.(type) {
-	case *sip.SipUri:
-		uri := *(expected.header.Address.(*sip.SipUri))
-		urisEqual := uri.Equals(actual.header.Address)
+	case *sip.SipUri, *sip.TelUri, *sip.AbsoluteUri:
+		urisEqual := expected.header.Address.Equals(actual.header.Address)
 		msg := ""
 		if !urisEqual {
 			msg = fmt.Sprintf("unexpected result: expected %s, got %s",
@@ -2337,6 +2772,18 @@ type parserTestStep struct {
 	returnedError error
 }
 
+// Serializes the message without the raw header lines, so the parsed headers are compared.
+func canonicalString(msg sip.Message) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(msg.StartLine() + "\r\n")
+	for _, header := range msg.Headers() {
+		buffer.WriteString(header.String() + "\r\n")
+	}
+	buffer.WriteString("\r\n")
+	buffer.Write(msg.BodyBytes())
+	return buffer.String()
+}
+
 func (step *parserTestStep) Test(parser parser.Parser, msgChan chan sip.Message, errChan chan error) (success bool, reason string) {
 	_, err := parser.Write([]byte(step.input))
 	if err != step.returnedError {
@@ -2358,7 +2805,7 @@ func (step *parserTestStep) Test(parser parser.Parser, msgChan chan sip.Message,
 			} else if msg != nil && step.result == nil {
 				success = false
 				reason = fmt.Sprintf("expected no message to be returned; got\n%s", msg.String())
-			} else if msg.String() != step.result.String() {
+			} else if canonicalString(msg) != step.result.String() {
 				success = false
 				reason = fmt.Sprintf("unexpected message returned by parser; expected:\n\n%s\n\nbut got:\n\n%s", step.result.String(), msg.String())
 			} else {
@@ -4,6 +4,7 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -11,6 +12,8 @@ import (
 	"github.com/ghettovoice/gosip/log"
 )
 
+var errLineTooLong = errors.New("line too long")
+
 // parserBuffer is a specialized buffer for use in the parser.
 // It is written to via the non-blocking Write.
 // It exposes various blocking read methods, which wait until the requested
@@ -27,6 +30,11 @@ type parserBuffer struct {
 	// Don't access this directly except when closing.
 	pipeReader *io.PipeReader
 
+	// Number of bytes read since the message start, owned by the reading goroutine.
+	consumed int
+	// Bytes read since the message start, recorded if not nil, owned by the reading goroutine.
+	raw *bytes.Buffer
+
 	log log.Logger
 }
 
@@ -59,25 +67,44 @@ func (pb *parserBuffer) Write(p []byte) (n int, err error) {
 
 // Block until the buffer contains at least one CRLF-terminated line.
 // Return the line, excluding the terminal CRLF, and delete it from the buffer.
+// If maxLen > 0 and the line is longer than maxLen bytes, errLineTooLong is returned
+// as soon as it is detected, without waiting for the rest of the line.
 // Returns an error if the parserbuffer has been stopped.
-func (pb *parserBuffer) NextLine() (response string, err error) {
+func (pb *parserBuffer) NextLine(maxLen int) (response string, err error) {
 	var buffer bytes.Buffer
-	var data string
+	var data []byte
 	var b byte
 
 	// There has to be a better way!
 	for {
-		data, err = pb.reader.ReadString('\r')
+		data, err = pb.reader.ReadSlice('\r')
+		pb.advance(data...)
+
+		if maxLen > 0 {
+			lineLen := buffer.Len() + len(data)
+			if err == nil {
+				lineLen--
+			}
+			if lineLen > maxLen {
+				err = errLineTooLong
+				return
+			}
+		}
+
+		buffer.Write(data)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
 		if err != nil {
 			return
 		}
 
-		buffer.WriteString(data)
-
 		b, err = pb.reader.ReadByte()
 		if err != nil {
 			return
 		}
+		pb.advance(b)
 
 		buffer.WriteByte(b)
 		if b == '\n' {
@@ -91,27 +118,72 @@ func (pb *parserBuffer) NextLine() (response string, err error) {
 	}
 }
 
-// Block until the buffer contains at least n characters.
-// Return precisely those n characters, then delete them from the buffer.
-func (pb *parserBuffer) NextChunk(n int) (response string, err error) {
+// Block until the buffer contains at least n bytes.
+// Return precisely those n bytes, then delete them from the buffer.
+func (pb *parserBuffer) NextChunk(n int) (response []byte, err error) {
 	var data = make([]byte, n)
 
 	var read int
 	for total := 0; total < n; {
 		read, err = pb.reader.Read(data[total:])
+		pb.advance(data[total : total+read]...)
 		total += read
 		if err != nil {
 			return
 		}
 	}
 
-	response = string(data)
+	response = data
 
 	pb.Log().Tracef("return chunk:\n%s", response)
 
 	return
 }
 
+// StartMessage resets the number of consumed bytes, the message bytes are recorded if record is true.
+func (pb *parserBuffer) StartMessage(record bool) {
+	pb.consumed = 0
+	switch {
+	case !record:
+		pb.raw = nil
+	case pb.raw == nil:
+		pb.raw = new(bytes.Buffer)
+	default:
+		pb.raw.Reset()
+	}
+}
+
+// Raw returns a copy of the bytes read since the message start if they are recorded.
+func (pb *parserBuffer) Raw() []byte {
+	if pb.raw == nil {
+		return nil
+	}
+	return append([]byte(nil), pb.raw.Bytes()...)
+}
+
+func (pb *parserBuffer) advance(data ...byte) {
+	pb.consumed += len(data)
+	if pb.raw != nil {
+		pb.raw.Write(data)
+	}
+}
+
+// Discard skips the next n bytes.
+func (pb *parserBuffer) Discard(n int) error {
+	discarded, err := pb.reader.Discard(n)
+	pb.consumed += discarded
+	return err
+}
+
+// Drain discards all incoming data until the buffer is stopped.
+func (pb *parserBuffer) Drain() {
+	for {
+		if _, err := pb.reader.Discard(pb.reader.Size()); err != nil {
+			return
+		}
+	}
+}
+
 // Stop the parser buffer.
 func (pb *parserBuffer) Stop() {
 	pb.mu.RLock()
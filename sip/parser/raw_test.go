@@ -0,0 +1,81 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+)
+
+var rawTestMessage = strings.Join([]string{
+	"INVITE sip:bob@biloxi.com SIP/2.0",
+	"v: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds",
+	"ROUTE: <sip:proxy.atlanta.com;lr>",
+	"Via:   SIP/2.0/UDP  bigbox3.site3.atlanta.com;branch=z9hG4bK77ef4c2312983.1",
+	"To: Bob <sip:bob@biloxi.com>",
+	"f: Alice <sip:alice@atlanta.com>;tag=1928301774",
+	"X-Custom:  some   value",
+	"\twith folding",
+	"Call-ID: a84b4c76e66710@pc33.atlanta.com",
+	"CSeq: 314159 INVITE",
+	"Contact: <sip:alice@pc33.atlanta.com>, <sip:alice@192.0.2.4>",
+	"Content-Length: 0",
+}, "\r\n") + "\r\n\r\n"
+
+func parseRawTestMessage(t *testing.T) sip.Message {
+	msg, err := parser.ParseMessage([]byte(rawTestMessage), testutils.NewLogrusLogger())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	return msg
+}
+
+func TestRawHeaders(t *testing.T) {
+	msg := parseRawTestMessage(t)
+
+	if msg.String() != rawTestMessage {
+		t.Errorf("message is not serialized as received:\n%s", msg.String())
+	}
+	if clone := msg.Clone(); clone.String() != rawTestMessage {
+		t.Errorf("cloned message is not serialized as received:\n%s", clone.String())
+	}
+
+	vias := msg.GetRawHeaders("Via")
+	if len(vias) != 2 || string(vias[0]) != "v: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds" {
+		t.Errorf("unexpected raw Via headers: %q", vias)
+	}
+	if custom := msg.GetRawHeaders("x-custom"); len(custom) != 1 || string(custom[0]) != "X-Custom:  some   value\r\n\twith folding" {
+		t.Errorf("unexpected raw X-Custom headers: %q", custom)
+	}
+}
+
+func TestRawHeadersModified(t *testing.T) {
+	msg := parseRawTestMessage(t)
+
+	hop, _ := msg.ViaHop()
+	hop.Params.Add("received", sip.String{Str: "192.0.2.1"})
+	msg.RemoveHeader("X-Custom")
+	msg.AppendHeader(&sip.GenericHeader{HeaderName: "Route", Contents: "<sip:edge.biloxi.com;lr>"})
+
+	expected := strings.Join([]string{
+		"INVITE sip:bob@biloxi.com SIP/2.0",
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds;received=192.0.2.1",
+		"ROUTE: <sip:proxy.atlanta.com;lr>",
+		"Route: <sip:edge.biloxi.com;lr>",
+		"Via:   SIP/2.0/UDP  bigbox3.site3.atlanta.com;branch=z9hG4bK77ef4c2312983.1",
+		"To: Bob <sip:bob@biloxi.com>",
+		"f: Alice <sip:alice@atlanta.com>;tag=1928301774",
+		"Call-ID: a84b4c76e66710@pc33.atlanta.com",
+		"CSeq: 314159 INVITE",
+		"Contact: <sip:alice@pc33.atlanta.com>, <sip:alice@192.0.2.4>",
+		"Content-Length: 0",
+	}, "\r\n") + "\r\n\r\n"
+	if msg.String() != expected {
+		t.Errorf("unexpected message:\n%s\nexpected:\n%s", msg.String(), expected)
+	}
+	if vias := msg.GetRawHeaders("Via"); len(vias) != 1 {
+		t.Errorf("modified Via is returned as raw: %q", vias)
+	}
+}
@@ -0,0 +1,362 @@
+package parser_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/testutils"
+)
+
+// RFC 4475 torture test messages, each one is stored in testdata/rfc4475/<name>.dat.
+// Messages of s. 3.1.2 that are syntactically valid but must be rejected
+// by the application (unsupported version, CSeq mismatch) are parsed successfully,
+// as well as all messages of s. 3.2 - 3.4.
+var rfc4475Tests = []struct {
+	name  string
+	valid bool
+	check func(t *testing.T, msg sip.Message)
+}{
+	// 3.1.1. Valid messages
+	{"wsinv", true, func(t *testing.T, msg sip.Message) {
+		if from, _ := msg.From(); from == nil || from.DisplayName.String() != `J Rosenberg \\\"` {
+			t.Errorf("unexpected From: %v", from)
+		}
+		if to, _ := msg.To(); to == nil || to.Params.String() != "tag=1918181833n" {
+			t.Errorf("unexpected To: %v", to)
+		}
+		if cseq, _ := msg.CSeq(); cseq == nil || cseq.SeqNo != 9 || cseq.MethodName != sip.INVITE {
+			t.Errorf("unexpected CSeq: %v", cseq)
+		}
+		assertViaHops(t, msg, "192.0.2.2", "spindle.example.com", "192.168.255.111")
+		if contact, _ := msg.Contact(); contact == nil || contact.DisplayName.String() != `Quoted string \"\"` ||
+			!contact.Params.Has("secondparam") {
+			t.Errorf("unexpected Contact: %v", contact)
+		}
+		if hdrs := msg.GetHeaders("NewFangledHeader"); len(hdrs) != 1 ||
+			!strings.Contains(hdrs[0].Value(), "continued newfangled value") {
+			t.Errorf("unexpected NewFangledHeader: %v", hdrs)
+		}
+		assertBodyLength(t, msg)
+	}},
+	{"intmeth", true, func(t *testing.T, msg sip.Message) {
+		req := msg.(sip.Request)
+		method := sip.RequestMethod("!interesting-Method0123456789_*+`.%indeed'~")
+		if req.Method() != method {
+			t.Errorf("unexpected method %q", req.Method())
+		}
+		if cseq, _ := msg.CSeq(); cseq == nil || cseq.MethodName != method {
+			t.Errorf("unexpected CSeq: %v", cseq)
+		}
+		uri := req.Recipient()
+		if uri.User().String() != "1_unusual.URI~(to-be!sure)&isn't+it$/crazy?,/;;*" ||
+			uri.Password().String() != "&it+has=1,weird!*pas$wo~d_too.(doesn't-it)" ||
+			uri.Host() != "example.com" {
+			t.Errorf("unexpected Request-URI %s", uri)
+		}
+		if from, _ := msg.From(); from == nil || from.DisplayName.String() != "token1~` token2'+_ token3*%!.-" {
+			t.Errorf("unexpected From: %v", from)
+		}
+		if callID, _ := msg.CallID(); callID == nil || string(*callID) != `intmeth.word%ZK-!.*_+'@word`+"`"+`~)(><:\/"][?}{` {
+			t.Errorf("unexpected Call-ID: %v", callID)
+		}
+	}},
+	{"esc01", true, func(t *testing.T, msg sip.Message) {
+		if user := msg.(sip.Request).Recipient().User().String(); user != "sips:user@example.com" {
+			t.Errorf("unexpected Request-URI user %q", user)
+		}
+		if to, _ := msg.To(); to == nil || to.Address.User().String() != "user" {
+			t.Errorf("unexpected To: %v", to)
+		}
+		if contact, _ := msg.Contact(); contact == nil || contact.Address.User().String() != "caller" ||
+			!contact.Address.UriParams().Has("lr") {
+			t.Errorf("unexpected Contact: %v", contact)
+		}
+	}},
+	{"escnull", true, func(t *testing.T, msg sip.Message) {
+		if to, _ := msg.To(); to == nil || to.Address.User().String() != "null-\x00-null" {
+			t.Errorf("unexpected To: %v", to)
+		}
+		if contacts := msg.GetHeaders("Contact"); len(contacts) != 2 {
+			t.Errorf("expected 2 Contact headers, got %d", len(contacts))
+		}
+	}},
+	{"esc02", true, func(t *testing.T, msg sip.Message) {
+		// % is a valid token character, method and unknown headers are not unescaped.
+		if method := msg.(sip.Request).Method(); method != "RE%47IST%45R" {
+			t.Errorf("unexpected method %q", method)
+		}
+		if contacts := msg.GetHeaders("Contact"); len(contacts) != 2 {
+			t.Errorf("expected 2 Contact headers, got %d", len(contacts))
+		}
+		if hop, _ := msg.ViaHop(); hop == nil || hop.Params.String() != "branch=z9hG4bK209%25fzsnel234" {
+			t.Errorf("unexpected Via: %v", hop)
+		}
+	}},
+	{"lwsdisp", true, func(t *testing.T, msg sip.Message) {
+		if from, _ := msg.From(); from == nil || from.DisplayName.String() != "caller" {
+			t.Errorf("unexpected From: %v", from)
+		}
+	}},
+	{"longreq", true, func(t *testing.T, msg sip.Message) {
+		hops := 0
+		for _, hdr := range msg.GetHeaders("Via") {
+			hops += len(hdr.(sip.ViaHeader))
+		}
+		if hops != 34 {
+			t.Errorf("expected 34 Via hops, got %d", hops)
+		}
+		if to, _ := msg.To(); to == nil || len(to.DisplayName.String()) < 400 {
+			t.Errorf("unexpected To: %v", to)
+		}
+		assertBodyLength(t, msg)
+	}},
+	{"dblreq", true, func(t *testing.T, msg sip.Message) {
+		// The INVITE following the REGISTER in the same datagram is discarded.
+		if method := msg.(sip.Request).Method(); method != sip.REGISTER {
+			t.Errorf("unexpected method %q", method)
+		}
+		if body := msg.Body(); body != "" {
+			t.Errorf("unexpected body %q", body)
+		}
+	}},
+	{"semiuri", true, func(t *testing.T, msg sip.Message) {
+		uri := msg.(sip.Request).Recipient()
+		if uri.User().String() != "user;par=u@example.net" || uri.Host() != "example.com" ||
+			uri.UriParams().Length() != 0 {
+			t.Errorf("unexpected Request-URI %s", uri)
+		}
+	}},
+	{"transports", true, func(t *testing.T, msg sip.Message) {
+		var transports []string
+		for _, hdr := range msg.GetHeaders("Via") {
+			for _, hop := range hdr.(sip.ViaHeader) {
+				transports = append(transports, hop.Transport)
+			}
+		}
+		if s := strings.Join(transports, ","); s != "UDP,SCTP,TLS,UNKNOWN,TCP" {
+			t.Errorf("unexpected transports %s", s)
+		}
+	}},
+	{"mpart01", true, assertBodyLength},
+	{"unreason", true, func(t *testing.T, msg sip.Message) {
+		if reason := msg.(sip.Response).Reason(); reason != "= 2**3 * 5**2 но сто девяносто девять - простое" {
+			t.Errorf("unexpected reason %q", reason)
+		}
+	}},
+	{"noreason", true, func(t *testing.T, msg sip.Message) {
+		res := msg.(sip.Response)
+		if res.StatusCode() != 100 || res.Reason() != "" {
+			t.Errorf("unexpected status line %q", res.StartLine())
+		}
+	}},
+
+	// 3.1.2. Invalid messages
+	{name: "badinv01"},
+	{name: "clerr"},
+	{name: "ncl"},
+	{name: "scalar02"},
+	{name: "scalarlg"},
+	{name: "quotbal"},
+	{name: "ltgtruri"},
+	{name: "lwsruri"},
+	{name: "lwsstart"},
+	{name: "trws"},
+	{name: "escruri"},
+	// Date is not used by the stack, so the message is accepted (s. 3.1.2.12).
+	{"baddate", true, nil},
+	{name: "regbadct"},
+	{name: "badaspec"},
+	{name: "baddn"},
+	// Must be rejected with 505 Version Not Supported.
+	{"badvers", true, func(t *testing.T, msg sip.Message) {
+		if v := msg.SipVersion(); v != "SIP/7.0" {
+			t.Errorf("unexpected version %q", v)
+		}
+	}},
+	// CSeq method mismatch must be rejected with 400 Bad Request.
+	{"mismatch01", true, nil},
+	{"mismatch02", true, nil},
+	{name: "bigcode"},
+
+	// 3.2. Transaction layer semantics
+	{"badbranch", true, func(t *testing.T, msg sip.Message) {
+		if hop, _ := msg.ViaHop(); hop == nil || hop.Params.String() != "branch=z9hG4bK" {
+			t.Errorf("unexpected Via: %v", hop)
+		}
+	}},
+
+	// 3.3. Application layer semantics
+	{"insuf", true, nil},
+	{"unkscm", true, func(t *testing.T, msg sip.Message) {
+		if uri, ok := msg.(sip.Request).Recipient().(*sip.AbsoluteUri); !ok || uri.Scheme() != "nobodyKnowsThisScheme" {
+			t.Errorf("unexpected Request-URI %s", msg.(sip.Request).Recipient())
+		}
+	}},
+	{"novelsc", true, func(t *testing.T, msg sip.Message) {
+		if uri, ok := msg.(sip.Request).Recipient().(*sip.AbsoluteUri); !ok || uri.Scheme() != "soap.beep" {
+			t.Errorf("unexpected Request-URI %s", msg.(sip.Request).Recipient())
+		}
+	}},
+	{"unksm2", true, func(t *testing.T, msg sip.Message) {
+		if to, _ := msg.To(); to == nil || to.Address.String() != "isbn:2983792873" {
+			t.Errorf("unexpected To: %v", to)
+		}
+	}},
+	{"bext01", true, nil},
+	{"invut", true, assertBodyLength},
+	{"regaut01", true, nil},
+	// Multiple values of single value headers must be rejected with 400 Bad Request.
+	{"multi01", true, func(t *testing.T, msg sip.Message) {
+		if callIDs := msg.GetHeaders("Call-ID"); len(callIDs) != 2 {
+			t.Errorf("expected 2 Call-ID headers, got %d", len(callIDs))
+		}
+	}},
+	// Unlike multi01 the length of the body is unknown, so the message can not be parsed.
+	{name: "mcl01"},
+	{"bcast", true, nil},
+	{"zeromf", true, nil},
+	{"cparam01", true, func(t *testing.T, msg sip.Message) {
+		if contact, _ := msg.Contact(); contact == nil || !contact.Params.Has("unknownparam") ||
+			contact.Address.UriParams().Length() != 0 {
+			t.Errorf("unexpected Contact: %v", contact)
+		}
+	}},
+	{"cparam02", true, func(t *testing.T, msg sip.Message) {
+		if contact, _ := msg.Contact(); contact == nil || !contact.Address.UriParams().Has("unknownparam") {
+			t.Errorf("unexpected Contact: %v", contact)
+		}
+	}},
+	{"regescrt", true, func(t *testing.T, msg sip.Message) {
+		if contact, _ := msg.Contact(); contact == nil || !contact.Address.Headers().Has("Route") {
+			t.Errorf("unexpected Contact: %v", contact)
+		}
+	}},
+	{"sdp01", true, nil},
+
+	// 3.4. Backward compatibility
+	{"inv2543", true, func(t *testing.T, msg sip.Message) {
+		if _, ok := msg.ContentLength(); ok {
+			t.Errorf("unexpected Content-Length")
+		}
+		if !strings.HasPrefix(msg.Body(), "v=0") {
+			t.Errorf("unexpected body %q", msg.Body())
+		}
+	}},
+}
+
+func readRFC4475Message(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "rfc4475", name+".dat"))
+	if err != nil {
+		t.Fatalf("read message %s: %s", name, err)
+	}
+	return data
+}
+
+func assertViaHops(t *testing.T, msg sip.Message, hosts ...string) {
+	var actual []string
+	for _, hdr := range msg.GetHeaders("Via") {
+		for _, hop := range hdr.(sip.ViaHeader) {
+			actual = append(actual, hop.Host)
+		}
+	}
+	if strings.Join(actual, " ") != strings.Join(hosts, " ") {
+		t.Errorf("unexpected Via hosts %v, expected %v", actual, hosts)
+	}
+}
+
+func assertBodyLength(t *testing.T, msg sip.Message) {
+	cl, ok := msg.ContentLength()
+	if !ok || int(*cl) != len(msg.BodyBytes()) {
+		t.Errorf("body length %d does not match Content-Length %v", len(msg.BodyBytes()), cl)
+	}
+}
+
+func TestRFC4475(t *testing.T) {
+	logger := testutils.NewLogrusLogger()
+	for _, tt := range rfc4475Tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parser.ParseMessage(readRFC4475Message(t, tt.name), logger)
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("invalid message parsed:\n%s", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse message: %s", err)
+			}
+			if tt.check != nil {
+				tt.check(t, msg)
+			}
+
+			// the message must survive sending it further
+			if _, err := parser.ParseMessage([]byte(msg.String()), logger); err != nil {
+				t.Errorf("failed to parse rendered message: %s\n%s", err, msg)
+			}
+		})
+	}
+}
+
+// All messages with Content-Length are written to the stream parser at once in small chunks,
+// invalid messages must not break parsing of the following ones.
+func TestRFC4475Streamed(t *testing.T) {
+	logger := testutils.NewLogrusLogger()
+	var (
+		stream   []byte
+		expected []sip.Message
+	)
+	for _, tt := range rfc4475Tests {
+		switch tt.name {
+		case "inv2543", "dblreq", "clerr", "mcl01":
+			// no framing or framing is broken on purpose
+			continue
+		}
+
+		data := readRFC4475Message(t, tt.name)
+		stream = append(stream, data...)
+		if tt.valid {
+			msg, err := parser.ParseMessage(data, logger)
+			if err != nil {
+				t.Fatalf("failed to parse message %s: %s", tt.name, err)
+			}
+			expected = append(expected, msg)
+		}
+	}
+
+	output := make(chan sip.Message)
+	errs := make(chan error)
+	p := parser.NewParser(output, errs, true, logger)
+	defer p.Stop()
+
+	go func() {
+		for i := 0; i < len(stream); i += 13 {
+			end := i + 13
+			if end > len(stream) {
+				end = len(stream)
+			}
+			if _, err := p.Write(stream[i:end]); err != nil {
+				t.Errorf("write failed: %s", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < len(expected); {
+		select {
+		case msg := <-output:
+			if msg.String() != expected[i].String() {
+				t.Errorf("unexpected message:\n%s\nexpected:\n%s", msg, expected[i])
+			}
+			i++
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for message:\n%s", expected[i])
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// ReferToHeader introduces SIP 'Refer-To' header (RFC 3515).
+// The address may carry embedded headers, e.g. Replaces for attended transfer.
+type ReferToHeader struct {
+	// The display name from the header, may be omitted.
+	DisplayName MaybeString
+	Address     Uri
+	// Any parameters present in the header.
+	Params Params
+}
+
+func (referTo *ReferToHeader) String() string {
+	return fmt.Sprintf("%s: %s", referTo.Name(), referTo.Value())
+}
+
+func (referTo *ReferToHeader) Name() string { return "Refer-To" }
+
+func (referTo *ReferToHeader) Value() string {
+	return addressValue(referTo.DisplayName, referTo.Address, referTo.Params)
+}
+
+func (referTo *ReferToHeader) Clone() Header {
+	var newReferTo *ReferToHeader
+	if referTo == nil {
+		return newReferTo
+	}
+
+	newReferTo = &ReferToHeader{
+		DisplayName: referTo.DisplayName,
+		Params:      cloneWithNil(referTo.Params),
+	}
+	if referTo.Address != nil {
+		newReferTo.Address = referTo.Address.Clone()
+	}
+	return newReferTo
+}
+
+func (referTo *ReferToHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ReferToHeader); ok {
+		if referTo == h {
+			return true
+		}
+		if referTo == nil || h == nil {
+			return false
+		}
+
+		return addressEqual(referTo.DisplayName, referTo.Address, referTo.Params, h.DisplayName, h.Address, h.Params)
+	}
+
+	return false
+}
+
+// ReferredByHeader introduces SIP 'Referred-By' header (RFC 3892).
+type ReferredByHeader struct {
+	// The display name from the header, may be omitted.
+	DisplayName MaybeString
+	Address     Uri
+	// Any parameters present in the header, e.g. cid.
+	Params Params
+}
+
+func (referredBy *ReferredByHeader) String() string {
+	return fmt.Sprintf("%s: %s", referredBy.Name(), referredBy.Value())
+}
+
+func (referredBy *ReferredByHeader) Name() string { return "Referred-By" }
+
+func (referredBy *ReferredByHeader) Value() string {
+	return addressValue(referredBy.DisplayName, referredBy.Address, referredBy.Params)
+}
+
+func (referredBy *ReferredByHeader) Clone() Header {
+	var newReferredBy *ReferredByHeader
+	if referredBy == nil {
+		return newReferredBy
+	}
+
+	newReferredBy = &ReferredByHeader{
+		DisplayName: referredBy.DisplayName,
+		Params:      cloneWithNil(referredBy.Params),
+	}
+	if referredBy.Address != nil {
+		newReferredBy.Address = referredBy.Address.Clone()
+	}
+	return newReferredBy
+}
+
+func (referredBy *ReferredByHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ReferredByHeader); ok {
+		if referredBy == h {
+			return true
+		}
+		if referredBy == nil || h == nil {
+			return false
+		}
+
+		return addressEqual(referredBy.DisplayName, referredBy.Address, referredBy.Params,
+			h.DisplayName, h.Address, h.Params)
+	}
+
+	return false
+}
+
+// ReplacesHeader introduces SIP 'Replaces' header (RFC 3891).
+// Tags are given from the point of view of the UA that receives the header:
+// ToTag is matched against its local tag and FromTag against the remote one.
+type ReplacesHeader struct {
+	CallID  string
+	ToTag   string
+	FromTag string
+	// Only replace early dialog.
+	EarlyOnly bool
+	// Other parameters present in the header.
+	Params Params
+}
+
+func (replaces *ReplacesHeader) String() string {
+	return fmt.Sprintf("%s: %s", replaces.Name(), replaces.Value())
+}
+
+func (replaces *ReplacesHeader) Name() string { return "Replaces" }
+
+func (replaces *ReplacesHeader) Value() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(replaces.CallID)
+	buffer.WriteString(";to-tag=" + replaces.ToTag)
+	buffer.WriteString(";from-tag=" + replaces.FromTag)
+	if replaces.EarlyOnly {
+		buffer.WriteString(";early-only")
+	}
+	if replaces.Params != nil && replaces.Params.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(replaces.Params.ToString(';'))
+	}
+
+	return buffer.String()
+}
+
+func (replaces *ReplacesHeader) Clone() Header {
+	var newReplaces *ReplacesHeader
+	if replaces == nil {
+		return newReplaces
+	}
+
+	newReplaces = &ReplacesHeader{
+		CallID:    replaces.CallID,
+		ToTag:     replaces.ToTag,
+		FromTag:   replaces.FromTag,
+		EarlyOnly: replaces.EarlyOnly,
+	}
+	if replaces.Params != nil {
+		newReplaces.Params = replaces.Params.Clone()
+	}
+	return newReplaces
+}
+
+func (replaces *ReplacesHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ReplacesHeader); ok {
+		if replaces == h {
+			return true
+		}
+		if replaces == nil || h == nil {
+			return false
+		}
+
+		return replaces.CallID == h.CallID &&
+			replaces.ToTag == h.ToTag &&
+			replaces.FromTag == h.FromTag &&
+			replaces.EarlyOnly == h.EarlyOnly &&
+			paramsEqual(replaces.Params, h.Params)
+	}
+
+	return false
+}
+
+// Matches returns true if the header identifies the dialog.
+func (replaces *ReplacesHeader) Matches(dialog *Dialog) bool {
+	return replaces.CallID == string(dialog.CallID()) &&
+		replaces.ToTag == dialog.LocalTag() &&
+		replaces.FromTag == dialog.RemoteTag()
+}
+
+// NewReplacesFromDialog creates Replaces header that identifies the dialog to the remote party of the dialog,
+// e.g. to the transfer target in attended transfer.
+func NewReplacesFromDialog(dialog *Dialog) *ReplacesHeader {
+	return &ReplacesHeader{
+		CallID:  string(dialog.CallID()),
+		ToTag:   dialog.RemoteTag(),
+		FromTag: dialog.LocalTag(),
+	}
+}
+
+// ReferSubHeader introduces SIP 'Refer-Sub' header (RFC 4488).
+// False value suppresses implicit subscription created by REFER.
+type ReferSubHeader struct {
+	Enabled bool
+	Params  Params
+}
+
+func (referSub *ReferSubHeader) String() string {
+	return fmt.Sprintf("%s: %s", referSub.Name(), referSub.Value())
+}
+
+func (referSub *ReferSubHeader) Name() string { return "Refer-Sub" }
+
+func (referSub *ReferSubHeader) Value() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(strconv.FormatBool(referSub.Enabled))
+	if referSub.Params != nil && referSub.Params.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(referSub.Params.ToString(';'))
+	}
+	return buffer.String()
+}
+
+func (referSub *ReferSubHeader) Clone() Header {
+	var newReferSub *ReferSubHeader
+	if referSub == nil {
+		return newReferSub
+	}
+
+	newReferSub = &ReferSubHeader{Enabled: referSub.Enabled}
+	if referSub.Params != nil {
+		newReferSub.Params = referSub.Params.Clone()
+	}
+	return newReferSub
+}
+
+func (referSub *ReferSubHeader) Equals(other interface{}) bool {
+	if h, ok := other.(*ReferSubHeader); ok {
+		if referSub == h {
+			return true
+		}
+		if referSub == nil || h == nil {
+			return false
+		}
+
+		return referSub.Enabled == h.Enabled && paramsEqual(referSub.Params, h.Params)
+	}
+
+	return false
+}
+
+func addressValue(displayName MaybeString, uri Uri, params Params) string {
+	return nameAddrValue(displayName, fmt.Sprintf("%s", uri), params)
+}
+
+func nameAddrValue(displayName MaybeString, uri string, params Params) string {
+	var buffer bytes.Buffer
+	if displayName, ok := displayName.(String); ok && displayName.String() != "" {
+		buffer.WriteString(fmt.Sprintf("\"%s\" ", displayName))
+	}
+
+	buffer.WriteString("<" + uri + ">")
+
+	if params != nil && params.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(params.ToString(';'))
+	}
+
+	return buffer.String()
+}
+
+func addressEqual(displayName MaybeString, uri Uri, params Params,
+	otherDisplayName MaybeString, otherUri Uri, otherParams Params) bool {
+	if displayName != otherDisplayName {
+		if displayName == nil || !displayName.Equals(otherDisplayName) {
+			return false
+		}
+	}
+	if uri != otherUri {
+		if uri == nil || !uri.Equals(otherUri) {
+			return false
+		}
+	}
+	return paramsEqual(params, otherParams)
+}
@@ -46,7 +46,7 @@ func NewRequest(
 	req.headers = newHeaders(hdrs)
 	req.method = method
 	req.recipient = recipient
-	req.body = body
+	req.body = []byte(body)
 	req.fields = fields.WithFields(log.Fields{
 		"request_id": req.messID,
 	})
@@ -233,7 +233,7 @@ func (req *request) Destination() string {
 	if hdrs := req.GetHeaders("Route"); len(hdrs) > 0 {
 		routeHeader, ok := hdrs[0].(*RouteHeader)
 		if ok && len(routeHeader.Addresses) > 0 {
-			uri = routeHeader.Addresses[0].(*SipUri)
+			uri, _ = routeHeader.Addresses[0].(*SipUri)
 		}
 	}
 	if uri == nil {
@@ -366,10 +366,11 @@ func cloneRequest(req Request, id MessageID, fields log.Fields) Request {
 		req.Method(),
 		req.Recipient().Clone(),
 		req.SipVersion(),
-		cloneHeaders(req),
+		nil,
 		req.Body(),
 		newFields,
 	)
+	newReq.(*request).headers = cloneMessageHeaders(req)
 	newReq.SetTransport(req.Transport())
 	newReq.SetSource(req.Source())
 	newReq.SetDestination(req.Destination())
@@ -54,7 +54,7 @@ func NewResponse(
 	res.headers = newHeaders(hdrs)
 	res.status = statusCode
 	res.reason = reason
-	res.body = body
+	res.body = []byte(body)
 	res.fields = fields.WithFields(log.Fields{
 		"response_id": res.messID,
 	})
@@ -292,10 +292,11 @@ func cloneResponse(res Response, id MessageID, fields log.Fields) Response {
 		res.SipVersion(),
 		res.StatusCode(),
 		res.Reason(),
-		cloneHeaders(res),
+		nil,
 		res.Body(),
 		newFields,
 	)
+	newRes.(*response).headers = cloneMessageHeaders(res)
 	newRes.SetPrevious(res.Previous())
 	newRes.SetTransport(res.Transport())
 	newRes.SetSource(res.Source())
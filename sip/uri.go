@@ -0,0 +1,311 @@
+package sip
+
+import (
+	"bytes"
+	"strings"
+)
+
+// TelUri
+// A telephone number URI as described in RFC 3966, e.g. tel:+1-201-555-0123 or tel:7042;phone-context=example.com.
+type TelUri struct {
+	// The telephone-subscriber number as it appears in the URI, including visual separators.
+	// Global numbers start with '+', local numbers must be accompanied by the phone-context parameter.
+	FNumber string
+
+	// Any parameters associated with the URI: isub, ext, phone-context and others.
+	FUriParams Params
+}
+
+// IsGlobal returns true if the number is a global (E.164) number.
+func (uri *TelUri) IsGlobal() bool {
+	return strings.HasPrefix(uri.FNumber, "+")
+}
+
+// Number returns the number without visual separators.
+func (uri *TelUri) Number() string {
+	return stripVisualSeparators(uri.FNumber)
+}
+
+// PhoneContext returns value of the phone-context parameter.
+func (uri *TelUri) PhoneContext() (string, bool) {
+	return uri.param("phone-context")
+}
+
+// Extension returns value of the ext parameter.
+func (uri *TelUri) Extension() (string, bool) {
+	return uri.param("ext")
+}
+
+// Isub returns value of the isub parameter.
+func (uri *TelUri) Isub() (string, bool) {
+	return uri.param("isub")
+}
+
+func (uri *TelUri) param(name string) (string, bool) {
+	if uri.FUriParams == nil {
+		return "", false
+	}
+	for _, key := range uri.FUriParams.Keys() {
+		if strings.EqualFold(key, name) {
+			if val, ok := uri.FUriParams.Get(key); ok && val != nil {
+				return val.String(), true
+			}
+			return "", true
+		}
+	}
+	return "", false
+}
+
+func (uri *TelUri) IsEncrypted() bool { return false }
+
+func (uri *TelUri) SetEncrypted(flag bool) {}
+
+// User returns the number, so that code routing on the user part works for tel URIs too.
+func (uri *TelUri) User() MaybeString {
+	return String{Str: uri.FNumber}
+}
+
+func (uri *TelUri) SetUser(user MaybeString) {
+	if user == nil {
+		uri.FNumber = ""
+		return
+	}
+	uri.FNumber = user.String()
+}
+
+func (uri *TelUri) Password() MaybeString { return nil }
+
+func (uri *TelUri) SetPassword(pass MaybeString) {}
+
+func (uri *TelUri) Host() string { return "" }
+
+func (uri *TelUri) SetHost(host string) {}
+
+func (uri *TelUri) Port() *Port { return nil }
+
+func (uri *TelUri) SetPort(port *Port) {}
+
+func (uri *TelUri) UriParams() Params {
+	return uri.FUriParams
+}
+
+func (uri *TelUri) SetUriParams(params Params) {
+	uri.FUriParams = params
+}
+
+func (uri *TelUri) Headers() Params { return nil }
+
+func (uri *TelUri) SetHeaders(params Params) {}
+
+func (uri *TelUri) IsWildcard() bool {
+	return false
+}
+
+// Determine if the tel URI is equal to the specified URI according to the rules laid down in RFC 3966 s. 4:
+// numbers are compared ignoring visual separators, parameters are compared regardless of their order,
+// values of isub, ext and phone-context ignoring visual separators, all comparisons are case-insensitive.
+func (uri *TelUri) Equals(val interface{}) bool {
+	other, ok := val.(*TelUri)
+	if !ok {
+		return false
+	}
+
+	if uri == other {
+		return true
+	}
+	if uri == nil || other == nil {
+		return false
+	}
+
+	if uri.IsGlobal() != other.IsGlobal() ||
+		!strings.EqualFold(uri.Number(), other.Number()) {
+		return false
+	}
+
+	params := telParamsMap(uri.FUriParams)
+	otherParams := telParamsMap(other.FUriParams)
+	if len(params) != len(otherParams) {
+		return false
+	}
+	for key, val := range params {
+		otherVal, ok := otherParams[key]
+		if !ok || val != otherVal {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Generates the string representation of a TelUri struct.
+func (uri *TelUri) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("tel:")
+	buffer.WriteString(uri.FNumber)
+
+	if uri.FUriParams != nil && uri.FUriParams.Length() > 0 {
+		buffer.WriteString(";")
+		buffer.WriteString(uri.FUriParams.ToString(';'))
+	}
+
+	return buffer.String()
+}
+
+// Clone the tel URI.
+func (uri *TelUri) Clone() Uri {
+	var newUri *TelUri
+	if uri == nil {
+		return newUri
+	}
+
+	return &TelUri{
+		FNumber:    uri.FNumber,
+		FUriParams: cloneWithNil(uri.FUriParams),
+	}
+}
+
+// telParamsMap normalises tel URI params for comparison.
+func telParamsMap(params Params) map[string]string {
+	m := make(map[string]string)
+	if params == nil {
+		return m
+	}
+
+	for _, key := range params.Keys() {
+		var val string
+		if v, ok := params.Get(key); ok && v != nil {
+			val = v.String()
+		}
+
+		key = strings.ToLower(key)
+		switch key {
+		case "isub", "ext", "phone-context":
+			val = stripVisualSeparators(val)
+		}
+		m[key] = strings.ToLower(val)
+	}
+
+	return m
+}
+
+func stripVisualSeparators(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// AbsoluteUri
+// Any URI with a schema not natively supported, e.g. urn:service:sos, mailto:bob@example.com or http://example.com.
+// The part after the schema is kept opaque.
+type AbsoluteUri struct {
+	// The URI schema, e.g. "urn".
+	FScheme string
+	// Everything after the "schema:" prefix.
+	FOpaque string
+}
+
+// Scheme returns the URI schema.
+func (uri *AbsoluteUri) Scheme() string {
+	return uri.FScheme
+}
+
+// Opaque returns the URI part after the schema.
+func (uri *AbsoluteUri) Opaque() string {
+	return uri.FOpaque
+}
+
+func (uri *AbsoluteUri) IsEncrypted() bool { return false }
+
+func (uri *AbsoluteUri) SetEncrypted(flag bool) {}
+
+func (uri *AbsoluteUri) User() MaybeString { return nil }
+
+func (uri *AbsoluteUri) SetUser(user MaybeString) {}
+
+func (uri *AbsoluteUri) Password() MaybeString { return nil }
+
+func (uri *AbsoluteUri) SetPassword(pass MaybeString) {}
+
+func (uri *AbsoluteUri) Host() string { return "" }
+
+func (uri *AbsoluteUri) SetHost(host string) {}
+
+func (uri *AbsoluteUri) Port() *Port { return nil }
+
+func (uri *AbsoluteUri) SetPort(port *Port) {}
+
+func (uri *AbsoluteUri) UriParams() Params { return nil }
+
+func (uri *AbsoluteUri) SetUriParams(params Params) {}
+
+func (uri *AbsoluteUri) Headers() Params { return nil }
+
+func (uri *AbsoluteUri) SetHeaders(params Params) {}
+
+func (uri *AbsoluteUri) IsWildcard() bool {
+	return false
+}
+
+// Determines if the URI equals the specified other URI.
+// Schemas are compared case-insensitively, as well as the namespace identifier of URNs
+// and service URNs entirely, the rest is compared as is.
+func (uri *AbsoluteUri) Equals(val interface{}) bool {
+	other, ok := val.(*AbsoluteUri)
+	if !ok {
+		return false
+	}
+
+	if uri == other {
+		return true
+	}
+	if uri == nil || other == nil {
+		return false
+	}
+
+	if !strings.EqualFold(uri.FScheme, other.FScheme) {
+		return false
+	}
+
+	if strings.EqualFold(uri.FScheme, "urn") {
+		nid, nss := splitUrn(uri.FOpaque)
+		otherNid, otherNss := splitUrn(other.FOpaque)
+		if !strings.EqualFold(nid, otherNid) {
+			return false
+		}
+		// service URNs are case-insensitive, RFC 5031 s. 4.1
+		if strings.EqualFold(nid, "service") {
+			return strings.EqualFold(nss, otherNss)
+		}
+		return nss == otherNss
+	}
+
+	return uri.FOpaque == other.FOpaque
+}
+
+func (uri *AbsoluteUri) String() string {
+	return uri.FScheme + ":" + uri.FOpaque
+}
+
+func (uri *AbsoluteUri) Clone() Uri {
+	var newUri *AbsoluteUri
+	if uri == nil {
+		return newUri
+	}
+
+	return &AbsoluteUri{
+		FScheme: uri.FScheme,
+		FOpaque: uri.FOpaque,
+	}
+}
+
+func splitUrn(s string) (nid, nss string) {
+	if i := strings.Index(s, ":"); i != -1 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
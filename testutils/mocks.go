@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"sync"
 
 	"github.com/ghettovoice/gosip/log"
@@ -134,6 +135,10 @@ func (tpl *MockTransportLayer) Listen(network string, addr string, options ...tr
 	return nil
 }
 
+func (tpl *MockTransportLayer) WsHandler(network string, options ...transport.WsHandlerOption) (http.Handler, error) {
+	return http.NotFoundHandler(), nil
+}
+
 func (tpl *MockTransportLayer) Send(msg sip.Message) error {
 	select {
 	case <-tpl.done:
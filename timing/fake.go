@@ -0,0 +1,251 @@
+package timing
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock where time does not pass as normal, but only progresses when Advance is called.
+//
+// Timers that expire during single Advance call fire in the order of their expiry time,
+// timers with equal expiry time - in the order they were set.
+// AfterFunc callbacks are called one by one in that order on a separate goroutine,
+// so a callback that blocks delays the following ones.
+type FakeClock struct {
+	now    time.Time
+	seq    uint64
+	timers []*fakeTimer
+	mu     sync.Mutex
+	cond   *sync.Cond
+
+	// queued AfterFunc callbacks
+	calls   []func()
+	calling bool
+	idle    *sync.Cond
+}
+
+// NewFakeClock creates FakeClock that starts at the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	clock := &FakeClock{now: now}
+	clock.cond = sync.NewCond(&clock.mu)
+	clock.idle = sync.NewCond(&clock.mu)
+
+	return clock
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.now
+}
+
+func (clock *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{
+		clock: clock,
+		c:     make(chan time.Time, 1),
+	}
+
+	clock.mu.Lock()
+	clock.schedule(t, d)
+	clock.mu.Unlock()
+
+	return t
+}
+
+func (clock *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{
+		clock: clock,
+		c:     make(chan time.Time, 1),
+		f:     f,
+	}
+
+	clock.mu.Lock()
+	clock.schedule(t, d)
+	clock.mu.Unlock()
+
+	return t
+}
+
+func (clock *FakeClock) After(d time.Duration) <-chan time.Time {
+	return clock.NewTimer(d).C()
+}
+
+// Sleep blocks until the clock is advanced by d.
+func (clock *FakeClock) Sleep(d time.Duration) {
+	<-clock.After(d)
+}
+
+// Advance moves the current time forward by d and fires all timers whose time has come up.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+
+	var fired []*fakeTimer
+	remaining := clock.timers[:0]
+	for _, t := range clock.timers {
+		if t.deadline.After(clock.now) {
+			remaining = append(remaining, t)
+		} else {
+			fired = append(fired, t)
+		}
+	}
+	for i := len(remaining); i < len(clock.timers); i++ {
+		clock.timers[i] = nil
+	}
+	clock.timers = remaining
+
+	sort.Slice(fired, func(i, j int) bool {
+		if fired[i].deadline.Equal(fired[j].deadline) {
+			return fired[i].seq < fired[j].seq
+		}
+		return fired[i].deadline.Before(fired[j].deadline)
+	})
+	for _, t := range fired {
+		clock.fire(t)
+	}
+
+	clock.cond.Broadcast()
+}
+
+// Waiters returns number of active timers, including blocked After and Sleep calls.
+func (clock *FakeClock) Waiters() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return len(clock.timers)
+}
+
+// BlockUntil blocks until there are at least n active timers.
+// It is used to make sure that the code under test has set up its timers before calling Advance.
+func (clock *FakeClock) BlockUntil(n int) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	for len(clock.timers) < n {
+		clock.cond.Wait()
+	}
+}
+
+// Settle blocks until all AfterFunc callbacks fired so far have returned.
+func (clock *FakeClock) Settle() {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	for clock.calling {
+		clock.idle.Wait()
+	}
+}
+
+// schedule sets timer to fire after d, must be called with locked mu.
+func (clock *FakeClock) schedule(t *fakeTimer, d time.Duration) {
+	if d <= 0 {
+		clock.fire(t)
+		return
+	}
+
+	clock.seq++
+	t.seq = clock.seq
+	t.deadline = clock.now.Add(d)
+	t.active = true
+	clock.timers = append(clock.timers, t)
+
+	clock.cond.Broadcast()
+}
+
+// remove stops tracking of the timer, must be called with locked mu.
+func (clock *FakeClock) remove(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+
+	t.active = false
+	for i, elt := range clock.timers {
+		if elt == t {
+			clock.timers = append(clock.timers[:i], clock.timers[i+1:]...)
+			break
+		}
+	}
+
+	clock.cond.Broadcast()
+
+	return true
+}
+
+// fire expires the timer, must be called with locked mu.
+func (clock *FakeClock) fire(t *fakeTimer) {
+	t.active = false
+
+	if t.f != nil {
+		clock.calls = append(clock.calls, t.f)
+		if !clock.calling {
+			clock.calling = true
+			go clock.runCalls()
+		}
+		return
+	}
+
+	// Clear the channel if something is already in it.
+	select {
+	case <-t.c:
+	default:
+	}
+	t.c <- clock.now
+}
+
+func (clock *FakeClock) runCalls() {
+	clock.mu.Lock()
+	for len(clock.calls) > 0 {
+		f := clock.calls[0]
+		clock.calls[0] = nil
+		clock.calls = clock.calls[1:]
+
+		clock.mu.Unlock()
+		f()
+		clock.mu.Lock()
+	}
+	clock.calling = false
+	clock.idle.Broadcast()
+	clock.mu.Unlock()
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	f        func()
+	deadline time.Time
+	seq      uint64
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.clock.remove(t)
+	t.clock.schedule(t, d)
+
+	return wasActive
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	if !t.clock.remove(t) {
+		select {
+		case <-t.c:
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
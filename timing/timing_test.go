@@ -1,6 +1,6 @@
 package timing
 
-// Tests for the mock timing module.
+// Tests for the fake clock.
 
 import (
 	"testing"
@@ -8,8 +8,8 @@ import (
 )
 
 func TestTimer(t *testing.T) {
-	MockMode = true
-	timer := NewTimer(5 * time.Second)
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer := clock.NewTimer(5 * time.Second)
 	done := make(chan struct{})
 
 	go func() {
@@ -17,16 +17,16 @@ func TestTimer(t *testing.T) {
 		done <- struct{}{}
 	}()
 
-	Elapse(5 * time.Second)
+	clock.Advance(5 * time.Second)
 	<-done
 }
 
 func TestTwoTimers(t *testing.T) {
-	MockMode = true
-	timer1 := NewTimer(5 * time.Second)
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer1 := clock.NewTimer(5 * time.Second)
 	done1 := make(chan struct{})
 
-	timer2 := NewTimer(5 * time.Millisecond)
+	timer2 := clock.NewTimer(5 * time.Millisecond)
 	done2 := make(chan struct{})
 
 	go func() {
@@ -39,50 +39,50 @@ func TestTwoTimers(t *testing.T) {
 		done2 <- struct{}{}
 	}()
 
-	Elapse(5 * time.Millisecond)
+	clock.Advance(5 * time.Millisecond)
 	<-done2
 
-	Elapse(9995 * time.Millisecond)
+	clock.Advance(9995 * time.Millisecond)
 	<-done1
 }
 
 func TestAfter(t *testing.T) {
-	MockMode = true
+	clock := NewFakeClock(time.Unix(0, 0))
 	done := make(chan struct{})
-	c := After(5 * time.Second)
+	c := clock.After(5 * time.Second)
 
 	go func() {
 		<-c
 		done <- struct{}{}
 	}()
 
-	Elapse(5 * time.Second)
+	clock.Advance(5 * time.Second)
 	<-done
 }
 
 func TestAfterFunc(t *testing.T) {
-	MockMode = true
+	clock := NewFakeClock(time.Unix(0, 0))
 	done := make(chan struct{})
-	AfterFunc(5*time.Second,
+	clock.AfterFunc(5*time.Second,
 		func() {
 			done <- struct{}{}
 		})
 
-	Elapse(5 * time.Second)
+	clock.Advance(5 * time.Second)
 	<-done
 }
 
 func TestAfterFuncReset(t *testing.T) {
-	MockMode = true
+	clock := NewFakeClock(time.Unix(0, 0))
 	done := make(chan struct{})
-	timer := AfterFunc(5*time.Second,
+	timer := clock.AfterFunc(5*time.Second,
 		func() {
 			done <- struct{}{}
 		})
 
-	Elapse(3 * time.Second)
+	clock.Advance(3 * time.Second)
 	timer.Reset(5 * time.Second)
-	Elapse(2 * time.Second)
+	clock.Advance(2 * time.Second)
 
 	select {
 	case <-done:
@@ -91,7 +91,7 @@ func TestAfterFuncReset(t *testing.T) {
 		t.Log("AfterFunc correctly didn't fire at its old end time after being reset.")
 	}
 
-	Elapse(3 * time.Second)
+	clock.Advance(3 * time.Second)
 	select {
 	case <-done:
 		t.Log("AfterFunc correctly fired at its new end time after being reset.")
@@ -101,14 +101,14 @@ func TestAfterFuncReset(t *testing.T) {
 }
 
 func TestAfterFuncExpiredReset(t *testing.T) {
-	MockMode = true
+	clock := NewFakeClock(time.Unix(0, 0))
 	done := make(chan struct{})
-	timer := AfterFunc(5*time.Second,
+	timer := clock.AfterFunc(5*time.Second,
 		func() {
 			done <- struct{}{}
 		})
 
-	Elapse(5 * time.Second)
+	clock.Advance(5 * time.Second)
 
 	select {
 	case <-done:
@@ -118,7 +118,7 @@ func TestAfterFuncExpiredReset(t *testing.T) {
 	}
 
 	timer.Reset(5 * time.Second)
-	Elapse(5 * time.Second)
+	clock.Advance(5 * time.Second)
 	select {
 	case <-done:
 		t.Log("AfterFunc correctly fired at its new end time after being reset.")
@@ -128,8 +128,8 @@ func TestAfterFuncExpiredReset(t *testing.T) {
 }
 
 func TestExpiredReset(t *testing.T) {
-	MockMode = true
-	timer := NewTimer(5 * time.Second)
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer := clock.NewTimer(5 * time.Second)
 	done := make(chan struct{})
 
 	go func() {
@@ -137,7 +137,7 @@ func TestExpiredReset(t *testing.T) {
 		done <- struct{}{}
 	}()
 
-	Elapse(5 * time.Second)
+	clock.Advance(5 * time.Second)
 	<-done
 
 	timer.Reset(3 * time.Second)
@@ -146,7 +146,7 @@ func TestExpiredReset(t *testing.T) {
 		done <- struct{}{}
 	}()
 
-	Elapse(2 * time.Second)
+	clock.Advance(2 * time.Second)
 	select {
 	case <-done:
 		t.Fatal("Timer fired at its old end time after being reset.")
@@ -154,7 +154,7 @@ func TestExpiredReset(t *testing.T) {
 		t.Log("Timer correctly didn't fire at its old end time after being reset.")
 	}
 
-	Elapse(1 * time.Second)
+	clock.Advance(1 * time.Second)
 	select {
 	case <-done:
 		t.Log("Timer correctly fired at its new end time after being reset.")
@@ -164,8 +164,8 @@ func TestExpiredReset(t *testing.T) {
 }
 
 func TestNotExpiredReset(t *testing.T) {
-	MockMode = true
-	timer := NewTimer(5 * time.Second)
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer := clock.NewTimer(5 * time.Second)
 	done := make(chan struct{})
 
 	go func() {
@@ -173,9 +173,9 @@ func TestNotExpiredReset(t *testing.T) {
 		done <- struct{}{}
 	}()
 
-	Elapse(4 * time.Second)
+	clock.Advance(4 * time.Second)
 	timer.Reset(5 * time.Second)
-	Elapse(1 * time.Second)
+	clock.Advance(1 * time.Second)
 
 	select {
 	case <-done:
@@ -184,7 +184,7 @@ func TestNotExpiredReset(t *testing.T) {
 		t.Log("Timer correctly didn't fire at its old end time after being reset.")
 	}
 
-	Elapse(4 * time.Second)
+	clock.Advance(4 * time.Second)
 	select {
 	case <-done:
 		t.Log("Timer correctly fired at its new end time after being reset.")
@@ -194,18 +194,18 @@ func TestNotExpiredReset(t *testing.T) {
 }
 
 // This is a regression test for a bug where:
-//  - Create 3 timers.
-//  - Reset() the first one.
-//  - The third timer is now no longer tracked and won't fire.
+//   - Create 3 timers.
+//   - Reset() the first one.
+//   - The third timer is now no longer tracked and won't fire.
 func TestThreeTimersWithReset(t *testing.T) {
-	MockMode = true
-	timer1 := NewTimer(1 * time.Second)
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer1 := clock.NewTimer(1 * time.Second)
 	done1 := make(chan struct{})
 
-	timer2 := NewTimer(2 * time.Second)
+	timer2 := clock.NewTimer(2 * time.Second)
 	done2 := make(chan struct{})
 
-	timer3 := NewTimer(3 * time.Second)
+	timer3 := clock.NewTimer(3 * time.Second)
 	done3 := make(chan struct{})
 
 	go func() {
@@ -225,10 +225,56 @@ func TestThreeTimersWithReset(t *testing.T) {
 
 	timer1.Reset(4 * time.Second)
 
-	Elapse(2 * time.Second)
+	clock.Advance(2 * time.Second)
 	<-done2
 
-	Elapse(1 * time.Second)
+	clock.Advance(1 * time.Second)
 	// Panic here if bug exists.
 	<-done3
 }
+
+func TestFiringOrder(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fired := make(chan int, 3)
+
+	clock.AfterFunc(3*time.Second, func() { fired <- 3 })
+	clock.AfterFunc(time.Second, func() { fired <- 1 })
+	clock.AfterFunc(time.Second, func() { fired <- 2 })
+
+	clock.Advance(5 * time.Second)
+	clock.Settle()
+	close(fired)
+
+	var order []int
+	for n := range fired {
+		order = append(order, n)
+	}
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("timers fired in wrong order: %v", order)
+	}
+}
+
+func TestBlockUntil(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	done := make(chan struct{})
+
+	go func() {
+		clock.Sleep(time.Second)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	if n := clock.Waiters(); n != 1 {
+		t.Fatalf("expected 1 waiter, got %d", n)
+	}
+
+	clock.Advance(time.Second)
+	<-done
+
+	if n := clock.Waiters(); n != 0 {
+		t.Fatalf("expected no waiters, got %d", n)
+	}
+	if now := clock.Now(); !now.Equal(time.Unix(1, 0)) {
+		t.Fatalf("unexpected current time %v", now)
+	}
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import "sync"
+
+// InMemoryExporter stores ended spans in memory, useful for tests.
+type InMemoryExporter struct {
+	spans []SpanData
+	mu    sync.RWMutex
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (exp *InMemoryExporter) ExportSpan(data SpanData) {
+	exp.mu.Lock()
+	exp.spans = append(exp.spans, data)
+	exp.mu.Unlock()
+}
+
+// Spans returns copy of exported spans in the order they were ended.
+func (exp *InMemoryExporter) Spans() []SpanData {
+	exp.mu.RLock()
+	defer exp.mu.RUnlock()
+
+	return append([]SpanData(nil), exp.spans...)
+}
+
+// SpansByName returns exported spans with the name.
+func (exp *InMemoryExporter) SpansByName(name string) []SpanData {
+	spans := make([]SpanData, 0)
+	for _, data := range exp.Spans() {
+		if data.Name == name {
+			spans = append(spans, data)
+		}
+	}
+
+	return spans
+}
+
+func (exp *InMemoryExporter) Reset() {
+	exp.mu.Lock()
+	exp.spans = nil
+	exp.mu.Unlock()
+}
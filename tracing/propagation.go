@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// W3C trace context headers, carried in SIP messages as extension headers.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// TraceParent formats span context as W3C traceparent value.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceParent parses W3C traceparent value.
+func ParseTraceParent(value string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("invalid traceparent '%s'", value)
+	}
+	if len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("unsupported traceparent version in '%s'", value)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent '%s'", value)
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid trace-id in traceparent '%s': %w", value, err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid parent-id in traceparent '%s': %w", value, err)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid trace-flags in traceparent '%s': %w", value, err)
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent '%s': zero trace-id or parent-id", value)
+	}
+
+	return sc, nil
+}
+
+// Inject writes span context into the SIP message headers replacing existing ones.
+func Inject(msg sip.Message, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+
+	msg.RemoveHeader(TraceParentHeader)
+	msg.RemoveHeader(TraceStateHeader)
+
+	msg.AppendHeader(&sip.GenericHeader{
+		HeaderName: TraceParentHeader,
+		Contents:   sc.TraceParent(),
+	})
+	if sc.TraceState != "" {
+		msg.AppendHeader(&sip.GenericHeader{
+			HeaderName: TraceStateHeader,
+			Contents:   sc.TraceState,
+		})
+	}
+}
+
+// Extract reads remote span context from the SIP message headers.
+func Extract(msg sip.Message) (SpanContext, bool) {
+	hdrs := msg.GetHeaders(TraceParentHeader)
+	if len(hdrs) == 0 {
+		return SpanContext{}, false
+	}
+
+	sc, err := ParseTraceParent(hdrs[0].Value())
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	if hdrs := msg.GetHeaders(TraceStateHeader); len(hdrs) > 0 {
+		sc.TraceState = hdrs[0].Value()
+	}
+	sc.Remote = true
+
+	return sc, true
+}
+
+// ContextFromMessage returns context that holds remote span context extracted from the SIP message.
+func ContextFromMessage(ctx context.Context, msg sip.Message) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if sc, ok := Extract(msg); ok {
+		return ContextWithRemoteSpanContext(ctx, sc)
+	}
+
+	return ctx
+}
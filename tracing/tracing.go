@@ -0,0 +1,299 @@
+// tracing package implements minimal OpenTelemetry-compatible tracing API
+// used by the transport, transaction and server layers.
+//
+// Span and Tracer interfaces follow the OpenTelemetry trace API, so spans can be
+// forwarded to an OpenTelemetry SDK with a thin Exporter adapter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool  { return id != TraceID{} }
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+const FlagsSampled byte = 0x01
+
+// SpanContext identifies span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// TraceState is an opaque W3C tracestate value.
+	TraceState string
+	// Remote is true if the span context was extracted from the incoming message.
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagsSampled != 0
+}
+
+func (sc SpanContext) String() string {
+	return fmt.Sprintf("tracing.SpanContext<trace_id=%s span_id=%s>", sc.TraceID, sc.SpanID)
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+func (kind SpanKind) String() string {
+	switch kind {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute    { return Attribute{key, value} }
+func Int(key string, value int) Attribute   { return Attribute{key, value} }
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// Tracer creates spans.
+type Tracer interface {
+	// Start creates a span as a child of the span from the context
+	// and returns context that holds the new span.
+	Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a single operation within a trace.
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// SpanData is a snapshot of ended span passed to the Exporter.
+type SpanData struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanContext
+	StartTime   time.Time
+	EndTime     time.Time
+	Attributes  []Attribute
+	Events      []Event
+	Err         error
+}
+
+// Attribute returns value of the last attribute with the key.
+func (data SpanData) Attribute(key string) (interface{}, bool) {
+	for i := len(data.Attributes) - 1; i >= 0; i-- {
+		if data.Attributes[i].Key == key {
+			return data.Attributes[i].Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Exporter receives ended spans.
+type Exporter interface {
+	ExportSpan(data SpanData)
+}
+
+// NewTracer creates Tracer that passes ended spans to the exporter.
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+func (t *tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	parent := SpanContextFromContext(ctx)
+
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Parent:     parent,
+			StartTime:  time.Now(),
+			Attributes: append([]Attribute(nil), attrs...),
+		},
+	}
+	s.data.SpanContext = SpanContext{
+		TraceID:    parent.TraceID,
+		SpanID:     newSpanID(),
+		Flags:      FlagsSampled,
+		TraceState: parent.TraceState,
+	}
+	if parent.IsValid() {
+		s.data.SpanContext.Flags = parent.Flags
+	} else {
+		s.data.SpanContext.TraceID = newTraceID()
+	}
+
+	return ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	tracer *tracer
+	data   SpanData
+	ended  bool
+	mu     sync.Mutex
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+func (s *span) AddEvent(name string, attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Events = append(s.data.Events, Event{name, time.Now(), attrs})
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Err = err
+	s.data.Events = append(s.data.Events, Event{"exception", time.Now(), []Attribute{
+		String("exception.message", err.Error()),
+	}})
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil && data.SpanContext.IsSampled() {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+// NoopTracer returns Tracer that creates non-recording spans.
+func NoopTracer() Tracer {
+	return noopTracer{}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return ctx, noopSpan{SpanContextFromContext(ctx)}
+}
+
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext               { return s.sc }
+func (noopSpan) SetAttributes(attrs ...Attribute)         {}
+func (noopSpan) AddEvent(name string, attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)                    {}
+func (noopSpan) End()                                     {}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns context that holds the span.
+func ContextWithSpan(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// ContextWithRemoteSpanContext returns context that holds the remote span context,
+// spans started with the context become its children.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+
+	return ContextWithSpan(ctx, noopSpan{sc})
+}
+
+// SpanFromContext returns span from the context or non-recording span if the context doesn't hold any.
+func SpanFromContext(ctx context.Context) Span {
+	if ctx != nil {
+		if s, ok := ctx.Value(spanContextKey{}).(Span); ok {
+			return s
+		}
+	}
+
+	return noopSpan{}
+}
+
+// SpanContextFromContext returns span context of the span from the context.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return SpanFromContext(ctx).SpanContext()
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+
+	return id
+}
@@ -0,0 +1,101 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/tracing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"short span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01", false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", false},
+		{"garbage", "qwerty", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc, err := tracing.ParseTraceParent(test.input)
+			if test.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+					t.Errorf("unexpected span context %s", sc)
+				}
+			} else if err == nil {
+				t.Errorf("expected error, but got %s", sc)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", tracing.SpanKindServer)
+	_, child := tracer.Start(ctx, "child", tracing.SpanKindInternal, tracing.String("a", "b"))
+	child.RecordError(errors.New("failed"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, but got %d", len(spans))
+	}
+	if spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Errorf("unexpected spans order: %s, %s", spans[0].Name, spans[1].Name)
+	}
+	if spans[0].Parent.SpanID != parent.SpanContext().SpanID ||
+		spans[0].SpanContext.TraceID != parent.SpanContext().TraceID {
+		t.Errorf("child span is not linked to the parent")
+	}
+	if v, ok := spans[0].Attribute("a"); !ok || v != "b" {
+		t.Errorf("expected attribute a=b, but got %v", v)
+	}
+	if spans[0].Err == nil {
+		t.Errorf("expected recorded error")
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	req := sip.NewRequest("", sip.INVITE, &sip.SipUri{FHost: "example.com"}, "SIP/2.0", nil, "", nil)
+
+	if _, ok := tracing.Extract(req); ok {
+		t.Fatal("unexpected span context in the request without headers")
+	}
+
+	_, span := tracing.NewTracer(nil).Start(context.Background(), "test", tracing.SpanKindClient)
+	sc := span.SpanContext()
+	sc.TraceState = "vendor=value"
+	tracing.Inject(req, sc)
+	tracing.Inject(req, sc)
+
+	if hdrs := req.GetHeaders(tracing.TraceParentHeader); len(hdrs) != 1 {
+		t.Fatalf("expected 1 traceparent header, but got %d", len(hdrs))
+	}
+
+	extracted, ok := tracing.Extract(req)
+	if !ok {
+		t.Fatal("span context not extracted")
+	}
+	if extracted.TraceID != sc.TraceID || extracted.SpanID != sc.SpanID || extracted.TraceState != sc.TraceState {
+		t.Errorf("expected %s, but got %s", sc, extracted)
+	}
+	if !extracted.Remote {
+		t.Errorf("extracted span context should be remote")
+	}
+}
@@ -33,7 +33,7 @@ type clientTx struct {
 	closeOnce sync.Once
 }
 
-func NewClientTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (ClientTx, error) {
+func NewClientTx(origin sip.Request, tpl sip.Transport, logger log.Logger, options ...TxOption) (ClientTx, error) {
 	origin = prepareClientRequest(origin)
 	key, err := MakeClientTxKey(origin)
 	if err != nil {
@@ -43,6 +43,7 @@ func NewClientTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (Clie
 	tx := new(clientTx)
 	tx.key = key
 	tx.tpl = tpl
+	tx.applyOptions(options)
 	// buffer chan - about ~10 retransmit responses
 	tx.responses = make(chan sip.Response, 64)
 	tx.errs = make(chan error, 64)
@@ -89,6 +90,10 @@ func prepareClientRequest(origin sip.Request) sip.Request {
 func (tx *clientTx) Init() error {
 	tx.initFSM()
 
+	if tx.observer != nil {
+		tx.observer.TxCreated(tx)
+	}
+
 	if err := tx.tpl.Send(tx.Origin()); err != nil {
 		tx.mu.Lock()
 		tx.lastErr = err
@@ -113,12 +118,12 @@ func (tx *clientTx) Init() error {
 		// If a reliable transport is being used, the client transaction SHOULD NOT
 		// start timer A (Timer A controls request retransmissions).
 		// Timer A - retransmission
-		tx.Log().Tracef("timer_a set to %v", Timer_A)
+		tx.Log().Tracef("timer_a set to %v", tx.timings.T1)
 
 		tx.mu.Lock()
-		tx.timer_a_time = Timer_A
+		tx.timer_a_time = tx.timings.T1
 
-		tx.timer_a = timing.AfterFunc(tx.timer_a_time, func() {
+		tx.timer_a = tx.clock.AfterFunc(tx.timer_a_time, func() {
 			select {
 			case <-tx.done:
 				return
@@ -133,16 +138,26 @@ func (tx *clientTx) Init() error {
 			}
 			tx.fsmMu.RUnlock()
 		})
-		// Timer D is set to 32 seconds for unreliable transports
-		tx.timer_d_time = Timer_D
+		// Timer D is set to 32 seconds for unreliable transports,
+		// Timer K - to T4 seconds.
+		if tx.Origin().IsInvite() {
+			tx.timer_d_time = tx.timings.TimerD
+		} else {
+			tx.timer_d_time = tx.timings.TimerK
+		}
 		tx.mu.Unlock()
 	}
 
-	// Timer B - timeout
-	tx.Log().Tracef("timer_b set to %v", Timer_B)
+	// Timer B (Timer F for non-INVITE) - timeout
+	timeout := tx.timings.TimerB
+	if !tx.Origin().IsInvite() {
+		timeout = tx.timings.TimerF
+	}
+
+	tx.Log().Tracef("timer_b set to %v", timeout)
 
 	tx.mu.Lock()
-	tx.timer_b = timing.AfterFunc(Timer_B, func() {
+	tx.timer_b = tx.clock.AfterFunc(timeout, func() {
 		select {
 		case <-tx.done:
 			return
@@ -203,6 +218,13 @@ func (tx *clientTx) Receive(msg sip.Message) error {
 	return tx.fsm.Spin(input)
 }
 
+func (tx *clientTx) lastResponse() sip.Response {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	return tx.lastResp
+}
+
 func (tx *clientTx) Responses() <-chan sip.Response {
 	return tx.responses
 }
@@ -324,6 +346,7 @@ func (tx *clientTx) initFSM() {
 	}
 }
 
+// Timers driving the FSM transitions are described in Timings.
 func (tx *clientTx) initInviteFSM() {
 	tx.Log().Debug("initialising INVITE transaction FSM")
 
@@ -410,13 +433,13 @@ func (tx *clientTx) initInviteFSM() {
 		},
 	}
 
-	fsm_, err := fsm.Define(
+	fsm_, err := fsm.Define(observeStates(tx, tx.observer, clientStateNames,
 		client_state_def_calling,
 		client_state_def_proceeding,
 		client_state_def_completed,
 		client_state_def_accepted,
 		client_state_def_terminated,
-	)
+	)...)
 
 	if err != nil {
 		tx.Log().Errorf("define INVITE transaction FSM failed: %s", err)
@@ -490,12 +513,12 @@ func (tx *clientTx) initNonInviteFSM() {
 		},
 	}
 
-	fsm_, err := fsm.Define(
+	fsm_, err := fsm.Define(observeStates(tx, tx.observer, clientStateNames,
 		client_state_def_calling,
 		client_state_def_proceeding,
 		client_state_def_completed,
 		client_state_def_terminated,
-	)
+	)...)
 
 	if err != nil {
 		tx.Log().Errorf("define non-INVITE transaction FSM failed: %s", err)
@@ -517,6 +540,10 @@ func (tx *clientTx) resend() {
 
 	tx.Log().Debug("resend origin request")
 
+	if tx.observer != nil {
+		tx.observer.TxRetransmitted(tx, tx.Origin())
+	}
+
 	err := tx.tpl.Send(tx.Origin())
 
 	tx.mu.Lock()
@@ -561,6 +588,10 @@ func (tx *clientTx) transportErr() {
 		fmt.Sprintf("%p", tx),
 	}
 
+	tx.mu.Lock()
+	tx.termErr = err
+	tx.mu.Unlock()
+
 	select {
 	case <-tx.done:
 	case tx.errs <- err:
@@ -577,6 +608,10 @@ func (tx *clientTx) timeoutErr() {
 		fmt.Sprintf("%p", tx),
 	}
 
+	tx.mu.Lock()
+	tx.termErr = err
+	tx.mu.Unlock()
+
 	select {
 	case <-tx.done:
 	case tx.errs <- err:
@@ -593,6 +628,14 @@ func (tx *clientTx) delete() {
 	defer func() { recover() }()
 
 	tx.closeOnce.Do(func() {
+		if tx.observer != nil {
+			tx.mu.RLock()
+			termErr := tx.termErr
+			tx.mu.RUnlock()
+
+			tx.observer.TxTerminated(tx, termErr)
+		}
+
 		tx.mu.Lock()
 
 		close(tx.done)
@@ -653,8 +696,8 @@ func (tx *clientTx) act_non_invite_resend() fsm.Input {
 
 	tx.timer_a_time *= 2
 	// For non-INVITE, cap timer A at T2 seconds.
-	if tx.timer_a_time > T2 {
-		tx.timer_a_time = T2
+	if tx.timer_a_time > tx.timings.T2 {
+		tx.timer_a_time = tx.timings.T2
 	}
 	tx.timer_a.Reset(tx.timer_a_time)
 
@@ -722,7 +765,7 @@ func (tx *clientTx) act_invite_final() fsm.Input {
 
 	tx.Log().Tracef("timer_d set to %v", tx.timer_d_time)
 
-	tx.timer_d = timing.AfterFunc(tx.timer_d_time, func() {
+	tx.timer_d = tx.clock.AfterFunc(tx.timer_d_time, func() {
 		select {
 		case <-tx.done:
 			return
@@ -761,7 +804,7 @@ func (tx *clientTx) act_non_invite_final() fsm.Input {
 
 	tx.Log().Tracef("timer_d set to %v", tx.timer_d_time)
 
-	tx.timer_d = timing.AfterFunc(tx.timer_d_time, func() {
+	tx.timer_d = tx.clock.AfterFunc(tx.timer_d_time, func() {
 		select {
 		case <-tx.done:
 			return
@@ -795,13 +838,13 @@ func (tx *clientTx) act_cancel_timeout() fsm.Input {
 
 	tx.cancel()
 
-	tx.Log().Tracef("timer_b set to %v", Timer_B)
+	tx.Log().Tracef("timer_b set to %v", tx.timings.TimerB)
 
 	tx.mu.Lock()
 	if tx.timer_b != nil {
 		tx.timer_b.Stop()
 	}
-	tx.timer_b = timing.AfterFunc(Timer_B, func() {
+	tx.timer_b = tx.clock.AfterFunc(tx.timings.TimerB, func() {
 		select {
 		case <-tx.done:
 			return
@@ -896,9 +939,9 @@ func (tx *clientTx) act_passup_accept() fsm.Input {
 		tx.timer_b = nil
 	}
 
-	tx.Log().Tracef("timer_m set to %v", Timer_M)
+	tx.Log().Tracef("timer_m set to %v", tx.timings.TimerM)
 
-	tx.timer_m = timing.AfterFunc(Timer_M, func() {
+	tx.timer_m = tx.clock.AfterFunc(tx.timings.TimerM, func() {
 		select {
 		case <-tx.done:
 			return
@@ -9,20 +9,23 @@ import (
 
 	"github.com/ghettovoice/gosip/sip"
 	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/timing"
 	"github.com/ghettovoice/gosip/transaction"
 )
 
 var _ = Describe("ClientTx", func() {
 	var (
-		tpl *testutils.MockTransportLayer
-		txl transaction.Layer
+		tpl   *testutils.MockTransportLayer
+		txl   transaction.Layer
+		clock *timing.FakeClock
 	)
 
 	clientAddr := "localhost:9001"
 
 	BeforeEach(func() {
 		tpl = testutils.NewMockTransportLayer()
-		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger())
+		clock = timing.NewFakeClock(time.Unix(0, 0))
+		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger(), transaction.WithClock(clock))
 	})
 	AfterEach(func(done Done) {
 		txl.Cancel()
@@ -98,11 +101,11 @@ var _ = Describe("ClientTx", func() {
 		})
 
 		It("should send INVITE request", func(done Done) {
+			defer close(done)
+
+			sent := make(chan sip.Message, 1)
 			go func() {
-				defer close(done)
-				msg := <-tpl.OutMsgs
-				Expect(msg).ToNot(BeNil())
-				Expect(msg.String()).To(Equal(invite.String()))
+				sent <- <-tpl.OutMsgs
 			}()
 
 			_, err = transaction.MakeClientTxKey(invite)
@@ -110,11 +113,17 @@ var _ = Describe("ClientTx", func() {
 			_, err = transaction.MakeClientTxKey(ack)
 			Expect(err).ToNot(HaveOccurred())
 
+			// the spec must not finish before Request returns,
+			// otherwise the layer is canceled under the lock
 			mu.Lock()
 			tx, err = txl.Request(invite.(sip.Request))
+			mu.Unlock()
 			Expect(tx).ToNot(BeNil())
 			Expect(err).ToNot(HaveOccurred())
-			mu.Unlock()
+
+			msg := <-sent
+			Expect(msg).ToNot(BeNil())
+			Expect(msg.String()).To(Equal(invite.String()))
 		})
 
 		Context("receives 200 OK on INVITE", func() {
@@ -136,9 +145,9 @@ var _ = Describe("ClientTx", func() {
 
 				mu.Lock()
 				tx, err = txl.Request(invite.(sip.Request))
+				mu.Unlock()
 				Expect(tx).ToNot(BeNil())
 				Expect(err).ToNot(HaveOccurred())
-				mu.Unlock()
 			})
 			AfterEach(func(done Done) {
 				defer close(done)
@@ -187,9 +196,9 @@ var _ = Describe("ClientTx", func() {
 
 				mu.Lock()
 				tx, err = txl.Request(invite.(sip.Request))
+				mu.Unlock()
 				Expect(tx).ToNot(BeNil())
 				Expect(err).ToNot(HaveOccurred())
-				mu.Unlock()
 			})
 			AfterEach(func(done Done) {
 				defer close(done)
@@ -244,9 +253,9 @@ var _ = Describe("ClientTx", func() {
 
 				mu.Lock()
 				tx, err = txl.Request(invite.(sip.Request))
+				mu.Unlock()
 				Expect(tx).ToNot(BeNil())
 				Expect(err).ToNot(HaveOccurred())
-				mu.Unlock()
 			})
 			AfterEach(func(done Done) {
 				defer close(done)
@@ -270,4 +279,43 @@ var _ = Describe("ClientTx", func() {
 			})
 		})
 	})
+
+	Context("sends OPTIONS request with custom timings", func() {
+		var options sip.Request
+
+		BeforeEach(func() {
+			options = testutils.Request([]string{
+				"OPTIONS sip:bob@example.com SIP/2.0",
+				"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+				"CSeq: 1 OPTIONS",
+				"",
+				"",
+			})
+		})
+
+		It("should time out after Timer F", func(done Done) {
+			defer close(done)
+
+			go func() {
+				msg := <-tpl.OutMsgs
+				Expect(msg).ToNot(BeNil())
+			}()
+
+			tx, err := txl.Request(options, transaction.WithTimings(transaction.Timings{
+				T1:     10 * time.Millisecond,
+				TimerF: 100 * time.Millisecond,
+			}))
+			Expect(err).ToNot(HaveOccurred())
+
+			clock.Advance(99 * time.Millisecond)
+			Consistently(tx.Errors(), 50*time.Millisecond).ShouldNot(Receive())
+
+			clock.Advance(time.Millisecond)
+			err = <-tx.Errors()
+			Expect(err).To(HaveOccurred())
+			txErr, ok := err.(transaction.TxError)
+			Expect(ok).To(BeTrue())
+			Expect(txErr.Timeout()).To(BeTrue())
+		})
+	})
 })
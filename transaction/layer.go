@@ -6,6 +6,7 @@ import (
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
 )
 
 // Layer serves client and server transactions.
@@ -13,7 +14,7 @@ type Layer interface {
 	Cancel()
 	Done() <-chan struct{}
 	String() string
-	Request(req sip.Request) (sip.ClientTransaction, error)
+	Request(req sip.Request, options ...TxOption) (sip.ClientTransaction, error)
 	Respond(res sip.Response) (sip.ServerTransaction, error)
 	Transport() sip.Transport
 	// Requests returns channel with new incoming server transactions.
@@ -31,6 +32,10 @@ type layer struct {
 	acks         chan sip.Request
 	responses    chan sip.Response
 	transactions *transactionStore
+	timings      Timings
+	observer     Observer
+	clock        timing.Clock
+	admit        func(req sip.Request) bool
 
 	errs     chan error
 	done     chan struct{}
@@ -43,10 +48,21 @@ type layer struct {
 	log log.Logger
 }
 
-func NewLayer(tpl sip.Transport, logger log.Logger) Layer {
+func NewLayer(tpl sip.Transport, logger log.Logger, options ...LayerOption) Layer {
+	optsHash := &LayerOptions{
+		Clock: timing.NewRealClock(),
+	}
+	for _, opt := range options {
+		opt.ApplyLayer(optsHash)
+	}
+
 	txl := &layer{
 		tpl:          tpl,
 		transactions: newTransactionStore(),
+		timings:      optsHash.Timings,
+		observer:     optsHash.Observer,
+		clock:        optsHash.Clock,
+		admit:        optsHash.Admit,
 
 		requests:  make(chan sip.ServerTransaction),
 		acks:      make(chan sip.Request),
@@ -118,7 +134,7 @@ func (txl *layer) Transport() sip.Transport {
 	return txl.tpl
 }
 
-func (txl *layer) Request(req sip.Request) (sip.ClientTransaction, error) {
+func (txl *layer) Request(req sip.Request, options ...TxOption) (sip.ClientTransaction, error) {
 	select {
 	case <-txl.canceled:
 		return nil, fmt.Errorf("transaction layer is canceled")
@@ -129,7 +145,9 @@ func (txl *layer) Request(req sip.Request) (sip.ClientTransaction, error) {
 		return nil, fmt.Errorf("ACK request must be sent directly through transport")
 	}
 
-	tx, err := NewClientTx(req, txl.tpl, txl.Log())
+	options = append([]TxOption{WithTimings(txl.timings), WithObserver(txl.observer), WithClock(txl.clock)}, options...)
+
+	tx, err := NewClientTx(req, txl.tpl, txl.Log(), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -283,8 +301,13 @@ func (txl *layer) handleRequest(req sip.Request, logger log.Logger) {
 		}
 		return
 	}
+	if txl.admit != nil && !txl.admit(req) {
+		logger.Debug("SIP request is not admitted, discard it")
+
+		return
+	}
 
-	tx, err = NewServerTx(req, txl.tpl, txl.Log())
+	tx, err = NewServerTx(req, txl.tpl, txl.Log(), WithTimings(txl.timings), WithObserver(txl.observer), WithClock(txl.clock))
 	if err != nil {
 		logger.Error(err)
 
@@ -0,0 +1,280 @@
+package transaction
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// DefaultLatencyBuckets are upper bounds (in seconds) of the response latency histogram buckets.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 32}
+
+// Metrics is an Observer that collects Prometheus-style transaction metrics:
+//   - gosip_transactions_created_total{kind,method} - counter of created transactions;
+//   - gosip_transactions_active{kind,method} - gauge of alive transactions;
+//   - gosip_transaction_retransmissions_total{kind,method} - counter of retransmissions fired by timers;
+//   - gosip_transactions_terminated_total{kind,method,reason} - counter of terminated transactions,
+//     reason is one of "ok", "timeout", "transport";
+//   - gosip_transaction_response_duration_seconds{kind,method} - histogram of time between
+//     transaction creation and final response.
+//
+// kind label is "client" or "server".
+// Collected metrics are exposed in the Prometheus text format by WritePrometheus.
+type Metrics struct {
+	buckets []float64
+	now     func() time.Time
+
+	mu              sync.Mutex
+	created         map[metricLabels]uint64
+	active          map[metricLabels]int64
+	retransmissions map[metricLabels]uint64
+	terminated      map[metricLabels]uint64
+	latency         map[metricLabels]*histogram
+	started         map[Tx]time.Time
+}
+
+type metricLabels struct {
+	kind   string
+	method string
+	reason string
+}
+
+func (l metricLabels) String() string {
+	labels := []string{
+		fmt.Sprintf("kind=%q", l.kind),
+		fmt.Sprintf("method=%q", l.method),
+	}
+	if l.reason != "" {
+		labels = append(labels, fmt.Sprintf("reason=%q", l.reason))
+	}
+
+	return strings.Join(labels, ",")
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewMetrics creates transaction metrics collector.
+// Latency histogram uses DefaultLatencyBuckets if buckets are omitted.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		buckets:         buckets,
+		now:             time.Now,
+		created:         make(map[metricLabels]uint64),
+		active:          make(map[metricLabels]int64),
+		retransmissions: make(map[metricLabels]uint64),
+		terminated:      make(map[metricLabels]uint64),
+		latency:         make(map[metricLabels]*histogram),
+		started:         make(map[Tx]time.Time),
+	}
+}
+
+// SetNowFunc replaces the time source used to measure response latency.
+func (m *Metrics) SetNowFunc(now func() time.Time) {
+	m.mu.Lock()
+	m.now = now
+	m.mu.Unlock()
+}
+
+func (m *Metrics) TxCreated(tx Tx) {
+	labels := txLabels(tx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.created[labels]++
+	m.active[labels]++
+	m.started[tx] = m.now()
+}
+
+func (m *Metrics) TxStateChanged(tx Tx, from, to string) {
+	if to != "completed" && to != "accepted" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start, ok := m.started[tx]
+	if !ok {
+		return
+	}
+	// only the first final response is measured
+	delete(m.started, tx)
+
+	labels := txLabels(tx)
+	h, ok := m.latency[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[labels] = h
+	}
+
+	v := m.now().Sub(start).Seconds()
+	for i, bound := range m.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (m *Metrics) TxRetransmitted(tx Tx, msg sip.Message) {
+	labels := txLabels(tx)
+
+	m.mu.Lock()
+	m.retransmissions[labels]++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) TxTerminated(tx Tx, err error) {
+	labels := txLabels(tx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.started, tx)
+	m.active[labels]--
+
+	labels.reason = "ok"
+	if txErr, ok := err.(TxError); ok {
+		switch {
+		case txErr.Timeout():
+			labels.reason = "timeout"
+		case txErr.Transport():
+			labels.reason = "transport"
+		}
+	}
+	m.terminated[labels]++
+}
+
+// Created returns number of created transactions.
+func (m *Metrics) Created(kind string, method sip.RequestMethod) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.created[metricLabels{kind: kind, method: string(method)}]
+}
+
+// Active returns number of alive transactions.
+func (m *Metrics) Active(kind string, method sip.RequestMethod) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.active[metricLabels{kind: kind, method: string(method)}]
+}
+
+// Retransmissions returns number of retransmissions fired by timers.
+func (m *Metrics) Retransmissions(kind string, method sip.RequestMethod) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.retransmissions[metricLabels{kind: kind, method: string(method)}]
+}
+
+// Terminated returns number of terminated transactions with the reason: "ok", "timeout" or "transport".
+func (m *Metrics) Terminated(kind string, method sip.RequestMethod, reason string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.terminated[metricLabels{kind: kind, method: string(method), reason: reason}]
+}
+
+// WritePrometheus writes metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP gosip_transactions_created_total Number of created SIP transactions.\n")
+	b.WriteString("# TYPE gosip_transactions_created_total counter\n")
+	for _, labels := range sortedLabels(m.created) {
+		fmt.Fprintf(&b, "gosip_transactions_created_total{%s} %d\n", labels, m.created[labels])
+	}
+
+	b.WriteString("# HELP gosip_transactions_active Number of alive SIP transactions.\n")
+	b.WriteString("# TYPE gosip_transactions_active gauge\n")
+	for _, labels := range sortedLabels(m.active) {
+		fmt.Fprintf(&b, "gosip_transactions_active{%s} %d\n", labels, m.active[labels])
+	}
+
+	b.WriteString("# HELP gosip_transaction_retransmissions_total Number of SIP message retransmissions.\n")
+	b.WriteString("# TYPE gosip_transaction_retransmissions_total counter\n")
+	for _, labels := range sortedLabels(m.retransmissions) {
+		fmt.Fprintf(&b, "gosip_transaction_retransmissions_total{%s} %d\n", labels, m.retransmissions[labels])
+	}
+
+	b.WriteString("# HELP gosip_transactions_terminated_total Number of terminated SIP transactions.\n")
+	b.WriteString("# TYPE gosip_transactions_terminated_total counter\n")
+	for _, labels := range sortedLabels(m.terminated) {
+		fmt.Fprintf(&b, "gosip_transactions_terminated_total{%s} %d\n", labels, m.terminated[labels])
+	}
+
+	b.WriteString("# HELP gosip_transaction_response_duration_seconds Time to the final response.\n")
+	b.WriteString("# TYPE gosip_transaction_response_duration_seconds histogram\n")
+	for _, labels := range sortedLabels(m.latency) {
+		h := m.latency[labels]
+		for i, bound := range m.buckets {
+			fmt.Fprintf(&b, "gosip_transaction_response_duration_seconds_bucket{%s,le=\"%g\"} %d\n",
+				labels, bound, h.counts[i])
+		}
+		fmt.Fprintf(&b, "gosip_transaction_response_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "gosip_transaction_response_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(&b, "gosip_transaction_response_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func txLabels(tx Tx) metricLabels {
+	labels := metricLabels{
+		kind:   "server",
+		method: string(tx.Origin().Method()),
+	}
+	if _, ok := tx.(ClientTx); ok {
+		labels.kind = "client"
+	}
+
+	return labels
+}
+
+func sortedLabels(m interface{}) []metricLabels {
+	labels := make([]metricLabels, 0)
+	switch m := m.(type) {
+	case map[metricLabels]uint64:
+		for l := range m {
+			labels = append(labels, l)
+		}
+	case map[metricLabels]int64:
+		for l := range m {
+			labels = append(labels, l)
+		}
+	case map[metricLabels]*histogram:
+		for l := range m {
+			labels = append(labels, l)
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].String() < labels[j].String()
+	})
+
+	return labels
+}
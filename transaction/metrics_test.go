@@ -0,0 +1,107 @@
+package transaction_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		tpl     *testutils.MockTransportLayer
+		metrics *transaction.Metrics
+		now     time.Time
+	)
+
+	clientAddr := "localhost:9001"
+	request := func(method string) sip.Request {
+		return testutils.Request([]string{
+			method + " sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + sip.GenerateBranch(),
+			"CSeq: 1 " + method,
+			"",
+			"",
+		})
+	}
+
+	BeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		now = time.Unix(0, 0)
+		metrics = transaction.NewMetrics(0.1, 1)
+		metrics.SetNowFunc(func() time.Time { return now })
+	})
+
+	It("should count transaction events", func() {
+		tx, err := transaction.NewClientTx(request("INVITE"), tpl, testutils.NewLogrusLogger())
+		Expect(err).ToNot(HaveOccurred())
+
+		metrics.TxCreated(tx)
+		Expect(metrics.Created("client", sip.INVITE)).To(Equal(uint64(1)))
+		Expect(metrics.Active("client", sip.INVITE)).To(Equal(int64(1)))
+
+		metrics.TxRetransmitted(tx, tx.Origin())
+		metrics.TxRetransmitted(tx, tx.Origin())
+		Expect(metrics.Retransmissions("client", sip.INVITE)).To(Equal(uint64(2)))
+
+		now = now.Add(500 * time.Millisecond)
+		metrics.TxStateChanged(tx, "calling", "proceeding")
+		metrics.TxStateChanged(tx, "proceeding", "completed")
+		metrics.TxTerminated(tx, &transaction.TxTimeoutError{TxKey: tx.Key()})
+		Expect(metrics.Active("client", sip.INVITE)).To(Equal(int64(0)))
+		Expect(metrics.Terminated("client", sip.INVITE, "timeout")).To(Equal(uint64(1)))
+
+		buf := new(bytes.Buffer)
+		Expect(metrics.WritePrometheus(buf)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring(
+			`gosip_transactions_created_total{kind="client",method="INVITE"} 1`))
+		Expect(buf.String()).To(ContainSubstring(
+			`gosip_transaction_retransmissions_total{kind="client",method="INVITE"} 2`))
+		Expect(buf.String()).To(ContainSubstring(
+			`gosip_transactions_terminated_total{kind="client",method="INVITE",reason="timeout"} 1`))
+		Expect(buf.String()).To(ContainSubstring(
+			`gosip_transaction_response_duration_seconds_bucket{kind="client",method="INVITE",le="0.1"} 0`))
+		Expect(buf.String()).To(ContainSubstring(
+			`gosip_transaction_response_duration_seconds_bucket{kind="client",method="INVITE",le="1"} 1`))
+		Expect(buf.String()).To(ContainSubstring(
+			`gosip_transaction_response_duration_seconds_sum{kind="client",method="INVITE"} 0.5`))
+	})
+
+	It("should observe transactions of the layer", func(done Done) {
+		defer close(done)
+
+		clock := timing.NewFakeClock(time.Unix(0, 0))
+		txl := transaction.NewLayer(tpl, testutils.NewLogrusLogger(),
+			transaction.WithClock(clock),
+			transaction.WithObserver(metrics),
+			transaction.WithTimings(transaction.Timings{
+				T1:     10 * time.Millisecond,
+				TimerF: 50 * time.Millisecond,
+			}),
+		)
+		defer func() {
+			txl.Cancel()
+			<-txl.Done()
+		}()
+
+		go func() {
+			<-tpl.OutMsgs
+		}()
+
+		tx, err := txl.Request(request("OPTIONS"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metrics.Created("client", sip.OPTIONS)).To(Equal(uint64(1)))
+
+		clock.Advance(50 * time.Millisecond)
+		<-tx.Errors()
+		<-tx.Done()
+		Expect(metrics.Terminated("client", sip.OPTIONS, "timeout")).To(Equal(uint64(1)))
+		Expect(metrics.Active("client", sip.OPTIONS)).To(Equal(int64(0)))
+	})
+})
@@ -0,0 +1,96 @@
+package transaction
+
+import (
+	"github.com/discoviking/fsm"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// Observer receives transaction lifecycle events.
+// Methods are called synchronously from the transaction FSM,
+// so implementations should be fast and must not call back into the transaction.
+type Observer interface {
+	// TxCreated is called when the transaction is initialised.
+	TxCreated(tx Tx)
+	// TxStateChanged is called on every FSM transition to a different state.
+	TxStateChanged(tx Tx, from, to string)
+	// TxRetransmitted is called when the transaction retransmits message on timer (Timer A, Timer G).
+	TxRetransmitted(tx Tx, msg sip.Message)
+	// TxTerminated is called once when the transaction is done.
+	// err is a TxTimeoutError or a TxTransportError if the transaction failed, nil otherwise.
+	TxTerminated(tx Tx, err error)
+}
+
+// Observers combines several observers into one.
+func Observers(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+type multiObserver []Observer
+
+func (obs multiObserver) TxCreated(tx Tx) {
+	for _, o := range obs {
+		o.TxCreated(tx)
+	}
+}
+
+func (obs multiObserver) TxStateChanged(tx Tx, from, to string) {
+	for _, o := range obs {
+		o.TxStateChanged(tx, from, to)
+	}
+}
+
+func (obs multiObserver) TxRetransmitted(tx Tx, msg sip.Message) {
+	for _, o := range obs {
+		o.TxRetransmitted(tx, msg)
+	}
+}
+
+func (obs multiObserver) TxTerminated(tx Tx, err error) {
+	for _, o := range obs {
+		o.TxTerminated(tx, err)
+	}
+}
+
+var clientStateNames = map[int]string{
+	client_state_calling:    "calling",
+	client_state_proceeding: "proceeding",
+	client_state_completed:  "completed",
+	client_state_accepted:   "accepted",
+	client_state_terminated: "terminated",
+}
+
+var serverStateNames = map[int]string{
+	server_state_trying:     "trying",
+	server_state_proceeding: "proceeding",
+	server_state_completed:  "completed",
+	server_state_confirmed:  "confirmed",
+	server_state_accepted:   "accepted",
+	server_state_terminated: "terminated",
+}
+
+// observeStates wraps FSM actions to report state transitions to the observer.
+func observeStates(tx Tx, observer Observer, names map[int]string, states ...fsm.State) []fsm.State {
+	if observer == nil {
+		return states
+	}
+
+	for _, state := range states {
+		from := state.Index
+		for input, outcome := range state.Outcomes {
+			to, action := outcome.State, outcome.Action
+			state.Outcomes[input] = fsm.Outcome{
+				State: to,
+				Action: func() fsm.Input {
+					if from != to {
+						observer.TxStateChanged(tx, names[from], names[to])
+					}
+
+					return action()
+				},
+			}
+		}
+	}
+
+	return states
+}
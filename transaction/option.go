@@ -0,0 +1,110 @@
+package transaction
+
+import (
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// Layer constructor options
+type LayerOption interface {
+	ApplyLayer(opts *LayerOptions)
+}
+
+type LayerOptions struct {
+	Timings  Timings
+	Observer Observer
+	Clock    timing.Clock
+	Admit    func(req sip.Request) bool
+}
+
+// Transaction constructor options
+type TxOption interface {
+	ApplyTx(opts *TxOptions)
+}
+
+type TxOptions struct {
+	Timings  Timings
+	Observer Observer
+	Clock    timing.Clock
+}
+
+// WithTimings sets transaction timers.
+// Being passed to NewLayer it sets timers of all transactions created by the layer,
+// being passed to Layer.Request it overrides non-zero timers for the single client transaction,
+// other timers keep the layer values. Timers that are set neither for the layer nor for the request
+// are derived from the resulting T1, T2 and T4.
+func WithTimings(timings Timings) interface {
+	LayerOption
+	TxOption
+} {
+	return withTimings{timings}
+}
+
+type withTimings struct {
+	timings Timings
+}
+
+// Timings are kept as configured and normalized by the transaction,
+// so that derived timers follow T1 of the per-request override.
+func (o withTimings) ApplyLayer(opts *LayerOptions) {
+	opts.Timings = o.timings
+}
+
+func (o withTimings) ApplyTx(opts *TxOptions) {
+	opts.Timings = opts.Timings.Merge(o.timings)
+}
+
+// WithObserver sets observer of transaction lifecycle events.
+func WithObserver(observer Observer) interface {
+	LayerOption
+	TxOption
+} {
+	return withObserver{observer}
+}
+
+type withObserver struct {
+	observer Observer
+}
+
+func (o withObserver) ApplyLayer(opts *LayerOptions) {
+	opts.Observer = o.observer
+}
+
+func (o withObserver) ApplyTx(opts *TxOptions) {
+	opts.Observer = o.observer
+}
+
+// WithClock sets clock that drives transaction timers, default is the real clock.
+func WithClock(clock timing.Clock) interface {
+	LayerOption
+	TxOption
+} {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock timing.Clock
+}
+
+func (o withClock) ApplyLayer(opts *LayerOptions) {
+	opts.Clock = o.clock
+}
+
+func (o withClock) ApplyTx(opts *TxOptions) {
+	opts.Clock = o.clock
+}
+
+// WithAdmission sets the check of incoming requests that start new server transactions,
+// requests that are not admitted are discarded before the transaction is created.
+// Retransmissions, ACK and CANCEL requests are not checked.
+func WithAdmission(admit func(req sip.Request) bool) LayerOption {
+	return withAdmission{admit}
+}
+
+type withAdmission struct {
+	admit func(req sip.Request) bool
+}
+
+func (o withAdmission) ApplyLayer(opts *LayerOptions) {
+	opts.Admit = o.admit
+}
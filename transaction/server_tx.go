@@ -39,7 +39,7 @@ type serverTx struct {
 	closeOnce sync.Once
 }
 
-func NewServerTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (ServerTx, error) {
+func NewServerTx(origin sip.Request, tpl sip.Transport, logger log.Logger, options ...TxOption) (ServerTx, error) {
 	key, err := MakeServerTxKey(origin)
 	if err != nil {
 		return nil, err
@@ -48,6 +48,7 @@ func NewServerTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (Serv
 	tx := new(serverTx)
 	tx.key = key
 	tx.tpl = tpl
+	tx.applyOptions(options)
 	// about ~10 retransmits
 	tx.acks = make(chan sip.Request, 64)
 	tx.cancels = make(chan sip.Request, 64)
@@ -73,23 +74,27 @@ func NewServerTx(origin sip.Request, tpl sip.Transport, logger log.Logger) (Serv
 func (tx *serverTx) Init() error {
 	tx.initFSM()
 
+	if tx.observer != nil {
+		tx.observer.TxCreated(tx)
+	}
+
 	tx.mu.Lock()
 
 	if tx.reliable {
 		tx.timer_i_time = 0
 	} else {
-		tx.timer_g_time = Timer_G
-		tx.timer_i_time = Timer_I
+		tx.timer_g_time = tx.timings.T1
+		tx.timer_i_time = tx.timings.TimerI
 	}
 
 	tx.mu.Unlock()
 
 	// RFC 3261 - 17.2.1
 	if tx.Origin().IsInvite() {
-		tx.Log().Tracef("set timer_1xx to %v", Timer_1xx)
+		tx.Log().Tracef("set timer_1xx to %v", tx.timings.Timer1xx)
 
 		tx.mu.Lock()
-		tx.timer_1xx = timing.AfterFunc(Timer_1xx, func() {
+		tx.timer_1xx = tx.clock.AfterFunc(tx.timings.Timer1xx, func() {
 			select {
 			case <-tx.done:
 				return
@@ -190,6 +195,13 @@ func (tx *serverTx) Respond(res sip.Response) error {
 	return tx.fsm.Spin(input)
 }
 
+func (tx *serverTx) lastResponse() sip.Response {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+
+	return tx.lastResp
+}
+
 func (tx *serverTx) Acks() <-chan sip.Request {
 	return tx.acks
 }
@@ -244,6 +256,7 @@ func (tx *serverTx) initFSM() {
 	}
 }
 
+// Timers driving the FSM transitions are described in Timings.
 func (tx *serverTx) initInviteFSM() {
 	// Define States
 	tx.Log().Debug("initialising INVITE transaction FSM")
@@ -324,13 +337,13 @@ func (tx *serverTx) initInviteFSM() {
 	}
 
 	// Define FSM
-	fsm_, err := fsm.Define(
+	fsm_, err := fsm.Define(observeStates(tx, tx.observer, serverStateNames,
 		server_state_def_proceeding,
 		server_state_def_completed,
 		server_state_def_confirmed,
 		server_state_def_accepted,
 		server_state_def_terminated,
-	)
+	)...)
 	if err != nil {
 		tx.Log().Errorf("define INVITE transaction FSM failed: %s", err)
 
@@ -401,12 +414,12 @@ func (tx *serverTx) initNonInviteFSM() {
 	}
 
 	// Define FSM
-	fsm_, err := fsm.Define(
+	fsm_, err := fsm.Define(observeStates(tx, tx.observer, serverStateNames,
 		server_state_def_trying,
 		server_state_def_proceeding,
 		server_state_def_completed,
 		server_state_def_terminated,
-	)
+	)...)
 	if err != nil {
 		tx.Log().Errorf("define non-INVITE FSM failed: %s", err)
 
@@ -436,6 +449,10 @@ func (tx *serverTx) transportErr() {
 		fmt.Sprintf("%p", tx),
 	}
 
+	tx.mu.Lock()
+	tx.termErr = err
+	tx.mu.Unlock()
+
 	select {
 	case <-tx.done:
 	case tx.errs <- err:
@@ -452,6 +469,10 @@ func (tx *serverTx) timeoutErr() {
 		fmt.Sprintf("%p", tx),
 	}
 
+	tx.mu.Lock()
+	tx.termErr = err
+	tx.mu.Unlock()
+
 	select {
 	case <-tx.done:
 	case tx.errs <- err:
@@ -468,6 +489,14 @@ func (tx *serverTx) delete() {
 	defer func() { recover() }()
 
 	tx.closeOnce.Do(func() {
+		if tx.observer != nil {
+			tx.mu.RLock()
+			termErr := tx.termErr
+			tx.mu.RUnlock()
+
+			tx.observer.TxTerminated(tx, termErr)
+		}
+
 		tx.mu.Lock()
 
 		close(tx.done)
@@ -558,7 +587,7 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 		if tx.timer_g == nil {
 			tx.Log().Tracef("timer_g set to %v", tx.timer_g_time)
 
-			tx.timer_g = timing.AfterFunc(tx.timer_g_time, func() {
+			tx.timer_g = tx.clock.AfterFunc(tx.timer_g_time, func() {
 				select {
 				case <-tx.done:
 					return
@@ -575,12 +604,16 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 			})
 		} else {
 			tx.timer_g_time *= 2
-			if tx.timer_g_time > T2 {
-				tx.timer_g_time = T2
+			if tx.timer_g_time > tx.timings.T2 {
+				tx.timer_g_time = tx.timings.T2
 			}
 
 			tx.Log().Tracef("timer_g reset to %v", tx.timer_g_time)
 
+			if tx.observer != nil {
+				tx.observer.TxRetransmitted(tx, lastResp)
+			}
+
 			tx.timer_g.Reset(tx.timer_g_time)
 		}
 		tx.mu.Unlock()
@@ -588,9 +621,9 @@ func (tx *serverTx) act_respond_complete() fsm.Input {
 
 	tx.mu.Lock()
 	if tx.timer_h == nil {
-		tx.Log().Tracef("timer_h set to %v", Timer_H)
+		tx.Log().Tracef("timer_h set to %v", tx.timings.TimerH)
 
-		tx.timer_h = timing.AfterFunc(Timer_H, func() {
+		tx.timer_h = tx.clock.AfterFunc(tx.timings.TimerH, func() {
 			select {
 			case <-tx.done:
 				return
@@ -633,9 +666,9 @@ func (tx *serverTx) act_respond_accept() fsm.Input {
 	}
 
 	tx.mu.Lock()
-	tx.Log().Tracef("timer_l set to %v", Timer_L)
+	tx.Log().Tracef("timer_l set to %v", tx.timings.TimerL)
 
-	tx.timer_l = timing.AfterFunc(Timer_L, func() {
+	tx.timer_l = tx.clock.AfterFunc(tx.timings.TimerL, func() {
 		select {
 		case <-tx.done:
 			return
@@ -696,9 +729,9 @@ func (tx *serverTx) act_final() fsm.Input {
 
 	tx.mu.Lock()
 
-	tx.Log().Tracef("timer_j set to %v", Timer_J)
+	tx.Log().Tracef("timer_j set to %v", tx.timings.TimerJ)
 
-	tx.timer_j = timing.AfterFunc(Timer_J, func() {
+	tx.timer_j = tx.clock.AfterFunc(tx.timings.TimerJ, func() {
 		select {
 		case <-tx.done:
 			return
@@ -785,9 +818,9 @@ func (tx *serverTx) act_confirm() fsm.Input {
 		tx.timer_h = nil
 	}
 
-	tx.Log().Tracef("timer_i set to %v", Timer_I)
+	tx.Log().Tracef("timer_i set to %v", tx.timer_i_time)
 
-	tx.timer_i = timing.AfterFunc(Timer_I, func() {
+	tx.timer_i = tx.clock.AfterFunc(tx.timer_i_time, func() {
 		select {
 		case <-tx.done:
 			return
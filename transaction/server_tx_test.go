@@ -10,13 +10,15 @@ import (
 
 	"github.com/ghettovoice/gosip/sip"
 	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/timing"
 	"github.com/ghettovoice/gosip/transaction"
 )
 
 var _ = Describe("ServerTx", func() {
 	var (
-		tpl *testutils.MockTransportLayer
-		txl transaction.Layer
+		tpl   *testutils.MockTransportLayer
+		txl   transaction.Layer
+		clock *timing.FakeClock
 	)
 
 	// serverAddr := "localhost:8001"
@@ -24,7 +26,8 @@ var _ = Describe("ServerTx", func() {
 
 	BeforeEach(func() {
 		tpl = testutils.NewMockTransportLayer()
-		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger())
+		clock = timing.NewFakeClock(time.Unix(0, 0))
+		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger(), transaction.WithClock(clock))
 	})
 	AfterEach(func(done Done) {
 		txl.Cancel()
@@ -122,14 +125,17 @@ var _ = Describe("ServerTx", func() {
 
 				mu.Lock()
 				tx = <-txl.Requests()
-				Expect(tx).ToNot(BeNil())
 				mu.Unlock()
+				Expect(tx).ToNot(BeNil())
 			})
 
 			It("should send 100 Trying after Timer_1xx fired", func(done Done) {
 				defer close(done)
 
-				time.Sleep(transaction.Timer_1xx + time.Millisecond)
+				clock.Advance(transaction.Timer_1xx - time.Millisecond)
+				Consistently(tpl.OutMsgs, 50*time.Millisecond).ShouldNot(Receive())
+
+				clock.Advance(time.Millisecond)
 				By(fmt.Sprintf("UAC waits %s", trying.Short()))
 				msg := <-tpl.OutMsgs
 				Expect(msg).ToNot(BeNil())
@@ -137,18 +143,21 @@ var _ = Describe("ServerTx", func() {
 			})
 
 			It("should send in transaction", func(done Done) {
-				go func() {
-					defer close(done)
+				defer close(done)
 
-					By(fmt.Sprintf("UAC waits %s", ok.Short()))
-					msg := <-tpl.OutMsgs
-					Expect(msg).ToNot(BeNil())
-					Expect(msg.String()).To(Equal(ok.String()))
+				sent := make(chan sip.Message, 1)
+				go func() {
+					sent <- <-tpl.OutMsgs
 				}()
 
 				By(fmt.Sprintf("UAS sends %s", ok.Short()))
 				_, err := txl.Respond(ok.(sip.Response))
 				Expect(err).ToNot(HaveOccurred())
+
+				By(fmt.Sprintf("UAC waits %s", ok.Short()))
+				msg := <-sent
+				Expect(msg).ToNot(BeNil())
+				Expect(msg.String()).To(Equal(ok.String()))
 			})
 
 			Context("after 2xx OK was sent", func() {
@@ -204,9 +213,9 @@ var _ = Describe("ServerTx", func() {
 						By(fmt.Sprintf("UAS sends %s", notOk.Short()))
 						mu.Lock()
 						tx, err = txl.Respond(notOk.(sip.Response))
+						mu.Unlock()
 						Expect(tx).ToNot(BeNil())
 						Expect(err).To(BeNil())
-						mu.Unlock()
 					}()
 					go func() {
 						defer wg.Done()
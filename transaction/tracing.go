@@ -0,0 +1,114 @@
+package transaction
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/tracing"
+)
+
+// NewTracingObserver creates Observer that records a span for each transaction.
+//
+// Client transaction span becomes a child of the span context carried by the traceparent header
+// of the origin request, server transaction span - a child of the remote span context from the incoming request.
+// The traceparent header of the origin request is replaced with the transaction span context
+// before the request is sent (client) or passed up to the handler (server),
+// so the trace continues on the remote side and in the request handler.
+func NewTracingObserver(tracer tracing.Tracer) Observer {
+	return &tracingObserver{
+		tracer: tracer,
+		spans:  make(map[Tx]*txSpan),
+	}
+}
+
+type tracingObserver struct {
+	tracer tracing.Tracer
+	spans  map[Tx]*txSpan
+	mu     sync.Mutex
+}
+
+type txSpan struct {
+	span        tracing.Span
+	retransmits int
+}
+
+func (obs *tracingObserver) TxCreated(tx Tx) {
+	origin := tx.Origin()
+
+	kind := tracing.SpanKindServer
+	peer := origin.Source()
+	if _, ok := tx.(ClientTx); ok {
+		kind = tracing.SpanKindClient
+		peer = origin.Destination()
+	}
+
+	attrs := []tracing.Attribute{
+		tracing.String("sip.method", string(origin.Method())),
+		tracing.String("sip.transaction_key", string(tx.Key())),
+		tracing.String("sip.transport", origin.Transport()),
+		tracing.String("net.peer.addr", peer),
+	}
+	if callID, ok := origin.CallID(); ok {
+		attrs = append(attrs, tracing.String("sip.call_id", callID.Value()))
+	}
+
+	ctx := tracing.ContextFromMessage(context.Background(), origin)
+	_, span := obs.tracer.Start(ctx, "SIP "+string(origin.Method()), kind, attrs...)
+
+	tracing.Inject(origin, span.SpanContext())
+
+	obs.mu.Lock()
+	obs.spans[tx] = &txSpan{span: span}
+	obs.mu.Unlock()
+}
+
+func (obs *tracingObserver) TxStateChanged(tx Tx, from, to string) {
+	obs.mu.Lock()
+	s, ok := obs.spans[tx]
+	obs.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	s.span.AddEvent("state_changed",
+		tracing.String("sip.transaction_state.from", from),
+		tracing.String("sip.transaction_state.to", to),
+	)
+}
+
+func (obs *tracingObserver) TxRetransmitted(tx Tx, msg sip.Message) {
+	obs.mu.Lock()
+	s, ok := obs.spans[tx]
+	if ok {
+		s.retransmits++
+	}
+	obs.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	s.span.AddEvent("retransmitted", tracing.String("sip.message", msg.Short()))
+}
+
+func (obs *tracingObserver) TxTerminated(tx Tx, err error) {
+	obs.mu.Lock()
+	s, ok := obs.spans[tx]
+	delete(obs.spans, tx)
+	obs.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	s.span.SetAttributes(tracing.Int("sip.retransmits", s.retransmits))
+	if tx, ok := tx.(interface{ lastResponse() sip.Response }); ok {
+		if res := tx.lastResponse(); res != nil {
+			s.span.SetAttributes(tracing.Int("sip.status_code", int(res.StatusCode())))
+		}
+	}
+	s.span.RecordError(err)
+	s.span.End()
+}
@@ -0,0 +1,86 @@
+package transaction_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/tracing"
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("TracingObserver", func() {
+	var (
+		tpl      *testutils.MockTransportLayer
+		txl      transaction.Layer
+		exporter *tracing.InMemoryExporter
+	)
+
+	clientAddr := "localhost:9001"
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	BeforeEach(func() {
+		tpl = testutils.NewMockTransportLayer()
+		exporter = tracing.NewInMemoryExporter()
+		txl = transaction.NewLayer(tpl, testutils.NewLogrusLogger(),
+			transaction.WithObserver(transaction.NewTracingObserver(tracing.NewTracer(exporter))))
+	})
+	AfterEach(func(done Done) {
+		txl.Cancel()
+		<-txl.Done()
+		close(done)
+	}, 3)
+
+	It("should record client transaction span", func(done Done) {
+		defer close(done)
+
+		branch := sip.GenerateBranch()
+		options := testutils.Request([]string{
+			"OPTIONS sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+			"CSeq: 1 OPTIONS",
+			"Call-ID: qwerty",
+			"traceparent: " + traceParent,
+			"",
+			"",
+		})
+		ok := testutils.Response([]string{
+			"SIP/2.0 200 OK",
+			"Via: SIP/2.0/UDP " + clientAddr + ";branch=" + branch,
+			"CSeq: 1 OPTIONS",
+			"Call-ID: qwerty",
+			"",
+			"",
+		})
+
+		sent := make(chan sip.Message, 1)
+		go func() {
+			sent <- <-tpl.OutMsgs
+		}()
+
+		tx, err := txl.Request(options)
+		Expect(err).ToNot(HaveOccurred())
+		// respond only when the transaction is stored in the layer
+		msg := <-sent
+		tpl.InMsgs <- ok
+		Expect((<-tx.Responses()).StatusCode()).To(Equal(sip.StatusCode(200)))
+		<-tx.Done()
+
+		spans := exporter.SpansByName("SIP OPTIONS")
+		Expect(spans).To(HaveLen(1))
+		span := spans[0]
+		Expect(span.Kind).To(Equal(tracing.SpanKindClient))
+		Expect(span.Parent.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(span.Parent.SpanID.String()).To(Equal("00f067aa0ba902b7"))
+		statusCode, _ := span.Attribute("sip.status_code")
+		Expect(statusCode).To(Equal(200))
+		callID, _ := span.Attribute("sip.call_id")
+		Expect(callID).To(Equal("qwerty"))
+
+		// outgoing request continues trace from the transaction span
+		sc, found := tracing.Extract(msg)
+		Expect(found).To(BeTrue())
+		Expect(sc.SpanID).To(Equal(span.SpanContext.SpanID))
+	})
+})
@@ -29,6 +29,138 @@ const (
 	Timer_M   = 64 * T1
 )
 
+// Timings is a set of RFC 3261 transaction timers.
+// Zero values are derived from T1, T2 and T4 the same way as the package defaults,
+// so setting only T1 scales Timer A/B/E/F/G/H/J/L/M as well.
+//
+// Client transactions (client_tx.go):
+//   - T1 (Timer A) - INVITE/non-INVITE request retransmission in "calling"/"proceeding", unreliable transports only;
+//   - T2 - upper limit of the non-INVITE request retransmission interval;
+//   - TimerB - INVITE timeout in "calling", restarted on CANCEL in "proceeding";
+//   - TimerF - non-INVITE timeout in "trying"/"proceeding";
+//   - TimerD - INVITE "completed" -> "terminated", unreliable transports only;
+//   - TimerK - non-INVITE "completed" -> "terminated", unreliable transports only;
+//   - TimerM - INVITE "accepted" -> "terminated".
+//
+// Server transactions (server_tx.go):
+//   - Timer1xx - automatic "100 Trying" on INVITE;
+//   - T1 (Timer G) - INVITE final non-2xx response retransmission in "completed", unreliable transports only;
+//   - T2 - upper limit of the response retransmission interval;
+//   - TimerH - INVITE "completed" -> "terminated" when ACK is not received;
+//   - TimerI - INVITE "confirmed" -> "terminated", unreliable transports only;
+//   - TimerJ - non-INVITE "completed" -> "terminated";
+//   - TimerL - INVITE "accepted" -> "terminated".
+type Timings struct {
+	T1       time.Duration
+	T2       time.Duration
+	T4       time.Duration
+	TimerB   time.Duration
+	TimerD   time.Duration
+	TimerF   time.Duration
+	TimerH   time.Duration
+	TimerI   time.Duration
+	TimerJ   time.Duration
+	TimerK   time.Duration
+	TimerL   time.Duration
+	TimerM   time.Duration
+	Timer1xx time.Duration
+}
+
+// DefaultTimings returns timer values recommended by RFC 3261.
+func DefaultTimings() Timings {
+	return Timings{
+		T1:       T1,
+		T2:       T2,
+		T4:       T4,
+		TimerB:   Timer_B,
+		TimerD:   Timer_D,
+		TimerF:   Timer_F,
+		TimerH:   Timer_H,
+		TimerI:   Timer_I,
+		TimerJ:   Timer_J,
+		TimerK:   Timer_K,
+		TimerL:   Timer_L,
+		TimerM:   Timer_M,
+		Timer1xx: Timer_1xx,
+	}
+}
+
+// Merge returns timings with non-zero values of other replacing the own ones.
+func (t Timings) Merge(other Timings) Timings {
+	for _, timer := range []struct {
+		dst *time.Duration
+		src time.Duration
+	}{
+		{&t.T1, other.T1},
+		{&t.T2, other.T2},
+		{&t.T4, other.T4},
+		{&t.TimerB, other.TimerB},
+		{&t.TimerD, other.TimerD},
+		{&t.TimerF, other.TimerF},
+		{&t.TimerH, other.TimerH},
+		{&t.TimerI, other.TimerI},
+		{&t.TimerJ, other.TimerJ},
+		{&t.TimerK, other.TimerK},
+		{&t.TimerL, other.TimerL},
+		{&t.TimerM, other.TimerM},
+		{&t.Timer1xx, other.Timer1xx},
+	} {
+		if timer.src > 0 {
+			*timer.dst = timer.src
+		}
+	}
+
+	return t
+}
+
+// Normalize fills zero timer values with defaults derived from T1, T2 and T4.
+func (t Timings) Normalize() Timings {
+	if t.T1 <= 0 {
+		t.T1 = T1
+	}
+	if t.T2 <= 0 {
+		t.T2 = T2
+	}
+	if t.T4 <= 0 {
+		t.T4 = T4
+	}
+	if t.TimerB <= 0 {
+		t.TimerB = 64 * t.T1
+	}
+	if t.TimerD <= 0 {
+		t.TimerD = Timer_D
+		if t.TimerD < 64*t.T1 {
+			t.TimerD = 64 * t.T1
+		}
+	}
+	if t.TimerF <= 0 {
+		t.TimerF = 64 * t.T1
+	}
+	if t.TimerH <= 0 {
+		t.TimerH = 64 * t.T1
+	}
+	if t.TimerI <= 0 {
+		t.TimerI = t.T4
+	}
+	if t.TimerJ <= 0 {
+		t.TimerJ = 64 * t.T1
+	}
+	if t.TimerK <= 0 {
+		t.TimerK = t.T4
+	}
+	if t.TimerL <= 0 {
+		t.TimerL = 64 * t.T1
+	}
+	if t.TimerM <= 0 {
+		t.TimerM = 64 * t.T1
+	}
+	if t.Timer1xx <= 0 {
+		t.Timer1xx = Timer_1xx
+	}
+
+	return t
+}
+
 type TxError interface {
 	error
 	Key() TxKey
@@ -0,0 +1,58 @@
+package transaction_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/transaction"
+)
+
+var _ = Describe("Timings", func() {
+	It("should fallback to RFC 3261 defaults", func() {
+		Expect(transaction.Timings{}.Normalize()).To(Equal(transaction.DefaultTimings()))
+	})
+
+	It("should derive timers from T1 and T4", func() {
+		timings := transaction.Timings{
+			T1: 2 * time.Second,
+			T4: 10 * time.Second,
+		}.Normalize()
+
+		Expect(timings.TimerB).To(Equal(128 * time.Second))
+		Expect(timings.TimerF).To(Equal(128 * time.Second))
+		Expect(timings.TimerD).To(Equal(128 * time.Second))
+		Expect(timings.TimerI).To(Equal(10 * time.Second))
+		Expect(timings.TimerK).To(Equal(10 * time.Second))
+		Expect(timings.T2).To(Equal(transaction.T2))
+	})
+
+	It("should merge non-zero values", func() {
+		layer := transaction.Timings{T1: 100 * time.Millisecond, TimerH: time.Second}.Normalize()
+		timings := layer.Merge(transaction.Timings{T1: time.Second})
+
+		Expect(timings.T1).To(Equal(time.Second))
+		Expect(timings.TimerH).To(Equal(time.Second))
+		Expect(timings.TimerB).To(Equal(layer.TimerB))
+		Expect(timings.T2).To(Equal(layer.T2))
+	})
+
+	It("should derive per-request timers from the merged T1", func() {
+		timings := transaction.Timings{TimerH: time.Second}.
+			Merge(transaction.Timings{T1: 50 * time.Millisecond}).
+			Normalize()
+
+		Expect(timings.TimerB).To(Equal(64 * 50 * time.Millisecond))
+		Expect(timings.TimerF).To(Equal(64 * 50 * time.Millisecond))
+		Expect(timings.TimerJ).To(Equal(64 * 50 * time.Millisecond))
+		Expect(timings.TimerH).To(Equal(time.Second))
+	})
+
+	It("should keep explicit values", func() {
+		timings := transaction.Timings{TimerB: 3 * time.Second}.Normalize()
+
+		Expect(timings.TimerB).To(Equal(3 * time.Second))
+		Expect(timings.TimerF).To(Equal(transaction.Timer_F))
+	})
+})
@@ -8,6 +8,7 @@ import (
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
 )
 
 type TxKey = sip.TransactionKey
@@ -33,9 +34,13 @@ type commonTx struct {
 	origin   sip.Request
 	tpl      sip.Transport
 	lastResp sip.Response
+	timings  Timings
+	observer Observer
+	clock    timing.Clock
 
 	errs    chan error
 	lastErr error
+	termErr error
 	done    chan bool
 
 	log log.Logger
@@ -76,3 +81,16 @@ func (tx *commonTx) Errors() <-chan error {
 func (tx *commonTx) Done() <-chan bool {
 	return tx.done
 }
+
+func (tx *commonTx) applyOptions(options []TxOption) {
+	optsHash := &TxOptions{
+		Clock: timing.NewRealClock(),
+	}
+	for _, opt := range options {
+		opt.ApplyTx(optsHash)
+	}
+
+	tx.timings = optsHash.Timings.Normalize()
+	tx.observer = optsHash.Observer
+	tx.clock = optsHash.Clock
+}
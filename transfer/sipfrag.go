@@ -0,0 +1,32 @@
+package transfer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+)
+
+// SipFragContentType is the content type of NOTIFY bodies of the refer event package (RFC 3420).
+const SipFragContentType = "message/sipfrag;version=2.0"
+
+// NewSipFrag returns message/sipfrag body with the status line only.
+func NewSipFrag(code sip.StatusCode, reason string) string {
+	return fmt.Sprintf("SIP/2.0 %d %s\r\n", code, reason)
+}
+
+// ParseSipFrag returns status code and reason from the status line of message/sipfrag body.
+func ParseSipFrag(body string) (sip.StatusCode, string, error) {
+	line := body
+	if i := strings.IndexAny(body, "\r\n"); i != -1 {
+		line = body[:i]
+	}
+
+	_, code, reason, err := parser.ParseStatusLine(strings.TrimSpace(line))
+	if err != nil {
+		return 0, "", fmt.Errorf("parse sipfrag status line: %w", err)
+	}
+
+	return code, reason, nil
+}
@@ -0,0 +1,384 @@
+package transfer_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/transfer"
+)
+
+var logger = log.NewDefaultLogrusLogger()
+
+type response struct {
+	status  sip.StatusCode
+	headers []sip.Header
+}
+
+// fakeSender accepts all sent requests with the configured status and records everything.
+type fakeSender struct {
+	// methods that are not used by the tests panic
+	gosip.Sender
+
+	mu        sync.Mutex
+	status    sip.StatusCode
+	headers   []sip.Header
+	requests  []sip.Request
+	responses []response
+}
+
+func (s *fakeSender) RequestWithContext(
+	ctx context.Context,
+	request sip.Request,
+	options ...gosip.RequestWithContextOption,
+) (sip.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, request)
+	res := sip.NewResponseFromRequest("", request, s.status, "", "")
+	for _, header := range s.headers {
+		res.AppendHeader(header)
+	}
+	if s.status >= 300 {
+		return nil, sip.NewRequestError(uint(s.status), "", request, res)
+	}
+	return res, nil
+}
+
+func (s *fakeSender) RespondOnRequest(
+	request sip.Request,
+	status sip.StatusCode,
+	reason, body string,
+	headers []sip.Header,
+) (sip.ServerTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, response{status, headers})
+	return nil, nil
+}
+
+func (s *fakeSender) lastRequest(t *testing.T) sip.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.requests) == 0 {
+		t.Fatalf("no requests sent")
+	}
+	// deliver the request to the other side as it would be received from network
+	return parse(t, s.requests[len(s.requests)-1].String()).(sip.Request)
+}
+
+func (s *fakeSender) lastResponse(t *testing.T) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.responses) == 0 {
+		t.Fatalf("no responses sent")
+	}
+	return s.responses[len(s.responses)-1]
+}
+
+func parse(t *testing.T, data string) sip.Message {
+	msg, err := parser.ParseMessage([]byte(data), logger)
+	if err != nil {
+		t.Fatalf("failed to parse message: %s\n%s", err, data)
+	}
+	return msg
+}
+
+// dialogs returns both sides of the call established by INVITE from the first party to the second one.
+func dialogs(t *testing.T, callID, from, fromTag, to, toTag string) (*sip.Dialog, *sip.Dialog) {
+	invite := parse(t, strings.Join([]string{
+		"INVITE sip:" + to + "@example.com SIP/2.0",
+		"Via: SIP/2.0/UDP " + from + ".example.com;branch=z9hG4bK." + callID,
+		"From: <sip:" + from + "@example.com>;tag=" + fromTag,
+		"To: <sip:" + to + "@example.com>",
+		"Call-ID: " + callID,
+		"CSeq: 1 INVITE",
+		"Contact: <sip:" + from + "@" + from + ".example.com>",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")).(sip.Request)
+	ok := parse(t, strings.Join([]string{
+		"SIP/2.0 200 OK",
+		"Via: SIP/2.0/UDP " + from + ".example.com;branch=z9hG4bK." + callID,
+		"From: <sip:" + from + "@example.com>;tag=" + fromTag,
+		"To: <sip:" + to + "@example.com>;tag=" + toTag,
+		"Call-ID: " + callID,
+		"CSeq: 1 INVITE",
+		"Contact: <sip:" + to + "@" + to + ".example.com>",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")).(sip.Response)
+
+	uac, err := sip.NewClientDialog(invite, ok)
+	if err != nil {
+		t.Fatalf("failed to create UAC dialog: %s", err)
+	}
+	uas, err := sip.NewServerDialog(invite, ok)
+	if err != nil {
+		t.Fatalf("failed to create UAS dialog: %s", err)
+	}
+	return uac, uas
+}
+
+func TestBlindTransfer(t *testing.T) {
+	aliceDialog, bobDialog := dialogs(t, "call-1", "alice", "a1", "bob", "b1")
+	aliceSender := &fakeSender{status: 202}
+	bobSender := &fakeSender{status: 200}
+	transferor := transfer.NewTransferor(aliceSender, logger)
+	transferee := transfer.NewTransferee(bobSender, logger)
+
+	ctx := context.Background()
+	target := &sip.SipUri{FUser: sip.String{Str: "carol"}, FHost: "example.com"}
+	from := &sip.Address{Uri: &sip.SipUri{FUser: sip.String{Str: "alice"}, FHost: "example.com"}}
+	tr, err := transferor.BlindTransfer(ctx, aliceDialog, target, transfer.WithReferredBy(from))
+	if err != nil {
+		t.Fatalf("REFER failed: %s", err)
+	}
+
+	refer := aliceSender.lastRequest(t)
+	if refer.Method() != sip.REFER || !bobDialog.Matches(refer) {
+		t.Fatalf("unexpected REFER:\n%s", refer)
+	}
+
+	referral, err := transferee.Accept(ctx, bobDialog, refer)
+	if err != nil {
+		t.Fatalf("accept REFER failed: %s", err)
+	}
+	if res := bobSender.lastResponse(t); res.status != 202 {
+		t.Errorf("expected 202 response, got %d", res.status)
+	}
+	if referral.IsAttended() || !target.Equals(referral.ReferTo.Address) || referral.ReferredBy == nil {
+		t.Errorf("unexpected referral %+v", referral)
+	}
+
+	invite, err := referral.NewInvite()
+	if err != nil {
+		t.Fatalf("failed to create INVITE: %s", err)
+	}
+	if !target.Equals(invite.Recipient()) || len(invite.GetHeaders("Referred-By")) != 1 {
+		t.Errorf("unexpected INVITE:\n%s", invite)
+	}
+	if callID, _ := invite.CallID(); *callID == "call-1" {
+		t.Errorf("INVITE must be sent out of the dialog:\n%s", invite)
+	}
+
+	// initial NOTIFY
+	if !transferor.HandleNotify(bobSender.lastRequest(t)) {
+		t.Fatalf("NOTIFY not matched")
+	}
+	if p := <-tr.Progress(); p.StatusCode != 100 || p.Final {
+		t.Errorf("unexpected progress %+v", p)
+	}
+
+	if err := referral.Notify(ctx, 200, "OK"); err != nil {
+		t.Fatalf("NOTIFY failed: %s", err)
+	}
+	notify := bobSender.lastRequest(t)
+	if hdrs := notify.GetHeaders("Subscription-State"); len(hdrs) != 1 ||
+		!hdrs[0].(*sip.SubscriptionStateHeader).IsTerminated() {
+		t.Errorf("expected terminated subscription:\n%s", notify)
+	}
+	if !transferor.HandleNotify(notify) {
+		t.Fatalf("NOTIFY not matched")
+	}
+	if res := aliceSender.lastResponse(t); res.status != 200 {
+		t.Errorf("expected 200 response on NOTIFY, got %d", res.status)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	p, err := tr.Wait(ctx)
+	if err != nil {
+		t.Fatalf("transfer not finished: %s", err)
+	}
+	if !p.Success() || !p.Final {
+		t.Errorf("unexpected result %+v", p)
+	}
+
+	// subscription is gone
+	if transferor.HandleNotify(notify) {
+		t.Errorf("NOTIFY of finished transfer must not be matched")
+	}
+}
+
+func TestAttendedTransfer(t *testing.T) {
+	aliceDialog, bobDialog := dialogs(t, "call-1", "alice", "a1", "bob", "b1")
+	aliceCarolDialog, carolDialog := dialogs(t, "call-2", "alice", "a2", "carol", "c2")
+	aliceSender := &fakeSender{status: 202}
+	bobSender := &fakeSender{status: 200}
+	transferor := transfer.NewTransferor(aliceSender, logger)
+	transferee := transfer.NewTransferee(bobSender, logger)
+
+	ctx := context.Background()
+	if _, err := transferor.AttendedTransfer(ctx, aliceDialog, aliceCarolDialog); err != nil {
+		t.Fatalf("REFER failed: %s", err)
+	}
+
+	referral, err := transferee.Accept(ctx, bobDialog, aliceSender.lastRequest(t))
+	if err != nil {
+		t.Fatalf("accept REFER failed: %s", err)
+	}
+	if !referral.IsAttended() {
+		t.Fatalf("expected attended transfer")
+	}
+
+	invite, err := referral.NewInvite()
+	if err != nil {
+		t.Fatalf("failed to create INVITE: %s", err)
+	}
+	invite = parse(t, invite.String()).(sip.Request)
+	if invite.Recipient().Headers() != nil && invite.Recipient().Headers().Length() > 0 {
+		t.Errorf("URI headers must be stripped:\n%s", invite)
+	}
+	replaces, ok := transfer.ReplacesFromRequest(invite)
+	if !ok {
+		t.Fatalf("missing Replaces header:\n%s", invite)
+	}
+	if !replaces.Matches(carolDialog) {
+		t.Errorf("Replaces %s does not match dialog %s", replaces, carolDialog.ID())
+	}
+	if replaces.Matches(bobDialog) {
+		t.Errorf("Replaces %s must not match dialog %s", replaces, bobDialog.ID())
+	}
+}
+
+func TestTransferWithoutSubscription(t *testing.T) {
+	aliceDialog, bobDialog := dialogs(t, "call-1", "alice", "a1", "bob", "b1")
+	aliceSender := &fakeSender{status: 202, headers: []sip.Header{&sip.ReferSubHeader{Enabled: false}}}
+	bobSender := &fakeSender{status: 200}
+	transferor := transfer.NewTransferor(aliceSender, logger)
+	transferee := transfer.NewTransferee(bobSender, logger)
+
+	ctx := context.Background()
+	target := &sip.SipUri{FUser: sip.String{Str: "carol"}, FHost: "example.com"}
+	tr, err := transferor.BlindTransfer(ctx, aliceDialog, target, transfer.WithoutSubscription())
+	if err != nil {
+		t.Fatalf("REFER failed: %s", err)
+	}
+	select {
+	case <-tr.Done():
+	default:
+		t.Errorf("transfer without subscription must be finished after REFER is accepted")
+	}
+
+	referral, err := transferee.Accept(ctx, bobDialog, aliceSender.lastRequest(t))
+	if err != nil {
+		t.Fatalf("accept REFER failed: %s", err)
+	}
+	if referral.Subscribed() {
+		t.Errorf("expected suppressed subscription")
+	}
+	res := bobSender.lastResponse(t)
+	if len(res.headers) != 1 || res.headers[0].Name() != "Refer-Sub" {
+		t.Errorf("expected Refer-Sub in 202 response, got %v", res.headers)
+	}
+	if len(bobSender.requests) != 0 {
+		t.Errorf("NOTIFY must not be sent")
+	}
+}
+
+func TestTransferExpiry(t *testing.T) {
+	aliceDialog, bobDialog := dialogs(t, "call-1", "alice", "a1", "bob", "b1")
+	expires := sip.Expires(30)
+	aliceSender := &fakeSender{status: 202, headers: []sip.Header{&expires}}
+	bobSender := &fakeSender{status: 200}
+	clock := timing.NewFakeClock(time.Now())
+	transferor := transfer.NewTransferor(aliceSender, logger, transfer.WithClock(clock))
+	transferee := transfer.NewTransferee(bobSender, logger)
+
+	ctx := context.Background()
+	target := &sip.SipUri{FUser: sip.String{Str: "carol"}, FHost: "example.com"}
+	tr, err := transferor.BlindTransfer(ctx, aliceDialog, target)
+	if err != nil {
+		t.Fatalf("REFER failed: %s", err)
+	}
+	assertDone := func(expected bool) {
+		t.Helper()
+
+		clock.Settle()
+		select {
+		case <-tr.Done():
+			if !expected {
+				t.Fatalf("transfer finished too early")
+			}
+		default:
+			if expected {
+				t.Fatalf("transfer not finished")
+			}
+		}
+	}
+
+	clock.Advance(29 * time.Second)
+	assertDone(false)
+
+	// initial NOTIFY extends the subscription to 60 seconds
+	if _, err := transferee.Accept(ctx, bobDialog, aliceSender.lastRequest(t)); err != nil {
+		t.Fatalf("accept REFER failed: %s", err)
+	}
+	if !transferor.HandleNotify(bobSender.lastRequest(t)) {
+		t.Fatalf("NOTIFY not matched")
+	}
+	clock.Advance(59 * time.Second)
+	assertDone(false)
+
+	clock.Advance(time.Second)
+	assertDone(true)
+	if p := tr.Result(); !p.Final || p.StatusCode != 0 {
+		t.Errorf("unexpected result %+v", p)
+	}
+	if transferor.HandleNotify(bobSender.lastRequest(t)) {
+		t.Errorf("NOTIFY of expired transfer must not be matched")
+	}
+}
+
+func TestRejectInvalidRefer(t *testing.T) {
+	_, bobDialog := dialogs(t, "call-1", "alice", "a1", "bob", "b1")
+	bobSender := &fakeSender{status: 200}
+	transferee := transfer.NewTransferee(bobSender, logger)
+
+	refer := parse(t, strings.Join([]string{
+		"REFER sip:bob@bob.example.com SIP/2.0",
+		"Via: SIP/2.0/UDP alice.example.com;branch=z9hG4bK.refer",
+		"From: <sip:alice@example.com>;tag=a1",
+		"To: <sip:bob@example.com>;tag=b1",
+		"Call-ID: call-1",
+		"CSeq: 2 REFER",
+		"Content-Length: 0",
+		"",
+		"",
+	}, "\r\n")).(sip.Request)
+
+	if _, err := transferee.Accept(context.Background(), bobDialog, refer); err == nil {
+		t.Fatalf("expected error for REFER without Refer-To")
+	}
+	if res := bobSender.lastResponse(t); res.status != 400 {
+		t.Errorf("expected 400 response, got %d", res.status)
+	}
+}
+
+func TestSipFrag(t *testing.T) {
+	code, reason, err := transfer.ParseSipFrag(transfer.NewSipFrag(486, "Busy Here"))
+	if err != nil {
+		t.Fatalf("failed to parse sipfrag: %s", err)
+	}
+	if code != 486 || reason != "Busy Here" {
+		t.Errorf("unexpected status %d %s", code, reason)
+	}
+
+	if _, _, err := transfer.ParseSipFrag("INVITE sip:bob@example.com SIP/2.0\r\n"); err == nil {
+		t.Errorf("expected error for request line")
+	}
+}
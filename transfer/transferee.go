@@ -0,0 +1,235 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// Transferee accepts incoming REFER requests.
+type Transferee struct {
+	sender gosip.Sender
+	log    log.Logger
+}
+
+func NewTransferee(sender gosip.Sender, logger log.Logger) *Transferee {
+	t := &Transferee{
+		sender: sender,
+	}
+	t.log = logger.
+		WithPrefix("transfer.Transferee").
+		WithFields(log.Fields{
+			"transferee_ptr": fmt.Sprintf("%p", t),
+		})
+
+	return t
+}
+
+func (t *Transferee) Log() log.Logger {
+	return t.log
+}
+
+// Accept validates REFER received within the dialog, responds 202 Accepted and sends the initial NOTIFY.
+// Invalid REFER is rejected with 400 Bad Request and an error is returned.
+// The caller is responsible for sending INVITE created by Referral.NewInvite and reporting its outcome.
+func (t *Transferee) Accept(ctx context.Context, dialog *sip.Dialog, req sip.Request) (*Referral, error) {
+	logger := t.Log().WithFields(req.Fields())
+
+	referral, err := newReferral(dialog, req)
+	if err != nil {
+		logger.Warnf("reject REFER: %s", err)
+
+		if _, err := t.sender.RespondOnRequest(req, 400, "Bad Request", "", nil); err != nil {
+			logger.Errorf("respond '400 Bad Request' failed: %s", err)
+		}
+		return nil, err
+	}
+	referral.sender = t.sender
+	referral.log = logger
+
+	var hdrs []sip.Header
+	if !referral.subscribed {
+		hdrs = append(hdrs, &sip.ReferSubHeader{Enabled: false})
+	}
+	if _, err := t.sender.RespondOnRequest(req, 202, "Accepted", "", hdrs); err != nil {
+		return nil, fmt.Errorf("respond '202 Accepted': %w", err)
+	}
+
+	if err := referral.Notify(ctx, 100, "Trying"); err != nil {
+		logger.Warnf("send initial NOTIFY failed: %s", err)
+	}
+
+	return referral, nil
+}
+
+// Referral is an accepted REFER request.
+type Referral struct {
+	ReferTo    *sip.ReferToHeader
+	ReferredBy *sip.ReferredByHeader
+	// Replaces is set for attended transfer, it is taken from the Refer-To URI headers.
+	Replaces *sip.ReplacesHeader
+
+	dialog     *sip.Dialog
+	eventID    string
+	subscribed bool
+	sender     gosip.Sender
+	mu         sync.Mutex
+	terminated bool
+	log        log.Logger
+}
+
+// newReferral parses REFER received within the dialog.
+func newReferral(dialog *sip.Dialog, req sip.Request) (*Referral, error) {
+	if req.Method() != sip.REFER {
+		return nil, fmt.Errorf("unexpected method %s", req.Method())
+	}
+
+	hdrs := req.GetHeaders("Refer-To")
+	if len(hdrs) != 1 {
+		return nil, fmt.Errorf("expected exactly one 'Refer-To' header, got %d", len(hdrs))
+	}
+	referTo, ok := hdrs[0].(*sip.ReferToHeader)
+	if !ok || referTo.Address == nil {
+		return nil, fmt.Errorf("invalid 'Refer-To' header")
+	}
+
+	cseq, ok := req.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("missing 'CSeq' header")
+	}
+
+	referral := &Referral{
+		ReferTo:    referTo,
+		dialog:     dialog,
+		eventID:    strconv.FormatUint(uint64(cseq.SeqNo), 10),
+		subscribed: true,
+	}
+	if hdrs := req.GetHeaders("Referred-By"); len(hdrs) > 0 {
+		referral.ReferredBy, _ = hdrs[0].(*sip.ReferredByHeader)
+	}
+	for _, hdr := range req.GetHeaders("Refer-Sub") {
+		if referSub, ok := hdr.(*sip.ReferSubHeader); ok && !referSub.Enabled {
+			referral.subscribed = false
+		}
+	}
+	if uriHeaders := referTo.Address.Headers(); uriHeaders != nil {
+		if val, ok := uriHeaders.Get("Replaces"); ok && val != nil {
+			replaces, err := parser.ParseReplaces(val.String())
+			if err != nil {
+				return nil, fmt.Errorf("invalid 'Replaces' in 'Refer-To' header: %w", err)
+			}
+			referral.Replaces = replaces
+		}
+	}
+
+	return referral, nil
+}
+
+func (referral *Referral) Dialog() *sip.Dialog {
+	return referral.dialog
+}
+
+// IsAttended returns true if the transferor asked to replace an existing dialog.
+func (referral *Referral) IsAttended() bool {
+	return referral.Replaces != nil
+}
+
+// Subscribed returns false if the transferor suppressed the implicit subscription with Refer-Sub: false.
+func (referral *Referral) Subscribed() bool {
+	return referral.subscribed
+}
+
+// NewInvite creates INVITE to the transfer target out of the dialog.
+// Referred-By and Replaces headers are copied, URI headers are stripped from the Request-URI.
+func (referral *Referral) NewInvite() (sip.Request, error) {
+	target := referral.ReferTo.Address.Clone()
+	target.SetHeaders(nil)
+
+	from := referral.dialog.LocalAddress()
+	from.Params = sip.NewParams().Add("tag", sip.String{Str: util.RandString(8)})
+
+	builder := sip.NewRequestBuilder().
+		SetTransport(referral.dialog.Transport()).
+		SetHost(sip.DefaultHost).
+		SetMethod(sip.INVITE).
+		SetRecipient(target).
+		SetFrom(from).
+		SetTo(&sip.Address{Uri: target.Clone()}).
+		AddVia(&sip.ViaHop{
+			Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		})
+	if contact, ok := referral.dialog.LocalContact(); ok {
+		builder.SetContact(sip.NewAddressFromContactHeader(contact))
+	}
+	if referral.ReferredBy != nil {
+		builder.AddHeader(referral.ReferredBy.Clone())
+	}
+	if referral.Replaces != nil {
+		builder.AddHeader(referral.Replaces.Clone())
+	}
+
+	return builder.Build()
+}
+
+// Notify reports status of the INVITE sent to the transfer target.
+// Final status terminates the subscription, further calls do nothing.
+// Nothing is sent if the transferor suppressed the subscription.
+func (referral *Referral) Notify(ctx context.Context, code sip.StatusCode, reason string) error {
+	if !referral.subscribed {
+		return nil
+	}
+
+	referral.mu.Lock()
+	if referral.terminated {
+		referral.mu.Unlock()
+		return nil
+	}
+	state := &sip.SubscriptionStateHeader{State: sip.SubscriptionActive}
+	if code >= 200 {
+		referral.terminated = true
+		state.State = sip.SubscriptionTerminated
+		state.Params = sip.NewParams().Add("reason", sip.String{Str: "noresource"})
+	} else {
+		state.Params = sip.NewParams().Add("expires", sip.String{Str: "60"})
+	}
+	referral.mu.Unlock()
+
+	contentType := sip.ContentType(SipFragContentType)
+	req := referral.dialog.NewRequest(
+		sip.NOTIFY,
+		&sip.EventHeader{
+			EventType: "refer",
+			Params:    sip.NewParams().Add("id", sip.String{Str: referral.eventID}),
+		},
+		state,
+		&contentType,
+	)
+	req.SetBody(NewSipFrag(code, reason), true)
+
+	referral.log.Debugf("sending NOTIFY %d %s", code, reason)
+
+	_, err := referral.sender.RequestWithContext(ctx, req)
+	return err
+}
+
+// NotifyResponse reports the response received on INVITE sent to the transfer target.
+func (referral *Referral) NotifyResponse(ctx context.Context, res sip.Response) error {
+	return referral.Notify(ctx, res.StatusCode(), res.Reason())
+}
+
+// ReplacesFromRequest returns Replaces header of the incoming INVITE, if any.
+func ReplacesFromRequest(req sip.Request) (*sip.ReplacesHeader, bool) {
+	hdrs := req.GetHeaders("Replaces")
+	if len(hdrs) == 0 {
+		return nil, false
+	}
+	replaces, ok := hdrs[0].(*sip.ReplacesHeader)
+	return replaces, ok
+}
@@ -0,0 +1,499 @@
+// transfer package implements call transfer with REFER (RFC 3515), Referred-By (RFC 3892),
+// Replaces (RFC 3891) and suppression of the implicit subscription (RFC 4488).
+//
+// Transferor sends REFER within an existing dialog and tracks progress reported by the transferee
+// in message/sipfrag NOTIFY requests. Transferee accepts REFER, creates the INVITE to the transfer target
+// and reports the outcome back.
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+// DefaultSubscriptionExpiry is duration of the implicit REFER subscription
+// until the transferee sets it in the REFER response or NOTIFY.
+const DefaultSubscriptionExpiry = 60 * time.Second
+
+// Progress is a transfer state reported by the transferee.
+type Progress struct {
+	// Status of the INVITE sent to the transfer target,
+	// 0 if the subscription was terminated or expired without it.
+	StatusCode sip.StatusCode
+	Reason     string
+	// Final is set on the last update of the transfer.
+	Final bool
+}
+
+// Success returns true if the transfer target has answered.
+func (p Progress) Success() bool {
+	return p.StatusCode >= 200 && p.StatusCode < 300
+}
+
+// Transfer is an outgoing REFER accepted by the transferee.
+type Transfer struct {
+	dialog   *sip.Dialog
+	referTo  *sip.ReferToHeader
+	eventID  string
+	mu       sync.Mutex
+	progress chan Progress
+	done     chan struct{}
+	result   Progress
+	finished bool
+	expiry   timing.Timer
+}
+
+func newTransfer(dialog *sip.Dialog, referTo *sip.ReferToHeader, eventID string) *Transfer {
+	return &Transfer{
+		dialog:   dialog,
+		referTo:  referTo,
+		eventID:  eventID,
+		progress: make(chan Progress, 8),
+		done:     make(chan struct{}),
+	}
+}
+
+func (tr *Transfer) Dialog() *sip.Dialog {
+	return tr.dialog
+}
+
+func (tr *Transfer) ReferTo() *sip.ReferToHeader {
+	return tr.referTo
+}
+
+// Progress returns channel of the transfer progress updates, it is closed after the final one.
+// Intermediate updates are dropped if the channel is not read.
+func (tr *Transfer) Progress() <-chan Progress {
+	return tr.progress
+}
+
+// Done returns channel that is closed when the transfer is finished.
+func (tr *Transfer) Done() <-chan struct{} {
+	return tr.done
+}
+
+// Result returns the final progress, it is valid after Done is closed.
+func (tr *Transfer) Result() Progress {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return tr.result
+}
+
+// Wait blocks until the transfer is finished or the context is done.
+func (tr *Transfer) Wait(ctx context.Context) (Progress, error) {
+	select {
+	case <-tr.done:
+		return tr.Result(), nil
+	case <-ctx.Done():
+		return Progress{}, ctx.Err()
+	}
+}
+
+func (tr *Transfer) update(p Progress) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.finished {
+		return
+	}
+
+	select {
+	case tr.progress <- p:
+	default:
+	}
+
+	if p.Final {
+		tr.finished = true
+		tr.result = p
+		close(tr.progress)
+		close(tr.done)
+
+		if tr.expiry != nil {
+			tr.expiry.Stop()
+		}
+	}
+}
+
+// expireAfter (re)starts the subscription expiry timer, expire is called unless the transfer is finished before.
+// If reset is false, the running timer is kept.
+func (tr *Transfer) expireAfter(clock timing.Clock, d time.Duration, reset bool, expire func()) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.finished {
+		return
+	}
+	if tr.expiry != nil {
+		if !reset {
+			return
+		}
+		tr.expiry.Stop()
+	}
+
+	tr.expiry = clock.AfterFunc(d, expire)
+}
+
+// ReferOption modifies REFER sent by Transferor.
+type ReferOption interface {
+	ApplyRefer(options *ReferOptions)
+}
+
+type ReferOptions struct {
+	ReferredBy *sip.ReferredByHeader
+	// NoSubscription asks the transferee not to report progress (RFC 4488).
+	NoSubscription bool
+	// Headers are appended to the REFER request.
+	Headers        []sip.Header
+	RequestOptions []gosip.RequestWithContextOption
+}
+
+type withReferredBy struct {
+	address *sip.Address
+}
+
+func (o withReferredBy) ApplyRefer(options *ReferOptions) {
+	options.ReferredBy = &sip.ReferredByHeader{
+		DisplayName: o.address.DisplayName,
+		Address:     o.address.Uri,
+		Params:      o.address.Params,
+	}
+}
+
+// WithReferredBy adds Referred-By header with the given address.
+func WithReferredBy(address *sip.Address) ReferOption {
+	return withReferredBy{address.Clone()}
+}
+
+type withoutSubscription struct{}
+
+func (o withoutSubscription) ApplyRefer(options *ReferOptions) {
+	options.NoSubscription = true
+}
+
+// WithoutSubscription suppresses the implicit subscription with Refer-Sub: false.
+// Transfer created with the option is finished as soon as REFER is accepted,
+// unless the transferee does not support RFC 4488 and keeps sending NOTIFY.
+func WithoutSubscription() ReferOption {
+	return withoutSubscription{}
+}
+
+type withHeaders struct {
+	headers []sip.Header
+}
+
+func (o withHeaders) ApplyRefer(options *ReferOptions) {
+	options.Headers = append(options.Headers, o.headers...)
+}
+
+// WithHeaders appends headers to REFER request.
+func WithHeaders(headers ...sip.Header) ReferOption {
+	return withHeaders{headers}
+}
+
+type withRequestOptions struct {
+	options []gosip.RequestWithContextOption
+}
+
+func (o withRequestOptions) ApplyRefer(options *ReferOptions) {
+	options.RequestOptions = append(options.RequestOptions, o.options...)
+}
+
+// WithRequestOptions passes options to gosip.Sender.RequestWithContext, e.g. gosip.WithAuthorizer.
+func WithRequestOptions(options ...gosip.RequestWithContextOption) ReferOption {
+	return withRequestOptions{options}
+}
+
+// TransferorOption modifies Transferor.
+type TransferorOption interface {
+	ApplyTransferor(opts *TransferorOptions)
+}
+
+type TransferorOptions struct {
+	Clock timing.Clock
+}
+
+type withClock struct {
+	clock timing.Clock
+}
+
+func (o withClock) ApplyTransferor(opts *TransferorOptions) {
+	opts.Clock = o.clock
+}
+
+// WithClock sets clock that drives expiry of the transfer subscriptions, default is the real clock.
+func WithClock(clock timing.Clock) TransferorOption {
+	return withClock{clock}
+}
+
+// Transferor sends REFER requests and tracks transfers.
+//
+// Transfer is finished by the final NOTIFY or, if it never comes, when the subscription expires.
+// The expiry is taken from Expires header of the REFER response and from Subscription-State of NOTIFY,
+// DefaultSubscriptionExpiry is used if neither sets it.
+type Transferor struct {
+	sender    gosip.Sender
+	opts      TransferorOptions
+	mu        sync.Mutex
+	transfers map[string][]*Transfer
+	log       log.Logger
+}
+
+func NewTransferor(sender gosip.Sender, logger log.Logger, options ...TransferorOption) *Transferor {
+	t := &Transferor{
+		sender:    sender,
+		transfers: make(map[string][]*Transfer),
+	}
+	for _, opt := range options {
+		opt.ApplyTransferor(&t.opts)
+	}
+	if t.opts.Clock == nil {
+		t.opts.Clock = timing.NewRealClock()
+	}
+	t.log = logger.
+		WithPrefix("transfer.Transferor").
+		WithFields(log.Fields{
+			"transferor_ptr": fmt.Sprintf("%p", t),
+		})
+
+	return t
+}
+
+func (t *Transferor) Log() log.Logger {
+	return t.log
+}
+
+// BlindTransfer asks the remote party of the dialog to call the target.
+func (t *Transferor) BlindTransfer(
+	ctx context.Context,
+	dialog *sip.Dialog,
+	target sip.Uri,
+	options ...ReferOption,
+) (*Transfer, error) {
+	return t.Refer(ctx, dialog, &sip.ReferToHeader{Address: target.Clone()}, options...)
+}
+
+// AttendedTransfer asks the remote party of the dialog to replace the consultation dialog,
+// i.e. to call the remote party of the consultation dialog with Replaces header.
+func (t *Transferor) AttendedTransfer(
+	ctx context.Context,
+	dialog *sip.Dialog,
+	consultation *sip.Dialog,
+	options ...ReferOption,
+) (*Transfer, error) {
+	target := consultation.RemoteTarget()
+	headers := target.Headers()
+	if headers == nil {
+		headers = sip.NewParams()
+	}
+	replaces := sip.NewReplacesFromDialog(consultation)
+	headers.Add("Replaces", sip.String{Str: replaces.Value()})
+	target.SetHeaders(headers)
+
+	return t.Refer(ctx, dialog, &sip.ReferToHeader{Address: target}, options...)
+}
+
+// Refer sends REFER within the dialog and returns the transfer once the transferee has accepted it.
+// Failure responses are returned as *sip.RequestError.
+func (t *Transferor) Refer(
+	ctx context.Context,
+	dialog *sip.Dialog,
+	referTo *sip.ReferToHeader,
+	options ...ReferOption,
+) (*Transfer, error) {
+	optionsHash := &ReferOptions{}
+	for _, opt := range options {
+		opt.ApplyRefer(optionsHash)
+	}
+
+	req := dialog.NewRequest(sip.REFER, referTo)
+	if optionsHash.ReferredBy != nil {
+		req.AppendHeader(optionsHash.ReferredBy)
+	}
+	if optionsHash.NoSubscription {
+		req.AppendHeader(&sip.ReferSubHeader{Enabled: false})
+		req.AppendHeader(&sip.SupportedHeader{Options: []string{"norefersub"}})
+	}
+	for _, header := range optionsHash.Headers {
+		req.AppendHeader(header)
+	}
+
+	// NOTIFY may come before the REFER response, so the transfer is registered in advance
+	cseq, _ := req.CSeq()
+	tr := newTransfer(dialog, referTo, strconv.FormatUint(uint64(cseq.SeqNo), 10))
+	t.add(tr)
+
+	logger := t.Log().WithFields(req.Fields())
+	logger.Debugf("sending REFER to %s", referTo.Address)
+
+	res, err := t.sender.RequestWithContext(ctx, req, optionsHash.RequestOptions...)
+	if err != nil {
+		t.remove(tr)
+		return nil, err
+	}
+
+	subscribed := true
+	for _, hdr := range res.GetHeaders("Refer-Sub") {
+		if referSub, ok := hdr.(*sip.ReferSubHeader); ok && !referSub.Enabled {
+			subscribed = false
+		}
+	}
+	if !subscribed {
+		logger.Debug("REFER accepted without subscription")
+
+		t.remove(tr)
+		tr.update(Progress{
+			StatusCode: res.StatusCode(),
+			Reason:     res.Reason(),
+			Final:      true,
+		})
+
+		return tr, nil
+	}
+
+	expiry := DefaultSubscriptionExpiry
+	if hdrs := res.GetHeaders("Expires"); len(hdrs) > 0 {
+		if expires, ok := hdrs[0].(*sip.Expires); ok {
+			expiry = time.Duration(*expires) * time.Second
+		}
+	}
+	// NOTIFY received before the response has already set the expiry
+	t.expireAfter(tr, expiry, false)
+
+	return tr, nil
+}
+
+func (t *Transferor) expireAfter(tr *Transfer, d time.Duration, reset bool) {
+	tr.expireAfter(t.opts.Clock, d, reset, func() {
+		t.Log().WithFields(log.Fields{"dialog_id": tr.dialog.ID()}).Debug("transfer subscription expired")
+
+		t.remove(tr)
+		tr.update(Progress{Final: true})
+	})
+}
+
+// HandleNotify processes NOTIFY of the implicit REFER subscription and responds to it.
+// It returns false if the request does not belong to any transfer, so it can be passed to other handlers.
+func (t *Transferor) HandleNotify(req sip.Request) bool {
+	event, ok := eventHeader(req)
+	if !ok || !strings.EqualFold(event.EventType, "refer") {
+		return false
+	}
+	dialogID, err := sip.MakeDialogIDFromMessage(req)
+	if err != nil {
+		return false
+	}
+
+	tr, ok := t.find(dialogID, event.ID())
+	if !ok {
+		return false
+	}
+
+	logger := t.Log().WithFields(req.Fields())
+
+	var p Progress
+	if body := req.Body(); strings.TrimSpace(body) != "" {
+		p.StatusCode, p.Reason, err = ParseSipFrag(body)
+		if err != nil {
+			logger.Warnf("invalid NOTIFY body: %s", err)
+
+			if _, err := t.sender.RespondOnRequest(req, 400, "Bad Request", "", nil); err != nil {
+				logger.Errorf("respond '400 Bad Request' failed: %s", err)
+			}
+			return true
+		}
+	}
+	if p.StatusCode >= 200 {
+		p.Final = true
+	}
+	var expires *uint32
+	for _, hdr := range req.GetHeaders("Subscription-State") {
+		state, ok := hdr.(*sip.SubscriptionStateHeader)
+		if !ok {
+			continue
+		}
+		if state.IsTerminated() {
+			p.Final = true
+		} else if seconds, ok := state.Expires(); ok {
+			expires = &seconds
+		}
+	}
+
+	if _, err := t.sender.RespondOnRequest(req, 200, "OK", "", nil); err != nil {
+		logger.Errorf("respond '200 OK' failed: %s", err)
+	}
+
+	logger.Debugf("transfer progress %d %s", p.StatusCode, p.Reason)
+
+	if p.Final {
+		t.remove(tr)
+	} else if expires != nil {
+		t.expireAfter(tr, time.Duration(*expires)*time.Second, true)
+	}
+	tr.update(p)
+
+	return true
+}
+
+func (t *Transferor) add(tr *Transfer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := tr.dialog.ID()
+	t.transfers[id] = append(t.transfers[id], tr)
+}
+
+func (t *Transferor) remove(tr *Transfer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := tr.dialog.ID()
+	transfers := t.transfers[id]
+	for i, elt := range transfers {
+		if elt == tr {
+			transfers = append(transfers[:i], transfers[i+1:]...)
+			break
+		}
+	}
+	if len(transfers) == 0 {
+		delete(t.transfers, id)
+	} else {
+		t.transfers[id] = transfers
+	}
+}
+
+// find looks up transfer by event id, NOTIFY without id refers to the first REFER in the dialog.
+func (t *Transferor) find(dialogID, eventID string) (*Transfer, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	transfers := t.transfers[dialogID]
+	for _, tr := range transfers {
+		if tr.eventID == eventID {
+			return tr, true
+		}
+	}
+	if eventID == "" && len(transfers) > 0 {
+		return transfers[0], true
+	}
+
+	return nil, false
+}
+
+func eventHeader(msg sip.Message) (*sip.EventHeader, bool) {
+	hdrs := msg.GetHeaders("Event")
+	if len(hdrs) == 0 {
+		return nil, false
+	}
+	event, ok := hdrs[0].(*sip.EventHeader)
+	return event, ok
+}
@@ -0,0 +1,279 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ghettovoice/gosip/log"
+)
+
+// ErrACLCertificate is returned by TLS handshake when the client certificate does not match ACL names.
+var ErrACLCertificate = errors.New("client certificate is not allowed by ACL")
+
+// ACLRules are the rules of ACL.
+type ACLRules struct {
+	// Allow and Deny are IP addresses or CIDR networks. Deny rules win,
+	// empty Allow list allows all peers that are not denied.
+	Allow []string
+	Deny  []string
+	// TLSNames are allowed subject common names and DNS SANs of TLS client certificates,
+	// "*.example.com" matches any subdomain. Empty list does not check client certificates.
+	TLSNames []string
+	// ClientCAs verify TLS client certificates, nil means the system roots.
+	// Unlike other rules it is used only when the listener is created.
+	ClientCAs *x509.CertPool
+}
+
+// ACLStats are counters of the traffic rejected by ACL.
+type ACLStats struct {
+	RejectedConnections  uint64
+	RejectedPackets      uint64
+	RejectedCertificates uint64
+}
+
+// ACL controls which peers may send traffic to a listener, it is passed as ListenOption.
+// Connections of stream transports are checked when they are accepted,
+// packets are checked before they are parsed. Rules can be updated while listeners are served.
+type ACL struct {
+	stats ACLStats
+
+	mu    sync.RWMutex
+	rules ACLRules
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewACL creates ACL with the rules.
+func NewACL(rules ACLRules) (*ACL, error) {
+	acl := new(ACL)
+	if err := acl.Update(rules); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func (acl *ACL) ApplyListen(opts *ListenOptions) {
+	opts.ACL = acl
+}
+
+// Update replaces the rules, existing connections are not affected.
+func (acl *ACL) Update(rules ACLRules) error {
+	allow, err := parseNetworks(rules.Allow)
+	if err != nil {
+		return fmt.Errorf("parse allow rules: %w", err)
+	}
+	deny, err := parseNetworks(rules.Deny)
+	if err != nil {
+		return fmt.Errorf("parse deny rules: %w", err)
+	}
+
+	acl.mu.Lock()
+	acl.rules = rules
+	acl.allow = allow
+	acl.deny = deny
+	acl.mu.Unlock()
+
+	return nil
+}
+
+// Rules returns the current rules.
+func (acl *ACL) Rules() ACLRules {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	return acl.rules
+}
+
+// Stats returns counters of the rejected traffic.
+func (acl *ACL) Stats() ACLStats {
+	return ACLStats{
+		RejectedConnections:  atomic.LoadUint64(&acl.stats.RejectedConnections),
+		RejectedPackets:      atomic.LoadUint64(&acl.stats.RejectedPackets),
+		RejectedCertificates: atomic.LoadUint64(&acl.stats.RejectedCertificates),
+	}
+}
+
+// Allowed returns true if the peer IP address is allowed.
+func (acl *ACL) Allowed(ip net.IP) bool {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	if ip == nil {
+		return len(acl.allow) == 0 && len(acl.deny) == 0
+	}
+	for _, network := range acl.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(acl.allow) == 0 {
+		return true
+	}
+	for _, network := range acl.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedCertificate returns true if the subject common name or one of DNS SANs
+// of the certificate matches TLS names.
+func (acl *ACL) AllowedCertificate(cert *x509.Certificate) bool {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	if len(acl.rules.TLSNames) == 0 {
+		return true
+	}
+	if cert == nil {
+		return false
+	}
+
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, pattern := range acl.rules.TLSNames {
+		for _, name := range names {
+			if matchName(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (acl *ACL) allowedAddr(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		if addr != nil {
+			host := addr.String()
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			ip = net.ParseIP(strings.Trim(host, "[]"))
+		}
+	}
+	return acl.Allowed(ip)
+}
+
+// configureTLS requests client certificates and checks them against TLS names.
+// Certificates are requested even without TLS names, so the names can be set later with Update.
+func (acl *ACL) configureTLS(config *tls.Config) {
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	config.ClientCAs = acl.Rules().ClientCAs
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var cert *x509.Certificate
+		if len(rawCerts) > 0 {
+			var err error
+			if cert, err = x509.ParseCertificate(rawCerts[0]); err != nil {
+				atomic.AddUint64(&acl.stats.RejectedCertificates, 1)
+				return err
+			}
+		}
+		if !acl.AllowedCertificate(cert) {
+			atomic.AddUint64(&acl.stats.RejectedCertificates, 1)
+			return ErrACLCertificate
+		}
+		return nil
+	}
+}
+
+func listenACL(options []ListenOption) *ACL {
+	optsHash := ListenOptions{}
+	for _, opt := range options {
+		if opt != nil {
+			opt.ApplyListen(&optsHash)
+		}
+	}
+	return optsHash.ACL
+}
+
+func parseNetworks(rules []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(rules))
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if !strings.Contains(rule, "/") {
+			ip := net.ParseIP(rule)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", rule)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(rule)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func matchName(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if name == "" {
+		return false
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(name, pattern[1:]) && !strings.Contains(strings.TrimSuffix(name, pattern[1:]), ".")
+	}
+	return pattern == name
+}
+
+// aclListener closes accepted connections of peers that are not allowed by ACL.
+type aclListener struct {
+	net.Listener
+	acl *ACL
+	log log.Logger
+}
+
+func (l *aclListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.acl.allowedAddr(conn.RemoteAddr()) {
+			return conn, nil
+		}
+
+		atomic.AddUint64(&l.acl.stats.RejectedConnections, 1)
+		l.log.Debugf("connection from %s rejected by ACL", conn.RemoteAddr())
+
+		conn.Close()
+	}
+}
+
+// aclPacketConn drops packets of peers that are not allowed by ACL.
+type aclPacketConn struct {
+	*net.UDPConn
+	acl *ACL
+	log log.Logger
+}
+
+func (c *aclPacketConn) ReadFrom(buf []byte) (int, net.Addr, error) {
+	for {
+		num, raddr, err := c.UDPConn.ReadFrom(buf)
+		if err != nil || c.acl.allowedAddr(raddr) {
+			return num, raddr, err
+		}
+
+		atomic.AddUint64(&c.acl.stats.RejectedPackets, 1)
+		c.log.Tracef("packet from %s rejected by ACL", raddr)
+	}
+}
@@ -0,0 +1,147 @@
+package transport_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("ACL", func() {
+	msg := "OPTIONS sip:bob@example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP carrier.example.com;branch=z9hG4bK.acl\r\n" +
+		"To: <sip:bob@example.com>\r\n" +
+		"From: <sip:carrier@example.com>;tag=acl\r\n" +
+		"Call-ID: acl\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	logger := testutils.NewLogrusLogger()
+
+	It("should match peers by allow and deny rules", func() {
+		acl, err := transport.NewACL(transport.ACLRules{
+			Allow: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"},
+			Deny:  []string{"10.0.0.13"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(acl.Allowed(net.ParseIP("10.1.2.3"))).To(BeTrue())
+		Expect(acl.Allowed(net.ParseIP("192.0.2.1"))).To(BeTrue())
+		Expect(acl.Allowed(net.ParseIP("2001:db8::1"))).To(BeTrue())
+		Expect(acl.Allowed(net.ParseIP("10.0.0.13"))).To(BeFalse())
+		Expect(acl.Allowed(net.ParseIP("192.0.2.2"))).To(BeFalse())
+		Expect(acl.Allowed(nil)).To(BeFalse())
+
+		Expect(acl.Update(transport.ACLRules{Deny: []string{"192.0.2.0/24"}})).To(Succeed())
+		Expect(acl.Allowed(net.ParseIP("10.0.0.13"))).To(BeTrue())
+		Expect(acl.Allowed(net.ParseIP("192.0.2.1"))).To(BeFalse())
+
+		Expect(acl.Update(transport.ACLRules{Allow: []string{"carrier.example.com"}})).ToNot(Succeed())
+		Expect(acl.Rules().Deny).To(Equal([]string{"192.0.2.0/24"}))
+	})
+
+	It("should match TLS client certificates by names", func() {
+		acl, err := transport.NewACL(transport.ACLRules{TLSNames: []string{"sbc.example.com", "*.carrier.net"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(acl.AllowedCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "SBC.example.com"}})).To(BeTrue())
+		Expect(acl.AllowedCertificate(&x509.Certificate{DNSNames: []string{"edge.carrier.net"}})).To(BeTrue())
+		Expect(acl.AllowedCertificate(&x509.Certificate{DNSNames: []string{"a.edge.carrier.net", "carrier.net"}})).To(BeFalse())
+		Expect(acl.AllowedCertificate(nil)).To(BeFalse())
+	})
+
+	Context("with UDP listener", func() {
+		var (
+			output   chan sip.Message
+			errs     chan error
+			cancel   chan struct{}
+			protocol transport.Protocol
+			acl      *transport.ACL
+			client   net.Conn
+		)
+
+		target := transport.NewTarget(transport.DefaultHost, 9090)
+
+		BeforeEach(func() {
+			output = make(chan sip.Message)
+			errs = make(chan error)
+			cancel = make(chan struct{})
+			protocol = transport.NewUdpProtocol(output, errs, cancel, nil, logger)
+
+			var err error
+			acl, err = transport.NewACL(transport.ACLRules{Deny: []string{"127.0.0.0/8"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocol.Listen(target, acl)).To(Succeed())
+			client = testutils.CreateClient("udp", target.Addr(), "")
+		})
+		AfterEach(func() {
+			close(cancel)
+			<-protocol.Done()
+			client.Close()
+		})
+
+		It("should drop packets of denied peers before parsing", func() {
+			testutils.WriteToConn(client, []byte(msg))
+			Consistently(output, 100*time.Millisecond).ShouldNot(Receive())
+			Eventually(func() uint64 { return acl.Stats().RejectedPackets }).Should(Equal(uint64(1)))
+
+			Expect(acl.Update(transport.ACLRules{Allow: []string{"127.0.0.1"}})).To(Succeed())
+			testutils.WriteToConn(client, []byte(msg))
+			Eventually(output).Should(Receive())
+			Expect(acl.Stats().RejectedPackets).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("with TCP listener", func() {
+		var (
+			output   chan sip.Message
+			errs     chan error
+			cancel   chan struct{}
+			protocol transport.Protocol
+			acl      *transport.ACL
+		)
+
+		target := transport.NewTarget(transport.DefaultHost, 9091)
+
+		BeforeEach(func() {
+			output = make(chan sip.Message)
+			errs = make(chan error)
+			cancel = make(chan struct{})
+			protocol = transport.NewTcpProtocol(output, errs, cancel, nil, logger)
+
+			var err error
+			acl, err = transport.NewACL(transport.ACLRules{Allow: []string{"192.0.2.0/24"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocol.Listen(target, acl)).To(Succeed())
+		})
+		AfterEach(func() {
+			close(cancel)
+			<-protocol.Done()
+		})
+
+		It("should close connections of denied peers on accept", func() {
+			client := testutils.CreateClient("tcp", target.Addr(), "")
+			defer client.Close()
+
+			Expect(client.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			_, err := client.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+			Expect(acl.Stats().RejectedConnections).To(Equal(uint64(1)))
+
+			Expect(acl.Update(transport.ACLRules{Allow: []string{"127.0.0.0/8"}})).To(Succeed())
+			allowed := testutils.CreateClient("tcp", target.Addr(), "")
+			defer allowed.Close()
+			testutils.WriteToConn(allowed, []byte(msg))
+			Eventually(output).Should(Receive())
+			Expect(acl.Stats().RejectedConnections).To(Equal(uint64(1)))
+		})
+	})
+})
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
+)
+
+type CaptureDirection int
+
+const (
+	CaptureInbound CaptureDirection = iota
+	CaptureOutbound
+)
+
+func (dir CaptureDirection) String() string {
+	if dir == CaptureOutbound {
+		return "outbound"
+	}
+
+	return "inbound"
+}
+
+// CapturedMessage describes SIP message received or sent by the transport layer.
+type CapturedMessage struct {
+	Direction CaptureDirection
+	Time      time.Time
+	// Network is an upper-case transport protocol: UDP, TCP, TLS, WS, WSS.
+	Network    string
+	LocalAddr  string
+	RemoteAddr string
+	Message    sip.Message
+	// Data is the message as it was written to or read from the connection.
+	Data []byte
+}
+
+// SrcAddr returns address of the message sender.
+func (c *CapturedMessage) SrcAddr() string {
+	if c.Direction == CaptureOutbound {
+		return c.LocalAddr
+	}
+
+	return c.RemoteAddr
+}
+
+// DstAddr returns address of the message receiver.
+func (c *CapturedMessage) DstAddr() string {
+	if c.Direction == CaptureOutbound {
+		return c.RemoteAddr
+	}
+
+	return c.LocalAddr
+}
+
+// CaptureTap receives copies of all messages passed through the transport layer.
+// Capture is called synchronously on the message path, so implementations should be fast.
+type CaptureTap interface {
+	Capture(msg *CapturedMessage)
+}
+
+// capturer passes the messages written to or read from the connections to the tap.
+type capturer struct {
+	tap   CaptureTap
+	clock timing.Clock
+}
+
+// capture passes copy of the message data to the tap, raddr defaults to the connection remote address.
+func (c capturer) capture(dir CaptureDirection, conn Connection, raddr net.Addr, msg sip.Message, data []byte) {
+	if c.tap == nil {
+		return
+	}
+	if raddr == nil {
+		raddr = conn.RemoteAddr()
+	}
+
+	var now time.Time
+	if c.clock != nil {
+		now = c.clock.Now()
+	} else {
+		now = time.Now()
+	}
+
+	c.tap.Capture(&CapturedMessage{
+		Direction:  dir,
+		Time:       now,
+		Network:    strings.ToUpper(conn.Network()),
+		LocalAddr:  addrString(conn.LocalAddr()),
+		RemoteAddr: addrString(raddr),
+		Message:    msg,
+		Data:       append([]byte(nil), data...),
+	})
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	return addr.String()
+}
+
+// CaptureTaps combines several taps into one.
+func CaptureTaps(taps ...CaptureTap) CaptureTap {
+	return multiTap(taps)
+}
+
+type multiTap []CaptureTap
+
+func (taps multiTap) Capture(msg *CapturedMessage) {
+	for _, tap := range taps {
+		tap.Capture(msg)
+	}
+}
+
+// SplitCaptureAddr splits "host:port" address into IP and port.
+// Unresolved hosts are returned as unspecified IPv4 address.
+func SplitCaptureAddr(addr string) (net.IP, uint16) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+
+	return ip, uint16(port)
+}
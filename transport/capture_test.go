@@ -0,0 +1,122 @@
+package transport_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+type chanTap chan *transport.CapturedMessage
+
+func (tap chanTap) Capture(msg *transport.CapturedMessage) {
+	tap <- msg
+}
+
+var _ = Describe("TransportLayer capture", func() {
+	var (
+		tpl transport.Layer
+		tap chanTap
+	)
+	localAddr := "127.0.0.1:5065"
+	logger := testutils.NewLogrusLogger()
+	// compact and folded headers are changed by the serialisation
+	msg := "OPTIONS sip:bob@far-far-away.com SIP/2.0\r\n" +
+		"v: SIP/2.0/%s pc33.far-far-away.com:9001;branch=z9hG4bK776asdhds;rport\r\n" +
+		"t: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+		"f: \"Alice\"\r\n" +
+		" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+		"i: capture\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"l: 0\r\n" +
+		"\r\n"
+
+	capture := func() *transport.CapturedMessage {
+		var c *transport.CapturedMessage
+		Eventually(tap, time.Second).Should(Receive(&c))
+		return c
+	}
+
+	BeforeEach(func() {
+		tap = make(chanTap, 10)
+		tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger, transport.WithCaptureTap(tap))
+		Expect(tpl.Listen("udp", localAddr)).To(Succeed())
+		Expect(tpl.Listen("tcp", localAddr)).To(Succeed())
+	})
+	AfterEach(func(done Done) {
+		tpl.Cancel()
+		<-tpl.Done()
+		close(done)
+	}, 3)
+
+	It("should capture UDP messages as they are on the wire", func() {
+		client, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer client.Close()
+
+		raddr, err := net.ResolveUDPAddr("udp", localAddr)
+		Expect(err).ToNot(HaveOccurred())
+		data := []byte(fmt.Sprintf(msg, "UDP"))
+		_, err = client.WriteTo(data, raddr)
+		Expect(err).ToNot(HaveOccurred())
+
+		var req sip.Message
+		Eventually(tpl.Messages(), time.Second).Should(Receive(&req))
+		in := capture()
+		Expect(in.Direction).To(Equal(transport.CaptureInbound))
+		Expect(in.Network).To(Equal("UDP"))
+		Expect(strings.HasSuffix(in.LocalAddr, ":5065")).To(BeTrue())
+		Expect(in.RemoteAddr).To(Equal(client.LocalAddr().String()))
+		Expect(in.Data).To(Equal(data))
+
+		res := sip.NewResponseFromRequest("", req.(sip.Request), 200, "OK", "")
+		Expect(tpl.Send(res)).To(Succeed())
+		out := capture()
+		Expect(out.Direction).To(Equal(transport.CaptureOutbound))
+		Expect(out.LocalAddr).To(Equal(in.LocalAddr))
+		Expect(out.RemoteAddr).To(Equal(client.LocalAddr().String()))
+
+		buf := make([]byte, transport.MTU)
+		Expect(client.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+		num, _, err := client.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.Data).To(Equal(buf[:num]))
+	})
+
+	It("should capture TCP messages with the connection addresses", func() {
+		client := testutils.CreateClient("tcp", localAddr, "")
+		defer client.Close()
+
+		data := []byte(fmt.Sprintf(msg, "TCP"))
+		testutils.WriteToConn(client, data)
+
+		var req sip.Message
+		Eventually(tpl.Messages(), time.Second).Should(Receive(&req))
+		in := capture()
+		Expect(in.Direction).To(Equal(transport.CaptureInbound))
+		Expect(in.Network).To(Equal("TCP"))
+		Expect(in.LocalAddr).To(Equal(localAddr))
+		Expect(in.RemoteAddr).To(Equal(client.LocalAddr().String()))
+		Expect(in.Data).To(Equal(data))
+
+		res := sip.NewResponseFromRequest("", req.(sip.Request), 200, "OK", "")
+		Expect(tpl.Send(res)).To(Succeed())
+		out := capture()
+		Expect(out.Direction).To(Equal(transport.CaptureOutbound))
+		Expect(out.LocalAddr).To(Equal(localAddr))
+		Expect(out.RemoteAddr).To(Equal(client.LocalAddr().String()))
+
+		buf := make([]byte, transport.MTU)
+		Expect(client.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+		num, err := client.Read(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.Data).To(Equal(buf[:num]))
+	})
+})
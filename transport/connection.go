@@ -81,6 +81,14 @@ func (conn *connection) String() string {
 	return fmt.Sprintf("transport.Connection<%s>", fields)
 }
 
+// WsUpgrade returns the HTTP upgrade request of WebSocket connection accepted by WsHandler.
+func (conn *connection) WsUpgrade() *WsUpgrade {
+	if wc, ok := conn.baseConn.(*wsConn); ok {
+		return wc.upgrade
+	}
+	return nil
+}
+
 func (conn *connection) Log() log.Logger {
 	return conn.log
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghettovoice/gosip/log"
@@ -33,6 +34,22 @@ type ConnectionPool interface {
 	Length() int
 }
 
+// ConnectionPoolStats is implemented by ConnectionPool that counts the data received on its connections.
+type ConnectionPoolStats interface {
+	// Stats returns counters of the connection.
+	Stats(key ConnectionKey) (ConnectionStats, error)
+}
+
+// ConnectionStats holds counters of the data received on a connection.
+type ConnectionStats struct {
+	BytesReceived    uint64
+	MessagesReceived uint64
+	// ParseErrors is the number of dropped malformed messages.
+	ParseErrors uint64
+	// LimitViolations is the number of messages rejected due to the parser limits.
+	LimitViolations uint64
+}
+
 // ConnectionHandler serves associated connection, i.e. parses
 // incoming data, manages expiry time & etc.
 type ConnectionHandler interface {
@@ -51,9 +68,16 @@ type ConnectionHandler interface {
 	Serve()
 }
 
+// ConnectionHandlerStats is implemented by ConnectionHandler that counts the data received on the connection.
+type ConnectionHandlerStats interface {
+	// Stats returns counters of the served connection.
+	Stats() ConnectionStats
+}
+
 type connectionPool struct {
 	store     map[ConnectionKey]ConnectionHandler
 	msgMapper sip.MessageMapper
+	options   []ConnectionOption
 
 	output chan<- sip.Message
 	errs   chan<- error
@@ -75,10 +99,12 @@ func NewConnectionPool(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ConnectionOption,
 ) ConnectionPool {
 	pool := &connectionPool{
 		store:     make(map[ConnectionKey]ConnectionHandler),
 		msgMapper: msgMapper,
+		options:   options,
 
 		output: output,
 		errs:   errs,
@@ -192,6 +218,27 @@ func (pool *connectionPool) Length() int {
 	return len(pool.store)
 }
 
+func (pool *connectionPool) Stats(key ConnectionKey) (ConnectionStats, error) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	handler, err := pool.get(key)
+	if err != nil {
+		return ConnectionStats{}, err
+	}
+
+	stats, ok := handler.(ConnectionHandlerStats)
+	if !ok {
+		return ConnectionStats{}, &PoolError{
+			fmt.Errorf("connection %s does not count received data", key),
+			"get connection stats",
+			pool.String(),
+		}
+	}
+
+	return stats.Stats(), nil
+}
+
 func (pool *connectionPool) dispose() {
 	// clean pool
 	pool.DropAll()
@@ -343,6 +390,7 @@ func (pool *connectionPool) put(key ConnectionKey, conn Connection, ttl time.Dur
 		pool.herrs,
 		pool.msgMapper,
 		pool.Log(),
+		pool.options...,
 	)
 
 	logger := log.AddFieldsFrom(pool.Log(), handler)
@@ -402,9 +450,15 @@ func (pool *connectionPool) getConnection(key ConnectionKey) (Connection, error)
 
 // connectionHandler actually serves associated connection
 type connectionHandler struct {
+	// accessed atomically, keep first for 64-bit alignment
+	stats ConnectionStats
+
 	connection Connection
 	msgMapper  sip.MessageMapper
+	limits     parser.Limits
+	capturer   capturer
 
+	clock  timing.Clock
 	timer  timing.Timer
 	ttl    time.Duration
 	expiry time.Time
@@ -426,10 +480,23 @@ func NewConnectionHandler(
 	errs chan<- error,
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ConnectionOption,
 ) ConnectionHandler {
+	optsHash := ConnectionOptions{}
+	for _, opt := range options {
+		opt.ApplyConnection(&optsHash)
+	}
+	clock := optsHash.Clock
+	if clock == nil {
+		clock = timing.NewRealClock()
+	}
+
 	handler := &connectionHandler{
 		connection: conn,
 		msgMapper:  msgMapper,
+		limits:     optsHash.parserLimits(),
+		capturer:   capturer{optsHash.CaptureTap, clock},
+		clock:      clock,
 
 		output:   output,
 		errs:     errs,
@@ -450,11 +517,11 @@ func NewConnectionHandler(
 
 	// handler.Update(ttl)
 	if ttl > 0 {
-		handler.expiry = time.Now().Add(ttl)
-		handler.timer = timing.NewTimer(ttl)
+		handler.expiry = clock.Now().Add(ttl)
+		handler.timer = clock.NewTimer(ttl)
 	} else {
 		handler.expiry = time.Time{}
-		handler.timer = timing.NewTimer(0)
+		handler.timer = clock.NewTimer(0)
 		if !handler.timer.Stop() {
 			<-handler.timer.C()
 		}
@@ -494,7 +561,16 @@ func (handler *connectionHandler) Expiry() time.Time {
 }
 
 func (handler *connectionHandler) Expired() bool {
-	return !handler.Expiry().IsZero() && handler.Expiry().Before(time.Now())
+	return !handler.Expiry().IsZero() && handler.Expiry().Before(handler.clock.Now())
+}
+
+func (handler *connectionHandler) Stats() ConnectionStats {
+	return ConnectionStats{
+		BytesReceived:    atomic.LoadUint64(&handler.stats.BytesReceived),
+		MessagesReceived: atomic.LoadUint64(&handler.stats.MessagesReceived),
+		ParseErrors:      atomic.LoadUint64(&handler.stats.ParseErrors),
+		LimitViolations:  atomic.LoadUint64(&handler.stats.LimitViolations),
+	}
 }
 
 // resets the timeout timer.
@@ -543,8 +619,15 @@ func (handler *connectionHandler) readConnection() (<-chan sip.Message, <-chan e
 	)
 	if streamed {
 		strPrs = parser.NewParser(msgs, errs, streamed, handler.Log())
+		strPrs.SetLimits(handler.limits)
+		if handler.capturer.tap != nil {
+			strPrs.SetRawHandler(func(msg sip.Message, data []byte) {
+				handler.capturer.capture(CaptureInbound, handler.Connection(), nil, msg, data)
+			})
+		}
 	} else {
 		pktPrs = parser.NewPacketParser(handler.Log())
+		pktPrs.SetLimits(handler.limits)
 	}
 
 	var raddr net.Addr
@@ -615,6 +698,8 @@ func (handler *connectionHandler) readConnection() (<-chan sip.Message, <-chan e
 				return
 			}
 
+			atomic.AddUint64(&handler.stats.BytesReceived, uint64(num))
+
 			data := buf[:num]
 
 			// skip empty udp packets
@@ -631,8 +716,14 @@ func (handler *connectionHandler) readConnection() (<-chan sip.Message, <-chan e
 				}
 			} else {
 				if msg, err := pktPrs.ParseMessage(data); err == nil {
+					handler.capturer.capture(CaptureInbound, handler.Connection(), raddr, msg, data)
 					handler.handleMessage(msg, fmt.Sprintf("%v", raddr))
 				} else {
+					var lerr *parser.LimitError
+					if errors.As(err, &lerr) {
+						handler.handleLimitError(lerr, raddr)
+					}
+
 					handler.handleError(err, fmt.Sprintf("%v", raddr))
 				}
 			}
@@ -675,6 +766,11 @@ func (handler *connectionHandler) pipeOutputs(msgs <-chan sip.Message, errs <-ch
 				return
 			}
 
+			var lerr *parser.LimitError
+			if errors.As(err, &lerr) {
+				handler.handleLimitError(lerr, handler.Connection().RemoteAddr())
+			}
+
 			handler.handleError(err, handler.getRemoteAddr())
 		}
 	}
@@ -738,22 +834,32 @@ func (handler *connectionHandler) handleMessage(msg sip.Message, raddr string) {
 		msg.SetSource(raddr)
 	}
 
-	msg = handler.msgMapper(msg.WithFields(log.Fields{
+	atomic.AddUint64(&handler.stats.MessagesReceived, 1)
+
+	fields := log.Fields{
 		"connection_key": handler.Connection().Key(),
-		"received_at":    time.Now(),
-	}))
+		"received_at":    handler.clock.Now(),
+	}
+	if conn, ok := handler.Connection().(interface{ WsUpgrade() *WsUpgrade }); ok {
+		if upgrade := conn.WsUpgrade(); upgrade != nil {
+			fields[wsUpgradeField] = upgrade
+		}
+	}
+
+	msg = handler.msgMapper(msg.WithFields(fields))
 
 	// pass up
 	handler.output <- msg
 
 	if !handler.Expiry().IsZero() {
-		handler.expiry = time.Now().Add(handler.ttl)
+		handler.expiry = handler.clock.Now().Add(handler.ttl)
 		handler.timer.Reset(handler.ttl)
 	}
 }
 
 func (handler *connectionHandler) handleError(err error, raddr string) {
 	if isSyntaxError(err) {
+		atomic.AddUint64(&handler.stats.ParseErrors, 1)
 		handler.Log().Tracef("ignore error: %s", err)
 		return
 	}
@@ -773,6 +879,43 @@ func (handler *connectionHandler) handleError(err error, raddr string) {
 	}
 }
 
+// Responds to the request rejected due to the parser limits with 413 or 513 (RFC 3261 21.4.11, 21.5.9).
+// Streamed connection is closed, because the start of the next message can not be found anymore.
+func (handler *connectionHandler) handleLimitError(err *parser.LimitError, raddr net.Addr) {
+	atomic.AddUint64(&handler.stats.LimitViolations, 1)
+
+	handler.Log().Warnf("message rejected: %s", err)
+
+	if req, ok := err.Msg.(sip.Request); ok && !req.IsAck() {
+		_, hasVia := req.ViaHop()
+		_, hasCSeq := req.CSeq()
+		if hasVia && hasCSeq {
+			res := sip.NewResponseFromRequest("", req, err.StatusCode(), err.Reason(), "")
+			data := []byte(res.String())
+
+			var werr error
+			if handler.Connection().Streamed() {
+				_, werr = handler.Connection().Write(data)
+			} else {
+				_, werr = handler.Connection().WriteTo(data, raddr)
+			}
+			if werr != nil {
+				handler.Log().Warnf("send '%d %s' response failed: %s", res.StatusCode(), res.Reason(), werr)
+			} else {
+				handler.capturer.capture(CaptureOutbound, handler.Connection(), raddr, res, data)
+			}
+		}
+	}
+
+	if handler.Connection().Streamed() {
+		handler.Log().Debug("close connection after rejected message")
+
+		if cerr := handler.Connection().Close(); cerr != nil {
+			handler.Log().Warnf("close connection failed: %s", cerr)
+		}
+	}
+}
+
 func isSyntaxError(err error) bool {
 	var perr parser.Error
 	if errors.As(err, &perr) && perr.Syntax() {
@@ -1,6 +1,8 @@
 package transport_test
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -10,6 +12,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
 	"github.com/ghettovoice/gosip/testutils"
 	"github.com/ghettovoice/gosip/timing"
 	"github.com/ghettovoice/gosip/transport"
@@ -48,7 +51,7 @@ var _ = Describe("ConnectionHandler", func() {
 
 	logger := testutils.NewLogrusLogger()
 
-	timing.MockMode = true
+	clock := timing.NewFakeClock(time.Unix(0, 0))
 
 	Context("just initialized", func() {
 		var ttl time.Duration
@@ -68,7 +71,7 @@ var _ = Describe("ConnectionHandler", func() {
 			close(errs)
 		})
 		JustBeforeEach(func() {
-			handler = transport.NewConnectionHandler(conn, ttl, output, errs, nil, logger)
+			handler = transport.NewConnectionHandler(conn, ttl, output, errs, nil, logger, transport.WithClock(clock))
 		})
 
 		HasCorrectKeyAndConn := func() {
@@ -98,7 +101,7 @@ var _ = Describe("ConnectionHandler", func() {
 			var expectedExpire time.Time
 			BeforeEach(func() {
 				ttl = 100 * time.Millisecond
-				expectedExpire = time.Now().Add(ttl)
+				expectedExpire = clock.Now().Add(ttl)
 			})
 			HasCorrectKeyAndConn()
 			It("should set expiry time to Now() + 0.1 * time.Second", func() {
@@ -106,17 +109,18 @@ var _ = Describe("ConnectionHandler", func() {
 			})
 			It("should not be expired before TTL", func() {
 				Expect(handler.Expired()).To(BeFalse())
-				Eventually(func() bool {
-					return handler.Expired()
-				}).Should(BeTrue())
+				clock.Advance(ttl + time.Nanosecond)
+				Expect(handler.Expired()).To(BeTrue())
 			})
 		})
 	})
 
 	Context("serving connection", func() {
 		var ttl time.Duration = 0
+		var limits parser.Limits
 
 		BeforeEach(func() {
+			limits = parser.Limits{}
 			output = make(chan sip.Message)
 			errs = make(chan error)
 			c1, c2 := net.Pipe()
@@ -136,10 +140,57 @@ var _ = Describe("ConnectionHandler", func() {
 			close(errs)
 		})
 		JustBeforeEach(func() {
-			handler = transport.NewConnectionHandler(conn, ttl, output, errs, nil, logger)
+			handler = transport.NewConnectionHandler(conn, ttl, output, errs, nil, logger,
+				transport.WithClock(clock), transport.WithParserLimits(limits))
 			go handler.Serve()
 		})
 
+		Context("when message exceeds parser limits", func() {
+			bigMsg := "MESSAGE sip:bob@far-far-away.com SIP/2.0\r\n" +
+				"Via: SIP/2.0/TCP pc33.far-far-away.com;branch=z9hG4bK776asdhds\r\n" +
+				"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+				"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+				"Call-ID: a84b4c76e66710\r\n" +
+				"CSeq: 1 MESSAGE\r\n" +
+				"Content-Length: 12\r\n" +
+				"\r\n" +
+				"Hello world!"
+
+			BeforeEach(func() {
+				limits = parser.Limits{MaxBodySize: 8}
+			})
+			JustBeforeEach(func() {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					testutils.WriteToConn(client, []byte(bigMsg))
+				}()
+			})
+
+			It("should respond with 413 and close the connection", func(done Done) {
+				line, err := bufio.NewReader(client).ReadString('\n')
+				Expect(err).ToNot(HaveOccurred())
+				Expect(line).To(Equal("SIP/2.0 413 Request Entity Too Large\r\n"))
+
+				var limitErrs int
+				for i := 0; i < 2; i++ {
+					var lerr *parser.LimitError
+					if errors.As(<-errs, &lerr) {
+						limitErrs++
+						Expect(lerr.Limit).To(Equal(parser.LimitBodySize))
+					}
+				}
+				Expect(limitErrs).To(Equal(1))
+
+				<-handler.Done()
+				Expect(handler.(transport.ConnectionHandlerStats).Stats()).To(Equal(transport.ConnectionStats{
+					BytesReceived:   uint64(len(bigMsg)),
+					LimitViolations: 1,
+				}))
+				close(done)
+			}, 3)
+		})
+
 		Context("when new data arrives", func() {
 			JustBeforeEach(func() {
 				wg.Add(1)
@@ -185,7 +236,7 @@ var _ = Describe("ConnectionHandler", func() {
 				ttl = 0
 			})
 			It("should never expire", func() {
-				timing.Elapse(time.Duration(time.Unix(1<<63-1, 0).Nanosecond()))
+				clock.Advance(time.Duration(time.Unix(1<<63-1, 0).Nanosecond()))
 				select {
 				case <-handler.Done():
 					Fail("should run forever")
@@ -201,7 +252,7 @@ var _ = Describe("ConnectionHandler", func() {
 				ttl = 100 * time.Millisecond
 			})
 			It("should fire expire error after 0.1 * time.Second", func() {
-				timing.Elapse(ttl + time.Nanosecond)
+				clock.Advance(ttl + time.Nanosecond)
 				select {
 				case <-handler.Done():
 					Fail("should never complete")
@@ -275,7 +326,7 @@ var _ = Describe("ConnectionPool", func() {
 
 	logger := testutils.NewLogrusLogger()
 
-	timing.MockMode = true
+	clock := timing.NewFakeClock(time.Unix(0, 0))
 
 	AssertIsEmpty := func() {
 		Expect(pool.Length()).To(Equal(0))
@@ -292,7 +343,7 @@ var _ = Describe("ConnectionPool", func() {
 			output = make(chan sip.Message)
 			errs = make(chan error)
 			cancel = make(chan struct{})
-			pool = transport.NewConnectionPool(output, errs, cancel, nil, logger)
+			pool = transport.NewConnectionPool(output, errs, cancel, nil, logger, transport.WithClock(clock))
 		})
 
 		ShouldBeEmpty()
@@ -309,7 +360,7 @@ var _ = Describe("ConnectionPool", func() {
 			output = make(chan sip.Message)
 			errs = make(chan error)
 			cancel = make(chan struct{})
-			pool = transport.NewConnectionPool(output, errs, cancel, nil, logger)
+			pool = transport.NewConnectionPool(output, errs, cancel, nil, logger, transport.WithClock(clock))
 			expected = "connection pool closed"
 
 			_, c2 := net.Pipe()
@@ -346,7 +397,7 @@ var _ = Describe("ConnectionPool", func() {
 			output = make(chan sip.Message)
 			errs = make(chan error)
 			cancel = make(chan struct{})
-			pool = transport.NewConnectionPool(output, errs, cancel, nil, logger)
+			pool = transport.NewConnectionPool(output, errs, cancel, nil, logger, transport.WithClock(clock))
 
 			client1, server1 = createConn(addr1)
 			client2, server2 = createConn(addr2)
@@ -414,6 +465,12 @@ var _ = Describe("ConnectionPool", func() {
 				It("should find connection server1 by key1", func() {
 					Expect(pool.Get(key1)).To(Equal(server1))
 				})
+
+				It("should return stats of connection server1 by key1", func() {
+					stats, err := pool.(transport.ConnectionPoolStats).Stats(key1)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(stats).To(Equal(transport.ConnectionStats{}))
+				})
 			})
 		})
 
@@ -530,7 +587,7 @@ var _ = Describe("ConnectionPool", func() {
 
 			Context("after connection server1 expiry time", func() {
 				BeforeEach(func() {
-					timing.Elapse(ttl + time.Nanosecond)
+					clock.Advance(ttl + time.Nanosecond)
 					time.Sleep(time.Millisecond)
 				}, 3)
 				ShouldBeEmpty()
@@ -558,7 +615,7 @@ var _ = Describe("ConnectionPool", func() {
 						time.Sleep(10 * time.Millisecond)
 						testutils.WriteToConn(client2, []byte(msg2))
 						time.Sleep(20 * time.Millisecond)
-						timing.Elapse(ttl2 + time.Nanosecond)
+						clock.Advance(ttl2 + time.Nanosecond)
 					}()
 					go func() {
 						time.Sleep(20 * time.Millisecond)
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/tracing"
 )
 
 func init() {
@@ -26,6 +30,9 @@ type Layer interface {
 	Errors() <-chan error
 	// Listen starts listening on `addr` for each registered protocol.
 	Listen(network string, addr string, options ...ListenOption) error
+	// WsHandler returns http.Handler that accepts SIP over WebSocket connections
+	// of the ws or wss network, so they can be served by an existing HTTP server.
+	WsHandler(network string, options ...WsHandlerOption) (http.Handler, error)
 	// Send sends message on suitable protocol.
 	Send(msg sip.Message) error
 	String() string
@@ -40,18 +47,19 @@ var protocolFactory ProtocolFactory = func(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) (Protocol, error) {
 	switch strings.ToLower(network) {
 	case "udp":
-		return NewUdpProtocol(output, errs, cancel, msgMapper, logger), nil
+		return NewUdpProtocol(output, errs, cancel, msgMapper, logger, options...), nil
 	case "tcp":
-		return NewTcpProtocol(output, errs, cancel, msgMapper, logger), nil
+		return NewTcpProtocol(output, errs, cancel, msgMapper, logger, options...), nil
 	case "tls":
-		return NewTlsProtocol(output, errs, cancel, msgMapper, logger), nil
+		return NewTlsProtocol(output, errs, cancel, msgMapper, logger, options...), nil
 	case "ws":
-		return NewWsProtocol(output, errs, cancel, msgMapper, logger), nil
+		return NewWsProtocol(output, errs, cancel, msgMapper, logger, options...), nil
 	case "wss":
-		return NewWssProtocol(output, errs, cancel, msgMapper, logger), nil
+		return NewWssProtocol(output, errs, cancel, msgMapper, logger, options...), nil
 	default:
 		return nil, UnsupportedProtocolError(fmt.Sprintf("protocol %s is not supported", network))
 	}
@@ -74,6 +82,11 @@ type layer struct {
 	ip          net.IP
 	dnsResolver *net.Resolver
 	msgMapper   sip.MessageMapper
+	tracer      tracing.Tracer
+	tap         CaptureTap
+	clock       timing.Clock
+	limits      *parser.Limits
+	wsKeepAlive *WsKeepAlive
 
 	msgs     chan sip.Message
 	errs     chan error
@@ -96,13 +109,33 @@ func NewLayer(
 	dnsResolver *net.Resolver,
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...LayerOption,
 ) Layer {
+	optsHash := &LayerOptions{}
+	for _, opt := range options {
+		opt.ApplyLayer(optsHash)
+	}
+
+	tracer := optsHash.Tracer
+	if tracer == nil {
+		tracer = tracing.NoopTracer()
+	}
+	clock := optsHash.Clock
+	if clock == nil {
+		clock = timing.NewRealClock()
+	}
+
 	tpl := &layer{
 		protocols:   newProtocolStore(),
 		listenPorts: make(map[string][]sip.Port),
 		ip:          ip,
 		dnsResolver: dnsResolver,
 		msgMapper:   msgMapper,
+		tracer:      tracer,
+		tap:         optsHash.CaptureTap,
+		clock:       clock,
+		limits:      optsHash.ParserLimits,
+		wsKeepAlive: optsHash.WsKeepAlive,
 
 		msgs:     make(chan sip.Message),
 		errs:     make(chan error),
@@ -182,21 +215,9 @@ func (tpl *layer) Listen(network string, addr string, options ...ListenOption) e
 	default:
 	}
 
-	protocol, ok := tpl.protocols.get(protocolKey(network))
-	if !ok {
-		var err error
-		protocol, err = protocolFactory(
-			network,
-			tpl.pmsgs,
-			tpl.perrs,
-			tpl.canceled,
-			tpl.msgMapper,
-			tpl.Log(),
-		)
-		if err != nil {
-			return err
-		}
-		tpl.protocols.put(protocolKey(protocol.Network()), protocol)
+	protocol, err := tpl.getOrCreateProtocol(network)
+	if err != nil {
+		return err
 	}
 	target, err := NewTargetFromAddr(addr)
 	if err != nil {
@@ -217,6 +238,59 @@ func (tpl *layer) Listen(network string, addr string, options ...ListenOption) e
 	return err
 }
 
+func (tpl *layer) WsHandler(network string, options ...WsHandlerOption) (http.Handler, error) {
+	select {
+	case <-tpl.canceled:
+		return nil, fmt.Errorf("transport layer is canceled")
+	default:
+	}
+
+	protocol, err := tpl.getOrCreateProtocol(network)
+	if err != nil {
+		return nil, err
+	}
+	wsProtocol, ok := protocol.(interface {
+		Handler(options ...WsHandlerOption) http.Handler
+	})
+	if !ok {
+		return nil, fmt.Errorf("%s protocol can not be served by HTTP handler", protocol.Network())
+	}
+
+	return wsProtocol.Handler(options...), nil
+}
+
+func (tpl *layer) getOrCreateProtocol(network string) (Protocol, error) {
+	if protocol, ok := tpl.protocols.get(protocolKey(network)); ok {
+		return protocol, nil
+	}
+
+	options := []ProtocolOption{WithClock(tpl.clock)}
+	if tpl.limits != nil {
+		options = append(options, WithParserLimits(*tpl.limits))
+	}
+	if tpl.wsKeepAlive != nil {
+		options = append(options, WithWsKeepAlive(*tpl.wsKeepAlive))
+	}
+	if tpl.tap != nil {
+		options = append(options, WithCaptureTap(tpl.tap))
+	}
+	protocol, err := protocolFactory(
+		network,
+		tpl.pmsgs,
+		tpl.perrs,
+		tpl.canceled,
+		tpl.msgMapper,
+		tpl.Log(),
+		options...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	tpl.protocols.put(protocolKey(protocol.Network()), protocol)
+
+	return protocol, nil
+}
+
 func (tpl *layer) Send(msg sip.Message) error {
 	select {
 	case <-tpl.canceled:
@@ -263,8 +337,13 @@ func (tpl *layer) Send(msg sip.Message) error {
 
 		// dns srv lookup
 		if net.ParseIP(target.Host) == nil {
-			ctx := context.Background()
 			proto := strings.ToLower(network)
+			ctx, span := tpl.tracer.Start(
+				tracing.ContextFromMessage(context.Background(), msg),
+				"DNS SRV",
+				tracing.SpanKindClient,
+				tracing.String("dns.question.name", fmt.Sprintf("_sip._%s.%s", proto, target.Host)),
+			)
 			if _, addrs, err := tpl.dnsResolver.LookupSRV(ctx, "sip", proto, target.Host); err == nil && len(addrs) > 0 {
 				addr := addrs[0]
 				addrStr := fmt.Sprintf("%s:%d", addr.Target[:len(addr.Target)-1], addr.Port)
@@ -296,7 +375,11 @@ func (tpl *layer) Send(msg sip.Message) error {
 						target.Port = &port
 					}
 				}
+			} else {
+				span.RecordError(err)
 			}
+			span.SetAttributes(tracing.String("net.peer.addr", target.Addr()))
+			span.End()
 		}
 
 		logger := log.AddFieldsFrom(tpl.Log(), protocol, msg)
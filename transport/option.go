@@ -2,9 +2,13 @@ package transport
 
 import (
 	"net"
+	"time"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/sip/parser"
+	"github.com/ghettovoice/gosip/timing"
+	"github.com/ghettovoice/gosip/tracing"
 )
 
 // TODO migrate other factories to functional arguments
@@ -19,7 +23,12 @@ type LayerOption interface {
 
 type LayerOptions struct {
 	Options
-	DNSResolver *net.Resolver
+	Clock        timing.Clock
+	DNSResolver  *net.Resolver
+	Tracer       tracing.Tracer
+	CaptureTap   CaptureTap
+	ParserLimits *parser.Limits
+	WsKeepAlive  *WsKeepAlive
 }
 
 type ProtocolOption interface {
@@ -28,6 +37,56 @@ type ProtocolOption interface {
 
 type ProtocolOptions struct {
 	Options
+	Clock        timing.Clock
+	CaptureTap   CaptureTap
+	ParserLimits *parser.Limits
+	WsKeepAlive  *WsKeepAlive
+}
+
+// ConnectionOption modifies ConnectionPool and ConnectionHandler.
+type ConnectionOption interface {
+	ApplyConnection(opts *ConnectionOptions)
+}
+
+type ConnectionOptions struct {
+	Clock        timing.Clock
+	CaptureTap   CaptureTap
+	ParserLimits *parser.Limits
+}
+
+func (opts *ConnectionOptions) parserLimits() parser.Limits {
+	if opts.ParserLimits == nil {
+		return parser.DefaultLimits
+	}
+	return *opts.ParserLimits
+}
+
+func (opts *ProtocolOptions) parserLimits() parser.Limits {
+	if opts.ParserLimits == nil {
+		return parser.DefaultLimits
+	}
+	return *opts.ParserLimits
+}
+
+func (opts *ProtocolOptions) wsKeepAlive() WsKeepAlive {
+	if opts.WsKeepAlive == nil {
+		return DefaultWsKeepAlive
+	}
+	return *opts.WsKeepAlive
+}
+
+// WsKeepAlive configures pings of idle WebSocket connections (RFC 6455 s. 5.5.2, RFC 7118 s. 6).
+type WsKeepAlive struct {
+	// Interval of idleness after which Ping frame is sent, zero disables pings.
+	Interval time.Duration
+	// Timeout to wait for any frame after the Ping, then the peer is considered dead and the connection is closed.
+	Timeout time.Duration
+}
+
+// DefaultWsKeepAlive keeps connections open through proxies and NATs with idle timeouts of a minute.
+var DefaultWsKeepAlive = WsKeepAlive{
+	Interval: 30 * time.Second,
+	Timeout:  10 * time.Second,
 }
 
 func WithMessageMapper(mapper sip.MessageMapper) interface {
@@ -68,6 +127,77 @@ func (o withLogger) ApplyProtocol(opts *ProtocolOptions) {
 	opts.Logger = o.logger
 }
 
+// WithClock sets clock that drives connection expiry timers, default is the real clock.
+func WithClock(clock timing.Clock) interface {
+	LayerOption
+	ProtocolOption
+	ConnectionOption
+} {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock timing.Clock
+}
+
+func (o withClock) ApplyLayer(opts *LayerOptions) {
+	opts.Clock = o.clock
+}
+
+func (o withClock) ApplyProtocol(opts *ProtocolOptions) {
+	opts.Clock = o.clock
+}
+
+func (o withClock) ApplyConnection(opts *ConnectionOptions) {
+	opts.Clock = o.clock
+}
+
+// WithParserLimits sets resource limits of incoming messages, default is parser.DefaultLimits.
+// Zero Limits disable all checks.
+func WithParserLimits(limits parser.Limits) interface {
+	LayerOption
+	ProtocolOption
+	ConnectionOption
+} {
+	return withParserLimits{limits}
+}
+
+type withParserLimits struct {
+	limits parser.Limits
+}
+
+func (o withParserLimits) ApplyLayer(opts *LayerOptions) {
+	opts.ParserLimits = &o.limits
+}
+
+func (o withParserLimits) ApplyProtocol(opts *ProtocolOptions) {
+	opts.ParserLimits = &o.limits
+}
+
+func (o withParserLimits) ApplyConnection(opts *ConnectionOptions) {
+	opts.ParserLimits = &o.limits
+}
+
+// WithWsKeepAlive sets keep-alive of WS and WSS connections, default is DefaultWsKeepAlive.
+func WithWsKeepAlive(keepAlive WsKeepAlive) interface {
+	LayerOption
+	ProtocolOption
+} {
+	return withWsKeepAlive{keepAlive}
+}
+
+type withWsKeepAlive struct {
+	keepAlive WsKeepAlive
+}
+
+func (o withWsKeepAlive) ApplyLayer(opts *LayerOptions) {
+	opts.WsKeepAlive = &o.keepAlive
+}
+
+func (o withWsKeepAlive) ApplyProtocol(opts *ProtocolOptions) {
+	opts.WsKeepAlive = &o.keepAlive
+}
+
 func WithDNSResolver(resolver *net.Resolver) LayerOption {
 	return withDnsResolver{resolver}
 }
@@ -80,6 +210,43 @@ func (o withDnsResolver) ApplyLayer(opts *LayerOptions) {
 	opts.DNSResolver = o.resolver
 }
 
+func WithTracer(tracer tracing.Tracer) LayerOption {
+	return withTracer{tracer}
+}
+
+type withTracer struct {
+	tracer tracing.Tracer
+}
+
+func (o withTracer) ApplyLayer(opts *LayerOptions) {
+	opts.Tracer = o.tracer
+}
+
+// WithCaptureTap sets tap that receives copies of all sent and received messages.
+func WithCaptureTap(tap CaptureTap) interface {
+	LayerOption
+	ProtocolOption
+	ConnectionOption
+} {
+	return withCaptureTap{tap}
+}
+
+type withCaptureTap struct {
+	tap CaptureTap
+}
+
+func (o withCaptureTap) ApplyLayer(opts *LayerOptions) {
+	opts.CaptureTap = o.tap
+}
+
+func (o withCaptureTap) ApplyProtocol(opts *ProtocolOptions) {
+	opts.CaptureTap = o.tap
+}
+
+func (o withCaptureTap) ApplyConnection(opts *ConnectionOptions) {
+	opts.CaptureTap = o.tap
+}
+
 // Listen method options
 type ListenOption interface {
 	ApplyListen(opts *ListenOptions)
@@ -87,4 +254,6 @@ type ListenOption interface {
 
 type ListenOptions struct {
 	TLSConfig TLSConfig
+	// ACL restricts peers of the listener.
+	ACL *ACL
 }
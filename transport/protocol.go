@@ -32,12 +32,14 @@ type ProtocolFactory func(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) (Protocol, error)
 
 type protocol struct {
 	network  string
 	reliable bool
 	streamed bool
+	capturer capturer
 
 	log log.Logger
 }
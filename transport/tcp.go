@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
@@ -27,6 +28,9 @@ type tcpProtocol struct {
 	listen      func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error)
 	dial        func(addr *net.TCPAddr) (net.Conn, error)
 	resolveAddr func(addr string) (*net.TCPAddr, error)
+
+	doneOnce sync.Once
+	done     chan struct{}
 }
 
 func NewTcpProtocol(
@@ -35,7 +39,13 @@ func NewTcpProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
+	optsHash := &ProtocolOptions{}
+	for _, opt := range options {
+		opt.ApplyProtocol(optsHash)
+	}
+
 	p := new(tcpProtocol)
 	p.network = "tcp"
 	p.reliable = true
@@ -48,7 +58,17 @@ func NewTcpProtocol(
 		})
 	// TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(
+		output,
+		errs,
+		cancel,
+		msgMapper,
+		p.Log(),
+		WithClock(optsHash.Clock),
+		WithParserLimits(optsHash.parserLimits()),
+		WithCaptureTap(optsHash.CaptureTap),
+	)
+	p.capturer = capturer{optsHash.CaptureTap, optsHash.Clock}
 	p.listen = p.defaultListen
 	p.dial = p.defaultDial
 	p.resolveAddr = p.defaultResolveAddr
@@ -70,8 +90,17 @@ func (p *tcpProtocol) defaultResolveAddr(addr string) (*net.TCPAddr, error) {
 	return net.ResolveTCPAddr(p.network, addr)
 }
 
+// Done is closed when listeners and connections are closed, so their addresses can be reused.
 func (p *tcpProtocol) Done() <-chan struct{} {
-	return p.connections.Done()
+	p.doneOnce.Do(func() {
+		p.done = make(chan struct{})
+		go func() {
+			<-p.listeners.Done()
+			<-p.connections.Done()
+			close(p.done)
+		}()
+	})
+	return p.done
 }
 
 // piping new connections to connection pool for serving
@@ -122,6 +151,10 @@ func (p *tcpProtocol) Listen(target *Target, options ...ListenOption) error {
 
 	p.Log().Debugf("begin listening on %s %s", p.Network(), target.Addr())
 
+	if acl := listenACL(options); acl != nil {
+		listener = &aclListener{Listener: listener, acl: acl, log: p.Log()}
+	}
+
 	// index listeners by local address
 	// should live infinitely
 	key := ListenerKey(fmt.Sprintf("%s:0.0.0.0:%d", p.network, target.Port))
@@ -175,16 +208,18 @@ func (p *tcpProtocol) Send(target *Target, msg sip.Message) error {
 	logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
 
 	// send message
-	_, err = conn.Write([]byte(msg.String()))
-	if err != nil {
-		err = &ProtocolError{
+	data := []byte(msg.String())
+	if _, err = conn.Write(data); err != nil {
+		return &ProtocolError{
 			Err:      err,
 			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
 			ProtoPtr: fmt.Sprintf("%p", p),
 		}
 	}
 
-	return err
+	p.capturer.capture(CaptureOutbound, conn, nil, msg, data)
+
+	return nil
 }
 
 func (p *tcpProtocol) getOrCreateConnection(raddr *net.TCPAddr) (Connection, error) {
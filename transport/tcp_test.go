@@ -73,7 +73,7 @@ var _ = Describe("TcpProtocol", func() {
 
 	logger := testutils.NewLogrusLogger()
 
-	timing.MockMode = true
+	clock := timing.NewFakeClock(time.Unix(0, 0))
 
 	closeClients := func() {
 		if client1 != nil {
@@ -92,7 +92,7 @@ var _ = Describe("TcpProtocol", func() {
 		output = make(chan sip.Message)
 		errs = make(chan error)
 		cancel = make(chan struct{})
-		protocol = transport.NewTcpProtocol(output, errs, cancel, nil, logger)
+		protocol = transport.NewTcpProtocol(output, errs, cancel, nil, logger, transport.WithClock(clock))
 	})
 	AfterEach(func(done Done) {
 		wg.Wait()
@@ -20,7 +20,13 @@ func NewTlsProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
+	optsHash := &ProtocolOptions{}
+	for _, opt := range options {
+		opt.ApplyProtocol(optsHash)
+	}
+
 	p := new(tlsProtocol)
 	p.network = "tls"
 	p.reliable = true
@@ -33,7 +39,17 @@ func NewTlsProtocol(
 		})
 	//TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(
+		output,
+		errs,
+		cancel,
+		msgMapper,
+		p.Log(),
+		WithClock(optsHash.Clock),
+		WithParserLimits(optsHash.parserLimits()),
+		WithCaptureTap(optsHash.CaptureTap),
+	)
+	p.capturer = capturer{optsHash.CaptureTap, optsHash.Clock}
 	p.listen = func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error) {
 		if len(options) == 0 {
 			return net.ListenTCP("tcp", addr)
@@ -46,9 +62,13 @@ func NewTlsProtocol(
 		if err != nil {
 			return nil, fmt.Errorf("load TLS certficate %s: %w", optsHash.TLSConfig.Cert, err)
 		}
-		return tls.Listen("tcp", addr.String(), &tls.Config{
+		config := &tls.Config{
 			Certificates: []tls.Certificate{cert},
-		})
+		}
+		if optsHash.ACL != nil {
+			optsHash.ACL.configureTLS(config)
+		}
+		return tls.Listen("tcp", addr.String(), config)
 	}
 	p.dial = func(addr *net.TCPAddr) (net.Conn, error) {
 		return tls.Dial("tcp", addr.String(), &tls.Config{
@@ -83,7 +83,7 @@ var _ = Describe("TlsProtocol", func() {
 
 	logger := testutils.NewLogrusLogger()
 
-	timing.MockMode = true
+	clock := timing.NewFakeClock(time.Unix(0, 0))
 
 	closeClients := func() {
 		if client1 != nil {
@@ -102,7 +102,7 @@ var _ = Describe("TlsProtocol", func() {
 		output = make(chan sip.Message)
 		errs = make(chan error)
 		cancel = make(chan struct{})
-		protocol = transport.NewTlsProtocol(output, errs, cancel, nil, logger)
+		protocol = transport.NewTlsProtocol(output, errs, cancel, nil, logger, transport.WithClock(clock))
 	})
 	AfterEach(func(done Done) {
 		wg.Wait()
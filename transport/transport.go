@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/gobwas/ws"
+
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
 )
@@ -190,6 +192,26 @@ func (err ExpireError) Canceled() bool  { return false }
 func (err ExpireError) Expired() bool   { return true }
 func (err ExpireError) Error() string   { return "transport.ExpireError: " + string(err) }
 
+// WsCloseError is returned from reads of WebSocket connection closed by the peer with Close frame
+// or dropped by the keep-alive as dead (RFC 6455 s. 7.4).
+// It matches io.EOF, so the connection is dropped from the pool like any other closed stream.
+type WsCloseError struct {
+	Code   ws.StatusCode
+	Reason string
+}
+
+func (err *WsCloseError) Is(target error) bool { return target == io.EOF }
+func (err *WsCloseError) Network() bool         { return true }
+func (err *WsCloseError) Timeout() bool         { return err.Code == ws.StatusAbnormalClosure }
+func (err *WsCloseError) Temporary() bool       { return false }
+func (err *WsCloseError) Error() string {
+	if err == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("transport.WsCloseError: %d %s", err.Code, err.Reason)
+}
+
 // Net Protocol level error
 type ProtocolError struct {
 	Err      error
@@ -233,7 +255,7 @@ func (err *ConnectionHandlerError) Temporary() bool { return isTemporary(err.Err
 func (err *ConnectionHandlerError) Canceled() bool  { return isCanceled(err.Err) }
 func (err *ConnectionHandlerError) Expired() bool   { return isExpired(err.Err) }
 func (err *ConnectionHandlerError) EOF() bool {
-	if err.Err == io.EOF {
+	if errors.Is(err.Err, io.EOF) {
 		return true
 	}
 	ok, _ := regexp.MatchString("(?i)eof", err.Err.Error())
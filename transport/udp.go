@@ -21,7 +21,13 @@ func NewUdpProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
+	optsHash := &ProtocolOptions{}
+	for _, opt := range options {
+		opt.ApplyProtocol(optsHash)
+	}
+
 	p := new(udpProtocol)
 	p.network = "udp"
 	p.reliable = false
@@ -32,7 +38,17 @@ func NewUdpProtocol(
 			"protocol_ptr": fmt.Sprintf("%p", p),
 		})
 	// TODO: add separate errs chan to listen errors from pool for reconnection?
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(
+		output,
+		errs,
+		cancel,
+		msgMapper,
+		p.Log(),
+		WithClock(optsHash.Clock),
+		WithParserLimits(optsHash.parserLimits()),
+		WithCaptureTap(optsHash.CaptureTap),
+	)
+	p.capturer = capturer{optsHash.CaptureTap, optsHash.Clock}
 
 	return p
 }
@@ -65,10 +81,15 @@ func (p *udpProtocol) Listen(target *Target, options ...ListenOption) error {
 
 	p.Log().Debugf("begin listening on %s %s", p.Network(), laddr)
 
+	var baseConn net.Conn = udpConn
+	if acl := listenACL(options); acl != nil {
+		baseConn = &aclPacketConn{UDPConn: udpConn, acl: acl, log: p.Log()}
+	}
+
 	// register new connection
 	// index by local address, TTL=0 - unlimited expiry time
 	key := ConnectionKey(fmt.Sprintf("%s:0.0.0.0:%d", p.network, laddr.Port))
-	conn := NewConnection(udpConn, key, p.network, p.Log())
+	conn := NewConnection(baseConn, key, p.network, p.Log())
 	err = p.connections.Put(conn, 0)
 	if err != nil {
 		err = &ProtocolError{
@@ -118,7 +139,8 @@ func (p *udpProtocol) Send(target *Target, msg sip.Message) error {
 			logger := log.AddFieldsFrom(p.Log(), conn, msg)
 			logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
 
-			if _, err = conn.WriteTo([]byte(msg.String()), raddr); err != nil {
+			data := []byte(msg.String())
+			if _, err = conn.WriteTo(data, raddr); err != nil {
 				return &ProtocolError{
 					Err:      err,
 					Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
@@ -126,6 +148,8 @@ func (p *udpProtocol) Send(target *Target, msg sip.Message) error {
 				}
 			}
 
+			p.capturer.capture(CaptureOutbound, conn, raddr, msg, data)
+
 			return nil
 		}
 	}
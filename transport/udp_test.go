@@ -75,7 +75,7 @@ var _ = Describe("UdpProtocol", func() {
 
 	logger := testutils.NewLogrusLogger()
 
-	timing.MockMode = true
+	clock := timing.NewFakeClock(time.Unix(0, 0))
 
 	closeClients := func() {
 		if client1 != nil {
@@ -94,7 +94,7 @@ var _ = Describe("UdpProtocol", func() {
 		output = make(chan sip.Message)
 		errs = make(chan error)
 		cancel = make(chan struct{})
-		protocol = transport.NewUdpProtocol(output, errs, cancel, nil, logger)
+		protocol = transport.NewUdpProtocol(output, errs, cancel, nil, logger, transport.WithClock(clock))
 	})
 	AfterEach(func(done Done) {
 		wg.Wait()
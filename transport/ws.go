@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gobwas/ws"
@@ -14,62 +18,338 @@ import (
 
 	"github.com/ghettovoice/gosip/log"
 	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/timing"
 )
 
 var (
 	wsSubProtocol = "sip"
+	// bounds writing of Close and Ping frames, so that closing and keep-alive do not block on a stalled peer
+	wsControlTimeout = time.Second
 )
 
 type wsConn struct {
 	net.Conn
 	client bool
+	// set on connections accepted by WsHandler
+	upgrade *WsUpgrade
+
+	keepAlive WsKeepAlive
+	// max size of reassembled message, zero means no limit
+	maxMessageSize int
+	clock          timing.Clock
+
+	// rest of the message that did not fit into the buffer of the previous Read
+	pending []byte
+	// receive time of the last frame in unix nanoseconds
+	lastSeen int64
+	// set when the peer sends binary messages, replies are sent the same way
+	binary int32
+
+	// serializes data and control frames written concurrently
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	closeErr  error
+	closeOnce sync.Once
+	done      chan struct{}
+	// keep-alive goroutine
+	wg sync.WaitGroup
 }
 
-func (wc *wsConn) Read(b []byte) (n int, err error) {
-	var msg []byte
-	var op ws.OpCode
+func newWsConn(
+	conn net.Conn,
+	client bool,
+	keepAlive WsKeepAlive,
+	maxMessageSize int,
+	clock timing.Clock,
+) *wsConn {
+	if clock == nil {
+		clock = timing.NewRealClock()
+	}
+
+	wc := &wsConn{
+		Conn:           conn,
+		client:         client,
+		keepAlive:      keepAlive,
+		maxMessageSize: maxMessageSize,
+		clock:          clock,
+		done:           make(chan struct{}),
+	}
+	wc.touch()
+
+	if keepAlive.Interval > 0 {
+		wc.wg.Add(1)
+		go wc.serveKeepAlive()
+	}
+
+	return wc
+}
+
+func (wc *wsConn) state() ws.State {
 	if wc.client {
-		msg, op, err = wsutil.ReadServerData(wc.Conn)
-	} else {
-		msg, op, err = wsutil.ReadClientData(wc.Conn)
+		return ws.StateClientSide
 	}
-	if err != nil {
-		// handle error
-		var wsErr wsutil.ClosedError
-		if errors.As(err, &wsErr) {
-			return n, io.EOF
+	return ws.StateServerSide
+}
+
+// Read returns the payload of data messages as a stream,
+// message that does not fit into b is returned by the subsequent reads.
+func (wc *wsConn) Read(b []byte) (n int, err error) {
+	for len(wc.pending) == 0 {
+		var op ws.OpCode
+		wc.pending, op, err = wc.readMessage()
+		if err != nil {
+			return n, wc.readError(err)
 		}
-		return n, err
+		if op == ws.OpBinary {
+			atomic.StoreInt32(&wc.binary, 1)
+		} else {
+			atomic.StoreInt32(&wc.binary, 0)
+		}
+	}
+
+	n = copy(b, wc.pending)
+	wc.pending = wc.pending[n:]
+
+	return n, nil
+}
+
+// Reads the next text or binary message reassembled from continuation frames,
+// control frames are answered on the fly (RFC 6455 s. 5.4, 5.5).
+func (wc *wsConn) readMessage() ([]byte, ws.OpCode, error) {
+	state := wc.state()
+	controlHandler := wsutil.ControlFrameHandler(wsControlWriter{wc}, state)
+	onFrame := func(hdr ws.Header, r io.Reader) error {
+		wc.touch()
+		if hdr.OpCode.IsControl() {
+			return controlHandler(hdr, r)
+		}
+		return nil
+	}
+	rd := wsutil.Reader{
+		Source:         wc.Conn,
+		State:          state,
+		CheckUTF8:      true,
+		OnIntermediate: onFrame,
+		OnContinuation: onFrame,
+	}
+
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, 0, err
+		}
+		wc.touch()
+
+		if hdr.OpCode.IsControl() {
+			if err := controlHandler(hdr, &rd); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if hdr.OpCode&(ws.OpText|ws.OpBinary) == 0 {
+			if err := rd.Discard(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		var src io.Reader = &rd
+		if wc.maxMessageSize > 0 {
+			src = io.LimitReader(src, int64(wc.maxMessageSize)+1)
+		}
+		msg, err := ioutil.ReadAll(src)
+		if err != nil {
+			return nil, 0, err
+		}
+		if wc.maxMessageSize > 0 && len(msg) > wc.maxMessageSize {
+			return nil, 0, wc.closeWith(ws.StatusMessageTooBig, "message too big")
+		}
+
+		return msg, hdr.OpCode, nil
+	}
+}
+
+// Converts read errors to WsCloseError where the close status is known.
+func (wc *wsConn) readError(err error) error {
+	if closeErr := wc.closeError(); closeErr != nil {
+		return closeErr
 	}
-	if op == ws.OpClose {
-		return n, io.EOF
+
+	var closedErr wsutil.ClosedError
+	var protoErr ws.ProtocolError
+	switch {
+	case errors.As(err, &closedErr):
+		wc.setCloseError(&WsCloseError{closedErr.Code, closedErr.Reason})
+		wc.Conn.Close()
+	case errors.As(err, &protoErr):
+		wc.closeWith(ws.StatusProtocolError, protoErr.Error())
+	case errors.Is(err, wsutil.ErrInvalidUTF8):
+		wc.closeWith(ws.StatusInvalidFramePayloadData, err.Error())
+	default:
+		return err
 	}
-	copy(b, msg)
-	return len(msg), err
+
+	return wc.closeError()
 }
 
 func (wc *wsConn) Write(b []byte) (n int, err error) {
-	if wc.client {
-		err = wsutil.WriteClientMessage(wc.Conn, ws.OpText, b)
-	} else {
-		err = wsutil.WriteServerMessage(wc.Conn, ws.OpText, b)
+	op := ws.OpText
+	if atomic.LoadInt32(&wc.binary) == 1 {
+		op = ws.OpBinary
 	}
-	if err != nil {
-		// handle error
-		var wsErr wsutil.ClosedError
-		if errors.As(err, &wsErr) {
-			return n, io.EOF
+
+	if err = wc.writeMessage(op, b); err != nil {
+		if closeErr := wc.closeError(); closeErr != nil {
+			return n, closeErr
 		}
 		return n, err
 	}
+
 	return len(b), nil
 }
 
+func (wc *wsConn) writeMessage(op ws.OpCode, b []byte) error {
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+
+	return wsutil.WriteMessage(wc.Conn, wc.state(), op, b)
+}
+
+// Writes control frame, the write is bounded by wsControlTimeout.
+func (wc *wsConn) writeControl(op ws.OpCode, b []byte) error {
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+
+	if err := wc.Conn.SetWriteDeadline(time.Now().Add(wsControlTimeout)); err != nil {
+		return err
+	}
+	defer wc.Conn.SetWriteDeadline(time.Time{})
+
+	return wsutil.WriteMessage(wc.Conn, wc.state(), op, b)
+}
+
+// Close sends Close frame with normal closure status before closing the connection
+// and waits for the keep-alive goroutine.
+func (wc *wsConn) Close() error {
+	if wc.setCloseError(&WsCloseError{ws.StatusNormalClosure, "connection closed"}) {
+		_ = wc.writeControl(ws.OpClose, ws.NewCloseFrameBody(ws.StatusNormalClosure, ""))
+	}
+
+	err := wc.close()
+	wc.wg.Wait()
+
+	return err
+}
+
+func (wc *wsConn) close() error {
+	var err error
+	wc.closeOnce.Do(func() {
+		close(wc.done)
+		err = wc.Conn.Close()
+	})
+	return err
+}
+
+// Sends Close frame with the status and closes the connection (RFC 6455 s. 7.1.2).
+func (wc *wsConn) closeWith(code ws.StatusCode, reason string) error {
+	err := &WsCloseError{code, reason}
+	if wc.setCloseError(err) {
+		_ = wc.writeControl(ws.OpClose, ws.NewCloseFrameBody(code, reason))
+	}
+	wc.close()
+
+	return wc.closeError()
+}
+
+func (wc *wsConn) closeError() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	return wc.closeErr
+}
+
+// Stores the first close reason, following ones are ignored.
+func (wc *wsConn) setCloseError(err error) bool {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if wc.closeErr != nil {
+		return false
+	}
+	wc.closeErr = err
+
+	return true
+}
+
+func (wc *wsConn) touch() {
+	atomic.StoreInt64(&wc.lastSeen, wc.clock.Now().UnixNano())
+}
+
+func (wc *wsConn) idle() time.Duration {
+	return wc.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&wc.lastSeen)))
+}
+
+// Pings the peer after Interval of idleness and closes the connection
+// if nothing is received within Timeout after the ping (RFC 7118 s. 6).
+func (wc *wsConn) serveKeepAlive() {
+	defer wc.wg.Done()
+
+	timer := wc.clock.NewTimer(wc.keepAlive.Interval)
+	defer timer.Stop()
+
+	pinged := false
+	for {
+		select {
+		case <-wc.done:
+			return
+		case <-timer.C():
+		}
+
+		idle := wc.idle()
+		switch {
+		case idle < wc.keepAlive.Interval:
+			pinged = false
+			timer.Reset(wc.keepAlive.Interval - idle)
+		case pinged && idle >= wc.keepAlive.Interval+wc.keepAlive.Timeout:
+			wc.setCloseError(&WsCloseError{ws.StatusAbnormalClosure, "keep-alive timeout"})
+			wc.close()
+			return
+		case pinged:
+			timer.Reset(wc.keepAlive.Interval + wc.keepAlive.Timeout - idle)
+		default:
+			if err := wc.writeControl(ws.OpPing, nil); err != nil {
+				// the peer is stalled, Close frame would not be written either
+				wc.setCloseError(&WsCloseError{ws.StatusAbnormalClosure, fmt.Sprintf("keep-alive ping failed: %s", err)})
+				wc.close()
+				return
+			}
+			pinged = true
+			timer.Reset(wc.keepAlive.Timeout)
+		}
+	}
+}
+
+// wsControlWriter writes replies to control frames, each reply is written in one call.
+type wsControlWriter struct {
+	wc *wsConn
+}
+
+func (w wsControlWriter) Write(b []byte) (int, error) {
+	w.wc.writeMu.Lock()
+	defer w.wc.writeMu.Unlock()
+
+	return w.wc.Conn.Write(b)
+}
+
 type wsListener struct {
 	net.Listener
 	network string
 	u       ws.Upgrader
 	log     log.Logger
+
+	keepAlive      WsKeepAlive
+	maxMessageSize int
+	clock          timing.Clock
 }
 
 func NewWsListener(listener net.Listener, network string, log log.Logger) *wsListener {
@@ -84,21 +364,26 @@ func NewWsListener(listener net.Listener, network string, log log.Logger) *wsLis
 	return l
 }
 
+// Accept waits for the next connection and upgrades it to WebSocket.
+// Connections that fail the upgrade are closed, SIP over WebSocket requires the handshake (RFC 7118).
 func (l *wsListener) Accept() (net.Conn, error) {
-	conn, err := l.Listener.Accept()
-	if err != nil {
-		return nil, fmt.Errorf("accept new connection: %w", err)
-	}
-	if _, err = l.u.Upgrade(conn); err == nil {
-		conn = &wsConn{
-			Conn:   conn,
-			client: false,
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, fmt.Errorf("accept new connection: %w", err)
 		}
-	} else {
-		l.log.Warnf("fallback to simple TCP connection due to WS upgrade error: %s", err)
-		err = nil
+		if _, err = l.u.Upgrade(conn); err != nil {
+			l.log.Warnf("close connection from %s due to WS upgrade error: %s", conn.RemoteAddr(), err)
+
+			if err := conn.Close(); err != nil {
+				l.log.Warnf("close connection from %s failed: %s", conn.RemoteAddr(), err)
+			}
+
+			continue
+		}
+
+		return newWsConn(conn, false, l.keepAlive, l.maxMessageSize, l.clock), nil
 	}
-	return conn, err
 }
 
 func (l *wsListener) Network() string {
@@ -113,6 +398,13 @@ type wsProtocol struct {
 	listen      func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error)
 	resolveAddr func(addr string) (*net.TCPAddr, error)
 	dialer      ws.Dialer
+
+	keepAlive      WsKeepAlive
+	maxMessageSize int
+	clock          timing.Clock
+
+	doneOnce sync.Once
+	done     chan struct{}
 }
 
 func NewWsProtocol(
@@ -121,7 +413,13 @@ func NewWsProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
+	optsHash := &ProtocolOptions{}
+	for _, opt := range options {
+		opt.ApplyProtocol(optsHash)
+	}
+
 	p := new(wsProtocol)
 	p.network = "ws"
 	p.reliable = true
@@ -134,11 +432,24 @@ func NewWsProtocol(
 		})
 	//TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(
+		output,
+		errs,
+		cancel,
+		msgMapper,
+		p.Log(),
+		WithClock(optsHash.Clock),
+		WithParserLimits(optsHash.parserLimits()),
+		WithCaptureTap(optsHash.CaptureTap),
+	)
+	p.capturer = capturer{optsHash.CaptureTap, optsHash.Clock}
 	p.listen = p.defaultListen
 	p.resolveAddr = p.defaultResolveAddr
 	p.dialer.Protocols = []string{wsSubProtocol}
 	p.dialer.Timeout = time.Minute
+	p.keepAlive = optsHash.wsKeepAlive()
+	p.maxMessageSize = optsHash.parserLimits().MaxMessageSize
+	p.clock = optsHash.Clock
 	//pipe listener and connection pools
 	go p.pipePools()
 
@@ -153,8 +464,26 @@ func (p *wsProtocol) defaultResolveAddr(addr string) (*net.TCPAddr, error) {
 	return net.ResolveTCPAddr("tcp", addr)
 }
 
+// Handler returns http.Handler that accepts WebSocket connections on an HTTP server.
+func (p *wsProtocol) Handler(options ...WsHandlerOption) http.Handler {
+	return newWsHandler(p, options...)
+}
+
+func (p *wsProtocol) newConn(conn net.Conn, client bool) *wsConn {
+	return newWsConn(conn, client, p.keepAlive, p.maxMessageSize, p.clock)
+}
+
+// Done is closed when listeners and connections are closed, so their addresses can be reused.
 func (p *wsProtocol) Done() <-chan struct{} {
-	return p.connections.Done()
+	p.doneOnce.Do(func() {
+		p.done = make(chan struct{})
+		go func() {
+			<-p.listeners.Done()
+			<-p.connections.Done()
+			close(p.done)
+		}()
+	})
+	return p.done
 }
 
 //piping new connections to connection pool for serving
@@ -205,10 +534,18 @@ func (p *wsProtocol) Listen(target *Target, options ...ListenOption) error {
 
 	p.Log().Debugf("begin listening on %s %s", p.Network(), target.Addr())
 
+	if acl := listenACL(options); acl != nil {
+		listener = &aclListener{Listener: listener, acl: acl, log: p.Log()}
+	}
+
 	//index listeners by local address
 	// should live infinitely
 	key := ListenerKey(fmt.Sprintf("%s:0.0.0.0:%d", p.network, target.Port))
-	err = p.listeners.Put(key, NewWsListener(listener, p.network, p.Log()))
+	wsListener := NewWsListener(listener, p.network, p.Log())
+	wsListener.keepAlive = p.keepAlive
+	wsListener.maxMessageSize = p.maxMessageSize
+	wsListener.clock = p.clock
+	err = p.listeners.Put(key, wsListener)
 	if err != nil {
 		err = &ProtocolError{
 			Err:      err,
@@ -255,16 +592,18 @@ func (p *wsProtocol) Send(target *Target, msg sip.Message) error {
 	logger.Tracef("writing SIP message to %s %s", p.Network(), raddr)
 
 	//send message
-	_, err = conn.Write([]byte(msg.String()))
-	if err != nil {
-		err = &ProtocolError{
+	data := []byte(msg.String())
+	if _, err = conn.Write(data); err != nil {
+		return &ProtocolError{
 			Err:      err,
 			Op:       fmt.Sprintf("write SIP message to the %s connection", conn.Key()),
 			ProtoPtr: fmt.Sprintf("%p", p),
 		}
 	}
 
-	return err
+	p.capturer.capture(CaptureOutbound, conn, nil, msg, data)
+
+	return nil
 }
 
 func (p *wsProtocol) getOrCreateConnection(raddr *net.TCPAddr) (Connection, error) {
@@ -277,18 +616,15 @@ func (p *wsProtocol) getOrCreateConnection(raddr *net.TCPAddr) (Connection, erro
 		defer cancel()
 		url := fmt.Sprintf("%s://%s", p.network, raddr)
 		baseConn, _, _, err := p.dialer.Dial(ctx, url)
-		if err == nil {
-			baseConn = &wsConn{
-				Conn:   baseConn,
-				client: true,
-			}
-		} else {
-			if baseConn == nil {
-				return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr, err)
+		if err != nil {
+			// connection that failed the upgrade can not be used
+			if baseConn != nil {
+				baseConn.Close()
 			}
 
-			p.Log().Warnf("fallback to TCP connection due to WS upgrade error: %s", err)
+			return nil, fmt.Errorf("dial to %s %s: %w", p.Network(), raddr, err)
 		}
+		baseConn = p.newConn(baseConn, true)
 
 		conn = NewConnection(baseConn, key, p.network, p.Log())
 
@@ -0,0 +1,198 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ghettovoice/gosip/log"
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// wsUpgradeField is the message field with the WsUpgrade of the connection the message was received on.
+const wsUpgradeField = "ws_upgrade"
+
+// WsUpgrade describes the HTTP request that opened WebSocket connection served by WsHandler.
+type WsUpgrade struct {
+	Path       string
+	Header     http.Header
+	Cookies    []*http.Cookie
+	RemoteAddr string
+}
+
+func (u *WsUpgrade) String() string {
+	if u == nil {
+		return "<nil>"
+	}
+
+	return u.Path
+}
+
+// WsUpgradeFromMessage returns the WsUpgrade of the connection the message was received on.
+func WsUpgradeFromMessage(msg sip.Message) (*WsUpgrade, bool) {
+	upgrade, ok := msg.Fields()[wsUpgradeField].(*WsUpgrade)
+	return upgrade, ok && upgrade != nil
+}
+
+// WsUpgradeHook is called with the HTTP request before the WebSocket upgrade,
+// e.g. to authenticate the client or check Origin header.
+// Non-nil error rejects the upgrade with 403 Forbidden.
+type WsUpgradeHook func(r *http.Request) error
+
+type WsHandlerOption interface {
+	ApplyWsHandler(opts *WsHandlerOptions)
+}
+
+type WsHandlerOptions struct {
+	UpgradeHook WsUpgradeHook
+	// Header is written to the handshake response.
+	Header http.Header
+}
+
+// WithWsUpgradeHook sets the hook that decides whether to accept the WebSocket upgrade.
+func WithWsUpgradeHook(hook WsUpgradeHook) WsHandlerOption {
+	return withWsUpgradeHook{hook}
+}
+
+type withWsUpgradeHook struct {
+	hook WsUpgradeHook
+}
+
+func (o withWsUpgradeHook) ApplyWsHandler(opts *WsHandlerOptions) {
+	opts.UpgradeHook = o.hook
+}
+
+// WithWsHeader sets additional headers of the handshake response.
+func WithWsHeader(header http.Header) WsHandlerOption {
+	return withWsHeader{header}
+}
+
+type withWsHeader struct {
+	header http.Header
+}
+
+func (o withWsHeader) ApplyWsHandler(opts *WsHandlerOptions) {
+	opts.Header = o.header
+}
+
+// wsHandler serves SIP over WebSocket (RFC 7118) as a part of an HTTP server,
+// upgraded connections are served by the protocol connection pool.
+type wsHandler struct {
+	protocol *wsProtocol
+	upgrader ws.HTTPUpgrader
+	hook     WsUpgradeHook
+
+	log log.Logger
+}
+
+func newWsHandler(protocol *wsProtocol, options ...WsHandlerOption) *wsHandler {
+	optsHash := &WsHandlerOptions{}
+	for _, opt := range options {
+		opt.ApplyWsHandler(optsHash)
+	}
+
+	h := &wsHandler{
+		protocol: protocol,
+		hook:     optsHash.UpgradeHook,
+	}
+	h.upgrader.Protocol = func(val string) bool {
+		return val == wsSubProtocol
+	}
+	h.upgrader.Header = optsHash.Header
+	h.log = protocol.Log().
+		WithPrefix("transport.WsHandler").
+		WithFields(log.Fields{
+			"ws_handler_ptr": fmt.Sprintf("%p", h),
+		})
+
+	return h
+}
+
+func (h *wsHandler) Log() log.Logger {
+	return h.log
+}
+
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := h.Log().WithFields(log.Fields{
+		"remote_addr": r.RemoteAddr,
+		"path":        r.URL.Path,
+	})
+
+	if !hasWsSubProtocol(r, wsSubProtocol) {
+		logger.Debug("reject WS upgrade without SIP subprotocol")
+
+		http.Error(w, "SIP subprotocol required", http.StatusBadRequest)
+
+		return
+	}
+	if h.hook != nil {
+		if err := h.hook(r); err != nil {
+			logger.Debugf("WS upgrade rejected by hook: %s", err)
+
+			http.Error(w, err.Error(), http.StatusForbidden)
+
+			return
+		}
+	}
+
+	baseConn, rw, _, err := h.upgrader.Upgrade(r, w)
+	if err != nil {
+		// the upgrader already responded with the error
+		logger.Warnf("WS upgrade failed: %s", err)
+
+		if baseConn != nil {
+			baseConn.Close()
+		}
+
+		return
+	}
+
+	network := h.protocol.network
+	upgrade := &WsUpgrade{
+		Path:       r.URL.Path,
+		Header:     r.Header.Clone(),
+		Cookies:    r.Cookies(),
+		RemoteAddr: r.RemoteAddr,
+	}
+	key := ConnectionKey(network + ":" + baseConn.RemoteAddr().String())
+	wc := h.protocol.newConn(&bufferedConn{baseConn, rw.Reader}, false)
+	wc.upgrade = upgrade
+	conn := NewConnection(
+		wc,
+		key,
+		network,
+		h.protocol.Log(),
+	)
+
+	if err := h.protocol.connections.Put(conn, sockTTL); err != nil {
+		logger.Errorf("put %s connection to the pool failed: %s", conn.Key(), err)
+
+		conn.Close()
+	}
+}
+
+func hasWsSubProtocol(r *http.Request, protocol string) bool {
+	for _, value := range r.Header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.TrimSpace(token) == protocol {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// bufferedConn reads the data buffered by the HTTP server before hijacking.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,128 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+	"github.com/ghettovoice/gosip/transport"
+)
+
+var _ = Describe("WsHandler", func() {
+	var (
+		tpl    transport.Layer
+		srv    *httptest.Server
+		client net.Conn
+	)
+	msg := "MESSAGE sip:bob@far-far-away.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/WS df7jal23ls0d.invalid;branch=z9hG4bK776asdhds\r\n" +
+		"To: \"Bob\" <sip:bob@far-far-away.com>\r\n" +
+		"From: \"Alice\" <sip:alice@wonderland.com>;tag=1928301774\r\n" +
+		"Content-Length: 12\r\n" +
+		"\r\n" +
+		"Hello world!"
+	logger := testutils.NewLogrusLogger()
+
+	wsURL := func(path string) string {
+		return "ws" + strings.TrimPrefix(srv.URL, "http") + path
+	}
+
+	BeforeEach(func() {
+		tpl = transport.NewLayer(net.ParseIP("127.0.0.1"), net.DefaultResolver, nil, logger)
+		handler, err := tpl.WsHandler("ws", transport.WithWsUpgradeHook(func(r *http.Request) error {
+			if r.Header.Get("Origin") != "https://app.example.com" {
+				return errors.New("origin not allowed")
+			}
+			return nil
+		}))
+		Expect(err).ToNot(HaveOccurred())
+
+		mux := http.NewServeMux()
+		mux.Handle("/sip", handler)
+		mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+		srv = httptest.NewServer(mux)
+	})
+	AfterEach(func(done Done) {
+		if client != nil {
+			client.Close()
+			client = nil
+		}
+		srv.Close()
+		tpl.Cancel()
+		<-tpl.Done()
+		close(done)
+	}, 3)
+
+	It("should not be available for non WebSocket networks", func() {
+		_, err := tpl.WsHandler("udp")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should pass messages with upgrade request details", func(done Done) {
+		var err error
+		dialer := ws.Dialer{
+			Protocols: []string{"sip"},
+			Header: ws.HandshakeHeaderHTTP(http.Header{
+				"Origin": []string{"https://app.example.com"},
+				"Cookie": []string{"session=s3cr3t"},
+			}),
+		}
+		client, _, _, err = dialer.Dial(context.Background(), wsURL("/sip"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(wsutil.WriteClientMessage(client, ws.OpText, []byte(msg))).To(Succeed())
+
+		var in sip.Message
+		Eventually(tpl.Messages()).Should(Receive(&in))
+		Expect(in.Transport()).To(Equal("WS"))
+		upgrade, ok := transport.WsUpgradeFromMessage(in)
+		Expect(ok).To(BeTrue())
+		Expect(upgrade.Path).To(Equal("/sip"))
+		Expect(upgrade.Header.Get("Origin")).To(Equal("https://app.example.com"))
+		Expect(upgrade.Cookies).To(HaveLen(1))
+		Expect(upgrade.Cookies[0].Value).To(Equal("s3cr3t"))
+
+		res, err := http.Get(srv.URL + "/api")
+		Expect(err).ToNot(HaveOccurred())
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+		close(done)
+	}, 3)
+
+	It("should reject upgrade denied by the hook", func() {
+		dialer := ws.Dialer{
+			Protocols: []string{"sip"},
+			Header: ws.HandshakeHeaderHTTP(http.Header{
+				"Origin": []string{"https://evil.example.com"},
+			}),
+		}
+		_, _, _, err := dialer.Dial(context.Background(), wsURL("/sip"))
+		var statusErr ws.StatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(int(statusErr)).To(Equal(http.StatusForbidden))
+	})
+
+	It("should reject client without SIP subprotocol", func() {
+		dialer := ws.Dialer{
+			Header: ws.HandshakeHeaderHTTP(http.Header{
+				"Origin": []string{"https://app.example.com"},
+			}),
+		}
+		_, _, _, err := dialer.Dial(context.Background(), wsURL("/sip"))
+		var statusErr ws.StatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(int(statusErr)).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -1,9 +1,12 @@
 package transport_test
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,6 +30,7 @@ var _ = Describe("WsProtocol", func() {
 		client1, client2, client3 net.Conn
 		wg                        *sync.WaitGroup
 		wsDial                    *ws.Dialer
+		clock                     *timing.FakeClock
 	)
 
 	network := "tcp"
@@ -75,8 +79,6 @@ var _ = Describe("WsProtocol", func() {
 
 	logger := testutils.NewLogrusLogger()
 
-	timing.MockMode = true
-
 	closeClients := func() {
 		if client1 != nil {
 			client1.Close()
@@ -94,7 +96,8 @@ var _ = Describe("WsProtocol", func() {
 		output = make(chan sip.Message)
 		errs = make(chan error)
 		cancel = make(chan struct{})
-		protocol = transport.NewWsProtocol(output, errs, cancel, nil, logger)
+		clock = timing.NewFakeClock(time.Unix(0, 0))
+		protocol = transport.NewWsProtocol(output, errs, cancel, nil, logger, transport.WithClock(clock))
 		wsDial = &ws.Dialer{
 			Protocols: []string{"sip"},
 		}
@@ -240,6 +243,125 @@ var _ = Describe("WsProtocol", func() {
 			}, 3)
 		})
 
+		Context("when client1 is connected", func() {
+			BeforeEach(func() {
+				targetUrl, err := url.Parse(fmt.Sprintf("ws://%s", localTarget1.Addr()))
+				Expect(err).ToNot(HaveOccurred())
+				client1 = testutils.CreateClient(network, localTarget1.Addr(), "")
+				_, _, err = wsDial.Upgrade(client1, targetUrl)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			writeFrame := func(frame ws.Frame) {
+				Expect(ws.WriteFrame(client1, ws.MaskFrameInPlace(frame))).To(Succeed())
+			}
+
+			It("should reassemble fragmented message and answer pings between fragments", func(done Done) {
+				body := strings.Repeat("a", 40000)
+				data := []byte(strings.Replace(msg1, "Content-Length: 12\r\n\r\nHello world!", fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body), 1))
+
+				go func() {
+					defer GinkgoRecover()
+					writeFrame(ws.NewFrame(ws.OpText, false, data[:10000]))
+					writeFrame(ws.NewPingFrame([]byte("ping")))
+					writeFrame(ws.NewFrame(ws.OpContinuation, false, data[10000:30000]))
+					writeFrame(ws.NewFrame(ws.OpContinuation, true, data[30000:]))
+				}()
+
+				var msg sip.Message
+				Eventually(output).Should(Receive(&msg))
+				Expect(msg.Body()).To(Equal(body))
+
+				hdr, err := ws.ReadHeader(client1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.OpCode).To(Equal(ws.OpPong))
+				Expect(hdr.Length).To(BeEquivalentTo(4))
+
+				close(done)
+			}, 3)
+
+			It("should reply with binary frames to binary messages", func(done Done) {
+				Expect(wsutil.WriteClientBinary(client1, []byte(msg1))).To(Succeed())
+
+				var msg sip.Message
+				Eventually(output).Should(Receive(&msg))
+
+				clientTarget, err := transport.NewTargetFromAddr(client1.LocalAddr().String())
+				Expect(err).ToNot(HaveOccurred())
+				res := sip.NewResponseFromRequest("", msg.(sip.Request), 200, "OK", "")
+				go func() {
+					defer GinkgoRecover()
+					Expect(protocol.Send(clientTarget, res)).To(Succeed())
+				}()
+
+				data, op, err := wsutil.ReadServerData(client1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(op).To(Equal(ws.OpBinary))
+				Expect(string(data)).To(Equal(res.String()))
+
+				close(done)
+			}, 3)
+
+			It("should pass close status of the peer up as WsCloseError", func(done Done) {
+				writeFrame(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusGoingAway, "bye")))
+
+				var err error
+				Eventually(errs).Should(Receive(&err))
+				var closeErr *transport.WsCloseError
+				Expect(errors.As(err, &closeErr)).To(BeTrue())
+				Expect(closeErr.Code).To(Equal(ws.StatusGoingAway))
+				Expect(closeErr.Reason).To(Equal("bye"))
+
+				close(done)
+			}, 3)
+
+			It("should ping idle connection and close it when the peer is dead", func(done Done) {
+				Expect(wsutil.WriteClientText(client1, []byte(msg1))).To(Succeed())
+				Eventually(output).Should(Receive())
+
+				waiters := clock.Waiters()
+				clock.Advance(transport.DefaultWsKeepAlive.Interval)
+
+				hdr, err := ws.ReadHeader(client1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.OpCode).To(Equal(ws.OpPing))
+
+				Eventually(clock.Waiters).Should(Equal(waiters))
+				clock.Advance(transport.DefaultWsKeepAlive.Timeout)
+
+				Eventually(errs).Should(Receive(&err))
+				var closeErr *transport.WsCloseError
+				Expect(errors.As(err, &closeErr)).To(BeTrue())
+				Expect(closeErr.Code).To(Equal(ws.StatusAbnormalClosure))
+
+				close(done)
+			}, 3)
+		})
+
+		Context("when client1 connects without WS upgrade", func() {
+			BeforeEach(func() {
+				client1 = testutils.CreateClient(network, localTarget1.Addr(), "")
+				testutils.WriteToConn(client1, []byte(msg1))
+			})
+
+			It("should close the connection and keep accepting", func(done Done) {
+				Expect(client1.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+				_, err := ioutil.ReadAll(client1)
+				Expect(err).ToNot(HaveOccurred())
+				Consistently(output, 100*time.Millisecond).ShouldNot(Receive())
+
+				targetUrl, err := url.Parse(fmt.Sprintf("ws://%s", localTarget1.Addr()))
+				Expect(err).ToNot(HaveOccurred())
+				client2 = testutils.CreateClient(network, localTarget1.Addr(), "")
+				_, _, err = wsDial.Upgrade(client2, targetUrl)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(wsutil.WriteClientText(client2, []byte(msg1))).To(Succeed())
+				testutils.AssertMessageArrived(output, fmt.Sprintf(expectedMsg1, client2.LocalAddr().(*net.TCPAddr).IP), client2.LocalAddr().String(), localTarget1.Addr())
+
+				close(done)
+			}, 3)
+		})
+
 		Context("after cancel signal received", func() {
 			BeforeEach(func() {
 				time.Sleep(time.Millisecond)
@@ -21,7 +21,13 @@ func NewWssProtocol(
 	cancel <-chan struct{},
 	msgMapper sip.MessageMapper,
 	logger log.Logger,
+	options ...ProtocolOption,
 ) Protocol {
+	optsHash := &ProtocolOptions{}
+	for _, opt := range options {
+		opt.ApplyProtocol(optsHash)
+	}
+
 	p := new(wssProtocol)
 	p.network = "wss"
 	p.reliable = true
@@ -34,7 +40,17 @@ func NewWssProtocol(
 		})
 	//TODO: add separate errs chan to listen errors from pool for reconnection?
 	p.listeners = NewListenerPool(p.conns, errs, cancel, p.Log())
-	p.connections = NewConnectionPool(output, errs, cancel, msgMapper, p.Log())
+	p.connections = NewConnectionPool(
+		output,
+		errs,
+		cancel,
+		msgMapper,
+		p.Log(),
+		WithClock(optsHash.Clock),
+		WithParserLimits(optsHash.parserLimits()),
+		WithCaptureTap(optsHash.CaptureTap),
+	)
+	p.capturer = capturer{optsHash.CaptureTap, optsHash.Clock}
 	p.listen = func(addr *net.TCPAddr, options ...ListenOption) (net.Listener, error) {
 		if len(options) == 0 {
 			return net.ListenTCP("tcp", addr)
@@ -47,13 +63,20 @@ func NewWssProtocol(
 		if err != nil {
 			return nil, fmt.Errorf("load TLS certficate %s: %w", optsHash.TLSConfig.Cert, err)
 		}
-		return tls.Listen("tcp", addr.String(), &tls.Config{
+		config := &tls.Config{
 			Certificates: []tls.Certificate{cert},
-		})
+		}
+		if optsHash.ACL != nil {
+			optsHash.ACL.configureTLS(config)
+		}
+		return tls.Listen("tcp", addr.String(), config)
 	}
 	p.resolveAddr = p.defaultResolveAddr
 	p.dialer.Protocols = []string{wsSubProtocol}
 	p.dialer.Timeout = time.Minute
+	p.keepAlive = optsHash.wsKeepAlive()
+	p.maxMessageSize = optsHash.parserLimits().MaxMessageSize
+	p.clock = optsHash.Clock
 	p.dialer.TLSConfig = &tls.Config{
 		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 			return nil
@@ -0,0 +1,138 @@
+package gosip
+
+import (
+	"net"
+	"strings"
+
+	"github.com/ghettovoice/gosip/sip"
+)
+
+// privacyHeaders are removed on Privacy: header (RFC 3323 s. 5.1).
+var privacyHeaders = []string{
+	"Call-Info",
+	"Organization",
+	"Reply-To",
+	"In-Reply-To",
+	"Subject",
+	"User-Agent",
+	"Server",
+	"Warning",
+}
+
+// TrustDomain describes peers trusted to assert identity of users (RFC 3325, Spec(T)).
+// Server with the trust domain strips P-Asserted-Identity received from untrusted sources
+// and applies privacy requested with Privacy header to messages sent to untrusted peers.
+type TrustDomain struct {
+	// Networks of trusted peers.
+	Networks []*net.IPNet
+	// Hosts are trusted peers by IP address or host name.
+	Hosts []string
+	// AuthorizeIdentity is called for each P-Preferred-Identity of the incoming request
+	// without trusted P-Asserted-Identity. It returns true if the sender is authenticated
+	// and allowed to use the identity, then the identity is asserted with P-Asserted-Identity.
+	AuthorizeIdentity func(req sip.Request, identity *sip.Address) bool
+}
+
+// Trusted returns true if the peer at the address in host[:port] form belongs to the trust domain.
+func (td *TrustDomain) Trusted(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return false
+	}
+
+	for _, h := range td.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range td.Networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Inbound applies the trust domain policy to the received request.
+func (td *TrustDomain) Inbound(req sip.Request) {
+	if !td.Trusted(req.Source()) {
+		req.RemoveHeader("P-Asserted-Identity")
+	}
+
+	if len(req.GetHeaders("P-Asserted-Identity")) > 0 || td.AuthorizeIdentity == nil {
+		return
+	}
+
+	preferred := req.GetHeaders("P-Preferred-Identity")
+	asserted := make([]sip.Header, 0, len(preferred))
+	for _, hdr := range preferred {
+		ppi, ok := hdr.(*sip.PPreferredIdentityHeader)
+		if !ok {
+			continue
+		}
+		identity := &sip.Address{
+			DisplayName: ppi.DisplayName,
+			Uri:         ppi.Address,
+			Params:      ppi.Params,
+		}
+		if td.AuthorizeIdentity(req, identity) {
+			asserted = append(asserted, &sip.PAssertedIdentityHeader{
+				DisplayName: ppi.DisplayName,
+				Address:     ppi.Address,
+				Params:      ppi.Params,
+			})
+		}
+	}
+	if len(asserted) == 0 {
+		return
+	}
+
+	req.RemoveHeader("P-Preferred-Identity")
+	for _, hdr := range asserted {
+		req.AppendHeader(hdr)
+	}
+}
+
+// Outbound applies privacy requested by the user to the message sent to untrusted peer (RFC 3323, RFC 3325 s. 7).
+// Privacy: id removes P-Asserted-Identity, Privacy: header removes headers that may reveal the user
+// and Privacy: user replaces From of requests with anonymous address.
+func (td *TrustDomain) Outbound(msg sip.Message) {
+	if td.Trusted(msg.Destination()) {
+		return
+	}
+
+	privacy := &sip.PrivacyHeader{}
+	for _, hdr := range msg.GetHeaders("Privacy") {
+		if h, ok := hdr.(*sip.PrivacyHeader); ok {
+			privacy.Values = append(privacy.Values, h.Values...)
+		}
+	}
+	if len(privacy.Values) == 0 || privacy.Has(sip.PrivNone) {
+		return
+	}
+
+	if privacy.Has(sip.PrivID) {
+		msg.RemoveHeader("P-Asserted-Identity")
+	}
+	if privacy.Has(sip.PrivHeader) {
+		for _, name := range privacyHeaders {
+			msg.RemoveHeader(name)
+		}
+	}
+	if req, ok := msg.(sip.Request); ok && privacy.Has(sip.PrivUser) {
+		if from, ok := req.From(); ok {
+			anonymous := sip.AnonymousAddress().AsFromHeader()
+			if tag, ok := from.Params.Get("tag"); ok {
+				anonymous.Params.Add("tag", tag)
+			}
+			req.ReplaceHeaders("From", []sip.Header{anonymous})
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package gosip_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+)
+
+var _ = Describe("TrustDomain", func() {
+	var td *gosip.TrustDomain
+
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+
+	request := func(via, route string, extra ...string) sip.Request {
+		lines := []string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP " + via + ";branch=z9hG4bK.trust",
+			"Route: <sip:" + route + ";lr>",
+			"From: \"Alice\" <sip:alice@example.com>;tag=a1",
+			"To: <sip:bob@example.com>",
+			"Call-ID: trust",
+			"CSeq: 1 INVITE",
+		}
+		lines = append(lines, extra...)
+		lines = append(lines, "Content-Length: 0", "", "")
+		return testutils.Request(lines)
+	}
+
+	BeforeEach(func() {
+		td = &gosip.TrustDomain{
+			Networks: []*net.IPNet{network},
+			Hosts:    []string{"proxy.example.com"},
+		}
+	})
+
+	It("should match trusted peers", func() {
+		Expect(td.Trusted("10.1.2.3:5060")).To(BeTrue())
+		Expect(td.Trusted("proxy.example.com")).To(BeTrue())
+		Expect(td.Trusted("PROXY.example.com:5061")).To(BeTrue())
+		Expect(td.Trusted("192.0.2.1:5060")).To(BeFalse())
+		Expect(td.Trusted("")).To(BeFalse())
+	})
+
+	It("should strip P-Asserted-Identity received from untrusted source", func() {
+		req := request("192.0.2.1:5060", "10.0.0.1", "P-Asserted-Identity: <sip:admin@example.com>")
+		td.Inbound(req)
+		Expect(req.GetHeaders("P-Asserted-Identity")).To(BeEmpty())
+
+		req = request("10.0.0.2:5060", "10.0.0.1", "P-Asserted-Identity: <sip:admin@example.com>")
+		td.Inbound(req)
+		Expect(req.GetHeaders("P-Asserted-Identity")).To(HaveLen(1))
+	})
+
+	It("should assert preferred identity of authenticated user", func() {
+		td.AuthorizeIdentity = func(req sip.Request, identity *sip.Address) bool {
+			return identity.Uri.User().String() == "alice"
+		}
+
+		req := request("192.0.2.1:5060", "10.0.0.1",
+			"P-Preferred-Identity: \"Alice\" <sip:alice@example.com>, <tel:+15551234567>")
+		td.Inbound(req)
+		Expect(req.GetHeaders("P-Preferred-Identity")).To(BeEmpty())
+		hdrs := req.GetHeaders("P-Asserted-Identity")
+		Expect(hdrs).To(HaveLen(1))
+		Expect(hdrs[0].Value()).To(Equal("\"Alice\" <sip:alice@example.com>"))
+
+		req = request("192.0.2.1:5060", "10.0.0.1", "P-Preferred-Identity: <sip:mallory@example.com>")
+		td.Inbound(req)
+		Expect(req.GetHeaders("P-Preferred-Identity")).To(HaveLen(1))
+		Expect(req.GetHeaders("P-Asserted-Identity")).To(BeEmpty())
+	})
+
+	It("should apply privacy to messages sent to untrusted peers", func() {
+		extra := []string{
+			"P-Asserted-Identity: <sip:alice@example.com>",
+			"Privacy: id;header;user",
+			"User-Agent: Softphone 1.0",
+			"Organization: Example",
+		}
+
+		req := request("10.0.0.2:5060", "10.0.0.1", extra...)
+		td.Outbound(req)
+		Expect(req.GetHeaders("P-Asserted-Identity")).To(HaveLen(1))
+		Expect(req.GetHeaders("User-Agent")).To(HaveLen(1))
+
+		req = request("10.0.0.2:5060", "carrier.example.net", extra...)
+		td.Outbound(req)
+		Expect(req.GetHeaders("P-Asserted-Identity")).To(BeEmpty())
+		Expect(req.GetHeaders("User-Agent")).To(BeEmpty())
+		Expect(req.GetHeaders("Organization")).To(BeEmpty())
+		from, ok := req.From()
+		Expect(ok).To(BeTrue())
+		Expect(from.Value()).To(Equal("\"Anonymous\" <sip:anonymous@anonymous.invalid>;tag=a1"))
+	})
+
+	It("should keep identity without privacy request", func() {
+		req := request("10.0.0.2:5060", "carrier.example.net", "P-Asserted-Identity: <sip:alice@example.com>")
+		td.Outbound(req)
+		Expect(req.GetHeaders("P-Asserted-Identity")).To(HaveLen(1))
+	})
+})
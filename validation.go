@@ -0,0 +1,251 @@
+package gosip
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/util"
+)
+
+// RequestValidator performs UAS checks of incoming requests (RFC 3261 s. 8.2)
+// before they are routed to request handlers.
+type RequestValidator struct {
+	// Extensions are supported option tags, requests that require other ones are rejected with 420.
+	Extensions []string
+	// ContentTypes are accepted media types of request bodies, other bodies are rejected with 415.
+	// Empty list accepts any body.
+	ContentTypes []string
+
+	mu sync.Mutex
+	// Pending requests outside of a dialog by From tag, Call-ID and CSeq,
+	// used for merged requests detection.
+	pending map[string]pendingRequest
+	// Size of pending requests that triggers removal of the terminated ones.
+	sweepAt int
+}
+
+type pendingRequest struct {
+	branch string
+	done   <-chan bool
+}
+
+func (r pendingRequest) terminated() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+const minSweepAt = 64
+
+// Validate checks the request and returns the response that rejects it or nil if the request is valid.
+// Non-nil tx enables loop detection, the request is remembered until tx terminates.
+func (v *RequestValidator) Validate(req sip.Request, tx sip.ServerTransaction) sip.Response {
+	// ACK can not be rejected
+	if req.IsAck() {
+		return nil
+	}
+
+	if res := v.validateHeaders(req); res != nil {
+		return res
+	}
+	if res := v.validateMaxForwards(req); res != nil {
+		return res
+	}
+	if res := v.detectLoop(req, tx); res != nil {
+		return res
+	}
+	if res := v.validateRequire(req); res != nil {
+		return res
+	}
+
+	return v.validateContent(req)
+}
+
+// RFC 3261 s. 8.1.1, 8.2.2.
+// Missing Max-Forwards is tolerated, many user agents don't send it.
+func (v *RequestValidator) validateHeaders(req sip.Request) sip.Response {
+	for _, name := range []string{"Via", "From", "To", "Call-ID", "CSeq"} {
+		if len(req.GetHeaders(name)) == 0 {
+			return badRequest(req, fmt.Sprintf("Missing %s Header", name))
+		}
+	}
+	for _, name := range []string{"From", "To", "Call-ID", "CSeq", "Max-Forwards"} {
+		if len(req.GetHeaders(name)) > 1 {
+			return badRequest(req, fmt.Sprintf("Multiple %s Headers", name))
+		}
+	}
+
+	if cseq, ok := req.CSeq(); !ok || cseq.MethodName != req.Method() {
+		return badRequest(req, "CSeq Method Mismatch")
+	}
+
+	if len(req.Body()) > 0 {
+		if _, ok := req.ContentType(); !ok {
+			return badRequest(req, "Missing Content-Type Header")
+		}
+	}
+
+	return nil
+}
+
+// RFC 3261 s. 16.3 (3), Max-Forwards value is limited to 255 (s. 20.22).
+func (v *RequestValidator) validateMaxForwards(req sip.Request) sip.Response {
+	hdrs := req.GetHeaders("Max-Forwards")
+	if len(hdrs) == 0 {
+		return nil
+	}
+
+	maxForwards, ok := hdrs[0].(*sip.MaxForwards)
+	if !ok || *maxForwards > 255 {
+		return badRequest(req, "Invalid Max-Forwards Header")
+	}
+
+	// OPTIONS with exhausted Max-Forwards is answered by the element itself
+	if *maxForwards == 0 && req.Method() != sip.OPTIONS {
+		return rejectRequest(req, 483, "Too Many Hops")
+	}
+
+	return nil
+}
+
+// RFC 3261 s. 8.2.2.2.
+// The request is remembered until tx terminates, terminated requests are removed lazily
+// when the number of the pending ones doubles.
+func (v *RequestValidator) detectLoop(req sip.Request, tx sip.ServerTransaction) sip.Response {
+	if tx == nil || req.IsCancel() {
+		return nil
+	}
+	if to, ok := req.To(); ok && to.Params != nil && to.Params.Has("tag") {
+		return nil
+	}
+
+	from, _ := req.From()
+	if from.Params == nil {
+		return nil
+	}
+	fromTag, ok := from.Params.Get("tag")
+	if !ok || fromTag == nil {
+		return nil
+	}
+	callID, _ := req.CallID()
+	cseq, _ := req.CSeq()
+	viaHop, _ := req.ViaHop()
+	branch, ok := viaHop.Params.Get("branch")
+	if !ok || branch == nil {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s__%s__%d__%s", fromTag, callID.Value(), cseq.SeqNo, cseq.MethodName)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if pending, ok := v.pending[key]; ok && !pending.terminated() {
+		if pending.branch != branch.String() {
+			return rejectRequest(req, 482, "Loop Detected")
+		}
+
+		return nil
+	}
+
+	if v.pending == nil {
+		v.pending = make(map[string]pendingRequest)
+	}
+	v.pending[key] = pendingRequest{branch.String(), tx.Done()}
+
+	if len(v.pending) >= v.sweepAt {
+		for k, pending := range v.pending {
+			if pending.terminated() {
+				delete(v.pending, k)
+			}
+		}
+
+		v.sweepAt = 2 * len(v.pending)
+		if v.sweepAt < minSweepAt {
+			v.sweepAt = minSweepAt
+		}
+	}
+
+	return nil
+}
+
+// RFC 3261 s. 8.2.2.3.
+func (v *RequestValidator) validateRequire(req sip.Request) sip.Response {
+	if req.IsCancel() {
+		return nil
+	}
+
+	var unsupported []string
+	for _, hdr := range req.GetHeaders("Require") {
+		require, ok := hdr.(*sip.RequireHeader)
+		if !ok {
+			continue
+		}
+		for _, option := range require.Options {
+			if !containsFold(v.Extensions, option) && !containsFold(unsupported, option) {
+				unsupported = append(unsupported, option)
+			}
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	res := rejectRequest(req, 420, "Bad Extension")
+	res.AppendHeader(&sip.UnsupportedHeader{Options: unsupported})
+
+	return res
+}
+
+// RFC 3261 s. 8.2.3.
+func (v *RequestValidator) validateContent(req sip.Request) sip.Response {
+	if len(v.ContentTypes) == 0 || len(req.Body()) == 0 {
+		return nil
+	}
+
+	contentType, _ := req.ContentType()
+	mediaType := strings.TrimSpace(strings.SplitN(contentType.Value(), ";", 2)[0])
+	if containsFold(v.ContentTypes, mediaType) {
+		return nil
+	}
+
+	res := rejectRequest(req, 415, "Unsupported Media Type")
+	accept := sip.Accept(strings.Join(v.ContentTypes, ", "))
+	res.AppendHeader(&accept)
+
+	return res
+}
+
+func badRequest(req sip.Request, reason string) sip.Response {
+	return rejectRequest(req, 400, reason)
+}
+
+// Builds the final response, To tag is added if the request has no one (RFC 3261 s. 8.2.6.2).
+func rejectRequest(req sip.Request, statusCode sip.StatusCode, reason string) sip.Response {
+	res := sip.NewResponseFromRequest("", req, statusCode, reason, "")
+	if to, ok := res.To(); ok {
+		if to.Params == nil {
+			to.Params = sip.NewParams()
+		}
+		if !to.Params.Has("tag") {
+			to.Params.Add("tag", sip.String{Str: util.RandString(8)})
+		}
+	}
+
+	return res
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+
+	return false
+}
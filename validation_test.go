@@ -0,0 +1,119 @@
+package gosip_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ghettovoice/gosip"
+	"github.com/ghettovoice/gosip/sip"
+	"github.com/ghettovoice/gosip/testutils"
+)
+
+type pendingServerTx struct {
+	sip.ServerTransaction
+	done chan bool
+}
+
+func (tx *pendingServerTx) Done() <-chan bool { return tx.done }
+
+var _ = Describe("RequestValidator", func() {
+	var v *gosip.RequestValidator
+
+	request := func(method, branch string, headers ...string) sip.Request {
+		lines := []string{
+			method + " sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP pc33.example.com;branch=" + branch,
+			"From: \"Alice\" <sip:alice@example.com>;tag=a1",
+			"To: <sip:bob@example.com>",
+			"Call-ID: validator",
+			"CSeq: 1 " + method,
+		}
+		lines = append(lines, headers...)
+		lines = append(lines, "", "")
+		return testutils.Request(lines)
+	}
+	invite := func(headers ...string) sip.Request {
+		return request("INVITE", "z9hG4bK.v1", headers...)
+	}
+	assertRejected := func(res sip.Response, code sip.StatusCode, reason string) {
+		Expect(res).ToNot(BeNil())
+		Expect(res.StatusCode()).To(Equal(code))
+		Expect(res.Reason()).To(Equal(reason))
+		to, ok := res.To()
+		Expect(ok).To(BeTrue())
+		Expect(to.Params.Has("tag")).To(BeTrue())
+	}
+
+	BeforeEach(func() {
+		v = &gosip.RequestValidator{
+			Extensions:   []string{"replaces", "timer"},
+			ContentTypes: []string{"application/sdp"},
+		}
+	})
+
+	It("should pass valid request", func() {
+		Expect(v.Validate(invite("Max-Forwards: 70", "Require: Timer"), nil)).To(BeNil())
+	})
+
+	It("should reject request without mandatory header with 400", func() {
+		req := testutils.Request([]string{
+			"INVITE sip:bob@example.com SIP/2.0",
+			"Via: SIP/2.0/UDP pc33.example.com;branch=z9hG4bK.v1",
+			"From: \"Alice\" <sip:alice@example.com>;tag=a1",
+			"To: <sip:bob@example.com>",
+			"CSeq: 1 INVITE",
+			"",
+			"",
+		})
+		assertRejected(v.Validate(req, nil), 400, "Missing Call-ID Header")
+	})
+
+	It("should pass request without Max-Forwards", func() {
+		Expect(v.Validate(invite(), nil)).To(BeNil())
+	})
+
+	It("should reject request with mismatched CSeq method with 400", func() {
+		req := invite("Max-Forwards: 70")
+		req.ReplaceHeaders("CSeq", []sip.Header{&sip.CSeq{SeqNo: 1, MethodName: sip.BYE}})
+		assertRejected(v.Validate(req, nil), 400, "CSeq Method Mismatch")
+	})
+
+	It("should reject request with body without Content-Type with 400", func() {
+		req := invite("Max-Forwards: 70")
+		req.SetBody("v=0", true)
+		assertRejected(v.Validate(req, nil), 400, "Missing Content-Type Header")
+	})
+
+	It("should reject request with exhausted Max-Forwards with 483", func() {
+		assertRejected(v.Validate(invite("Max-Forwards: 0"), nil), 483, "Too Many Hops")
+		Expect(v.Validate(request("OPTIONS", "z9hG4bK.v2", "Max-Forwards: 0"), nil)).To(BeNil())
+	})
+
+	It("should reject request with unsupported extension with 420", func() {
+		res := v.Validate(invite("Max-Forwards: 70", "Require: 100rel, replaces", "Require: foo"), nil)
+		assertRejected(res, 420, "Bad Extension")
+		Expect(res.GetHeaders("Unsupported")).To(ConsistOf(&sip.UnsupportedHeader{Options: []string{"100rel", "foo"}}))
+	})
+
+	It("should reject request with unsupported body with 415", func() {
+		req := invite("Max-Forwards: 70", "Content-Type: text/plain")
+		req.SetBody("hello", true)
+		res := v.Validate(req, nil)
+		assertRejected(res, 415, "Unsupported Media Type")
+		accept := sip.Accept("application/sdp")
+		Expect(res.GetHeaders("Accept")).To(ConsistOf(&accept))
+	})
+
+	It("should reject merged request with 482", func() {
+		tx := &pendingServerTx{done: make(chan bool)}
+		Expect(v.Validate(invite("Max-Forwards: 70"), tx)).To(BeNil())
+		// retransmission
+		Expect(v.Validate(invite("Max-Forwards: 70"), tx)).To(BeNil())
+
+		merged := request("INVITE", "z9hG4bK.v3", "Max-Forwards: 70")
+		assertRejected(v.Validate(merged, &pendingServerTx{done: make(chan bool)}), 482, "Loop Detected")
+
+		close(tx.done)
+		Expect(v.Validate(merged, &pendingServerTx{done: make(chan bool)})).To(BeNil())
+	})
+})